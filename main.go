@@ -16,6 +16,8 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"flag"
 	"net"
 	"net/url"
 	"os"
@@ -23,46 +25,49 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/hammer-space/csi-plugin/pkg/common"
 	"github.com/hammer-space/csi-plugin/pkg/driver"
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
+	"github.com/hammer-space/csi-plugin/pkg/tracing"
 	log "github.com/sirupsen/logrus"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
+var tracerProvider *sdktrace.TracerProvider
+
 func init() {
-	// Setup logging
-	log.SetFormatter(&log.JSONFormatter{
-		PrettyPrint:      true,
-		DisableTimestamp: false,
-		TimestampFormat:  "2006-01-02 15:04:05",
-	})
-	log.SetOutput(os.Stdout)
-	log.SetLevel(log.DebugLevel)
+	// Setup logging from the environment, the config file is applied once loaded
+	if err := common.ApplyLogConfig(common.GetConfig()); err != nil {
+		log.Errorf("Invalid log configuration: %v", err)
+	}
 	log.SetReportCaller(false)
 	// Initialize OpenTelemetry Tracer
-	if _, err := initTracer(); err != nil {
+	var err error
+	if tracerProvider, err = initTracer(); err != nil {
 		log.Fatalf("failed to init tracer: %v", err)
 	}
 }
 
-// Setup tracing
+// Setup tracing, exporters and sampling are configured through the OTEL_* environment variables
 func initTracer() (*sdktrace.TracerProvider, error) {
-	// Create a new tracer provider with a short ID generator
-	// This will generate shorter span IDs for better readability in logs
-	// Note: This is a custom ID generator that generates shorter IDs for spans
-	// It is not a standard OpenTelemetry ID generator, but it is used here for demonstration
-	log.Info("Creating TracerProvider with full ID generator")
-	tp := sdktrace.NewTracerProvider()
-	otel.SetTracerProvider(tp)
+	tp, err := tracing.Init(context.Background())
+	if err != nil {
+		return nil, err
+	}
 	log.Info("OpenTelemetry TracerProvider set")
-	otel.SetTextMapPropagator(propagation.TraceContext{})
 	return tp, nil
 }
 
-func validateEnvironmentVars() {
+func validateEnvironmentVars(mode string) {
+	switch mode {
+	case common.ModeController, common.ModeNode, common.ModeAll:
+	default:
+		log.Errorf("--mode must be %s, %s or %s", common.ModeController, common.ModeNode, common.ModeAll)
+		os.Exit(1)
+	}
+
 	endpoint := os.Getenv("CSI_ENDPOINT")
 	if len(endpoint) == 0 {
 		log.Error("CSI_ENDPOINT must be defined and must be a path")
@@ -85,16 +90,19 @@ func validateEnvironmentVars() {
 		os.Exit(1)
 	}
 
-	username := os.Getenv("HS_USERNAME")
-	if len(username) == 0 {
-		log.Error("HS_USERNAME must be defined")
-		os.Exit(1)
-	}
+	// The node plugins may run without credentials, they tolerate a failed login
+	if mode != common.ModeNode {
+		username := os.Getenv("HS_USERNAME")
+		if len(username) == 0 {
+			log.Error("HS_USERNAME must be defined")
+			os.Exit(1)
+		}
 
-	password := os.Getenv("HS_PASSWORD")
-	if len(password) == 0 {
-		log.Error("HS_PASSWORD must be defined")
-		os.Exit(1)
+		password := os.Getenv("HS_PASSWORD")
+		if len(password) == 0 {
+			log.Error("HS_PASSWORD must be defined")
+			os.Exit(1)
+		}
 	}
 
 	if os.Getenv("HS_TLS_VERIFY") != "" {
@@ -111,8 +119,6 @@ func validateEnvironmentVars() {
 			os.Exit(1)
 		}
 	}
-
-	common.DataPortalMountPrefix = os.Getenv("HS_DATA_PORTAL_MOUNT_PREFIX")
 }
 
 type Server interface {
@@ -121,20 +127,45 @@ type Server interface {
 }
 
 func main() {
+	// The controller plugin serves the controller services, the node plugins on every host serve
+	// the node service. The node service only reads from the Hammerspace API, so the node plugins
+	// may use the credentials of a read-only user.
+	mode := flag.String("mode", common.ModeAll, "Services to serve: controller, node or all")
+	configPath := flag.String("config", os.Getenv("CSI_CONFIG_FILE"), "Path of the YAML plugin config file, reloaded on SIGHUP or change")
+	flag.Parse()
 
-	validateEnvironmentVars()
+	validateEnvironmentVars(*mode)
+
+	cfg, err := common.LoadConfig(*configPath)
+	if err != nil {
+		log.Errorf("Invalid plugin configuration: %v", err)
+		os.Exit(1)
+	}
+	common.SetConfig(cfg)
+	if err := common.ApplyLogConfig(cfg); err != nil {
+		log.Errorf("Invalid log configuration: %v", err)
+	}
+	common.BaseBackingShareMountPath = cfg.RootMountPath
+	common.BaseVolumeMarkerSourcePath = cfg.VolumeMarkerPath
+	log.Infof("plugin configuration: %+v", *cfg)
 
 	var server Server
 
 	CSI_version := os.Getenv("CSI_MAJOR_VERSION")
 	endpoint := os.Getenv("CSI_ENDPOINT")
 
-	csiDriver := driver.NewCSIDriver(
+	newDriver := driver.NewCSIDriver
+	if *mode == common.ModeNode {
+		newDriver = driver.NewNodeCSIDriver
+	}
+	csiDriver := newDriver(
 		os.Getenv("HS_ENDPOINT"),
 		os.Getenv("HS_USERNAME"),
 		os.Getenv("HS_PASSWORD"),
 		os.Getenv("HS_TLS_VERIFY"),
 	)
+	csiDriver.Mode = *mode
+	log.Infof("serving CSI services in %s mode", *mode)
 
 	if CSI_version == "0" {
 		server = driver.NewCSIDriver_v0Support(csiDriver)
@@ -143,6 +174,11 @@ func main() {
 		server = csiDriver
 	}
 
+	if metricsAddress := os.Getenv("CSI_METRICS_ADDRESS"); metricsAddress != "" {
+		metrics.Handle("/debug/locks", csiDriver.LocksHandler())
+		metrics.Serve(metricsAddress)
+	}
+
 	// Listen
 	os.Remove(endpoint)
 	l, err := net.Listen("unix", endpoint)
@@ -162,7 +198,12 @@ func main() {
 	}
 	log.Info("hammerspace driver started")
 
-	// Wait for signal
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	if *configPath != "" {
+		common.WatchConfig(watchCtx, *configPath, 10*time.Second)
+	}
+
+	// Wait for signal, SIGHUP reloads the configuration
 	sigc := make(chan os.Signal, 1)
 	sigs := []os.Signal{
 		syscall.SIGTERM,
@@ -172,7 +213,23 @@ func main() {
 	}
 	signal.Notify(sigc, sigs...)
 
-	<-sigc
+	for sig := <-sigc; sig == syscall.SIGHUP; sig = <-sigc {
+		if *configPath == "" {
+			log.Info("received SIGHUP without a config file, nothing to reload")
+			continue
+		}
+		if err := common.ReloadConfig(*configPath); err != nil {
+			log.Errorf("Failed to reload configuration, keeping the current one: %v", err)
+		}
+	}
+	stopWatch()
 	server.Stop()
 	log.Info("hammerspace driver stopped")
+
+	// Flush spans that have not been exported yet
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		log.Errorf("failed to shut down tracer provider: %v", err)
+	}
 }
@@ -0,0 +1,86 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+// Client is the Hammerspace API used by the driver. HammerspaceClient implements it over REST,
+// FakeClient keeps an in-memory cluster for tests.
+type Client interface {
+	// Endpoint returns the Hammerspace endpoint the client sends requests to
+	Endpoint() string
+	// CacheKey scopes a cache key to the Hammerspace cluster of the client
+	CacheKey(key string) string
+	EnsureLogin() error
+
+	// Cluster
+	GetAnvilPortal() (string, error)
+	GetPortalFloatingIp(ctx context.Context) (string, error)
+	GetDataPortals(ctx context.Context, nodeID string) ([]common.DataPortal, error)
+	GetClusterAvailableCapacity(ctx context.Context) (int64, error)
+	GetClusterName(ctx context.Context) (string, error)
+	ListVolumes(ctx context.Context) ([]common.VolumeResponse, error)
+
+	// Tasks
+	WaitForTaskCompletion(ctx context.Context, taskLocation string) error
+	CheckIfShareCreateTaskIsRunning(ctx context.Context, shareName string) (bool, error)
+	// ShareCreateTracked reports whether an earlier call stopped waiting for the task creating
+	// the share, which exists before its task completed
+	ShareCreateTracked(shareName string) bool
+
+	// Objectives
+	ListObjectives(ctx context.Context) ([]common.ClusterObjectiveResponse, error)
+	ListObjectiveNames(ctx context.Context) ([]string, error)
+	SetObjectives(ctx context.Context, shareName string, path string, objectives []string, replaceExisting bool) error
+
+	// Shares
+	ListShares(ctx context.Context) ([]common.ShareResponse, error)
+	GetShare(ctx context.Context, name string) (*common.ShareResponse, error)
+	GetShareRawFields(ctx context.Context, name string) (map[string]interface{}, error)
+	CreateShare(ctx context.Context, name string, exportPath string, size int64, objectives []string,
+		exportOptions []common.ShareExportOptions, deleteDelay int64, comment string) error
+	CreateShareFromSnapshot(ctx context.Context, name string, exportPath string, size int64, objectives []string,
+		exportOptions []common.ShareExportOptions, deleteDelay int64, comment string, snapshotPath string) error
+	UpdateShareSize(ctx context.Context, name string, size int64) error
+	UpdateShare(ctx context.Context, name string, comment *string, exportOptions []common.ShareExportOptions) error
+	UpdateShareExtendedInfo(ctx context.Context, name string, info map[string]string) error
+	DeleteShare(ctx context.Context, name string, deleteDelay int64) error
+
+	// Files
+	GetFile(ctx context.Context, path string) (*common.File, error)
+	DoesFileExist(ctx context.Context, path string) (bool, error)
+
+	// Snapshots
+	ListSnapshots(ctx context.Context, snapshot_id, volume_id string) ([]common.SnapshotResponse, error)
+	ListShareSnapshots(ctx context.Context, share *common.ShareResponse) ([]common.SnapshotResponse, error)
+	SnapshotShare(ctx context.Context, shareName string) (string, error)
+	GetShareSnapshots(ctx context.Context, shareName string) ([]string, error)
+	DeleteShareSnapshot(ctx context.Context, shareName, snapshotName string) error
+	RestoreShareSnapshot(ctx context.Context, shareName, snapshotName string) error
+	SetShareSnapshotSchedule(ctx context.Context, shareName string, schedule common.ShareSnapshotSchedule) error
+	RemoveShareSnapshotSchedule(ctx context.Context, shareName, scheduleName string) error
+	SnapshotFile(ctx context.Context, filepath string) (string, error)
+	GetFileSnapshots(ctx context.Context, filePath string) ([]common.FileSnapshot, error)
+	DeleteFileSnapshot(ctx context.Context, filePath, snapshotName string) error
+	RestoreFileSnapToDestination(ctx context.Context, snapshotPath, filePath string) error
+}
+
+var _ Client = (*HammerspaceClient)(nil)
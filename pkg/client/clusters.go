@@ -0,0 +1,72 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ClusterConfig describes an additional Hammerspace cluster that volumes may be placed on
+type ClusterConfig struct {
+	Name      string `yaml:"name"`
+	Endpoint  string `yaml:"endpoint"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+	TLSVerify bool   `yaml:"tlsVerify"`
+	Site      string `yaml:"site"`
+}
+
+type clustersFile struct {
+	Clusters []ClusterConfig `yaml:"clusters"`
+}
+
+// LoadClusters reads the clusters config file and returns the credentials of each cluster by name
+func LoadClusters(path string) (map[string]*Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file clustersFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse clusters config %s: %v", path, err)
+	}
+
+	clusters := map[string]*Credentials{}
+	for _, cluster := range file.Clusters {
+		if cluster.Name == "" || strings.ContainsAny(cluster.Name, ":/|") {
+			return nil, fmt.Errorf("invalid cluster name '%s', must be non-empty and not contain ':', '/' or '|'", cluster.Name)
+		}
+		if _, exists := clusters[cluster.Name]; exists {
+			return nil, fmt.Errorf("cluster %s is defined more than once", cluster.Name)
+		}
+		if cluster.Endpoint == "" || cluster.Username == "" || cluster.Password == "" {
+			return nil, fmt.Errorf("cluster %s must define endpoint, username and password", cluster.Name)
+		}
+		clusters[cluster.Name] = &Credentials{
+			Endpoint:  cluster.Endpoint,
+			Username:  cluster.Username,
+			Password:  cluster.Password,
+			TLSVerify: cluster.TLSVerify,
+			Site:      cluster.Site,
+		}
+	}
+	return clusters, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadClusters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.yaml")
+	err := os.WriteFile(path, []byte(`
+clusters:
+  - name: east
+    endpoint: https://anvil-east.example.com
+    username: admin
+    password: secret
+    tlsVerify: true
+    site: us-east
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := LoadClusters(path)
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	expected := map[string]*Credentials{
+		"east": {Endpoint: "https://anvil-east.example.com", Username: "admin", Password: "secret", TLSVerify: true, Site: "us-east"},
+	}
+	if !reflect.DeepEqual(clusters, expected) {
+		t.Errorf("Expected: %v", expected)
+		t.Errorf("Actual: %v", clusters)
+	}
+
+	for _, invalid := range []string{
+		"clusters:\n  - name: east:1\n    endpoint: https://a\n    username: u\n    password: p\n",
+		"clusters:\n  - name: east\n    endpoint: https://a\n",
+		"clusters:\n  - name: east\n    endpoint: https://a\n    username: u\n    password: p\n    unknown: x\n",
+	} {
+		if err := os.WriteFile(path, []byte(invalid), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadClusters(path); err == nil {
+			t.Errorf("Expected error for config %q", invalid)
+		}
+	}
+}
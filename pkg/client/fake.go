@@ -0,0 +1,685 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+// FakeClient is an in-memory Hammerspace cluster implementing Client. Shares, files and their
+// snapshots are kept in maps and tasks complete immediately, so the driver can be exercised
+// without an Anvil, ex. by the csi-sanity suite. Data is never stored, files only have a size.
+type FakeClient struct {
+	lock           sync.Mutex
+	endpoint       string
+	clusterName    string
+	capacity       int64
+	objectives     []string
+	portals        []common.DataPortal
+	shares         map[string]*common.ShareResponse
+	shareSnapshots map[string][]string // share name to snapshot names, oldest first
+	schedules      map[string][]common.ShareSnapshotSchedule
+	scheduled      map[string][]string // share and schedule name to the snapshot names it took, oldest first
+	files          map[string]*fakeFile
+	fileSnapshots  map[string][]string // file path to snapshot names, oldest first
+	lastSnapshot   time.Time
+	snapshotSeq    int
+}
+
+type fakeFile struct {
+	size    int64
+	created int64
+}
+
+// NewFakeClient returns an empty cluster with free capacity in bytes and the given objectives
+func NewFakeClient(endpoint string, capacity int64, objectives ...string) *FakeClient {
+	return &FakeClient{
+		endpoint:       endpoint,
+		clusterName:    "fake",
+		capacity:       capacity,
+		objectives:     objectives,
+		shares:         map[string]*common.ShareResponse{},
+		shareSnapshots: map[string][]string{},
+		schedules:      map[string][]common.ShareSnapshotSchedule{},
+		scheduled:      map[string][]string{},
+		files:          map[string]*fakeFile{},
+		fileSnapshots:  map[string][]string{},
+	}
+}
+
+var _ Client = (*FakeClient)(nil)
+
+// AddFile creates a file, ex. the device file of a file-backed volume, which the driver
+// writes through a mount of its share
+func (fake *FakeClient) AddFile(filePath string, size int64) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.files[filePath] = &fakeFile{size: size, created: time.Now().UnixMilli()}
+}
+
+// RemoveFile deletes a file, ex. the marker a node removes when it unstages a volume
+func (fake *FakeClient) RemoveFile(filePath string) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	delete(fake.files, filePath)
+}
+
+// SnapshotSchedules returns the snapshot schedules of a share
+func (fake *FakeClient) SnapshotSchedules(shareName string) []common.ShareSnapshotSchedule {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return append([]common.ShareSnapshotSchedule{}, fake.schedules[shareName]...)
+}
+
+// TakeScheduledSnapshot takes the snapshot a schedule of a share is due for, and deletes the
+// oldest snapshots the schedule took beyond its retention
+func (fake *FakeClient) TakeScheduledSnapshot(shareName, scheduleName string) (string, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	i := slices.IndexFunc(fake.schedules[shareName], func(schedule common.ShareSnapshotSchedule) bool {
+		return schedule.Name == scheduleName
+	})
+	if i < 0 {
+		return "", fmt.Errorf("share %s has no snapshot schedule %s", shareName, scheduleName)
+	}
+	key := shareName + "/" + scheduleName
+	name := fake.schedules[shareName][i].SnapshotNamePrefix + fake.newSnapshotName()
+	fake.shareSnapshots[shareName] = append(fake.shareSnapshots[shareName], name)
+	taken := []string{}
+	for _, snapshot := range append(fake.scheduled[key], name) {
+		if slices.Contains(fake.shareSnapshots[shareName], snapshot) {
+			taken = append(taken, snapshot)
+		}
+	}
+	if retention := fake.schedules[shareName][i].Retention; retention > 0 {
+		for len(taken) > retention {
+			fake.shareSnapshots[shareName] = removeName(fake.shareSnapshots[shareName], taken[0])
+			taken = taken[1:]
+		}
+	}
+	fake.scheduled[key] = taken
+	return name, nil
+}
+
+// AddDataPortal adds an operational NFS data portal on a node
+func (fake *FakeClient) AddDataPortal(nodeName, address string) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.portals = append(fake.portals, common.DataPortal{
+		OperState:      "UP",
+		AdminState:     "UP",
+		DataPortalType: "NFS_V3",
+		Node: common.DataPortalNode{
+			Name:          nodeName,
+			MgmtIpAddress: common.DataPortalNodeAddress{Address: address},
+		},
+		Uoid: map[string]string{"uuid": nodeName},
+	})
+}
+
+func (fake *FakeClient) Endpoint() string {
+	return fake.endpoint
+}
+
+func (fake *FakeClient) CacheKey(key string) string {
+	return key + "|" + fake.endpoint
+}
+
+func (fake *FakeClient) EnsureLogin() error {
+	return nil
+}
+
+func (fake *FakeClient) GetAnvilPortal() (string, error) {
+	endpointUrl, _ := url.Parse(fake.endpoint)
+	return endpointUrl.Hostname(), nil
+}
+
+func (fake *FakeClient) GetPortalFloatingIp(ctx context.Context) (string, error) {
+	return "", fmt.Errorf("no floating IPs found")
+}
+
+// GetDataPortals returns the data portals, those on the node first
+func (fake *FakeClient) GetDataPortals(ctx context.Context, nodeID string) ([]common.DataPortal, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	portals := make([]common.DataPortal, 0, len(fake.portals))
+	for _, p := range fake.portals {
+		if p.Node.Name == nodeID {
+			portals = append([]common.DataPortal{p}, portals...)
+		} else {
+			portals = append(portals, p)
+		}
+	}
+	return portals, nil
+}
+
+// GetClusterAvailableCapacity returns the capacity not reserved by share size limits
+func (fake *FakeClient) GetClusterAvailableCapacity(ctx context.Context) (int64, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	free := fake.capacity
+	for _, share := range fake.shares {
+		free -= share.Size
+	}
+	return max(free, 0), nil
+}
+
+func (fake *FakeClient) GetClusterName(ctx context.Context) (string, error) {
+	return fake.clusterName, nil
+}
+
+func (fake *FakeClient) ListVolumes(ctx context.Context) ([]common.VolumeResponse, error) {
+	return []common.VolumeResponse{{
+		Name:               "fake-volume",
+		OperatingState:     "UP",
+		StorageVolumeState: "OK",
+		Capacity:           fake.capacity,
+	}}, nil
+}
+
+func (fake *FakeClient) WaitForTaskCompletion(ctx context.Context, taskLocation string) error {
+	return nil
+}
+
+func (fake *FakeClient) CheckIfShareCreateTaskIsRunning(ctx context.Context, shareName string) (bool, error) {
+	return false, nil
+}
+
+func (fake *FakeClient) ShareCreateTracked(shareName string) bool {
+	return false
+}
+
+func (fake *FakeClient) ListObjectives(ctx context.Context) ([]common.ClusterObjectiveResponse, error) {
+	objectives := make([]common.ClusterObjectiveResponse, len(fake.objectives))
+	for i, name := range fake.objectives {
+		objectives[i] = common.ClusterObjectiveResponse{Name: name}
+	}
+	return objectives, nil
+}
+
+func (fake *FakeClient) ListObjectiveNames(ctx context.Context) ([]string, error) {
+	return append([]string{}, fake.objectives...), nil
+}
+
+// SetObjectives applies objectives to a share, objectives at other paths are only validated
+func (fake *FakeClient) SetObjectives(ctx context.Context, shareName string, path string, objectives []string, replaceExisting bool) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	share, exists := fake.shares[shareName]
+	if !exists {
+		return errors.New("failed to set objective")
+	}
+	for _, objective := range objectives {
+		if !slices.Contains(fake.objectives, objective) {
+			return errors.New("failed to set objective")
+		}
+	}
+	if path != "/" {
+		return nil
+	}
+	if replaceExisting && len(objectives) > 0 {
+		share.Objectives.Applied = nil
+	}
+	for _, objective := range objectives {
+		share.Objectives.Applied = append(share.Objectives.Applied, common.AppliedObjectiveResponse{Name: objective})
+	}
+	return nil
+}
+
+// ListShares returns the shares ordered by name
+func (fake *FakeClient) ListShares(ctx context.Context) ([]common.ShareResponse, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	shares := make([]common.ShareResponse, 0, len(fake.shares))
+	for _, share := range fake.shares {
+		shares = append(shares, *copyShare(share))
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Name < shares[j].Name })
+	return shares, nil
+}
+
+func (fake *FakeClient) GetShare(ctx context.Context, name string) (*common.ShareResponse, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	share, exists := fake.shares[name]
+	if !exists {
+		return nil, nil
+	}
+	return copyShare(share), nil
+}
+
+func (fake *FakeClient) GetShareRawFields(ctx context.Context, name string) (map[string]interface{}, error) {
+	share, err := fake.GetShare(ctx, name)
+	if err != nil || share == nil {
+		return nil, err
+	}
+	data, err := json.Marshal(share)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+func (fake *FakeClient) CreateShare(ctx context.Context, name string, exportPath string, size int64, objectives []string,
+	exportOptions []common.ShareExportOptions, deleteDelay int64, comment string) error {
+	if len(name) > common.MaxShareNameLength {
+		return status.Error(codes.InvalidArgument, common.InvalidShareNameSize)
+	}
+	// the API rejects shares without a name
+	if name == "" {
+		return fmt.Errorf(common.UnexpectedHSStatusCode, 400, 202)
+	}
+	extendedInfo := common.GetCommonExtendedInfo()
+	if deleteDelay >= 0 {
+		extendedInfo["csi_delete_delay"] = strconv.FormatInt(deleteDelay, 10)
+	}
+
+	fake.lock.Lock()
+	if _, exists := fake.shares[name]; exists {
+		fake.lock.Unlock()
+		return fmt.Errorf("share %s already exists", name)
+	}
+	total := size
+	if total <= 0 {
+		total = fake.capacity
+	}
+	fake.shares[name] = &common.ShareResponse{
+		Name:          name,
+		ExportPath:    exportPath,
+		Comment:       comment,
+		ExtendedInfo:  extendedInfo,
+		ShareState:    "PUBLISHED",
+		Size:          max(size, 0),
+		ExportOptions: append([]common.ShareExportOptions{}, exportOptions...),
+		Space:         common.ShareSpaceResponse{Total: total, Available: total},
+	}
+	fake.lock.Unlock()
+
+	return fake.SetObjectives(ctx, name, "/", objectives, true)
+}
+
+// CreateShareFromSnapshot creates a share recording snapshotPath like the API client does, the
+// snapshot must exist
+func (fake *FakeClient) CreateShareFromSnapshot(ctx context.Context, name string, exportPath string, size int64, objectives []string,
+	exportOptions []common.ShareExportOptions, deleteDelay int64, comment string, snapshotPath string) error {
+	fake.lock.Lock()
+	found := false
+	for _, snapshots := range fake.shareSnapshots {
+		found = found || slices.Contains(snapshots, path.Base(snapshotPath))
+	}
+	fake.lock.Unlock()
+	if !found {
+		return fmt.Errorf(common.UnexpectedHSStatusCode, 404, 202)
+	}
+	err := fake.CreateShare(ctx, name, exportPath, size, objectives, exportOptions, deleteDelay, comment)
+	if err != nil {
+		return err
+	}
+	return fake.UpdateShareExtendedInfo(ctx, name, map[string]string{common.ContentSourceRecord: snapshotPath})
+}
+
+func (fake *FakeClient) UpdateShareSize(ctx context.Context, name string, size int64) error {
+	return fake.updateShare(name, func(share *common.ShareResponse) {
+		share.Size = size
+		share.Space.Total = size
+		share.Space.Available = size - share.Space.Used
+	})
+}
+
+func (fake *FakeClient) UpdateShare(ctx context.Context, name string, comment *string, exportOptions []common.ShareExportOptions) error {
+	if comment != nil && len(*comment) > 255 {
+		return status.Error(codes.InvalidArgument, common.InvalidCommentSize)
+	}
+	return fake.updateShare(name, func(share *common.ShareResponse) {
+		if comment != nil {
+			share.Comment = *comment
+		}
+		if exportOptions != nil {
+			share.ExportOptions = append([]common.ShareExportOptions{}, exportOptions...)
+		}
+	})
+}
+
+func (fake *FakeClient) UpdateShareExtendedInfo(ctx context.Context, name string, info map[string]string) error {
+	return fake.updateShare(name, func(share *common.ShareResponse) {
+		for k, v := range info {
+			if v == "" {
+				delete(share.ExtendedInfo, k)
+			} else {
+				share.ExtendedInfo[k] = v
+			}
+		}
+	})
+}
+
+func (fake *FakeClient) updateShare(name string, update func(*common.ShareResponse)) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	share, exists := fake.shares[name]
+	if !exists {
+		return errors.New(common.ShareNotFound)
+	}
+	update(share)
+	return nil
+}
+
+// DeleteShare removes a share with its files and snapshots at once, whatever the delete delay
+func (fake *FakeClient) DeleteShare(ctx context.Context, name string, deleteDelay int64) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	share, exists := fake.shares[name]
+	if !exists {
+		return nil
+	}
+	for filePath := range fake.files {
+		if strings.HasPrefix(filePath, share.ExportPath+"/") {
+			delete(fake.files, filePath)
+			delete(fake.fileSnapshots, filePath)
+		}
+	}
+	delete(fake.shares, name)
+	delete(fake.shareSnapshots, name)
+	for _, schedule := range fake.schedules[name] {
+		delete(fake.scheduled, name+"/"+schedule.Name)
+	}
+	delete(fake.schedules, name)
+	return nil
+}
+
+// GetFile returns a file, the files directly inside a share or directory, or the snapshots in
+// the /.snapshot/ directory of a share. Directories are only returned with a trailing slash.
+func (fake *FakeClient) GetFile(ctx context.Context, filePath string) (*common.File, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if file, exists := fake.files[filePath]; exists {
+		return &common.File{Name: path.Base(filePath), Path: filePath, Size: file.size}, nil
+	}
+	if !strings.HasSuffix(filePath, "/") {
+		return nil, nil
+	}
+	dir := strings.TrimSuffix(filePath, "/")
+
+	if sharePath, isSnapshotDir := strings.CutSuffix(dir, "/.snapshot"); isSnapshotDir {
+		share := fake.shareAt(sharePath)
+		if share == nil {
+			return nil, nil
+		}
+		children := []common.FileChildren{{Name: "current", Path: filePath + "current"}}
+		for _, name := range fake.shareSnapshots[share.Name] {
+			stamp := strings.TrimPrefix(name, common.ScheduledSnapshotPrefix)
+			created, _ := time.ParseInLocation(common.SnapshotTimeFormat, stamp[:len(common.SnapshotTimeFormat)], time.UTC)
+			children = append(children, common.FileChildren{
+				Name:       name,
+				Path:       filePath + name,
+				Parent:     filePath,
+				SharePath:  share.ExportPath,
+				ShareName:  share.Name,
+				CreateTime: created.UnixMilli(),
+			})
+		}
+		return &common.File{Name: ".snapshot", Path: filePath, Children: children}, nil
+	}
+
+	share := fake.shareAt(dir)
+	var children []common.FileChildren
+	for childPath, file := range fake.files {
+		if path.Dir(childPath) == dir {
+			children = append(children, common.FileChildren{
+				Name:       path.Base(childPath),
+				Path:       childPath,
+				Size:       file.size,
+				Parent:     filePath,
+				CreateTime: file.created,
+			})
+		}
+	}
+	if share == nil && len(children) == 0 {
+		return nil, nil
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	return &common.File{Name: path.Base(dir), Path: filePath, Children: children}, nil
+}
+
+func (fake *FakeClient) DoesFileExist(ctx context.Context, filePath string) (bool, error) {
+	file, err := fake.GetFile(ctx, filePath)
+	return file != nil, err
+}
+
+// shareAt returns the share exported at exportPath. Callers hold the lock.
+func (fake *FakeClient) shareAt(exportPath string) *common.ShareResponse {
+	for _, share := range fake.shares {
+		if share.ExportPath == exportPath {
+			return share
+		}
+	}
+	return nil
+}
+
+// ListSnapshots returns the share snapshots like HammerspaceClient.ListSnapshots
+func (fake *FakeClient) ListSnapshots(ctx context.Context, snapshot_id, volume_id string) ([]common.SnapshotResponse, error) {
+	if snapshot_id != "" {
+		tokens := strings.SplitN(snapshot_id, "|", 2)
+		if len(tokens) != 2 || (volume_id != "" && volume_id != tokens[1]) {
+			return nil, nil
+		}
+		volume_id = tokens[1]
+	}
+	shares, _ := fake.ListShares(ctx)
+	var snapshots []common.SnapshotResponse
+	for i := range shares {
+		if volume_id != "" && volume_id != common.SharePathPrefix+shares[i].Name {
+			continue
+		}
+		shareSnapshots, _ := fake.ListShareSnapshots(ctx, &shares[i])
+		for _, snapshot := range shareSnapshots {
+			if snapshot_id == "" || snapshot.Id == snapshot_id {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Id < snapshots[j].Id })
+	return snapshots, nil
+}
+
+// ListShareSnapshots returns the snapshots in the /.snapshot/ directory of a share sorted by snapshot ID
+func (fake *FakeClient) ListShareSnapshots(ctx context.Context, share *common.ShareResponse) ([]common.SnapshotResponse, error) {
+	dir, _ := fake.GetFile(ctx, share.ExportPath+"/.snapshot/")
+	if dir == nil {
+		return nil, nil
+	}
+	volumeID := common.SharePathPrefix + share.Name
+	var snapshots []common.SnapshotResponse
+	for _, snapshotFile := range dir.Children {
+		if snapshotFile.Name == "current" {
+			continue
+		}
+		snapshots = append(snapshots, common.SnapshotResponse{
+			Id:             fmt.Sprintf("%s|%s", snapshotFile.Name, volumeID),
+			Created:        snapshotFile.CreateTime,
+			SourceVolumeId: volumeID,
+			ReadyToUse:     true,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Id < snapshots[j].Id })
+	return snapshots, nil
+}
+
+// newSnapshotName returns a snapshot name in the Hammerspace format, ex. 2019-05-24T15-26-57-0,
+// unique among the names returned before. Callers hold the lock.
+func (fake *FakeClient) newSnapshotName() string {
+	now := time.Now().UTC().Truncate(time.Second)
+	if now.Equal(fake.lastSnapshot) {
+		fake.snapshotSeq++
+	} else {
+		fake.lastSnapshot = now
+		fake.snapshotSeq = 0
+	}
+	return fmt.Sprintf("%s-%d", now.Format(common.SnapshotTimeFormat), fake.snapshotSeq)
+}
+
+func (fake *FakeClient) SnapshotShare(ctx context.Context, shareName string) (string, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if _, exists := fake.shares[shareName]; !exists {
+		return "", fmt.Errorf(common.UnexpectedHSStatusCode, 404, 200)
+	}
+	name := fake.newSnapshotName()
+	fake.shareSnapshots[shareName] = append(fake.shareSnapshots[shareName], name)
+	return name, nil
+}
+
+func (fake *FakeClient) GetShareSnapshots(ctx context.Context, shareName string) ([]string, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if _, exists := fake.shares[shareName]; !exists {
+		return []string{}, fmt.Errorf(common.UnexpectedHSStatusCode, 404, 200)
+	}
+	return append([]string{}, fake.shareSnapshots[shareName]...), nil
+}
+
+func (fake *FakeClient) DeleteShareSnapshot(ctx context.Context, shareName, snapshotName string) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.shareSnapshots[shareName] = removeName(fake.shareSnapshots[shareName], snapshotName)
+	return nil
+}
+
+// RestoreShareSnapshot checks the share has the snapshot, there is no data to restore
+func (fake *FakeClient) RestoreShareSnapshot(ctx context.Context, shareName, snapshotName string) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if _, exists := fake.shares[shareName]; !exists || !slices.Contains(fake.shareSnapshots[shareName], snapshotName) {
+		return fmt.Errorf(common.UnexpectedHSStatusCode, 404, 202)
+	}
+	return nil
+}
+
+// SetShareSnapshotSchedule adds a snapshot schedule to a share, replacing the schedule of the
+// same name. Snapshots are only taken through TakeScheduledSnapshot.
+func (fake *FakeClient) SetShareSnapshotSchedule(ctx context.Context, shareName string, schedule common.ShareSnapshotSchedule) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if _, exists := fake.shares[shareName]; !exists {
+		return errors.New(common.ShareNotFound)
+	}
+	fake.schedules[shareName] = append(fake.otherSnapshotSchedules(shareName, schedule.Name), schedule)
+	return nil
+}
+
+func (fake *FakeClient) RemoveShareSnapshotSchedule(ctx context.Context, shareName, scheduleName string) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if _, exists := fake.shares[shareName]; !exists {
+		return errors.New(common.ShareNotFound)
+	}
+	fake.schedules[shareName] = fake.otherSnapshotSchedules(shareName, scheduleName)
+	delete(fake.scheduled, shareName+"/"+scheduleName)
+	return nil
+}
+
+// otherSnapshotSchedules returns the snapshot schedules of a share not named scheduleName.
+// Callers hold the lock.
+func (fake *FakeClient) otherSnapshotSchedules(shareName, scheduleName string) []common.ShareSnapshotSchedule {
+	kept := []common.ShareSnapshotSchedule{}
+	for _, schedule := range fake.schedules[shareName] {
+		if schedule.Name != scheduleName {
+			kept = append(kept, schedule)
+		}
+	}
+	return kept
+}
+
+func (fake *FakeClient) SnapshotFile(ctx context.Context, filePath string) (string, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if _, exists := fake.files[filePath]; !exists {
+		return "", fmt.Errorf(common.UnexpectedHSStatusCode, 400, 200)
+	}
+	name := fake.newSnapshotName()
+	fake.fileSnapshots[filePath] = append(fake.fileSnapshots[filePath], name)
+	return name, nil
+}
+
+func (fake *FakeClient) GetFileSnapshots(ctx context.Context, filePath string) ([]common.FileSnapshot, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	var snapshots []common.FileSnapshot
+	for _, name := range fake.fileSnapshots[filePath] {
+		snapshots = append(snapshots, common.FileSnapshot{SourceFilename: filePath, Time: name})
+	}
+	return snapshots, nil
+}
+
+func (fake *FakeClient) DeleteFileSnapshot(ctx context.Context, filePath, snapshotName string) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.fileSnapshots[filePath] = removeName(fake.fileSnapshots[filePath], path.Base(snapshotName))
+	return nil
+}
+
+// RestoreFileSnapToDestination creates the destination file with the size of the snapshotted file
+func (fake *FakeClient) RestoreFileSnapToDestination(ctx context.Context, snapshotPath, filePath string) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	for source, snapshots := range fake.fileSnapshots {
+		if file, exists := fake.files[source]; exists && slices.Contains(snapshots, path.Base(snapshotPath)) {
+			fake.files[filePath] = &fakeFile{size: file.size, created: time.Now().UnixMilli()}
+			return nil
+		}
+	}
+	return fmt.Errorf(common.UnexpectedHSStatusCode, 404, 200)
+}
+
+// copyShare returns a copy of share that can be changed without changing the cluster
+func copyShare(share *common.ShareResponse) *common.ShareResponse {
+	shareCopy := *share
+	shareCopy.ExtendedInfo = make(map[string]string, len(share.ExtendedInfo))
+	for k, v := range share.ExtendedInfo {
+		shareCopy.ExtendedInfo[k] = v
+	}
+	shareCopy.ExportOptions = append([]common.ShareExportOptions{}, share.ExportOptions...)
+	shareCopy.Objectives.Applied = append([]common.AppliedObjectiveResponse{}, share.Objectives.Applied...)
+	return &shareCopy
+}
+
+func removeName(names []string, name string) []string {
+	kept := []string{}
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
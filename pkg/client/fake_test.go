@@ -0,0 +1,117 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFakeClientShareSnapshots(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeClient("https://anvil.fake", 1000, "keep-online")
+
+	if err := fake.CreateShare(ctx, "vol0", "/vol0", 100, []string{"missing"}, nil, 0, ""); err == nil {
+		t.Fatal("expected an error for an unknown objective")
+	}
+	fake.DeleteShare(ctx, "vol0", 0)
+	if err := fake.CreateShare(ctx, "vol1", "/vol1", 100, []string{"keep-online"}, nil, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	share, _ := fake.GetShare(ctx, "vol1")
+	if share == nil || share.Size != 100 || len(share.Objectives.Applied) != 1 {
+		t.Fatalf("unexpected share %+v", share)
+	}
+
+	first, err := fake.SnapshotShare(ctx, "vol1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := fake.SnapshotShare(ctx, "vol1")
+	if first == second {
+		t.Fatalf("snapshot names are not unique: %s", first)
+	}
+	snapshots, _ := fake.ListSnapshots(ctx, "", "/vol1")
+	if len(snapshots) != 2 || snapshots[0].SourceVolumeId != "/vol1" {
+		t.Fatalf("unexpected snapshots %+v", snapshots)
+	}
+	snapshots, _ = fake.ListSnapshots(ctx, first+"|/vol1", "")
+	if len(snapshots) != 1 || snapshots[0].Id != first+"|/vol1" {
+		t.Fatalf("unexpected snapshots %+v", snapshots)
+	}
+
+	if err := fake.CreateShareFromSnapshot(ctx, "vol2", "/vol2", 100, nil, nil, 0, "", "/vol1/.snapshot/"+first); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.CreateShareFromSnapshot(ctx, "vol3", "/vol3", 100, nil, nil, 0, "", "/vol1/.snapshot/missing"); err == nil {
+		t.Fatal("expected an error for a missing snapshot")
+	}
+
+	if err := fake.DeleteShare(ctx, "vol1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, _ := fake.ListSnapshots(ctx, "", "/vol1"); len(snapshots) != 0 {
+		t.Fatalf("snapshots of a deleted share are listed: %+v", snapshots)
+	}
+	shares, _ := fake.ListShares(ctx)
+	if len(shares) != 1 || shares[0].Name != "vol2" {
+		t.Fatalf("unexpected shares %+v", shares)
+	}
+}
+
+func TestFakeClientFiles(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeClient("https://anvil.fake", 1000)
+	if err := fake.CreateShare(ctx, "backing", "/backing", -1, nil, nil, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	fake.AddFile("/backing/vol1", 10)
+
+	if exists, _ := fake.DoesFileExist(ctx, "/backing/vol1"); !exists {
+		t.Fatal("file not found")
+	}
+	dir, _ := fake.GetFile(ctx, "/backing/")
+	if dir == nil || len(dir.Children) != 1 || dir.Children[0].Size != 10 {
+		t.Fatalf("unexpected directory %+v", dir)
+	}
+
+	snapshot, err := fake.SnapshotFile(ctx, "/backing/vol1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, _ := fake.GetFileSnapshots(ctx, "/backing/vol1")
+	if len(snapshots) != 1 || snapshots[0].Time != snapshot {
+		t.Fatalf("unexpected file snapshots %+v", snapshots)
+	}
+	if err := fake.RestoreFileSnapToDestination(ctx, snapshot, "/backing/vol2"); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := fake.GetFile(ctx, "/backing/vol2")
+	if file == nil || file.Size != 10 {
+		t.Fatalf("unexpected restored file %+v", file)
+	}
+
+	if err := fake.DeleteShare(ctx, "backing", 0); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := fake.DoesFileExist(ctx, "/backing/vol1"); exists {
+		t.Fatal("file of a deleted share still exists")
+	}
+	if snapshots, _ := fake.GetFileSnapshots(ctx, "/backing/vol1"); len(snapshots) != 0 {
+		t.Fatalf("snapshots of a deleted file are listed: %+v", snapshots)
+	}
+}
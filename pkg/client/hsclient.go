@@ -28,8 +28,8 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -42,6 +42,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/hammer-space/csi-plugin/pkg/common"
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
 	"github.com/jpillora/backoff"
 
 	"go.opentelemetry.io/otel"
@@ -54,6 +55,8 @@ const (
 	BasePath            = "/mgmt/v1.2/rest"
 	taskPollTimeout     = 3600 * time.Second // Seconds
 	taskPollIntervalCap = 30 * time.Second   //Seconds, The maximum duration between calls when polling task objects
+	// Number of share snapshot directories read at once when listing snapshots
+	listSnapshotsWorkers = 8
 )
 
 var (
@@ -70,7 +73,9 @@ type HammerspaceClient struct {
 	username   string
 	password   string
 	endpoint   string
+	tlsVerify  bool
 	httpclient *http.Client
+	breaker    circuitBreaker
 }
 
 func NewHammerspaceClient(endpoint, username, password string, tlsVerify bool) (*HammerspaceClient, error) {
@@ -93,6 +98,7 @@ func NewHammerspaceClient(endpoint, username, password string, tlsVerify bool) (
 		username:   username,
 		password:   password,
 		endpoint:   endpoint,
+		tlsVerify:  tlsVerify,
 		httpclient: httpclient,
 	}
 
@@ -101,6 +107,16 @@ func NewHammerspaceClient(endpoint, username, password string, tlsVerify bool) (
 	return hsclient, err
 }
 
+// Endpoint returns the Hammerspace endpoint this client sends requests to
+func (client *HammerspaceClient) Endpoint() string {
+	return client.endpoint
+}
+
+// CacheKey scopes a cache key to the Hammerspace cluster of this client
+func (client *HammerspaceClient) CacheKey(key string) string {
+	return key + "|" + client.endpoint
+}
+
 // GetAnvilPortal returns the hostname of the configured Hammerspace API gateway
 func (client *HammerspaceClient) GetAnvilPortal() (string, error) {
 	endpointUrl, _ := url.Parse(client.endpoint)
@@ -126,7 +142,7 @@ func (client *HammerspaceClient) GetPortalFloatingIp(ctx context.Context) (strin
 	var clusters common.Cluster
 	err = json.Unmarshal([]byte(respBody), &clusters)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 		return "", err
 	}
 
@@ -154,17 +170,17 @@ func (client *HammerspaceClient) GetPortalFloatingIp(ctx context.Context) (strin
 
 	// Strict sequential check — pick first valid FIP in round-robin order
 	for _, fip := range ordered {
-		ok, err := common.CheckNFSExports(fip)
+		ok, err := common.CheckNFSExports(ctx, fip)
 		if err != nil {
-			log.Warnf("Failed checking exports on FIP %s: %v", fip, err)
+			common.Logger(ctx).Warnf("Failed checking exports on FIP %s: %v", fip, err)
 			continue
 		}
 		if ok {
-			log.Infof("Selected FIP via strict round-robin: %s", fip)
+			common.Logger(ctx).Infof("Selected FIP via strict round-robin: %s", fip)
 			return fip, nil
 		}
 	}
-	log.Warnf("No valid floating IPs found in round-robin order: %v", ordered)
+	common.Logger(ctx).Warnf("No valid floating IPs found in round-robin order: %v", ordered)
 	return "", fmt.Errorf("no valid floating IPs found")
 }
 
@@ -174,14 +190,14 @@ func (client *HammerspaceClient) GetDataPortals(ctx context.Context, nodeID stri
 	req, err := client.generateRequest(ctx, "GET", "/data-portals/", "")
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 
 	statusCode, respBody, _, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 	if statusCode != 200 {
@@ -191,7 +207,7 @@ func (client *HammerspaceClient) GetDataPortals(ctx context.Context, nodeID stri
 	var portals []common.DataPortal
 	err = json.Unmarshal([]byte(respBody), &portals)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 		return nil, err
 	}
 
@@ -210,7 +226,7 @@ func (client *HammerspaceClient) GetDataPortals(ctx context.Context, nodeID stri
 	for _, p := range filteredPortals {
 		if p.Node.Name == nodeID {
 			colocatedPortals = append(colocatedPortals, p)
-			log.Infof("Found co-located data-portal, %s, with node name, %s", p.Uoid["uuid"], p.Node.Name)
+			common.Logger(ctx).Infof("Found co-located data-portal, %s, with node name, %s", p.Uoid["uuid"], p.Node.Name)
 		} else {
 			otherPortals = append(otherPortals, p)
 		}
@@ -227,7 +243,12 @@ func (client *HammerspaceClient) EnsureLogin() error {
 	v.Add("username", client.username)
 	v.Add("password", client.password)
 
-	resp, err := client.httpclient.PostForm(fmt.Sprintf("%s%s/login", client.endpoint, BasePath), v)
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s%s/login", client.endpoint, BasePath), strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.send(req)
 	if err != nil {
 		return err
 	}
@@ -235,10 +256,10 @@ func (client *HammerspaceClient) EnsureLogin() error {
 	body, err := io.ReadAll(resp.Body)
 	bodyString := string(body)
 	responseLog := log.WithFields(log.Fields{
-		"statusCode": resp.StatusCode,
-		"body":       bodyString,
-		"headers":    resp.Header,
-		"url":        resp.Request.URL,
+		"status_code": resp.StatusCode,
+		"body":        common.RedactBody(bodyString),
+		"headers":     common.RedactHeaders(resp.Header),
+		"url":         resp.Request.URL,
 	})
 
 	if err != nil {
@@ -251,26 +272,62 @@ func (client *HammerspaceClient) EnsureLogin() error {
 	return err
 }
 
+// doRequest sends req, retrying transient failures with a jittered backoff
 func (client *HammerspaceClient) doRequest(req http.Request) (int, string, map[string][]string, error) {
-	log.Debugf("sending request %s %s", req.Method, req.URL)
+	cfg := common.GetConfig()
+	b := &backoff.Backoff{
+		Min:    cfg.RestRetryMinInterval,
+		Max:    cfg.RestRetryMaxInterval,
+		Factor: 2,
+		Jitter: true,
+	}
+	for attempt := 1; ; attempt++ {
+		statusCode, body, headers, err := client.doRequestOnce(&req)
+		retry, wait := shouldRetry(req.Method, statusCode, headers, err)
+		if !retry || attempt > cfg.RestRetryCount || req.Context().Err() != nil {
+			return statusCode, body, headers, err
+		}
+		if wait > cfg.RestRetryMaxInterval {
+			common.Logger(req.Context()).Warnf("not retrying %s %s, Retry-After %s exceeds %s", req.Method, req.URL, wait, cfg.RestRetryMaxInterval)
+			return statusCode, body, headers, err
+		}
+		wait = max(wait, b.Duration())
+		common.Logger(req.Context()).Warnf("retrying %s %s in %s after attempt %d: status %d, error %v", req.Method, req.URL, wait, attempt, statusCode, err)
+		select {
+		case <-req.Context().Done():
+			return statusCode, body, headers, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// doRequestOnce sends req, logging in again once if the session expired
+func (client *HammerspaceClient) doRequestOnce(req *http.Request) (int, string, map[string][]string, error) {
+	common.Logger(req.Context()).Debugf("sending request %s %s", req.Method, req.URL)
 
-	resp, err := client.httpclient.Do(&req)
+	startTime := time.Now()
+	rewindBody(req)
+	resp, err := client.send(req)
 	// Attempt to login
 	if err == nil && (resp.StatusCode == 401 || resp.StatusCode == 403) {
+		resp.Body.Close()
 		client.EnsureLogin()
-		resp, err = client.httpclient.Do(&req)
+		rewindBody(req)
+		resp, err = client.send(req)
 	}
 	if err != nil {
+		metrics.ObserveRESTCall(req.Method, req.URL.Path, 0, time.Since(startTime))
 		return 0, "", nil, err
 	}
+	metrics.ObserveRESTCall(req.Method, req.URL.Path, resp.StatusCode, time.Since(startTime))
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	bodyString := string(body)
-	responseLog := log.WithFields(log.Fields{
-		"statusCode":  resp.StatusCode,
-		"body":        bodyString,
-		"headers":     resp.Header,
-		"request_url": req.URL,
+	responseLog := common.Logger(req.Context()).WithFields(log.Fields{
+		"status_code": resp.StatusCode,
+		"body":        common.RedactBody(bodyString),
+		"headers":     common.RedactHeaders(resp.Header),
+		"url":         req.URL,
 	})
 	if resp.StatusCode >= 500 {
 		responseLog.Error("received error response")
@@ -280,6 +337,15 @@ func (client *HammerspaceClient) doRequest(req http.Request) (int, string, map[s
 	return resp.StatusCode, bodyString, resp.Header, err
 }
 
+// rewindBody resets the body of req so it can be sent again
+func rewindBody(req *http.Request) {
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			req.Body = body
+		}
+	}
+}
+
 // generateRequest creates a new HTTP request with the given verb, URL path, and body.
 func (client *HammerspaceClient) generateRequest(ctx context.Context, verb, urlPath, body string) (*http.Request, error) {
 	ctx, span := tracer.Start(ctx, "HammerspaceClient.generateRequest")
@@ -288,7 +354,7 @@ func (client *HammerspaceClient) generateRequest(ctx context.Context, verb, urlP
 	fullURL := fmt.Sprintf("%s%s%s", client.endpoint, BasePath, urlPath)
 	req, err := http.NewRequestWithContext(ctx, verb, fullURL, bytes.NewBufferString(body))
 	if err != nil {
-		log.Error(err.Error())
+		common.Logger(ctx).Error(err.Error())
 		span.RecordError(err)
 		return nil, err
 	}
@@ -308,9 +374,9 @@ func (client *HammerspaceClient) generateRequest(ctx context.Context, verb, urlP
 
 	spanCtx := trace.SpanContextFromContext(ctx)
 	if !spanCtx.IsValid() {
-		log.Warn("No active span context found in ctx")
+		common.Logger(ctx).Warn("No active span context found in ctx")
 	} else {
-		log.Infof("trace: method=%s url=%s trace_id=%s span_id=%s",
+		common.Logger(ctx).Infof("trace: method=%s url=%s trace_id=%s span_id=%s",
 			req.Method,
 			req.URL.String(),
 			spanCtx.TraceID().String(),
@@ -321,61 +387,16 @@ func (client *HammerspaceClient) generateRequest(ctx context.Context, verb, urlP
 	return req, nil
 }
 
-func (client *HammerspaceClient) WaitForTaskCompletion(ctx context.Context, taskLocation string) (bool, error) {
-	b := &backoff.Backoff{
-		Max:    taskPollIntervalCap,
-		Factor: 1.5,
-		Jitter: true,
-	}
-	taskUrl, _ := url.Parse(taskLocation)
-	taskId := path.Base(taskUrl.Path)
-	startTime := time.Now()
-
-	var task common.Task
-	for time.Since(startTime) < taskPollTimeout {
-		d := b.Duration()
-		time.Sleep(d)
-
-		req, err := client.generateRequest(ctx, "GET", "/tasks/"+taskId, "")
-		if err != nil {
-			log.Error("Failed to generate request object")
-			os.Exit(1)
-		}
-		statusCode, respBody, _, err := client.doRequest(*req)
-		if err != nil {
-			return false, err
-		}
-		if statusCode != 200 {
-			return false, fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 200)
-		}
-
-		err = json.Unmarshal([]byte(respBody), &task)
-		if err != nil {
-			log.Error(err)
-			return false, nil
-		}
-		if task.Status != "NONE" && task.Status != "EXECUTING" {
-			if task.Status == "COMPLETED" || task.Status == "FAILED" || task.Status == "HALTED" || task.Status == "CANCELLED" {
-				return true, nil
-			} else {
-				log.Error(fmt.Sprintf("Task %s, of type %s, failed. Exit value is %s", task.Uuid, task.Action, task.StatusMessage))
-				return false, nil
-			}
-		}
-	}
-	return false, fmt.Errorf("task %s, of type %s, failed to complete within time limit. Current status is %s", task.Uuid, task.Action, task.Status)
-}
-
 func (client *HammerspaceClient) ListShares(ctx context.Context) ([]common.ShareResponse, error) {
 	req, err := client.generateRequest(ctx, "GET", "/shares", "")
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 	statusCode, respBody, _, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 	if statusCode != 200 {
@@ -385,9 +406,9 @@ func (client *HammerspaceClient) ListShares(ctx context.Context) ([]common.Share
 	var shares []common.ShareResponse
 	err = json.Unmarshal([]byte(respBody), &shares)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 	}
-	log.Debug(fmt.Sprintf("Found %d shares", len(shares)))
+	common.Logger(ctx).Debug(fmt.Sprintf("Found %d shares", len(shares)))
 
 	return shares, nil
 }
@@ -395,14 +416,14 @@ func (client *HammerspaceClient) ListShares(ctx context.Context) ([]common.Share
 func (client *HammerspaceClient) ListObjectives(ctx context.Context) ([]common.ClusterObjectiveResponse, error) {
 	req, err := client.generateRequest(ctx, "GET", "/objectives", "")
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 
 	statusCode, respBody, _, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 	if statusCode != 200 {
@@ -412,11 +433,11 @@ func (client *HammerspaceClient) ListObjectives(ctx context.Context) ([]common.C
 	var objs []common.ClusterObjectiveResponse
 	err = json.Unmarshal([]byte(respBody), &objs)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 	}
-	log.Debug(fmt.Sprintf("Found %d objectives", len(objs)))
+	common.Logger(ctx).Debug(fmt.Sprintf("Found %d objectives", len(objs)))
 	// set free capacity to cache expire in 5 min
-	common.SetCacheData("OBJECTIVE_LIST", objs, 60*5)
+	common.SetCacheData(client.CacheKey("OBJECTIVE_LIST"), objs, 60*5)
 	return objs, nil
 }
 
@@ -431,7 +452,7 @@ func (client *HammerspaceClient) ListObjectiveNames(ctx context.Context) ([]stri
 		objectiveNames[i] = o.Name
 	}
 	// set free capacity to cache expire in 5 min
-	common.SetCacheData("OBJECTIVE_LIST_NAMES", objectiveNames, 60*5)
+	common.SetCacheData(client.CacheKey("OBJECTIVE_LIST_NAMES"), objectiveNames, 60*5)
 	return objectiveNames, nil
 }
 
@@ -440,13 +461,13 @@ func (client *HammerspaceClient) ListVolumes(ctx context.Context) ([]common.Volu
 	trace.SpanFromContext(ctx).AddEvent("Listing base storage volumes")
 	req, err := client.generateRequest(ctx, "GET", "/base-storage-volumes", "")
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 
 	statusCode, respBody, _, err := client.doRequest(*req)
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 	if statusCode != 200 {
@@ -460,78 +481,138 @@ func (client *HammerspaceClient) ListVolumes(ctx context.Context) ([]common.Volu
 			attribute.String("response", respBody),
 			attribute.String("error", err.Error()),
 		))
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 	}
-	log.Debug(fmt.Sprintf("Found %d volumes", len(volumes)))
+	common.Logger(ctx).Debug(fmt.Sprintf("Found %d volumes", len(volumes)))
 	trace.SpanFromContext(ctx).AddEvent("Received base storage volumes", trace.WithAttributes(
 		attribute.Int("count", len(volumes)),
 	))
 	return volumes, nil
 }
 
+// ListSnapshots returns the share snapshots sorted by snapshot ID, optionally only those of one
+// snapshot ID or source volume ID. Without either, it reads the snapshot directory of every share.
 func (client *HammerspaceClient) ListSnapshots(ctx context.Context, snapshot_id, volume_id string) ([]common.SnapshotResponse, error) {
-	// Get all shares
-	shares, err := client.ListShares(ctx)
-	if err != nil || shares == nil {
-		log.Errorf("Error while fetching list of shares. Err %v", err)
-		return nil, err
+	// Snapshot IDs are <snapshot name>|<source volume ID>
+	if snapshot_id != "" {
+		tokens := strings.SplitN(snapshot_id, "|", 2)
+		if len(tokens) != 2 || (volume_id != "" && volume_id != tokens[1]) {
+			return nil, nil
+		}
+		volume_id = tokens[1]
 	}
 
 	var shareSnapshots []common.SnapshotResponse
-
-	// Iterate over each share
-	for _, share := range shares {
-		// Skip shares that don't match the provided volume_id (if specified)
-		if volume_id != "" && share.Name != volume_id {
-			continue
+	if volume_id != "" {
+		// only share-backed volumes are listed, their IDs are the path of the share
+		share, err := client.GetShare(ctx, path.Base(volume_id))
+		if err != nil {
+			return nil, err
 		}
-
-		// Get the snapshots from the /.snapshot/ directory of the share
-		shareSnapshotDir := share.ExportPath + "/.snapshot/"
-		shareFile, err := client.GetFile(ctx, shareSnapshotDir)
+		if share == nil || volume_id != common.SharePathPrefix+share.Name {
+			return nil, nil
+		}
+		shareSnapshots, err = client.ListShareSnapshots(ctx, share)
 		if err != nil {
-			log.Errorf("Failed to get share snapshots from %s: %v", shareSnapshotDir, err)
 			return nil, err
 		}
-
-		// assume no snapshot is there if shareFile is nil
-		if shareFile == nil {
-			log.Warnf("GetFile returned nil for path %s without error", shareSnapshotDir)
-			continue
+	} else {
+		var err error
+		shareSnapshots, err = client.listAllShareSnapshots(ctx)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		// Iterate over the snapshots in the /.snapshot/ directory
-		for _, snapshotFile := range shareFile.Children {
-			snapshot := common.SnapshotResponse{
-				Id:             snapshotFile.Name,
-				Created:        snapshotFile.CreateTime,
-				SourceVolumeId: share.Name,
-				ReadyToUse:     true, // Assume true if the snapshot exists
-				Size:           snapshotFile.Size,
+	if snapshot_id != "" {
+		for _, snapshot := range shareSnapshots {
+			if snapshot.Id == snapshot_id {
+				return []common.SnapshotResponse{snapshot}, nil
 			}
+		}
+		return nil, nil
+	}
+	common.Logger(ctx).Debugf("Found %d snapshots, snapshot ID '%s', volume ID '%s'", len(shareSnapshots), snapshot_id, volume_id)
+	return shareSnapshots, nil
+}
 
-			// Filter by snapshot_id if provided
-			if snapshot_id != "" {
-				if snapshot.Id == snapshot_id {
-					return []common.SnapshotResponse{snapshot}, nil
-				}
-				continue
-			}
+func (client *HammerspaceClient) listAllShareSnapshots(ctx context.Context) ([]common.SnapshotResponse, error) {
+	shares, err := client.ListShares(ctx)
+	if err != nil {
+		common.Logger(ctx).Errorf("Error while fetching list of shares. Err %v", err)
+		return nil, err
+	}
+
+	// The snapshot directories of several shares are read at once
+	results := make([][]common.SnapshotResponse, len(shares))
+	errs := make([]error, len(shares))
+	workers := make(chan struct{}, listSnapshotsWorkers)
+	var wg sync.WaitGroup
+	for i := range shares {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			results[i], errs[i] = client.ListShareSnapshots(ctx, &shares[i])
+		}(i)
+	}
+	wg.Wait()
 
-			// Add the snapshot to the list
-			shareSnapshots = append(shareSnapshots, snapshot)
+	var shareSnapshots []common.SnapshotResponse
+	for i := range shares {
+		if errs[i] != nil {
+			return nil, errs[i]
 		}
+		shareSnapshots = append(shareSnapshots, results[i]...)
 	}
-	log.Infof("%v, %s, %s", shareSnapshots, snapshot_id, volume_id)
+	sort.Slice(shareSnapshots, func(i, j int) bool {
+		return shareSnapshots[i].Id < shareSnapshots[j].Id
+	})
 	return shareSnapshots, nil
 }
 
+// ListShareSnapshots returns the snapshots in the /.snapshot/ directory of a share sorted by snapshot ID
+func (client *HammerspaceClient) ListShareSnapshots(ctx context.Context, share *common.ShareResponse) ([]common.SnapshotResponse, error) {
+	shareSnapshotDir := share.ExportPath + "/.snapshot/"
+	shareFile, err := client.GetFile(ctx, shareSnapshotDir)
+	if err != nil {
+		common.Logger(ctx).Errorf("Failed to get share snapshots from %s: %v", shareSnapshotDir, err)
+		return nil, err
+	}
+
+	// assume no snapshot is there if shareFile is nil
+	if shareFile == nil {
+		common.Logger(ctx).Warnf("GetFile returned nil for path %s without error", shareSnapshotDir)
+		return nil, nil
+	}
+
+	volumeID := common.SharePathPrefix + share.Name
+	var snapshots []common.SnapshotResponse
+	for _, snapshotFile := range shareFile.Children {
+		if snapshotFile.Name == "current" {
+			continue
+		}
+		snapshots = append(snapshots, common.SnapshotResponse{
+			Id:             fmt.Sprintf("%s|%s", snapshotFile.Name, volumeID),
+			Created:        snapshotFile.CreateTime,
+			SourceVolumeId: volumeID,
+			ReadyToUse:     true, // Assume true if the snapshot exists
+			Size:           snapshotFile.Size,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Id < snapshots[j].Id
+	})
+	return snapshots, nil
+}
+
 func (client *HammerspaceClient) GetShare(ctx context.Context, name string) (*common.ShareResponse, error) {
 	req, err := client.generateRequest(ctx, "GET", "/shares/"+url.PathEscape(name), "")
 	statusCode, respBody, _, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 	if statusCode == 404 {
@@ -544,7 +625,7 @@ func (client *HammerspaceClient) GetShare(ctx context.Context, name string) (*co
 	var share common.ShareResponse
 	err = json.Unmarshal([]byte(respBody), &share)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 	}
 	return &share, err
 }
@@ -554,7 +635,7 @@ func (client *HammerspaceClient) GetShareRawFields(ctx context.Context, name str
 	statusCode, respBody, _, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 	if statusCode == 404 {
@@ -567,7 +648,7 @@ func (client *HammerspaceClient) GetShareRawFields(ctx context.Context, name str
 	var share map[string]interface{}
 	err = json.Unmarshal([]byte(respBody), &share)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 	}
 	return share, err
 }
@@ -577,7 +658,7 @@ func (client *HammerspaceClient) GetFile(ctx context.Context, path string) (*com
 	statusCode, respBody, _, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return nil, err
 	}
 
@@ -594,7 +675,7 @@ func (client *HammerspaceClient) GetFile(ctx context.Context, path string) (*com
 	var file common.File
 	err = json.Unmarshal([]byte(respBody), &file)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 	}
 	return &file, nil
 }
@@ -613,7 +694,7 @@ func (client *HammerspaceClient) CreateShare(ctx context.Context,
 	deleteDelay int64,
 	comment string) error {
 
-	log.Debug("Creating share: " + name)
+	common.Logger(ctx).Debug("Creating share: " + name)
 	extendedInfo := common.GetCommonExtendedInfo()
 	if exportOptions == nil { // send empty list to api req
 		exportOptions = make([]common.ShareExportOptions, 0)
@@ -621,7 +702,7 @@ func (client *HammerspaceClient) CreateShare(ctx context.Context,
 	if deleteDelay >= 0 {
 		extendedInfo["csi_delete_delay"] = strconv.FormatInt(deleteDelay, 10)
 	}
-	if len(name) > 80 {
+	if len(name) > common.MaxShareNameLength {
 		return status.Error(codes.InvalidArgument, common.InvalidShareNameSize)
 	}
 
@@ -636,65 +717,19 @@ func (client *HammerspaceClient) CreateShare(ctx context.Context,
 		share.Size = size
 	}
 
-	shareString := new(bytes.Buffer)
-	json.NewEncoder(shareString).Encode(share)
-
-	req, err := client.generateRequest(ctx, "POST", "/shares", shareString.String())
-	if err != nil {
-		log.Errorf("unable to genrate share create request with POST. Error %v", err)
-		return err
-	}
-	statusCode, _, respHeaders, err := client.doRequest(*req)
-
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-	if statusCode != 202 {
-		if statusCode == 400 {
-			shareTaskRunning, err := client.CheckIfShareCreateTaskIsRunning(ctx, name)
-			log.Debug(fmt.Sprintf("Found share creating task running as: %v ", shareTaskRunning))
-			if shareTaskRunning {
-				return nil
-			}
-			return err
-		}
-		return fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 202)
-	}
-
-	// ensure the location header is set and also make sure length >= 1
-	if locs, exists := respHeaders["Location"]; exists {
-		success, err := client.WaitForTaskCompletion(ctx, locs[0])
-		if err != nil {
-			log.Error(err)
-			return err
-		}
-		if !success {
-			defer client.DeleteShare(ctx, share.Name, 0)
-			return errors.New("share failed to create")
-		}
-
-	} else {
-		log.Errorf("No task returned to monitor")
-	}
-
-	// Set objectives on share
-	err = client.SetObjectives(ctx, name, "/", objectives, true)
-	if err != nil {
-		log.Errorf("Failed to set objectives %s, %v", objectives, err)
-		return err
-	}
-
-	return nil
+	return client.createShare(ctx, share, objectives)
 }
 
+// CreateShareFromSnapshot creates an empty share recording snapshotPath in its extended info.
+// The API cannot create a share from a snapshot, so the caller copies the snapshot content into
+// the share and then removes the record.
 func (client *HammerspaceClient) CreateShareFromSnapshot(ctx context.Context, name string, exportPath string, size int64, objectives []string, exportOptions []common.ShareExportOptions, deleteDelay int64, comment string, snapshotPath string) error {
-	log.WithFields(log.Fields{
-		"name":          name,
-		"deleteDelay":   deleteDelay,
-		"exportOptions": exportOptions,
-		"exportPath":    exportPath,
-		"snapshotPath":  snapshotPath,
+	common.Logger(ctx).WithFields(log.Fields{
+		"name":           name,
+		"delete_delay":   deleteDelay,
+		"export_options": exportOptions,
+		"export_path":    exportPath,
+		"snapshot_path":  snapshotPath,
 	}).Infof("creating new share from snapshot")
 
 	extendedInfo := common.GetCommonExtendedInfo()
@@ -705,10 +740,10 @@ func (client *HammerspaceClient) CreateShareFromSnapshot(ctx context.Context, na
 	if deleteDelay >= 0 {
 		extendedInfo["csi_delete_delay"] = strconv.FormatInt(deleteDelay, 10)
 	}
-	if len(name) > 80 {
+	extendedInfo[common.ContentSourceRecord] = snapshotPath
+	if len(name) > common.MaxShareNameLength {
 		return status.Error(codes.InvalidArgument, common.InvalidShareNameSize)
 	}
-	////// FIXME: Replace with new api to clone a snapshot to a new share
 	share := common.ShareRequest{
 		Name:          name,
 		ExportPath:    exportPath,
@@ -720,93 +755,85 @@ func (client *HammerspaceClient) CreateShareFromSnapshot(ctx context.Context, na
 		share.Size = size
 	}
 
-	shareString := new(bytes.Buffer)
-	json.NewEncoder(shareString).Encode(share)
-
-	req, err := client.generateRequest(ctx, "POST", "/shares", shareString.String())
-	if err != nil {
-		log.Errorf("unable to genrate share create request with POST. Error %v", err)
-		return err
-	}
-	statusCode, _, respHeaders, err := client.doRequest(*req)
+	return client.createShare(ctx, share, objectives)
+}
 
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-	if statusCode != 202 {
-		if statusCode == 400 {
-			shareTaskRunning, err := client.CheckIfShareCreateTaskIsRunning(ctx, name)
-			log.Debug(fmt.Sprintf("Found share creating task running as: %v ", shareTaskRunning))
-			if shareTaskRunning {
-				return nil
-			}
+// createShare starts the task creating share, or waits for the one started by an earlier call,
+// and sets objectives on the share once it is created. A share whose task did not complete is
+// deleted if the plugin started the task.
+func (client *HammerspaceClient) createShare(ctx context.Context, share common.ShareRequest, objectives []string) error {
+	tracked, _ := tasks.get(client.taskKey(taskShareCreate, share.Name))
+	taskLocation := tracked.location
+	if taskLocation == "" {
+		shareString := new(bytes.Buffer)
+		json.NewEncoder(shareString).Encode(share)
+
+		req, err := client.generateRequest(ctx, "POST", "/shares", shareString.String())
+		if err != nil {
+			common.Logger(ctx).Errorf("unable to genrate share create request with POST. Error %v", err)
 			return err
 		}
-		return fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 202)
-	}
+		statusCode, _, respHeaders, err := client.doRequest(*req)
 
-	// ensure the location header is set and also make sure length >= 1
-	if locs, exists := respHeaders["Location"]; exists {
-		success, err := client.WaitForTaskCompletion(ctx, locs[0])
 		if err != nil {
-			log.Error(err)
+			common.Logger(ctx).Error(err)
 			return err
 		}
-		if !success {
-			defer client.DeleteShare(ctx, share.Name, 0)
-			return errors.New("failed to create a share, delete share command issued")
+		switch statusCode {
+		case 202:
+			// ensure the location header is set and also make sure length >= 1
+			if locs, exists := respHeaders["Location"]; exists && len(locs) > 0 {
+				taskLocation = locs[0]
+			} else {
+				common.Logger(ctx).Errorf("No task returned to monitor")
+			}
+		case 400:
+			// The share may be created by a task the plugin does not track, ex. it was started
+			// before the plugin restarted
+			task, err := client.runningShareCreateTask(ctx, share.Name)
+			if err != nil {
+				return err
+			}
+			if task == nil {
+				return fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 202)
+			}
+			common.Logger(ctx).Infof("waiting for running task %s creating share %s", task.Uuid, share.Name)
+			taskLocation = "/tasks/" + task.Uuid
+			tasks.adopt(client.taskKey(taskShareCreate, share.Name), taskLocation)
+			tracked.adopted = true
+		default:
+			return fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 202)
 		}
+	}
 
-	} else {
-		log.Errorf("No task returned to monitor")
+	if taskLocation != "" {
+		task, err := client.waitForTrackedTask(ctx, taskShareCreate, share.Name, taskLocation)
+		if err != nil {
+			common.Logger(ctx).Error(err)
+			if task != nil && !tracked.adopted {
+				defer client.DeleteShare(ctx, share.Name, 0)
+			}
+			return err
+		}
 	}
 
 	// Set objectives on share
-	err = client.SetObjectives(ctx, name, "/", objectives, true)
+	err := client.SetObjectives(ctx, share.Name, "/", objectives, true)
 	if err != nil {
-		log.Errorf("Failed to set objectives %s, %v", objectives, err)
+		common.Logger(ctx).Errorf("Failed to set objectives %s, %v", objectives, err)
 		return err
 	}
 
 	return nil
 }
 
-func (client *HammerspaceClient) CheckIfShareCreateTaskIsRunning(ctx context.Context, shareName string) (bool, error) {
-	req, err := client.generateRequest(ctx, "GET", "/tasks", "")
-	if err != nil {
-		log.Error("Failed to generate request object")
-		return false, err
-	}
-	statusCode, respBody, _, err := client.doRequest(*req)
-	if err != nil {
-		return false, err
-	}
-	if statusCode != 200 {
-		return false, fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 200)
-	}
-	var tasks []common.Task
-	err = json.Unmarshal([]byte(respBody), &tasks)
-	if err != nil {
-		log.Error(err)
-		return false, nil
-	}
-	for _, task := range tasks {
-		// log.Debug(fmt.Printf("Task Name: %v\n  Task Status: %s\n Share Name: %s\n", task.ParamsMap.Name, task.Status, shareName))
-		if task.Status == "EXECUTING" && task.ParamsMap.Name == shareName {
-			return true, nil
-		}
-	}
-	return false, nil
-}
-
 // Set objectives on a share, at the specified path, optionally clearing previously-set objectives at the path
 // The path must start with a slash
 func (client *HammerspaceClient) SetObjectives(ctx context.Context, shareName string,
 	path string,
 	objectives []string,
 	replaceExisting bool) error {
-	log.Debugf("Setting objectives. Share=%s, Path=%s, Objectives=%v: ", shareName, path, objectives)
+	common.Logger(ctx).Debugf("Setting objectives. Share=%s, Path=%s, Objectives=%v: ", shareName, path, objectives)
 	// Set objectives on share at path
 	cleared := false
 	for _, objectiveName := range objectives {
@@ -818,19 +845,19 @@ func (client *HammerspaceClient) SetObjectives(ctx context.Context, shareName st
 		}
 		req, err := client.generateRequest(ctx, "POST", urlPath, "")
 		if err != nil {
-			log.Errorf("Failed to set objective %s on share %s at path %s, %v",
+			common.Logger(ctx).Errorf("Failed to set objective %s on share %s at path %s, %v",
 				objectiveName, shareName, path, err)
 			return err
 		}
 		statusCode, _, _, err := client.doRequest(*req)
 		if err != nil {
-			log.Errorf("Failed to set objective %s on share %s at path %s, %v",
+			common.Logger(ctx).Errorf("Failed to set objective %s on share %s at path %s, %v",
 				objectiveName, shareName, path, err)
 			return err
 		}
 		if statusCode != 200 {
 			//FIXME: err is not set here
-			log.Errorf("Failed to set objective %s on share %s at path %s, %v",
+			common.Logger(ctx).Errorf("Failed to set objective %s on share %s at path %s, %v",
 				objectiveName, shareName, path, err)
 			return errors.New("failed to set objective")
 		}
@@ -842,48 +869,138 @@ func (client *HammerspaceClient) SetObjectives(ctx context.Context, shareName st
 // size in bytes
 func (client *HammerspaceClient) UpdateShareSize(ctx context.Context, name string, size int64) error {
 
-	log.Debugf("Update share size : %s to %v", name, size)
+	common.Logger(ctx).Debugf("Update share size : %s to %v", name, size)
+
+	return client.updateShareRawFields(ctx, taskShareResize, name, func(share map[string]interface{}) {
+		share["shareSizeLimit"] = size
+	})
+}
+
+// UpdateShare changes the comment and export options of an existing share.
+// A nil comment or nil exportOptions leaves the corresponding field untouched.
+func (client *HammerspaceClient) UpdateShare(ctx context.Context, name string, comment *string, exportOptions []common.ShareExportOptions) error {
+	common.Logger(ctx).WithFields(log.Fields{
+		"name":           name,
+		"comment":        comment,
+		"export_options": exportOptions,
+	}).Debugf("Update share")
+
+	if comment != nil && len(*comment) > 255 {
+		return status.Error(codes.InvalidArgument, common.InvalidCommentSize)
+	}
+
+	return client.updateShareRawFields(ctx, taskShareUpdate, name, func(share map[string]interface{}) {
+		if comment != nil {
+			share["comment"] = *comment
+		}
+		if exportOptions != nil {
+			share["exportOptions"] = exportOptions
+		}
+	})
+}
+
+// UpdateShareExtendedInfo adds or replaces extended info entries on a share.
+// Entries with an empty value are removed from the share.
+func (client *HammerspaceClient) UpdateShareExtendedInfo(ctx context.Context, name string, info map[string]string) error {
+	common.Logger(ctx).Debugf("Update extended info on share %s: %v", name, info)
+
+	return client.updateShareRawFields(ctx, taskShareUpdate, name, func(share map[string]interface{}) {
+		extendedInfo, _ := share["extendedInfo"].(map[string]interface{})
+		if extendedInfo == nil {
+			extendedInfo = map[string]interface{}{}
+		}
+		for k, v := range info {
+			if v == "" {
+				delete(extendedInfo, k)
+			} else {
+				extendedInfo[k] = v
+			}
+		}
+		share["extendedInfo"] = extendedInfo
+	})
+}
+
+// SetShareSnapshotSchedule adds a snapshot schedule to a share, replacing the schedule of the
+// same name. Other schedules of the share are kept.
+func (client *HammerspaceClient) SetShareSnapshotSchedule(ctx context.Context, shareName string, schedule common.ShareSnapshotSchedule) error {
+	common.Logger(ctx).WithFields(log.Fields{
+		"share":     shareName,
+		"schedule":  schedule.Name,
+		"frequency": schedule.Frequency,
+		"retention": schedule.Retention,
+	}).Debugf("Set share snapshot schedule")
+
+	return client.updateShareRawFields(ctx, taskShareUpdate, shareName, func(share map[string]interface{}) {
+		share["snapshotSchedules"] = append(otherSnapshotSchedules(share, schedule.Name), schedule)
+	})
+}
+
+// RemoveShareSnapshotSchedule removes a snapshot schedule from a share, the snapshots it took
+// are kept
+func (client *HammerspaceClient) RemoveShareSnapshotSchedule(ctx context.Context, shareName, scheduleName string) error {
+	common.Logger(ctx).Debugf("Remove snapshot schedule %s from share %s", scheduleName, shareName)
+
+	return client.updateShareRawFields(ctx, taskShareUpdate, shareName, func(share map[string]interface{}) {
+		share["snapshotSchedules"] = otherSnapshotSchedules(share, scheduleName)
+	})
+}
+
+// otherSnapshotSchedules returns the raw snapshot schedules of a share not named scheduleName
+func otherSnapshotSchedules(share map[string]interface{}, scheduleName string) []interface{} {
+	schedules, _ := share["snapshotSchedules"].([]interface{})
+	kept := []interface{}{}
+	for _, schedule := range schedules {
+		if fields, ok := schedule.(map[string]interface{}); ok && fields["name"] == scheduleName {
+			continue
+		}
+		kept = append(kept, schedule)
+	}
+	return kept
+}
+
+// updateShareRawFields fetches the share as returned by the API, applies update to it and
+// PUTs it back, waiting for the resulting task. Working on the raw fields avoids dropping
+// share attributes the plugin does not model. The task is tracked as operation, a retried
+// update first waits for the task of the earlier call.
+func (client *HammerspaceClient) updateShareRawFields(ctx context.Context, operation, name string, update func(map[string]interface{})) error {
+	if taskLocation := client.trackedTaskLocation(operation, name); taskLocation != "" {
+		if _, err := client.waitForTrackedTask(ctx, operation, name, taskLocation); err != nil {
+			return err
+		}
+	}
 
 	share, err := client.GetShareRawFields(ctx, name)
-	if err != nil {
+	if err != nil || share == nil {
 		return errors.New(common.ShareNotFound)
 	}
 
-	share["shareSizeLimit"] = size
+	update(share)
 	shareString := new(bytes.Buffer)
 	json.NewEncoder(shareString).Encode(share)
 
-	req, err := client.generateRequest(ctx, "PUT", "/shares/"+name, shareString.String())
+	req, err := client.generateRequest(ctx, "PUT", "/shares/"+url.PathEscape(name), shareString.String())
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return err
 	}
 	statusCode, _, respHeaders, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return err
 	}
-	if statusCode == 400 {
-		//
-	}
 	if statusCode != 202 {
 		return fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 202)
 	}
 
 	// ensure the location header is set and also make sure length >= 1
-	if locs, exists := respHeaders["Location"]; exists {
-		success, err := client.WaitForTaskCompletion(ctx, locs[0])
-		if err != nil {
-			log.Error(err)
+	if locs, exists := respHeaders["Location"]; exists && len(locs) > 0 {
+		if _, err := client.waitForTrackedTask(ctx, operation, name, locs[0]); err != nil {
+			common.Logger(ctx).Error(err)
 			return err
 		}
-		if !success {
-			return errors.New("Share failed to update")
-		}
-
 	} else {
-		log.Errorf("No task returned to monitor")
+		common.Logger(ctx).Errorf("No task returned to monitor")
 	}
 
 	return nil
@@ -891,7 +1008,7 @@ func (client *HammerspaceClient) UpdateShareSize(ctx context.Context, name strin
 
 func (client *HammerspaceClient) DeleteShare(ctx context.Context, name string, deleteDelay int64) error {
 	queryParams := "?delete-path=true"
-	log.Debugf("Deleting share: %s with delete delay %d", name, deleteDelay)
+	common.Logger(ctx).Debugf("Deleting share: %s with delete delay %d", name, deleteDelay)
 	trace.SpanFromContext(ctx).SetAttributes(
 		attribute.String("share.name", name),
 		attribute.Int64("share.delete_delay", deleteDelay),
@@ -899,6 +1016,10 @@ func (client *HammerspaceClient) DeleteShare(ctx context.Context, name string, d
 	if deleteDelay >= 0 {
 		queryParams = queryParams + "&delete-delay=" + strconv.FormatInt(deleteDelay, 10)
 	}
+	if taskLocation := client.trackedTaskLocation(taskShareDelete, name); taskLocation != "" {
+		_, err := client.waitForTrackedTask(ctx, taskShareDelete, name, taskLocation)
+		return err
+	}
 	req, err := client.generateRequest(ctx, "DELETE", "/shares/"+url.PathEscape(name)+queryParams, "")
 	if err != nil {
 		return err
@@ -920,18 +1041,13 @@ func (client *HammerspaceClient) DeleteShare(ctx context.Context, name string, d
 	}
 
 	// ensure the location header is set and also make sure length >= 1
-	if locs, exists := respHeaders["Location"]; exists {
-		if !exists {
-			log.Errorf("No task returned to monitor")
-		} else {
-			success, err := client.WaitForTaskCompletion(ctx, locs[0])
-			if err != nil {
-				log.Error(err)
-			}
-			if !success {
-				return errors.New("share-delete task failed")
-			}
+	if locs, exists := respHeaders["Location"]; exists && len(locs) > 0 {
+		if _, err := client.waitForTrackedTask(ctx, taskShareDelete, name, locs[0]); err != nil {
+			common.Logger(ctx).Error(err)
+			return err
 		}
+	} else {
+		common.Logger(ctx).Errorf("No task returned to monitor")
 	}
 
 	return nil
@@ -943,7 +1059,7 @@ func (client *HammerspaceClient) SnapshotShare(ctx context.Context, shareName st
 	statusCode, respBody, _, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return "", err
 	}
 	if statusCode != 200 {
@@ -953,7 +1069,7 @@ func (client *HammerspaceClient) SnapshotShare(ctx context.Context, shareName st
 	//var snapshotNames []string
 	//err = json.Unmarshal([]byte(respBody), &snapshotNames)
 	//if err != nil {
-	//	log.Error("Error parsing JSON response: " + err.Error())
+	//	common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 	//	return "", err
 	//}
 	// FIXME: currently the API just returns the raw string for the snapshot name
@@ -976,7 +1092,7 @@ func (client *HammerspaceClient) GetShareSnapshots(ctx context.Context, shareNam
 	var snapshotNames []string
 	err = json.Unmarshal([]byte(respBody), &snapshotNames)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 		return []string{}, err
 	}
 	// Need to prune the snapshot name current from the list
@@ -1011,6 +1127,43 @@ func (client *HammerspaceClient) DeleteShareSnapshot(ctx context.Context, shareN
 	}
 }
 
+// RestoreShareSnapshot reverts the content of a share to one of its snapshots. The restore task
+// is tracked, a retried restore waits for the task of the earlier call.
+func (client *HammerspaceClient) RestoreShareSnapshot(ctx context.Context, shareName, snapshotName string) error {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("share.name", shareName),
+		attribute.String("snapshot.name", snapshotName),
+	)
+	if taskLocation := client.trackedTaskLocation(taskShareRestore, shareName); taskLocation != "" {
+		_, err := client.waitForTrackedTask(ctx, taskShareRestore, shareName, taskLocation)
+		return err
+	}
+	req, err := client.generateRequest(ctx, "POST",
+		fmt.Sprintf("/share-snapshots/snapshot-restore/%s/%s",
+			url.PathEscape(shareName), url.PathEscape(snapshotName)), "")
+	if err != nil {
+		common.Logger(ctx).Error(err)
+		return err
+	}
+	statusCode, _, respHeaders, err := client.doRequest(*req)
+	if err != nil {
+		common.Logger(ctx).Error(err)
+		return err
+	}
+	switch statusCode {
+	case 200:
+		return nil
+	case 202:
+		if locs, exists := respHeaders["Location"]; exists && len(locs) > 0 {
+			_, err = client.waitForTrackedTask(ctx, taskShareRestore, shareName, locs[0])
+			return err
+		}
+		common.Logger(ctx).Errorf("No task returned to monitor")
+		return nil
+	}
+	return fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 202)
+}
+
 func (client *HammerspaceClient) GetFileSnapshots(ctx context.Context, filePath string) ([]common.FileSnapshot, error) {
 	req, _ := client.generateRequest(ctx, "GET",
 		fmt.Sprintf("/file-snapshots/list?filename-expression=%s", url.PathEscape(filePath)), "")
@@ -1026,7 +1179,7 @@ func (client *HammerspaceClient) GetFileSnapshots(ctx context.Context, filePath
 	var snapshots []common.FileSnapshot
 	err = json.Unmarshal([]byte(respBody), &snapshots)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 		return []common.FileSnapshot{}, err
 	}
 
@@ -1064,14 +1217,14 @@ func (client *HammerspaceClient) DeleteFileSnapshot(ctx context.Context, filePat
 func (client *HammerspaceClient) SnapshotFile(ctx context.Context, filepath string) (string, error) {
 	req, err := client.generateRequest(ctx, "POST", fmt.Sprintf("/file-snapshots/create?filename-expression=%s", url.PathEscape(filepath)), "")
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return "", err
 	}
 
 	statusCode, respBody, _, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return "", err
 	}
 	if statusCode != 200 {
@@ -1080,27 +1233,40 @@ func (client *HammerspaceClient) SnapshotFile(ctx context.Context, filepath stri
 	var snapshotNames []string
 	err = json.Unmarshal([]byte(respBody), &snapshotNames)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 		return "", err
 	}
 
 	return snapshotNames[0], nil
 }
 
+// RestoreFileSnapToDestination restores the file snapshot at snapshotPath to filePath. A restore
+// that runs as a task is tracked, a retried restore waits for the task of the earlier call.
 func (client *HammerspaceClient) RestoreFileSnapToDestination(ctx context.Context, snapshotPath, filePath string) error {
+	if taskLocation := client.trackedTaskLocation(taskFileRestore, filePath); taskLocation != "" {
+		_, err := client.waitForTrackedTask(ctx, taskFileRestore, filePath, taskLocation)
+		return err
+	}
 	req, err := client.generateRequest(ctx, "POST", fmt.Sprintf("/file-snapshots/%s/%s", url.PathEscape(snapshotPath), url.PathEscape(filePath)), "")
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return err
 	}
 
-	statusCode, _, _, err := client.doRequest(*req)
+	statusCode, _, respHeaders, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return err
 	}
+	if statusCode == 202 {
+		if locs, exists := respHeaders["Location"]; exists && len(locs) > 0 {
+			_, err = client.waitForTrackedTask(ctx, taskFileRestore, filePath, locs[0])
+			return err
+		}
+		return nil
+	}
 	if statusCode != 200 {
 		return fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 200)
 	}
@@ -1110,14 +1276,14 @@ func (client *HammerspaceClient) RestoreFileSnapToDestination(ctx context.Contex
 func (client *HammerspaceClient) GetClusterAvailableCapacity(ctx context.Context) (int64, error) {
 	req, err := client.generateRequest(ctx, "GET", "/cntl/state", "")
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return 0, err
 	}
 
 	statusCode, respBody, _, err := client.doRequest(*req)
 
 	if err != nil {
-		log.Error(err)
+		common.Logger(ctx).Error(err)
 		return 0, err
 	}
 	if statusCode != 200 {
@@ -1127,15 +1293,41 @@ func (client *HammerspaceClient) GetClusterAvailableCapacity(ctx context.Context
 	var cluster common.ClusterResponse
 	err = json.Unmarshal([]byte(respBody), &cluster)
 	if err != nil {
-		log.Error("Error parsing JSON response: " + err.Error())
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
 	}
 	// set free capacity to cache expire in 5 min
-	common.SetCacheData("FREE_CAPACITY", cluster.Capacity["free"], 60*5)
+	common.SetCacheData(client.CacheKey("FREE_CAPACITY"), cluster.Capacity["free"], 60*5)
 
 	free := cluster.Capacity["free"]
 	if err != nil {
-		log.Error("Error parsing free cluster capacity: " + err.Error())
+		common.Logger(ctx).Error("Error parsing free cluster capacity: " + err.Error())
 	}
 
 	return free, nil
 }
+
+// GetClusterName returns the name of the Hammerspace cluster
+func (client *HammerspaceClient) GetClusterName(ctx context.Context) (string, error) {
+	cached, _ := common.GetCacheData(client.CacheKey("CLUSTER_NAME"))
+	if name, ok := cached.(string); ok && name != "" {
+		return name, nil
+	}
+	req, err := client.generateRequest(ctx, "GET", "/cntl/state", "")
+	if err != nil {
+		return "", err
+	}
+	statusCode, respBody, _, err := client.doRequest(*req)
+	if err != nil {
+		return "", err
+	}
+	if statusCode != 200 {
+		return "", fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 200)
+	}
+	var cluster common.Cluster
+	if err := json.Unmarshal([]byte(respBody), &cluster); err != nil {
+		common.Logger(ctx).Error("Error parsing JSON response: " + err.Error())
+		return "", err
+	}
+	common.SetCacheData(client.CacheKey("CLUSTER_NAME"), cluster.Name, 60*5)
+	return cluster.Name, nil
+}
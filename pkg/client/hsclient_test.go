@@ -18,6 +18,7 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -175,7 +176,8 @@ func TestCreateShare(t *testing.T) {
 			"csi_created_by_plugin_name":"%s",
 			"csi_delete_delay": "%d",
 			"csi_created_by_plugin_git_hash":"%s",
-			"csi_created_by_csi_version":"%s"
+			"csi_created_by_csi_version":"%s",
+			"csi_backing_shares_marked":"true"
 		}
 	}`, common.Version, common.CsiPluginName, 1, common.Githash, common.CsiVersion)
 
@@ -220,7 +222,8 @@ func TestCreateShare(t *testing.T) {
 			"csi_created_by_plugin_name":"%s",
 			"csi_delete_delay": "%d",
 			"csi_created_by_plugin_git_hash":"%s",
-			"csi_created_by_csi_version":"%s"
+			"csi_created_by_csi_version":"%s",
+			"csi_backing_shares_marked":"true"
 		},
 		"shareSizeLimit":100
 	}`, common.Version, common.CsiPluginName, 1, common.Githash, common.CsiVersion)
@@ -246,7 +249,8 @@ func TestCreateShare(t *testing.T) {
 			"csi_created_by_plugin_name":"%s",
 			"csi_delete_delay": "%d",
 			"csi_created_by_plugin_git_hash":"%s",
-			"csi_created_by_csi_version":"%s"
+			"csi_created_by_csi_version":"%s",
+			"csi_backing_shares_marked":"true"
 		},
 		"shareSizeLimit":100,
 		"exportOptions":[
@@ -296,7 +300,8 @@ func TestCreateShare(t *testing.T) {
 	    "csi_created_by_plugin_name":"%s",
 	    "csi_delete_delay":"%d",
 	    "csi_created_by_plugin_git_hash":"%s",
-	    "csi_created_by_csi_version":"%s"
+	    "csi_created_by_csi_version":"%s",
+	    "csi_backing_shares_marked":"true"
 	}
 	}`, common.Version, common.CsiPluginName, 1, common.Githash, common.CsiVersion)
 
@@ -308,3 +313,249 @@ func TestCreateShare(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestUpdateShare(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+
+	expectedUpdateShareBody := ""
+	Mux.HandleFunc(BasePath+"/shares/test-client-code", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(200)
+			_, _ = io.WriteString(w, FakeShare1)
+		case "PUT":
+			bodyString, _ := io.ReadAll(r.Body)
+			var body map[string]interface{}
+			_ = json.Unmarshal(bodyString, &body)
+			actual, _ := json.Marshal(map[string]interface{}{
+				"comment":       body["comment"],
+				"exportOptions": body["exportOptions"],
+			})
+			testutils.AssertEqualJSON(t, string(actual), expectedUpdateShareBody)
+			w.Header().Set("Location", "http://fake_location/tasks/99184048-9390-4e68-92b8-d3ce6413372d")
+			w.WriteHeader(202)
+		}
+	})
+	Mux.HandleFunc(BasePath+"/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		_, _ = io.WriteString(w, FakeTaskCompleted)
+	})
+
+	// Only the comment changes, export options are kept as they are
+	expectedUpdateShareBody = `{
+		"comment":"new comment",
+		"exportOptions":[{"id":11,"subnet":"*","accessPermissions":"RW","rootSquash":false}]
+	}`
+	comment := "new comment"
+	err := hsclient.UpdateShare(context.Background(), "test-client-code", &comment, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Only the export options change, the comment is kept as it is
+	expectedUpdateShareBody = `{
+		"comment":null,
+		"exportOptions":[{"subnet":"10.0.0.0/8","accessPermissions":"RO","rootSquash":true}]
+	}`
+	err = hsclient.UpdateShare(context.Background(), "test-client-code", nil, []common.ShareExportOptions{
+		{
+			Subnet:            "10.0.0.0/8",
+			AccessPermissions: "RO",
+			RootSquash:        true,
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateShareExtendedInfo(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+
+	expectedExtendedInfo := ""
+	Mux.HandleFunc(BasePath+"/shares/test-client-code", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(200)
+			_, _ = io.WriteString(w, FakeShare1)
+		case "PUT":
+			bodyString, _ := io.ReadAll(r.Body)
+			var body map[string]interface{}
+			_ = json.Unmarshal(bodyString, &body)
+			actual, _ := json.Marshal(body["extendedInfo"])
+			testutils.AssertEqualJSON(t, string(actual), expectedExtendedInfo)
+			w.Header().Set("Location", "http://fake_location/tasks/99184048-9390-4e68-92b8-d3ce6413372d")
+			w.WriteHeader(202)
+		}
+	})
+	Mux.HandleFunc(BasePath+"/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		_, _ = io.WriteString(w, FakeTaskCompleted)
+	})
+
+	// New keys are added, keys with an empty value are removed, others are kept
+	expectedExtendedInfo = `{
+		"csi_created_by_plugin_version": "test_version",
+		"csi_created_by_plugin_name": "test_plugin",
+		"csi_created_by_plugin_git_hash": "",
+		"csi_created_by_csi_version": "1",
+		"csi_snapshot_snap1": "2019-05-24T15-26-57-0|/test-client-code"
+	}`
+	err := hsclient.UpdateShareExtendedInfo(context.Background(), "test-client-code", map[string]string{
+		"csi_snapshot_snap1": "2019-05-24T15-26-57-0|/test-client-code",
+		"csi_delayed_delete": "",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShareSnapshotSchedule(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+
+	var share map[string]interface{}
+	_ = json.Unmarshal([]byte(FakeShare1), &share)
+	share["snapshotSchedules"] = []map[string]interface{}{
+		{"name": "nightly", "frequency": "daily", "retention": 30},
+		{"name": common.SnapshotScheduleName, "frequency": "weekly"},
+	}
+	shareWithSchedules, _ := json.Marshal(share)
+
+	expectedSchedules := ""
+	Mux.HandleFunc(BasePath+"/shares/test-client-code", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(200)
+			_, _ = w.Write(shareWithSchedules)
+		case "PUT":
+			bodyString, _ := io.ReadAll(r.Body)
+			var body map[string]interface{}
+			_ = json.Unmarshal(bodyString, &body)
+			actual, _ := json.Marshal(body["snapshotSchedules"])
+			testutils.AssertEqualJSON(t, string(actual), expectedSchedules)
+			w.Header().Set("Location", "http://fake_location/tasks/99184048-9390-4e68-92b8-d3ce6413372d")
+			w.WriteHeader(202)
+		}
+	})
+	Mux.HandleFunc(BasePath+"/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		_, _ = io.WriteString(w, FakeTaskCompleted)
+	})
+
+	// The schedule of the same name is replaced, other schedules are kept
+	expectedSchedules = `[
+		{"name": "nightly", "frequency": "daily", "retention": 30},
+		{"name": "csi-snapshot-schedule", "frequency": "hourly", "retention": 24}
+	]`
+	err := hsclient.SetShareSnapshotSchedule(context.Background(), "test-client-code", common.ShareSnapshotSchedule{
+		Name:      common.SnapshotScheduleName,
+		Frequency: "hourly",
+		Retention: 24,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectedSchedules = `[{"name": "nightly", "frequency": "daily", "retention": 30}]`
+	err = hsclient.RemoveShareSnapshotSchedule(context.Background(), "test-client-code", common.SnapshotScheduleName)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListSnapshots(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+
+	Mux.HandleFunc(BasePath+"/shares", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, fmt.Sprintf("[%s,%s]", FakeShareRoot, FakeShare1))
+	})
+	Mux.HandleFunc(BasePath+"/shares/test-client-code", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, FakeShare1)
+	})
+	fileRequests := 0
+	Mux.HandleFunc(BasePath+"/files", func(w http.ResponseWriter, r *http.Request) {
+		fileRequests++
+		if r.URL.Query().Get("path") != "/test-client-code/.snapshot/" {
+			_, _ = io.WriteString(w, `{"name": ".snapshot", "children": []}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"name": ".snapshot", "children": [
+			{"name": "current"},
+			{"name": "2019-05-24T15-26-58-0", "createTime": 1558711618},
+			{"name": "2019-05-24T15-26-57-0", "createTime": 1558711617}
+		]}`)
+	})
+
+	snapshots, err := hsclient.ListSnapshots(context.Background(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []common.SnapshotResponse{
+		{
+			Id:             "2019-05-24T15-26-57-0|/test-client-code",
+			Created:        1558711617,
+			ReadyToUse:     true,
+			SourceVolumeId: "/test-client-code",
+		},
+		{
+			Id:             "2019-05-24T15-26-58-0|/test-client-code",
+			Created:        1558711618,
+			ReadyToUse:     true,
+			SourceVolumeId: "/test-client-code",
+		},
+	}
+	if !reflect.DeepEqual(snapshots, expected) {
+		t.Logf("Expected: %v", expected)
+		t.Logf("Actual: %v", snapshots)
+		t.FailNow()
+	}
+
+	if fileRequests != 2 {
+		t.Errorf("Expected the snapshot directory of each share to be read once, got %d file requests", fileRequests)
+	}
+
+	snapshots, err = hsclient.ListSnapshots(context.Background(), "2019-05-24T15-26-58-0|/test-client-code", "")
+	if err != nil || len(snapshots) != 1 || snapshots[0].Id != "2019-05-24T15-26-58-0|/test-client-code" {
+		t.Errorf("Expected a single snapshot, got %v, %v", snapshots, err)
+	}
+
+	snapshots, err = hsclient.ListSnapshots(context.Background(), "", "/test-client-code")
+	if err != nil || len(snapshots) != 2 {
+		t.Errorf("Expected the snapshots of /test-client-code, got %v, %v", snapshots, err)
+	}
+}
+
+func TestRestoreShareSnapshot(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+
+	restores := 0
+	Mux.HandleFunc(BasePath+"/share-snapshots/snapshot-restore/test-client-code/2019-05-24T15-26-57-0", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected a POST, got %s", r.Method)
+		}
+		restores++
+		w.Header().Set("Location", "http://fake_location/tasks/99184048-9390-4e68-92b8-d3ce6413372d")
+		w.WriteHeader(202)
+	})
+	Mux.HandleFunc(BasePath+"/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, FakeTaskCompleted)
+	})
+
+	err := hsclient.RestoreShareSnapshot(context.Background(), "test-client-code", "2019-05-24T15-26-57-0")
+	if err != nil {
+		t.Error(err)
+	}
+	if restores != 1 {
+		t.Errorf("Expected one restore request, got %d", restores)
+	}
+
+	err = hsclient.RestoreShareSnapshot(context.Background(), "test-client-code", "missing")
+	if err == nil {
+		t.Error("Expected an error for a missing snapshot")
+	}
+}
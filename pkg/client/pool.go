@@ -0,0 +1,130 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Keys of the CSI secrets used to select Hammerspace credentials
+const (
+	SecretEndpoint  = "endpoint"
+	SecretUsername  = "username"
+	SecretPassword  = "password"
+	SecretTLSVerify = "tlsVerify"
+)
+
+// Credentials identify a Hammerspace API gateway and the user to log in as
+type Credentials struct {
+	Endpoint  string
+	Username  string
+	Password  string
+	TLSVerify bool
+	// Site reported in the topology of volumes on this cluster, not used to log in
+	Site string
+}
+
+// ClientPool keeps one logged-in client per Hammerspace endpoint and user. Requests without
+// credentials use the default client configured from the environment.
+type ClientPool struct {
+	lock          sync.Mutex
+	defaultClient Client
+	clients       map[string]*HammerspaceClient
+	// creates and logs in new clients, replaced in tests
+	newClient func(endpoint, username, password string, tlsVerify bool) (*HammerspaceClient, error)
+}
+
+func NewClientPool(defaultClient Client) *ClientPool {
+	return &ClientPool{
+		defaultClient: defaultClient,
+		clients:       map[string]*HammerspaceClient{},
+		newClient:     NewHammerspaceClient,
+	}
+}
+
+// Default returns the client configured from the environment
+func (p *ClientPool) Default() Client {
+	return p.defaultClient
+}
+
+// CredentialsFromSecrets reads Hammerspace credentials from the secrets of a CSI request.
+// Returns nil if the secrets do not contain credentials. The endpoint and TLS verification
+// default to those of the defaults client.
+func CredentialsFromSecrets(secrets map[string]string, defaults Client) (*Credentials, error) {
+	username, password := secrets[SecretUsername], secrets[SecretPassword]
+	if username == "" && password == "" {
+		return nil, nil
+	}
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("secrets must contain both %s and %s", SecretUsername, SecretPassword)
+	}
+
+	creds := &Credentials{
+		Endpoint: secrets[SecretEndpoint],
+		Username: username,
+		Password: password,
+	}
+	if defaults != nil {
+		// only clients logging in over REST verify certificates
+		if hsclient, ok := defaults.(*HammerspaceClient); ok {
+			creds.TLSVerify = hsclient.tlsVerify
+		}
+		if creds.Endpoint == "" {
+			creds.Endpoint = defaults.Endpoint()
+		}
+	}
+	if creds.Endpoint == "" {
+		return nil, fmt.Errorf("secrets must contain %s", SecretEndpoint)
+	}
+	if value, exists := secrets[SecretTLSVerify]; exists {
+		tlsVerify, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s secret must be a bool, received '%s'", SecretTLSVerify, value)
+		}
+		creds.TLSVerify = tlsVerify
+	}
+	return creds, nil
+}
+
+// Get returns a logged-in client for the credentials, creating it on first use.
+// A nil value returns the default client.
+func (p *ClientPool) Get(creds *Credentials) (Client, error) {
+	if creds == nil {
+		return p.defaultClient, nil
+	}
+	key := creds.Endpoint + "|" + creds.Username
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	client, exists := p.clients[key]
+	if exists && client.password == creds.Password && client.tlsVerify == creds.TLSVerify {
+		return client, nil
+	}
+
+	log.Infof("creating Hammerspace client for %s as user %s", creds.Endpoint, creds.Username)
+	client, err := p.newClient(creds.Endpoint, creds.Username, creds.Password, creds.TLSVerify)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[key] = client
+	return client, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCredentialsFromSecrets(t *testing.T) {
+	defaults := &HammerspaceClient{endpoint: "https://default.example.com", tlsVerify: true}
+
+	creds, err := CredentialsFromSecrets(map[string]string{}, defaults)
+	if err != nil || creds != nil {
+		t.Errorf("Expected no credentials for empty secrets, got %v, %v", creds, err)
+	}
+
+	// endpoint and TLS verification default to the default client
+	creds, err = CredentialsFromSecrets(map[string]string{"username": "tenant", "password": "secret"}, defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	expected := &Credentials{Endpoint: "https://default.example.com", Username: "tenant", Password: "secret", TLSVerify: true}
+	if !reflect.DeepEqual(creds, expected) {
+		t.Errorf("Expected: %v", expected)
+		t.Errorf("Actual: %v", creds)
+	}
+
+	creds, err = CredentialsFromSecrets(map[string]string{
+		"endpoint": "https://other.example.com", "username": "tenant", "password": "secret", "tlsVerify": "false",
+	}, defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	expected = &Credentials{Endpoint: "https://other.example.com", Username: "tenant", Password: "secret", TLSVerify: false}
+	if !reflect.DeepEqual(creds, expected) {
+		t.Errorf("Expected: %v", expected)
+		t.Errorf("Actual: %v", creds)
+	}
+
+	if _, err = CredentialsFromSecrets(map[string]string{"username": "tenant"}, defaults); err == nil {
+		t.Errorf("Expected error for missing password")
+	}
+	if _, err = CredentialsFromSecrets(map[string]string{"username": "tenant", "password": "secret", "tlsVerify": "maybe"}, defaults); err == nil {
+		t.Errorf("Expected error for invalid tlsVerify")
+	}
+}
+
+func TestClientPoolGet(t *testing.T) {
+	defaultClient := &HammerspaceClient{endpoint: "https://default.example.com"}
+	pool := NewClientPool(defaultClient)
+	logins := 0
+	pool.newClient = func(endpoint, username, password string, tlsVerify bool) (*HammerspaceClient, error) {
+		logins++
+		if password == "wrong" {
+			return nil, errors.New("failed to login to Hammerspace Anvil")
+		}
+		return &HammerspaceClient{endpoint: endpoint, username: username, password: password, tlsVerify: tlsVerify}, nil
+	}
+
+	client, err := pool.Get(nil)
+	if err != nil || client != defaultClient {
+		t.Errorf("Expected default client without credentials")
+	}
+
+	creds := &Credentials{Endpoint: "https://other.example.com", Username: "tenant", Password: "secret"}
+	first, err := pool.Get(creds)
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	second, _ := pool.Get(creds)
+	if first != second || logins != 1 {
+		t.Errorf("Expected client to be reused, logins %d", logins)
+	}
+
+	// a changed password logs in again
+	third, _ := pool.Get(&Credentials{Endpoint: "https://other.example.com", Username: "tenant", Password: "rotated"})
+	if third == first || logins != 2 {
+		t.Errorf("Expected new client after password change, logins %d", logins)
+	}
+
+	if _, err = pool.Get(&Credentials{Endpoint: "https://other.example.com", Username: "tenant", Password: "wrong"}); err == nil {
+		t.Errorf("Expected login error")
+	}
+	// failed logins are not cached
+	fourth, _ := pool.Get(&Credentials{Endpoint: "https://other.example.com", Username: "tenant", Password: "rotated"})
+	if fourth != third {
+		t.Errorf("Expected previous client to remain after failed login")
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+// circuitBreaker fails requests fast while the Hammerspace API is unreachable. After the threshold
+// of consecutive failures it opens for the cooldown, then lets one request through to try again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trying    bool // a request is trying the API after the cooldown
+}
+
+// allow reports whether a request may be sent and, if not, how long the breaker stays open
+func (cb *circuitBreaker) allow(threshold int) (bool, time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if threshold == 0 || cb.failures < threshold {
+		return true, 0
+	}
+	if wait := time.Until(cb.openUntil); wait > 0 {
+		return false, wait
+	}
+	if cb.trying {
+		return false, 0
+	}
+	cb.trying = true
+	return true, 0
+}
+
+// record counts the outcome of a request that was allowed
+func (cb *circuitBreaker) record(failed bool, threshold int, cooldown time.Duration, endpoint string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.trying = false
+	if !failed {
+		if threshold > 0 && cb.failures >= threshold {
+			log.Infof("Hammerspace API at %s is reachable again", endpoint)
+		}
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if threshold > 0 && cb.failures >= threshold {
+		if cb.failures == threshold {
+			log.Errorf("Hammerspace API at %s failed %d times in a row, failing requests for %s", endpoint, cb.failures, cooldown)
+		}
+		cb.openUntil = time.Now().Add(cooldown)
+	}
+}
+
+// abandon releases a request that was allowed but ended without an outcome, ex. it was cancelled
+func (cb *circuitBreaker) abandon() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.trying = false
+}
+
+// send sends req unless the circuit breaker is open, and records whether the API was reachable
+func (client *HammerspaceClient) send(req *http.Request) (*http.Response, error) {
+	cfg := common.GetConfig()
+	if ok, wait := client.breaker.allow(cfg.RestCircuitBreakerThreshold); !ok {
+		return nil, status.Errorf(codes.Unavailable, common.HammerspaceUnavailable, client.endpoint, wait.Round(time.Second))
+	}
+	resp, err := client.httpclient.Do(req)
+	if req.Context().Err() != nil {
+		client.breaker.abandon()
+		return resp, err
+	}
+	failed := err != nil || isUnavailableStatus(resp.StatusCode)
+	client.breaker.record(failed, cfg.RestCircuitBreakerThreshold, cfg.RestCircuitBreakerCooldown, client.endpoint)
+	return resp, err
+}
+
+// isUnavailableStatus reports whether the status code means the API could not serve the request
+func isUnavailableStatus(statusCode int) bool {
+	return statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
+
+// isIdempotent reports whether a request with method can be sent again after an unknown outcome
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// shouldRetry reports whether a request should be sent again after statusCode or err, and the
+// delay asked by the API with Retry-After. Requests that were not processed, a refused connection
+// or 429, are retried for every method, other transient failures only for idempotent methods.
+func shouldRetry(method string, statusCode int, headers http.Header, err error) (bool, time.Duration) {
+	if err != nil {
+		// the circuit breaker is open
+		if status.Code(err) == codes.Unavailable {
+			return false, 0
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return true, 0
+		}
+		return isIdempotent(method), 0
+	}
+	if statusCode == http.StatusTooManyRequests {
+		return true, retryAfter(headers)
+	}
+	if statusCode >= 500 && isIdempotent(method) {
+		return true, retryAfter(headers)
+	}
+	return false, 0
+}
+
+// retryAfter parses the Retry-After header, in seconds or as an HTTP date
+func retryAfter(headers http.Header) time.Duration {
+	value := headers.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	common "github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+// setRetryConfig shortens the retry intervals for the duration of a test
+func setRetryConfig(t *testing.T, retries, threshold int, cooldown time.Duration) {
+	cfg := *common.DefaultPluginConfig()
+	cfg.RestRetryCount = retries
+	cfg.RestRetryMinInterval = time.Millisecond
+	cfg.RestRetryMaxInterval = 10 * time.Millisecond
+	cfg.RestCircuitBreakerThreshold = threshold
+	cfg.RestCircuitBreakerCooldown = cooldown
+	common.SetConfig(&cfg)
+	t.Cleanup(func() { common.SetConfig(common.DefaultPluginConfig()) })
+}
+
+func TestDoRequestRetry(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+	setRetryConfig(t, 3, 0, time.Second)
+
+	var attempts atomic.Int32
+	var bodies []string
+	Mux.HandleFunc(BasePath+"/flaky", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	Mux.HandleFunc(BasePath+"/failing", func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	Mux.HandleFunc(BasePath+"/throttled", func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	// idempotent requests are retried until they succeed, with their body
+	req, _ := hsclient.generateRequest(context.Background(), "PUT", "/flaky", "payload")
+	statusCode, _, _, err := hsclient.doRequest(*req)
+	if err != nil || statusCode != http.StatusOK || attempts.Load() != 3 {
+		t.Fatalf("expected success after 3 attempts, got status %d, error %v, attempts %d", statusCode, err, attempts.Load())
+	}
+	for _, body := range bodies {
+		if body != "payload" {
+			t.Fatalf("expected every attempt to send the body, got %v", bodies)
+		}
+	}
+
+	// idempotent requests give up after the retries
+	attempts.Store(0)
+	req, _ = hsclient.generateRequest(context.Background(), "GET", "/failing", "")
+	statusCode, _, _, _ = hsclient.doRequest(*req)
+	if statusCode != http.StatusInternalServerError || attempts.Load() != 4 {
+		t.Fatalf("expected 4 attempts, got status %d, attempts %d", statusCode, attempts.Load())
+	}
+
+	// POST is not retried after a server error
+	attempts.Store(0)
+	req, _ = hsclient.generateRequest(context.Background(), "POST", "/failing", "")
+	hsclient.doRequest(*req)
+	if attempts.Load() != 1 {
+		t.Fatalf("expected a single POST attempt, got %d", attempts.Load())
+	}
+
+	// Retry-After longer than the maximum interval is not waited for
+	attempts.Store(0)
+	req, _ = hsclient.generateRequest(context.Background(), "POST", "/throttled", "")
+	statusCode, _, _, _ = hsclient.doRequest(*req)
+	if statusCode != http.StatusTooManyRequests || attempts.Load() != 1 {
+		t.Fatalf("expected a single attempt, got status %d, attempts %d", statusCode, attempts.Load())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+	setRetryConfig(t, 0, 2, 50*time.Millisecond)
+
+	var attempts atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	Mux.HandleFunc(BasePath+"/anvil", func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	send := func() (int, error) {
+		req, _ := hsclient.generateRequest(context.Background(), "GET", "/anvil", "")
+		statusCode, _, _, err := hsclient.doRequest(*req)
+		return statusCode, err
+	}
+
+	send()
+	send()
+	if _, err := send(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the open breaker to fail with Unavailable, got %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Fatalf("expected the open breaker not to send requests, got %d attempts", attempts.Load())
+	}
+
+	// after the cooldown one request tries the API again and closes the breaker
+	down.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if statusCode, err := send(); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("expected the API to be tried after the cooldown, got status %d, error %v", statusCode, err)
+	}
+	if statusCode, err := send(); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("expected the breaker to be closed, got status %d, error %v", statusCode, err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"":        0,
+		"5":       5 * time.Second,
+		"invalid": 0,
+		time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat): 0,
+	} {
+		headers := http.Header{}
+		headers.Set("Retry-After", value)
+		if actual := retryAfter(headers); actual != expected {
+			t.Errorf("Retry-After %q: expected %s, got %s", value, expected, actual)
+		}
+	}
+}
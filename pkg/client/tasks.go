@@ -0,0 +1,273 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jpillora/backoff"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
+)
+
+// Terminal statuses of Hammerspace tasks, tasks in any other status are still running
+const (
+	TaskStatusCompleted = "COMPLETED"
+	TaskStatusFailed    = "FAILED"
+	TaskStatusHalted    = "HALTED"
+	TaskStatusCancelled = "CANCELLED"
+)
+
+// Operations whose tasks are tracked across calls
+const (
+	taskShareCreate  = "share-create"
+	taskShareUpdate  = "share-update"
+	taskShareResize  = "share-resize"
+	taskShareDelete  = "share-delete"
+	taskShareRestore = "share-restore"
+	taskFileRestore  = "file-restore"
+)
+
+// trackedTask is a Hammerspace task the plugin waits for and has not seen end yet
+type trackedTask struct {
+	location string
+	started  time.Time
+	// adopted tasks were not started by the plugin, ex. they were started before it restarted
+	adopted bool
+}
+
+// taskTracker remembers the tasks started for an operation on a resource of a cluster. A call
+// that stops waiting for a task fails with Aborted, and its retry waits for the same task
+// instead of starting another one.
+type taskTracker struct {
+	mu    sync.Mutex
+	tasks map[string]trackedTask
+}
+
+var tasks = &taskTracker{tasks: map[string]trackedTask{}}
+
+// track records the task at location, keeping the start time when it is already tracked
+func (t *taskTracker) track(key, location string) trackedTask {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	task, exists := t.tasks[key]
+	if !exists || task.location != location {
+		task = trackedTask{location: location, started: time.Now()}
+		t.tasks[key] = task
+	}
+	return task
+}
+
+// adopt records the task at location as one the plugin did not start
+func (t *taskTracker) adopt(key, location string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tasks[key] = trackedTask{location: location, started: time.Now(), adopted: true}
+}
+
+func (t *taskTracker) get(key string) (trackedTask, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	task, exists := t.tasks[key]
+	return task, exists
+}
+
+func (t *taskTracker) forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tasks, key)
+}
+
+func (client *HammerspaceClient) taskKey(operation, resource string) string {
+	return client.CacheKey(operation + ":" + resource)
+}
+
+// trackedTaskLocation returns the location of the task running for operation on resource,
+// or an empty string
+func (client *HammerspaceClient) trackedTaskLocation(operation, resource string) string {
+	task, _ := tasks.get(client.taskKey(operation, resource))
+	return task.location
+}
+
+// ShareCreateTracked reports whether the task creating shareName is tracked, the retried
+// CreateShare then waits for it instead of starting another
+func (client *HammerspaceClient) ShareCreateTracked(shareName string) bool {
+	return client.trackedTaskLocation(taskShareCreate, shareName) != ""
+}
+
+// waitForTrackedTask waits for the task at taskLocation, started for operation on resource.
+// A task still running after taskWaitTimeout stays tracked and the call fails with Aborted.
+// The task is returned once it ended, with an error unless it completed.
+func (client *HammerspaceClient) waitForTrackedTask(ctx context.Context, operation, resource, taskLocation string) (*common.Task, error) {
+	key := client.taskKey(operation, resource)
+	tracked := tasks.track(key, taskLocation)
+	task, err := client.pollTask(ctx, taskLocation, tracked.started)
+	if status.Code(err) == codes.Aborted {
+		return nil, err
+	}
+	tasks.forget(key)
+	if err != nil {
+		return nil, err
+	}
+	return task, taskError(task)
+}
+
+// WaitForTaskCompletion waits for the task at taskLocation, failing with Aborted if it is still
+// running after taskWaitTimeout, or with the gRPC code of the status it ended in
+func (client *HammerspaceClient) WaitForTaskCompletion(ctx context.Context, taskLocation string) error {
+	task, err := client.pollTask(ctx, taskLocation, time.Now())
+	if err != nil {
+		return err
+	}
+	return taskError(task)
+}
+
+// pollTask polls the task at taskLocation until it ends, ctx is done or taskWaitTimeout passed.
+// Tasks running for longer than taskPollTimeout since started fail with DeadlineExceeded.
+func (client *HammerspaceClient) pollTask(ctx context.Context, taskLocation string, started time.Time) (*common.Task, error) {
+	b := &backoff.Backoff{
+		Max:    taskPollIntervalCap,
+		Factor: 1.5,
+		Jitter: true,
+	}
+	taskUrl, err := url.Parse(taskLocation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid task location '%s': %v", taskLocation, err)
+	}
+	taskId := path.Base(taskUrl.Path)
+	startTime := time.Now()
+	result := "error"
+	defer func() { metrics.ObserveTaskWait(result, time.Since(startTime)) }()
+
+	waitCtx, cancel := context.WithTimeout(ctx, common.GetConfig().TaskWaitTimeout)
+	defer cancel()
+
+	task := &common.Task{Uuid: taskId}
+	// The progress is only exported while the plugin waits for the task
+	defer func() { metrics.ClearTaskProgress(task.Action, task.Uuid) }()
+	for {
+		select {
+		case <-waitCtx.Done():
+			result = "running"
+			return nil, status.Errorf(codes.Aborted, common.TaskStillRunning, task.Uuid, task.Action, task.Progress.Percentage())
+		case <-time.After(b.Duration()):
+		}
+
+		req, err := client.generateRequest(ctx, "GET", "/tasks/"+url.PathEscape(taskId), "")
+		if err != nil {
+			return nil, err
+		}
+		statusCode, respBody, _, err := client.doRequest(*req)
+		if err != nil {
+			if waitCtx.Err() != nil {
+				continue
+			}
+			return nil, err
+		}
+		if statusCode != 200 {
+			return nil, fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 200)
+		}
+		if err := json.Unmarshal([]byte(respBody), task); err != nil {
+			return nil, fmt.Errorf("invalid task %s: %v", taskId, err)
+		}
+
+		taskLog := common.Logger(ctx).WithFields(log.Fields{
+			"task_id":     task.Uuid,
+			"task_action": task.Action,
+			"task_status": task.Status,
+			"progress":    task.Progress.Percentage(),
+		})
+		if isTerminalTaskStatus(task.Status) {
+			result = strings.ToLower(task.Status)
+			taskLog.Infof("task ended after %s", time.Since(started).Round(time.Second))
+			return task, nil
+		}
+		metrics.SetTaskProgress(task.Action, task.Uuid, float64(task.Progress))
+		taskLog.Debug("task is running")
+
+		if time.Since(started) > taskPollTimeout {
+			result = "timeout"
+			return nil, status.Errorf(codes.DeadlineExceeded, common.TaskTimedOut, task.Uuid, task.Action, taskPollTimeout, task.Status)
+		}
+	}
+}
+
+func isTerminalTaskStatus(taskStatus string) bool {
+	switch taskStatus {
+	case TaskStatusCompleted, TaskStatusFailed, TaskStatusHalted, TaskStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// taskError returns the error of a task that ended, nil if it completed
+func taskError(task *common.Task) error {
+	switch task.Status {
+	case TaskStatusCompleted:
+		return nil
+	case TaskStatusHalted:
+		return status.Errorf(codes.Unavailable, common.TaskHalted, task.Uuid, task.Action, task.StatusMessage)
+	case TaskStatusCancelled:
+		return status.Errorf(codes.Aborted, common.TaskCancelled, task.Uuid, task.Action, task.StatusMessage)
+	default:
+		return status.Errorf(codes.Internal, common.TaskFailed, task.Uuid, task.Action, task.StatusMessage)
+	}
+}
+
+// runningShareCreateTask returns the task creating the share name, or nil if there is none
+func (client *HammerspaceClient) runningShareCreateTask(ctx context.Context, shareName string) (*common.Task, error) {
+	req, err := client.generateRequest(ctx, "GET", "/tasks", "")
+	if err != nil {
+		common.Logger(ctx).Error("Failed to generate request object")
+		return nil, err
+	}
+	statusCode, respBody, _, err := client.doRequest(*req)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != 200 {
+		return nil, fmt.Errorf(common.UnexpectedHSStatusCode, statusCode, 200)
+	}
+	var hsTasks []common.Task
+	err = json.Unmarshal([]byte(respBody), &hsTasks)
+	if err != nil {
+		common.Logger(ctx).Error(err)
+		return nil, nil
+	}
+	for i, task := range hsTasks {
+		if task.Status == "EXECUTING" && task.ParamsMap.Name == shareName {
+			return &hsTasks[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (client *HammerspaceClient) CheckIfShareCreateTaskIsRunning(ctx context.Context, shareName string) (bool, error) {
+	task, err := client.runningShareCreateTask(ctx, shareName)
+	return task != nil, err
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	common "github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+const fakeTaskLocation = "http://fake_location/tasks/99184048-9390-4e68-92b8-d3ce6413372d"
+
+// setTaskWaitTimeout shortens the wait for tasks for the duration of a test
+func setTaskWaitTimeout(t *testing.T, timeout time.Duration) {
+	cfg := *common.DefaultPluginConfig()
+	cfg.TaskWaitTimeout = timeout
+	common.SetConfig(&cfg)
+	t.Cleanup(func() { common.SetConfig(common.DefaultPluginConfig()) })
+}
+
+func fakeTask(taskStatus string) string {
+	return fmt.Sprintf(`{
+		"uuid": "99184048-9390-4e68-92b8-d3ce6413372d",
+		"name": "share-create",
+		"status": "%s",
+		"progress": 0.4,
+		"statusMessage": "%s"
+	}`, taskStatus, taskStatus)
+}
+
+func TestWaitForTaskCompletion(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+	setTaskWaitTimeout(t, 500*time.Millisecond)
+
+	var taskResponse atomic.Value
+	Mux.HandleFunc(BasePath+"/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, taskResponse.Load().(string))
+	})
+
+	cases := map[string]codes.Code{
+		FakeTaskCompleted:             codes.OK,
+		FakeTaskFailed:                codes.Internal,
+		fakeTask(TaskStatusHalted):    codes.Unavailable,
+		fakeTask(TaskStatusCancelled): codes.Aborted,
+		fakeTask("EXECUTING"):         codes.Aborted,
+	}
+	for response, expected := range cases {
+		taskResponse.Store(response)
+		err := hsclient.WaitForTaskCompletion(context.Background(), fakeTaskLocation)
+		if status.Code(err) != expected {
+			t.Errorf("Expected %s for task %s, got %v", expected, response, err)
+		}
+	}
+}
+
+func TestCreateShareWaitsForTrackedTask(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+	setTaskWaitTimeout(t, 300*time.Millisecond)
+
+	var creates int32
+	Mux.HandleFunc(BasePath+"/shares", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&creates, 1)
+		w.Header().Set("Location", fakeTaskLocation)
+		w.WriteHeader(202)
+	})
+	var taskResponse atomic.Value
+	taskResponse.Store(fakeTask("EXECUTING"))
+	Mux.HandleFunc(BasePath+"/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, taskResponse.Load().(string))
+	})
+
+	// The task is still running when the wait times out
+	err := hsclient.CreateShare(context.Background(), "tracked", "/tracked", -1, nil, nil, -1, "")
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("Expected Aborted while the task is running, got %v", err)
+	}
+	if !hsclient.ShareCreateTracked("tracked") {
+		t.Fatal("Expected the share create task to be tracked")
+	}
+
+	// The retry waits for the same task instead of creating the share again
+	taskResponse.Store(FakeTaskCompleted)
+	err = hsclient.CreateShare(context.Background(), "tracked", "/tracked", -1, nil, nil, -1, "")
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if creates != 1 {
+		t.Errorf("Expected the share to be created once, got %d requests", creates)
+	}
+	if hsclient.ShareCreateTracked("tracked") {
+		t.Error("Expected the completed task to be forgotten")
+	}
+}
+
+func TestCreateShareTaskFailed(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+	setTaskWaitTimeout(t, time.Second)
+
+	var deletes int32
+	Mux.HandleFunc(BasePath+"/shares", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", fakeTaskLocation)
+		w.WriteHeader(202)
+	})
+	Mux.HandleFunc(BasePath+"/shares/failed", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			atomic.AddInt32(&deletes, 1)
+		}
+		w.WriteHeader(200)
+	})
+	Mux.HandleFunc(BasePath+"/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, FakeTaskFailed)
+	})
+
+	err := hsclient.CreateShare(context.Background(), "failed", "/failed", -1, nil, nil, -1, "")
+	if status.Code(err) != codes.Internal {
+		t.Errorf("Expected Internal for a failed task, got %v", err)
+	}
+	if deletes != 1 {
+		t.Errorf("Expected the share of the failed task to be deleted, got %d requests", deletes)
+	}
+	if hsclient.ShareCreateTracked("failed") {
+		t.Error("Expected the failed task to be forgotten")
+	}
+}
+
+func TestCreateShareAdoptedTaskFailed(t *testing.T) {
+	setupHTTP()
+	defer tearDownHTTP()
+	setTaskWaitTimeout(t, time.Second)
+
+	var deletes int32
+	Mux.HandleFunc(BasePath+"/shares", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	})
+	Mux.HandleFunc(BasePath+"/shares/adopted", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			atomic.AddInt32(&deletes, 1)
+		}
+		w.WriteHeader(200)
+	})
+	Mux.HandleFunc(BasePath+"/tasks", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `[{
+			"uuid": "99184048-9390-4e68-92b8-d3ce6413372d",
+			"name": "share-create",
+			"status": "EXECUTING",
+			"paramsMap": {"name": "adopted"}
+		}]`)
+	})
+	Mux.HandleFunc(BasePath+"/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, FakeTaskFailed)
+	})
+
+	// The share may belong to whoever started the task, so it is not deleted
+	err := hsclient.CreateShare(context.Background(), "adopted", "/adopted", -1, nil, nil, -1, "")
+	if status.Code(err) != codes.Internal {
+		t.Errorf("Expected Internal for a failed task, got %v", err)
+	}
+	if deletes != 0 {
+		t.Errorf("Expected the share of a task the plugin did not start to be kept, got %d requests", deletes)
+	}
+	if hsclient.ShareCreateTracked("adopted") {
+		t.Error("Expected the failed task to be forgotten")
+	}
+}
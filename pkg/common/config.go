@@ -16,10 +16,6 @@ limitations under the License.
 
 package common
 
-import (
-	"time"
-)
-
 const (
 	CsiPluginName = "com.hammerspace.csi"
 
@@ -29,9 +25,52 @@ const (
 	SharePathPrefix             = "/"
 	DefaultBackingFileSizeBytes = 1073741824
 	DefaultVolumeNameFormat     = "%s"
+	// Longest share name Hammerspace accepts
+	MaxShareNameLength = 80
+
+	// Services served by the plugin, selected with --mode
+	ModeController = "controller"
+	ModeNode       = "node"
+	ModeAll        = "all"
 
 	// Topology keys
 	TopologyKeyDataPortal = "topology.csi.hammerspace.com/is-data-portal"
+	TopologyKeySite       = "topology.csi.hammerspace.com/site"
+	TopologyKeyCluster    = "topology.csi.hammerspace.com/cluster"
+	TopologyKeyZone       = "topology.csi.hammerspace.com/zone"
+
+	// Prefix of the share extended info keys recording the Hammerspace snapshot created for a CSI snapshot name
+	SnapshotRecordPrefix = "csi_snapshot_"
+	// Prefix of the share extended info keys recording the member snapshots of a CSI group snapshot
+	GroupSnapshotRecordPrefix = "csi_group_snapshot_"
+	// Prefix of group snapshot IDs, followed by the CSI group snapshot name
+	GroupSnapshotIDPrefix = "group|"
+	// Prefix of the backing share extended info keys recording the size of each volume created inside it
+	VolumeRecordPrefix = "csi_volume_"
+	// Backing share extended info key marking a share that holds volumes rather than being one
+	BackingShareMarker = "csi_backing_share"
+	// Extended info key set on every share created by a version that marks backing shares, so such a
+	// share without the BackingShareMarker is a share-backed volume
+	BackingSharesMarkedKey = "csi_backing_shares_marked"
+	// Prefix of the share extended info keys recording the snapshot a volume was last reverted to
+	RevertRecordPrefix = "csi_revert_"
+	// Prefix of the share extended info keys recording the volumes published to a node IP through an export rule
+	NodeExportRecordPrefix = "csi_export_"
+	// Share extended info key recording the snapshot a share created from a snapshot is filled from,
+	// removed once the snapshot content is copied into the share
+	ContentSourceRecord = "csi_content_source"
+	// Share extended info key recording the frequency of the snapshot schedule the plugin configured on the share
+	SnapshotScheduleRecord = "csi_schedule"
+	// Share extended info key recording the retention of the snapshot schedule the plugin configured
+	// on the share, not set when the cluster default applies
+	SnapshotRetentionRecord = "csi_schedule_retention"
+	// Name of the snapshot schedule the plugin configures on shares from the snapshotSchedule parameter
+	SnapshotScheduleName = "csi-snapshot-schedule"
+	// Name prefix of the snapshots taken by the snapshot schedule the plugin configures, which tells
+	// them apart from snapshots taken for CSI snapshots or by administrators
+	ScheduledSnapshotPrefix = "csi-scheduled-"
+	// Layout of the creation time at the start of Hammerspace snapshot names, ex. 2019-05-24T15-26-57-0
+	SnapshotTimeFormat = "2006-01-02T15-04-05"
 )
 
 var (
@@ -43,11 +82,11 @@ var (
 
 	// The list of export path prefixes to try to use, in order, when mounting to a data portal
 	DefaultDataPortalMountPrefixes = [...]string{"/", "/mnt/data-portal", ""}
-	DataPortalMountPrefix          = ""
-	CommandExecTimeout             = 300 * time.Second // Seconds
 	UseAnvil                       bool
 	BaseBackingShareMountPath      = "/var/lib/hammerspace/rootmount"
 	BaseVolumeMarkerSourcePath     = "/var/lib/hammerspace/volumes"
+	// Directory, relative to the root export, holding one file per staged volume and node
+	PublishedNodesDir = "/.csi-published"
 )
 
 // Extended info to be set on every share created by the driver
@@ -57,6 +96,7 @@ func GetCommonExtendedInfo() map[string]string {
 		"csi_created_by_plugin_version":  Version,
 		"csi_created_by_plugin_git_hash": Githash,
 		"csi_created_by_csi_version":     CsiVersion,
+		BackingSharesMarkedKey:           "true",
 	}
 	return extendedInfo
 }
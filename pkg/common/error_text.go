@@ -20,34 +20,88 @@ package common
 // Convention is to be lowercase with no ending punctuation
 const (
 	// Validation errors
-	EmptyVolumeId                 = "volume ID cannot be empty"
-	VolumeIdTooLong               = "volume ID cannot be longer than %d characters"
-	SnapshotIdTooLong             = "shapshot ID cannot be longer than %d characters"
-	ImproperlyFormattedSnapshotId = "shapshot ID should be of the format <datetime>|<share export path>, received %s"
-	EmptyTargetPath               = "target path cannot be empty"
-	EmptyStagingTargetPath        = "staging target path cannot be empty"
-	EmptyVolumePath               = "volume Path cannot be empty"
-	NoCapabilitiesSupplied        = "no capabilities supplied for volume %s" // volume id
-	ConflictingCapabilities       = "cannot request a volume to be both raw and a filesystem"
-	InvalidDeleteDelay            = "deleteDelay parameter must be an Integer. Value received '%s'"
-	InvalidComment                = "failed to set comment, invalid value"
-	InvalidShareNameSize          = "share name cannot be longer than 80 characters"
-	InvalidCommentSize            = "share comment cannot be longer than 255 characters"
-	EmptySnapshotId               = "snapshot ID cannot be empty"
-	MissingSnapshotSourceVolumeId = "snapshot SourceVolumeId cannot be empty"
-	MissingBlockBackingShareName  = "blockBackingShareName must be provided when creating BlockVolumes"
-	MissingMountBackingShareName  = "mountBackingShareName must be provided when creating Filesystem volumes other than 'nfs'"
-	BlockVolumeSizeNotSpecified   = "capacity must be specified for block volumes"
-	ShareNotMounted               = "share is not in mounted state."
+	EmptyVolumeId                       = "volume ID cannot be empty"
+	VolumeIdTooLong                     = "volume ID cannot be longer than %d characters"
+	SnapshotIdTooLong                   = "shapshot ID cannot be longer than %d characters"
+	ImproperlyFormattedSnapshotId       = "shapshot ID should be of the format <datetime>|<share export path>, received %s"
+	EmptyTargetPath                     = "target path cannot be empty"
+	EmptyStagingTargetPath              = "staging target path cannot be empty"
+	EmptyVolumePath                     = "volume Path cannot be empty"
+	NoCapabilitiesSupplied              = "no capabilities supplied for volume %s" // volume id
+	ConflictingCapabilities             = "cannot request a volume to be both raw and a filesystem"
+	InvalidDeleteDelay                  = "deleteDelay parameter must be an Integer. Value received '%s'"
+	InvalidComment                      = "failed to set comment, invalid value"
+	InvalidShareNameSize                = "share name cannot be longer than 80 characters"
+	InvalidCommentSize                  = "share comment cannot be longer than 255 characters"
+	EmptyGroupSnapshotName              = "group snapshot name cannot be empty"
+	EmptyGroupSnapshotId                = "group snapshot ID cannot be empty"
+	ImproperlyFormattedGroupSnapshotId  = "group snapshot ID should be of the format group|<name>, received %s"
+	MissingGroupSnapshotSourceVolumeIds = "group snapshot SourceVolumeIds cannot be empty"
+	MissingGroupSnapshotIds             = "group snapshot SnapshotIds cannot be empty"
+	DuplicateGroupSnapshotMember        = "%s is listed more than once"
+	GroupSnapshotMembersOnSeveralShares = "members of a group snapshot must be on one share to be snapshotted together, %s is on share %s and %s on share %s"
+	InvalidStartingToken                = "invalid starting token '%s'"
+	EmptySnapshotId                     = "snapshot ID cannot be empty"
+	MissingSnapshotSourceVolumeId       = "snapshot SourceVolumeId cannot be empty"
+	MissingBlockBackingShareName        = "blockBackingShareName must be provided when creating BlockVolumes"
+	MissingMountBackingShareName        = "mountBackingShareName must be provided when creating Filesystem volumes other than 'nfs'"
+	BlockVolumeSizeNotSpecified         = "capacity must be specified for block volumes"
+	ShareNotMounted                     = "share is not in mounted state."
 
 	InvalidExportOptions             = "export options must consist of 3 values: subnet,access,rootSquash, received '%s'"
 	InvalidRootSquash                = "rootSquash must be a bool. Value received '%s'"
 	InvalidAdditionalMetadataTags    = "extended Info must be of format key=value, received '%s'"
 	InvalidObjectiveNameDoesNotExist = "cannot find objective with the name %s"
+	InvalidSnapshotSchedule          = "snapshotSchedule must be one of hourly, daily, weekly or monthly, received '%s'"
+	InvalidSnapshotRetention         = "snapshotRetention must be a positive integer, received '%s'"
+	SnapshotRetentionWithoutSchedule = "snapshotRetention requires snapshotSchedule"
+	SnapshotScheduleMismatch         = "backing share %s has snapshotSchedule '%s' and snapshotRetention '%s', requested '%s' and '%s'"
 
-	VolumeExistsSizeMismatch = "requested volume exists, but has a different size. Existing: %d, Requested: %d"
-	VolumeDeleteHasSnapshots = "volumes with snapshots cannot be deleted, delete snapshots first"
-	VolumeBeingDeleted       = "the specified volume is currently being deleted"
+	VolumeExistsSizeMismatch           = "requested volume exists, but has a different size. Existing: %d, Requested: %d"
+	VolumeDeleteHasSnapshots           = "volumes with snapshots cannot be deleted, delete snapshots first"
+	VolumeBeingDeleted                 = "the specified volume is currently being deleted"
+	ImmutableVolumeParameter           = "parameter %s cannot be modified on an existing volume"
+	ShareOnlyVolumeParameters          = "comment and exportOptions can only be modified on share-backed volumes"
+	CloneSourceTooLarge                = "requested capacity %d is smaller than the source volume size %d"
+	CloneSourceWrongShare              = "source volume %s must reside in backing share %s to be cloned"
+	SnapshotExistsForOtherVolume       = "snapshot %s already exists for a different source volume %s"
+	GroupSnapshotExistsForOtherVolumes = "group snapshot %s already exists for different source volumes"
+	GroupSnapshotMemberMismatch        = "snapshots %v do not match the members %v of group snapshot %s"
+	RevertSnapshotOtherVolume          = "snapshot %s was not taken of volume %s"
+	RevertVolumePublished              = "volume %s is staged on nodes %v, unpublish it before reverting it to a snapshot"
+	VolumeRecordFailed                 = "failed to record volume %s on backing share %s: %v"
+	SnapshotRecordFailed               = "failed to record snapshot %s on share %s: %v"
+	RevertStagingUnknown               = "cannot tell whether volume %s is staged, no node has recorded the volumes it stages on the cluster yet"
+
+	// Authentication errors
+	InvalidSecrets = "invalid Hammerspace credentials in secrets: %s"
+	LoginFailed    = "failed to log in to Hammerspace at %s as %s: %s"
+
+	// Cluster errors
+	UnknownCluster         = "cluster %s is not configured"
+	ClusterMismatch        = "%s does not belong to cluster '%s'"
+	TopologyNotAccessible  = "volume cannot be made accessible from the requisite topologies %v, cluster is at site %s"
+	HammerspaceUnavailable = "hammerspace API at %s is unavailable after repeated failures, next attempt in %s"
+
+	// Mode errors
+	MethodNotServedInMode = "%s is not served by this plugin, which runs in %s mode"
+
+	// Lock errors
+	LockTimeout = "timed out after %s waiting for the %s lock of %s held by %s, retry later"
+
+	// Task errors
+	TaskStillRunning = "hammerspace task %s (%s) is still running at %d%%, retry later"
+	TaskFailed       = "hammerspace task %s (%s) failed: %s"
+	TaskHalted       = "hammerspace task %s (%s) was halted: %s"
+	TaskCancelled    = "hammerspace task %s (%s) was cancelled: %s"
+	TaskTimedOut     = "hammerspace task %s (%s) did not end within %s, current status is %s"
+
+	// Publish errors
+	EmptyNodeId   = "node ID cannot be empty"
+	NodeIPMissing = "node %s does not report an IP address, set CSI_NODE_IP on the node plugin"
+
+	// Quota errors
+	DirectoryQuotaUnavailable = "cannot limit volume directory %s to %d bytes: %v; install the Hammerspace toolkit on the controller or set HS_UNLIMITED_DIRECTORY_VOLUMES=true"
 
 	// Not Found errors
 	VolumeNotFound              = "volume does not exist"
@@ -56,6 +110,8 @@ const (
 	BackingShareNotFound        = "could not find specified backing share"
 	SourceSnapshotNotFound      = "could not find source snapshots"
 	SourceSnapshotShareNotFound = "could not find the share for the source snapshot"
+	SourceVolumeNotFound        = "could not find source volume %s"
+	GroupSnapshotNotFound       = "group snapshot %s does not exist"
 
 	// Internal errors
 	UnexpectedHSStatusCode    = "unexpected HTTP response from Hammerspace API: recieved status code %d, expected %d"
@@ -64,6 +120,12 @@ const (
 	TargetPathUnknownFiletype = "target path exists but is not a block device nor directory"
 	UnknownError              = "unknown internal error"
 
+	// Volume conditions
+	VolumeHealthy             = "volume is healthy"
+	VolumeShareRemoved        = "share %s has been removed"
+	VolumeShareNotPublished   = "share %s is not published, current state is %s"
+	VolumeBackingShareMissing = "backing share %s does not exist"
+
 	// CSI v0
 	BlockVolumesUnsupported = "block volumes are unsupported in CSI v0.3"
 )
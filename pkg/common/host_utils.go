@@ -28,8 +28,10 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 	unix "golang.org/x/sys/unix"
 
@@ -40,25 +42,8 @@ import (
 
 const LOOP_CTL_GET_FREE = 0x4C82
 
-var (
-	defaultMountCheckTimeout time.Duration = 50 * time.Second // Default timeout for checking mount status
-)
-
-func init() {
-	// Read environment variables for mount check timeout
-	mountCheckTimeoutStr := os.Getenv("MOUNT_CHECK_TIMEOUT")
-	if mountCheckTimeoutStr != "" {
-		if timeout, err := time.ParseDuration(mountCheckTimeoutStr); err == nil && timeout > 0 {
-			defaultMountCheckTimeout = timeout
-		} else {
-			log.Warnf("Invalid MOUNT_CHECK_TIMEOUT=%s; using default %s", mountCheckTimeoutStr, defaultMountCheckTimeout)
-		}
-	}
-
-	log.Infof("mountCheckTimeout=%s", defaultMountCheckTimeout)
-}
-
 func execCommandHelper(command string, args ...string) ([]byte, error) {
+	timeout := GetConfig().CommandExecTimeout
 	cmd := exec.Command(command, args...)
 	log.Debugf("Executing command: %v", cmd)
 	var b bytes.Buffer
@@ -74,9 +59,9 @@ func execCommandHelper(command string, args ...string) ([]byte, error) {
 		done <- cmd.Wait()
 	}()
 	select {
-	case <-time.After(CommandExecTimeout):
-		log.Warnf("Command '%s' with args '%v' did not completed after %d seconds",
-			command, args, CommandExecTimeout)
+	case <-time.After(timeout):
+		log.Warnf("Command '%s' with args '%v' did not completed after %s",
+			command, args, timeout)
 		if err := cmd.Process.Kill(); err != nil {
 			log.Error("failed to kill process: ", err)
 		}
@@ -113,27 +98,28 @@ func EnsureFreeLoopbackDeviceFile() (uint64, error) {
 	return uint64(dev), nil
 }
 
-func MountFilesystem(sourcefile, destfile, fsType string, mountFlags []string) error {
+func MountFilesystem(ctx context.Context, sourcefile, destfile, fsType string, mountFlags []string) error {
 	mounter := mount.New("")
 	// Check if the file already exists
 	if _, err := os.Stat(destfile); os.IsNotExist(err) {
 		// Make sure parent dir exists
 		err := os.MkdirAll(filepath.Dir(destfile), 0755) // Use 0755 for dirs, not 0644
 		if err != nil {
-			log.Errorf("could not create parent directory: %v", err)
+			Logger(ctx).Errorf("could not create parent directory: %v", err)
 			return status.Error(codes.Internal, err.Error())
 		}
 
 		// Create the file
 		f, err := os.OpenFile(destfile, os.O_CREATE|os.O_EXCL, 0644)
 		if err != nil {
-			log.Errorf("could not create target file: %v", err)
+			Logger(ctx).Errorf("could not create target file: %v", err)
 			return status.Error(codes.Internal, err.Error())
 		}
 		f.Close()
 	}
 
 	err := mounter.Mount(sourcefile, destfile, fsType, mountFlags)
+	metrics.RecordMountOperation("mount", err)
 	if err != nil {
 		if os.IsPermission(err) {
 			return status.Error(codes.PermissionDenied, err.Error())
@@ -146,8 +132,8 @@ func MountFilesystem(sourcefile, destfile, fsType string, mountFlags []string) e
 	return nil
 }
 
-func ExpandFilesystem(device, fsType string) error {
-	log.Infof("Resizing filesystem on file '%s' with '%s' filesystem", device, fsType)
+func ExpandFilesystem(ctx context.Context, device, fsType string) error {
+	Logger(ctx).Infof("Resizing filesystem on file '%s' with '%s' filesystem", device, fsType)
 
 	var command string
 	if fsType == "xfs" {
@@ -157,33 +143,34 @@ func ExpandFilesystem(device, fsType string) error {
 	}
 	output, err := ExecCommand(command, device)
 	if err != nil {
-		log.Errorf("Could not expand filesystem on device %s: %s: %s", device, err.Error(), output)
+		Logger(ctx).Errorf("Could not expand filesystem on device %s: %s: %s", device, err.Error(), output)
 		return err
 	}
 	return nil
 }
 
-func BindMountDevice(sourcefile, destfile string) error {
+func BindMountDevice(ctx context.Context, sourcefile, destfile string) error {
 	mounter := mount.New("")
 	// Check if the file already exists
 	if _, err := os.Stat(destfile); os.IsNotExist(err) {
 		// Make sure parent dir exists
 		err := os.MkdirAll(filepath.Dir(destfile), 0755) // Use 0755 for dirs, not 0644
 		if err != nil {
-			log.Errorf("could not create parent directory: %v", err)
+			Logger(ctx).Errorf("could not create parent directory: %v", err)
 			return status.Error(codes.Internal, err.Error())
 		}
 
 		// Create the file
 		f, err := os.OpenFile(destfile, os.O_CREATE|os.O_EXCL, 0644)
 		if err != nil {
-			log.Errorf("could not create target file: %v", err)
+			Logger(ctx).Errorf("could not create target file: %v", err)
 			return status.Error(codes.Internal, err.Error())
 		}
 		f.Close()
 	}
 
 	err := mounter.Mount(sourcefile, destfile, "", []string{"bind"})
+	metrics.RecordMountOperation("bind_mount", err)
 	if err != nil {
 		if os.IsPermission(err) {
 			return status.Error(codes.PermissionDenied, err.Error())
@@ -205,54 +192,55 @@ func GetDeviceMinorNumber(device string) (uint32, error) {
 	return unix.Minor(dev), nil
 }
 
-func MakeEmptyRawFile(pathname string, size int64) error {
-	log.Infof("creating file '%s'", pathname)
+func MakeEmptyRawFile(ctx context.Context, pathname string, size int64) error {
+	Logger(ctx).Infof("creating file '%s'", pathname)
 	sizeStr := strconv.FormatInt(size, 10)
 	output, err := ExecCommand("qemu-img", "create", "-fraw", pathname, sizeStr)
 	if err != nil {
-		log.Errorf("%s, %v", output, err.Error())
+		Logger(ctx).Errorf("%s, %v", output, err.Error())
 		return err
 	}
 	return nil
 }
 
-func ExpandDeviceFileSize(pathname string, size int64) error {
-	log.Infof("resizing device file '%s'", pathname)
+func ExpandDeviceFileSize(ctx context.Context, pathname string, size int64) error {
+	Logger(ctx).Infof("resizing device file '%s'", pathname)
 	sizeStr := strconv.FormatInt(size, 10)
 	loopdev, err := determineLoopDeviceFromBackingFile(pathname)
 	if err != nil {
-		// log.Errorf("DFERR: loopdev: '%s', error: '%v'", loopdev, err.Error())
+		// Logger(ctx).Errorf("DFERR: loopdev: '%s', error: '%v'", loopdev, err.Error())
 		return err
 	}
 	// Refresh the loop device size with losetup -c
 	// Requires UBI image
 	loresize, err := ExecCommand("losetup", "-c", loopdev)
+	metrics.RecordMountOperation("loop_resize", err)
 	if err != nil {
-		log.Errorf("Resizing loop device '%s' failed with output '%s': '%v'", loopdev, loresize, err.Error())
+		Logger(ctx).Errorf("Resizing loop device '%s' failed with output '%s': '%v'", loopdev, loresize, err.Error())
 		return err
 	}
 	output, err := ExecCommand("qemu-img", "resize", "-fraw", pathname, sizeStr)
 	if err != nil {
-		log.Errorf("%s, %v", output, err.Error())
+		Logger(ctx).Errorf("%s, %v", output, err.Error())
 		return err
 	}
 	return nil
 }
 
-func FormatDevice(device, fsType string) error {
-	log.Infof("formatting file '%s' with '%s' filesystem", device, fsType)
+func FormatDevice(ctx context.Context, device, fsType string) error {
+	Logger(ctx).Infof("formatting file '%s' with '%s' filesystem", device, fsType)
 	args := []string{device}
 	if fsType == "xfs" {
 		args = []string{"-m", "reflink=0", device}
 	}
 	output, err := ExecCommand(fmt.Sprintf("mkfs.%s", fsType), args...)
 	if err != nil {
-		log.Errorf("Error executing mkfs command. %v", err)
+		Logger(ctx).Errorf("Error executing mkfs command. %v", err)
 		if output != nil && strings.Contains(string(output), "will not make a filesystem here") {
-			log.Warningf("Device %s is already mounted", device)
+			Logger(ctx).Warningf("Device %s is already mounted", device)
 			return err
 		}
-		log.Errorf("Could not format device %s: %s", device, err.Error())
+		Logger(ctx).Errorf("Could not format device %s: %s", device, err.Error())
 		return err
 	}
 	return nil
@@ -284,8 +272,8 @@ func statWithTimeout(path string, timeout time.Duration) (os.FileInfo, error) {
 	}
 }
 
-func DeleteFile(pathname string) error {
-	log.Infof("deleting all data from path '%s'", pathname)
+func DeleteFile(ctx context.Context, pathname string) error {
+	Logger(ctx).Infof("deleting all data from path '%s'", pathname)
 
 	// Don't allow deleting root
 	if pathname == "/" {
@@ -307,25 +295,25 @@ func DeleteFile(pathname string) error {
 	_, err := statWithTimeout(pathname, 30*time.Second)
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Warnf("file '%s' does not exist", pathname)
+			Logger(ctx).Warnf("file '%s' does not exist", pathname)
 			return nil
 		}
-		log.Errorf("error accessing file '%s': %v", pathname, err)
+		Logger(ctx).Errorf("error accessing file '%s': %v", pathname, err)
 		return err
 	}
 
 	// Remove the file or directory
 	if err := os.RemoveAll(pathname); err != nil {
-		log.Errorf("error while deleting data from path '%s': %v", pathname, err)
+		Logger(ctx).Errorf("error while deleting data from path '%s': %v", pathname, err)
 		return err
 	}
 
-	log.Debugf("successfully deleted '%s'", pathname)
+	Logger(ctx).Debugf("successfully deleted '%s'", pathname)
 	return nil
 }
 
-func MountShare(sourcePath, targetPath string, mountFlags []string) error {
-	log.Infof("mounting %s to %s, with options %v", sourcePath, targetPath, mountFlags)
+func MountShare(ctx context.Context, sourcePath, targetPath string, mountFlags []string) error {
+	Logger(ctx).Infof("mounting %s to %s, with options %v", sourcePath, targetPath, mountFlags)
 	mounted, err := SafeIsMountPoint(targetPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -339,7 +327,7 @@ func MountShare(sourcePath, targetPath string, mountFlags []string) error {
 	}
 
 	if mounted {
-		log.Infof("Share already mounted, sourcepath %s, targetPath %s", sourcePath, targetPath)
+		Logger(ctx).Infof("Share already mounted, sourcepath %s, targetPath %s", sourcePath, targetPath)
 		return nil
 	}
 
@@ -347,6 +335,7 @@ func MountShare(sourcePath, targetPath string, mountFlags []string) error {
 
 	mounter := mount.New("")
 	err = mounter.Mount(sourcePath, targetPath, "nfs", mo)
+	metrics.RecordMountOperation("nfs_mount", err)
 	if err != nil {
 		if os.IsPermission(err) {
 			return status.Error(codes.PermissionDenied, err.Error())
@@ -497,16 +486,16 @@ func checkIPType(ipAddress string) (string, error) {
 	return "", errors.New("unknown IP type")
 }
 
-func CheckNFSExports(address string) (bool, error) {
+func CheckNFSExports(ctx context.Context, address string) (bool, error) {
 	// Create a context with timeout of 5 min
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
 	defer cancel()
 
-	log.Infof("Checking floating ip %s", address)
+	Logger(ctx).Infof("Checking floating ip %s", address)
 
 	uaddr, protocol, err := computeUaddr(address, 2049)
 	if err != nil {
-		log.Errorf("Error while computing uaddr: %v", err)
+		Logger(ctx).Errorf("Error while computing uaddr: %v", err)
 	}
 
 	// Execute the command within the context
@@ -518,7 +507,7 @@ func CheckNFSExports(address string) (bool, error) {
 			errChan <- err
 			return
 		}
-		log.Infof("Check was success on uaddr %s, with protocol %s.", uaddr, protocol)
+		Logger(ctx).Infof("Check was success on uaddr %s, with protocol %s.", uaddr, protocol)
 		outputChan <- output
 	}()
 
@@ -529,55 +518,56 @@ func CheckNFSExports(address string) (bool, error) {
 	case err := <-errChan:
 		return false, status.Errorf(codes.Internal, "could not determine nfs exports: %v", err)
 	case output := <-outputChan:
-		log.Infof("%s", string(output))
+		Logger(ctx).Infof("%s", string(output))
 		return true, nil
 	}
 }
 
-func IsShareMounted(targetPath string) bool {
+func IsShareMounted(ctx context.Context, targetPath string) bool {
 	mounter := mount.New("")
 	isMounted, err := mounter.IsMountPoint(targetPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Warnf("Check [IsShareMounted] target path is empty, %s", EmptyTargetPath)
+			Logger(ctx).Warnf("Check [IsShareMounted] target path is empty, %s", EmptyTargetPath)
 			return false
 		} else {
-			log.Warnf("Error while checking mount point for targetPath %s, Error %v", targetPath, err)
+			Logger(ctx).Warnf("Error while checking mount point for targetPath %s, Error %v", targetPath, err)
 			return false
 		}
 	}
-	log.Debugf("Target path %s isMounted %t", targetPath, isMounted)
+	Logger(ctx).Debugf("Target path %s isMounted %t", targetPath, isMounted)
 	return isMounted
 }
 
-func UnmountFilesystem(targetPath string) error {
-	log.Infof("UnmountFilesystem is called with targetPath %s", targetPath)
+func UnmountFilesystem(ctx context.Context, targetPath string) error {
+	Logger(ctx).Infof("UnmountFilesystem is called with targetPath %s", targetPath)
 	mounter := mount.New("")
 
-	isMounted := IsShareMounted(targetPath)
+	isMounted := IsShareMounted(ctx, targetPath)
 
 	if !isMounted {
-		log.Warnf("Target path %s is not mounted so return without clean up.", targetPath)
+		Logger(ctx).Warnf("Target path %s is not mounted so return without clean up.", targetPath)
 		return nil
 	}
-	log.Debugf("Found mounted target dir %s", targetPath)
+	Logger(ctx).Debugf("Found mounted target dir %s", targetPath)
 	err := mounter.Unmount(targetPath)
+	metrics.RecordMountOperation("unmount", err)
 	if err != nil {
-		log.Errorf("Error while unmounting target path %s, Error %v", targetPath, err.Error())
+		Logger(ctx).Errorf("Error while unmounting target path %s, Error %v", targetPath, err.Error())
 		return status.Error(codes.Internal, err.Error())
 	}
-	log.Debugf("Successfully unmounted target dir %s", targetPath)
+	Logger(ctx).Debugf("Successfully unmounted target dir %s", targetPath)
 	// delete target path
 	err = os.Remove(targetPath)
 	if err != nil {
-		log.Errorf("Error while removing target path %s. Could not remove target path due to %v", targetPath, err)
+		Logger(ctx).Errorf("Error while removing target path %s. Could not remove target path due to %v", targetPath, err)
 		return status.Error(codes.Internal, err.Error())
 	}
-	log.Debugf("Successfully unmounted and deleted target dir %s", targetPath)
+	Logger(ctx).Debugf("Successfully unmounted and deleted target dir %s", targetPath)
 	return nil
 }
 
-func SetMetadataTags(localPath string, tags map[string]string) error {
+func SetMetadataTags(ctx context.Context, localPath string, tags map[string]string) error {
 	// hs attribute set localpath -e "CSI_DETAILS_TABLE{'<version-string>','<plugin-name-string>','<plugin-version-string>','<plugin-git-hash-string>'}"
 	attributeSetOutput, err := ExecCommand("hs",
 		"attribute",
@@ -585,20 +575,20 @@ func SetMetadataTags(localPath string, tags map[string]string) error {
 		fmt.Sprintf("-e \"CSI_DETAILS_TABLE{'%s','%s','%s','%s'}\" ", CsiVersion, CsiPluginName, Version, Githash),
 		localPath)
 	if err != nil {
-		log.Errorf("Failed to set CSI_DETAILS metadata. Command output %s. Error %s", string(attributeSetOutput), err.Error())
+		Logger(ctx).Errorf("Failed to set CSI_DETAILS metadata. Command output %s. Error %s", string(attributeSetOutput), err.Error())
 	}
 
-	log.Debugf("hs attributes set. Command output %s", string(attributeSetOutput))
+	Logger(ctx).Debugf("hs attributes set. Command output %s", string(attributeSetOutput))
 
 	for tag_key, tag_value := range tags {
 		output, err := ExecCommand("hs", "-v", "tag", "set", "-e", tag_value, tag_key, localPath)
 
 		// FIXME: The HS client returns exit code 0 even on failure, so we can't detect errors
 		if err != nil {
-			log.Errorf("%s", "Failed to set tag. Error - %v"+err.Error())
+			Logger(ctx).Errorf("%s", "Failed to set tag. Error - %v"+err.Error())
 			break
 		}
-		log.Debugf("hs tag set. output: %s", output)
+		Logger(ctx).Debugf("hs tag set. output: %s", output)
 	}
 
 	return err
@@ -629,7 +619,7 @@ func SafeIsMountPoint(path string) (bool, error) {
 
 	resultChan := make(chan result, 1)
 	// Use provided timeout if set, otherwise default to 1 minute
-	to := defaultMountCheckTimeout
+	to := GetConfig().MountCheckTimeout
 	go func() {
 		mounted, err := mount.New("").IsMountPoint(path)
 		resultChan <- result{mounted, err}
@@ -645,39 +635,164 @@ func SafeIsMountPoint(path string) (bool, error) {
 }
 
 // MakeEmptyRawFolder creates a folder at the specified path
-func MakeEmptyRawFolder(pathname string) error {
-	log.Debugf("checking folder '%s'", pathname)
+func MakeEmptyRawFolder(ctx context.Context, pathname string) error {
+	Logger(ctx).Debugf("checking folder '%s'", pathname)
 
 	// Check if directory exists
 	info, err := os.Stat(pathname)
 	if err == nil {
 		if !info.IsDir() {
-			log.Errorf("Path exists but is not a directory: %s", pathname)
+			Logger(ctx).Errorf("Path exists but is not a directory: %s", pathname)
 			return status.Error(codes.Internal, "path exists but is not a directory")
 		}
 		// Correct permissions if needed
 		err = os.Chmod(pathname, os.FileMode(0755))
 		if err != nil {
-			log.Errorf("Failed to set correct permissions on %s: %v", pathname, err)
+			Logger(ctx).Errorf("Failed to set correct permissions on %s: %v", pathname, err)
 			return status.Error(codes.Internal, err.Error())
 		}
-		log.Debugf("Directory already exists: %s", pathname)
+		Logger(ctx).Debugf("Directory already exists: %s", pathname)
 		return nil
 	}
 
 	// Create the directory if it does not exist
 	if os.IsNotExist(err) {
-		log.Debugf("Creating folder with path as -> %s", pathname)
+		Logger(ctx).Debugf("Creating folder with path as -> %s", pathname)
 		err = os.MkdirAll(pathname, os.FileMode(0755))
 		if err != nil {
-			log.Errorf("could not make folder, %v", err)
+			Logger(ctx).Errorf("could not make folder, %v", err)
 			return status.Error(codes.Internal, err.Error())
 		}
-		log.Debugf("Successfully created folder: %s", pathname)
+		Logger(ctx).Debugf("Successfully created folder: %s", pathname)
 		return nil
 	}
 
 	// Handle unexpected errors
-	log.Errorf("Unexpected error checking folder: %v", err)
+	Logger(ctx).Errorf("Unexpected error checking folder: %v", err)
 	return status.Error(codes.Internal, err.Error())
 }
+
+// CopyDirectoryContents copies everything below source into destination,
+// preserving ownership, permissions and timestamps
+func CopyDirectoryContents(ctx context.Context, source, destination string) error {
+	Logger(ctx).Infof("copying contents of '%s' to '%s'", source, destination)
+	output, err := ExecCommand("cp", "-a", source+"/.", destination)
+	if err != nil {
+		Logger(ctx).Errorf("failed to copy directory contents, %s, %v", output, err.Error())
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// CopyFile copies a file, keeping a sparse file sparse
+func CopyFile(ctx context.Context, source, destination string) error {
+	Logger(ctx).Infof("copying '%s' to '%s'", source, destination)
+	output, err := ExecCommand("cp", "--sparse=always", source, destination)
+	if err != nil {
+		Logger(ctx).Errorf("failed to copy file, %s, %v", output, err.Error())
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// ErrHSCommandNotFound is returned by the directory quota functions when the hs command of the
+// Hammerspace toolkit is not installed
+var ErrHSCommandNotFound = errors.New("hs command not found, directory quotas need the Hammerspace toolkit")
+
+// SetDirectoryQuota limits the space that may be consumed below a directory on a mounted
+// Hammerspace share, through the quota command of the Hammerspace toolkit. Returns
+// ErrHSCommandNotFound when the toolkit is not installed.
+func SetDirectoryQuota(ctx context.Context, localPath string, sizeBytes int64) error {
+	// hs quota set --space <bytes> <dir>/
+	output, err := ExecCommand("hs", "quota", "set", "--space", strconv.FormatInt(sizeBytes, 10),
+		strings.TrimSuffix(localPath, "/")+"/")
+	if errors.Is(err, exec.ErrNotFound) {
+		return ErrHSCommandNotFound
+	}
+	if err != nil {
+		Logger(ctx).Errorf("failed to set quota of %d bytes on %s. Command output %s. Error %v", sizeBytes, localPath, string(output), err)
+		return status.Error(codes.Internal, err.Error())
+	}
+	Logger(ctx).Debugf("hs quota set. Command output %s", string(output))
+	return nil
+}
+
+// GetDirectoryQuota returns the space quota of a directory on a mounted Hammerspace share,
+// 0 means the directory has no quota. Returns ErrHSCommandNotFound when the toolkit is not
+// installed.
+func GetDirectoryQuota(localPath string) (int64, error) {
+	output, err := ExecCommand("hs", "quota", "get", "--space", strings.TrimSuffix(localPath, "/")+"/")
+	if errors.Is(err, exec.ErrNotFound) {
+		return 0, ErrHSCommandNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(output))
+	if value == "" {
+		return 0, nil
+	}
+	quota, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output from hs quota get for %s: %s", localPath, value)
+	}
+	return quota, nil
+}
+
+// ErrDirectoryUsageLimit is returned by GetDirectoryUsage for directories with more entries than
+// it walks
+var ErrDirectoryUsageLimit = errors.New("directory has too many entries to determine its usage")
+
+// maxDirectoryUsageEntries bounds the walk of GetDirectoryUsage
+var maxDirectoryUsageEntries int64 = 1000000
+
+type directoryUsage struct {
+	bytesUsed, inodesUsed int64
+	err                   error
+}
+
+// directoryUsageCacheKey is the cache key of the usage of a directory, the path after the | is
+// left out of the cache metrics
+func directoryUsageCacheKey(localPath string) string {
+	return "DIRECTORY_USAGE|" + localPath
+}
+
+// GetDirectoryUsage returns the space and number of inodes used below a directory. The directory
+// is walked at most once a minute, and only up to maxDirectoryUsageEntries entries, since volume
+// stats are requested periodically for every volume. A walk that stops at the limit is cached too.
+func GetDirectoryUsage(localPath string) (int64, int64, error) {
+	cacheKey := directoryUsageCacheKey(localPath)
+	if cached, _ := GetCacheData(cacheKey); cached != nil {
+		usage := cached.(directoryUsage)
+		return usage.bytesUsed, usage.inodesUsed, usage.err
+	}
+
+	var bytesUsed, inodesUsed int64
+	err := filepath.WalkDir(localPath, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if inodesUsed >= maxDirectoryUsageEntries {
+			return ErrDirectoryUsageLimit
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			bytesUsed += st.Blocks * 512
+		} else {
+			bytesUsed += info.Size()
+		}
+		inodesUsed++
+		return nil
+	})
+	if errors.Is(err, ErrDirectoryUsageLimit) {
+		SetCacheData(cacheKey, directoryUsage{err: err}, 60)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	SetCacheData(cacheKey, directoryUsage{bytesUsed: bytesUsed, inodesUsed: inodesUsed}, 60)
+	return bytesUsed, inodesUsed, nil
+}
@@ -1,6 +1,11 @@
 package common
 
 import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -79,7 +84,10 @@ func TestExecCommandHelper(t *testing.T) {
 		t.FailNow()
 	}
 
-	CommandExecTimeout = 1
+	cfg := *GetConfig()
+	cfg.CommandExecTimeout = 1
+	SetConfig(&cfg)
+	defer SetConfig(DefaultPluginConfig())
 	_, err = execCommandHelper("sleep", "5")
 	if err == nil {
 		t.Logf("Expected error")
@@ -87,3 +95,150 @@ func TestExecCommandHelper(t *testing.T) {
 	}
 
 }
+
+func TestDirectoryQuota(t *testing.T) {
+	var actualArgs []string
+	ExecCommand = func(command string, args ...string) ([]byte, error) {
+		actualArgs = append([]string{command}, args...)
+		return []byte("1073741824\n"), nil
+	}
+
+	err := SetDirectoryQuota(context.Background(), "/tmp/test-backing-share/test-volume", 1073741824)
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	expectedArgs := []string{"hs", "quota", "set", "--space", "1073741824", "/tmp/test-backing-share/test-volume/"}
+	if !reflect.DeepEqual(actualArgs, expectedArgs) {
+		t.Errorf("Expected: %v", expectedArgs)
+		t.Errorf("Actual: %v", actualArgs)
+	}
+
+	quota, err := GetDirectoryQuota("/tmp/test-backing-share/test-volume/")
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	if quota != 1073741824 {
+		t.Errorf("Expected quota 1073741824, got %d", quota)
+	}
+
+	// no quota set
+	ExecCommand = func(command string, args ...string) ([]byte, error) {
+		return []byte(""), nil
+	}
+	quota, err = GetDirectoryQuota("/tmp/test-backing-share/test-volume")
+	if err != nil || quota != 0 {
+		t.Errorf("Expected no quota, got %d, %v", quota, err)
+	}
+
+	ExecCommand = func(command string, args ...string) ([]byte, error) {
+		return []byte("unlimited"), nil
+	}
+	_, err = GetDirectoryQuota("/tmp/test-backing-share/test-volume")
+	if err == nil {
+		t.Errorf("Expected error for unparsable quota, got nil")
+	}
+}
+
+func TestGetDirectoryUsage(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data"), make([]byte, 8192), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	bytesUsed, inodesUsed, err := GetDirectoryUsage(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	if inodesUsed != 3 {
+		t.Errorf("Expected 3 inodes used, got %d", inodesUsed)
+	}
+	if bytesUsed < 8192 {
+		t.Errorf("Expected at least 8192 bytes used, got %d", bytesUsed)
+	}
+}
+
+func TestGetDirectoryUsageIsBounded(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(limit int64) { maxDirectoryUsageEntries = limit }(maxDirectoryUsageEntries)
+	maxDirectoryUsageEntries = 2
+	if _, _, err := GetDirectoryUsage(dir); !errors.Is(err, ErrDirectoryUsageLimit) {
+		t.Errorf("Expected ErrDirectoryUsageLimit, got %v", err)
+	}
+
+	// The walk is not repeated while the failure is cached
+	maxDirectoryUsageEntries = 10
+	if _, _, err := GetDirectoryUsage(dir); !errors.Is(err, ErrDirectoryUsageLimit) {
+		t.Errorf("Expected the cached ErrDirectoryUsageLimit, got %v", err)
+	}
+
+	// The usage is cached
+	DeleteCacheData(directoryUsageCacheKey(dir))
+	_, inodesUsed, err := GetDirectoryUsage(dir)
+	if err != nil || inodesUsed != 3 {
+		t.Fatalf("Expected 3 inodes used, got %d, %v", inodesUsed, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "c"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, inodesUsed, _ = GetDirectoryUsage(dir); inodesUsed != 3 {
+		t.Errorf("Expected the cached usage of 3 inodes, got %d", inodesUsed)
+	}
+}
+
+func TestDirectoryQuotaWithoutHSCommand(t *testing.T) {
+	defer func(execCommand func(string, ...string) ([]byte, error)) { ExecCommand = execCommand }(ExecCommand)
+	ExecCommand = func(command string, args ...string) ([]byte, error) {
+		return nil, &exec.Error{Name: command, Err: exec.ErrNotFound}
+	}
+	if err := SetDirectoryQuota(context.Background(), "/tmp/test-backing-share/test-volume", 1073741824); err != ErrHSCommandNotFound {
+		t.Errorf("Expected ErrHSCommandNotFound, got %v", err)
+	}
+	if _, err := GetDirectoryQuota("/tmp/test-backing-share/test-volume"); err != ErrHSCommandNotFound {
+		t.Errorf("Expected ErrHSCommandNotFound, got %v", err)
+	}
+}
+
+func TestDirectoryQuotaCommand(t *testing.T) {
+	// A stub hs command records its arguments and reports a quota of 2048 bytes
+	binDir := t.TempDir()
+	argsFile := filepath.Join(binDir, "args")
+	script := "#!/bin/sh\necho \"$@\" >> " + argsFile + "\nif [ \"$2\" = get ]; then echo 2048; fi\n"
+	if err := os.WriteFile(filepath.Join(binDir, "hs"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+	defer func(execCommand func(string, ...string) ([]byte, error)) { ExecCommand = execCommand }(ExecCommand)
+	ExecCommand = execCommandHelper
+
+	if err := SetDirectoryQuota(context.Background(), "/tmp/test-backing-share/test-volume", 1073741824); err != nil {
+		t.Fatal(err)
+	}
+	quota, err := GetDirectoryQuota("/tmp/test-backing-share/test-volume/")
+	if err != nil || quota != 2048 {
+		t.Errorf("Expected a quota of 2048 bytes, got %d, %v", quota, err)
+	}
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "quota set --space 1073741824 /tmp/test-backing-share/test-volume/\n" +
+		"quota get --space /tmp/test-backing-share/test-volume/\n"
+	if string(args) != expected {
+		t.Errorf("Expected hs to be called with\n%s\ngot\n%s", expected, args)
+	}
+
+	// Without hs on the PATH
+	t.Setenv("PATH", t.TempDir())
+	if err := SetDirectoryQuota(context.Background(), "/tmp/test-backing-share/test-volume", 1073741824); !errors.Is(err, ErrHSCommandNotFound) {
+		t.Errorf("Expected ErrHSCommandNotFound, got %v", err)
+	}
+}
@@ -44,3 +44,10 @@ func (c *Cache) Get(key string) (interface{}, bool) {
 
 	return value.value, true
 }
+
+func (c *Cache) Delete(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.data, key)
+}
@@ -30,6 +30,8 @@ type HSVolumeParameters struct {
 	CacheEnabled           bool
 	FQDN                   string
 	ClientMountOptions     []string
+	SnapshotSchedule       string
+	SnapshotRetention      int
 }
 
 type HSVolume struct {
@@ -46,9 +48,13 @@ type HSVolume struct {
 	FSType                 string
 	Comment                string
 	SourceSnapShareName    string
+	SourceSnapVolumeId     string
+	SourceVolumeId         string
 	AdditionalMetadataTags map[string]string
 	FQDN                   string
 	ClientMountOptions     []string
+	SnapshotSchedule       string
+	SnapshotRetention      int
 }
 
 ///// Request and Response objects for interacting with the HS API
@@ -106,6 +112,16 @@ type ShareExportOptions struct {
 	AccessPermissions string `json:"accessPermissions"` // Must be "RO" or "RW"
 	RootSquash        bool   `json:"rootSquash"`
 }
+
+// ShareSnapshotSchedule takes a snapshot of a share at every frequency and keeps the latest
+// Retention snapshots it took, the cluster default when zero. The names of its snapshots start
+// with SnapshotNamePrefix.
+type ShareSnapshotSchedule struct {
+	Name               string `json:"name"`
+	Frequency          string `json:"frequency"` // hourly, daily, weekly or monthly
+	Retention          int    `json:"retention,omitempty"`
+	SnapshotNamePrefix string `json:"snapshotNamePrefix,omitempty"`
+}
 type ObjectivesResponse struct {
 	Applied []AppliedObjectiveResponse `json:"appliedObjectives"`
 }
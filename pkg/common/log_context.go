@@ -0,0 +1,92 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// Fields of the request-scoped logger
+const (
+	LogFieldMethod     = "method"
+	LogFieldVolumeID   = "volume_id"
+	LogFieldSnapshotID = "snapshot_id"
+	LogFieldNodeID     = "node_id"
+	LogFieldTraceID    = "trace_id"
+)
+
+type loggerKey struct{}
+
+// WithLogFields returns a context whose logger adds fields to those of the logger of ctx
+func WithLogFields(ctx context.Context, fields log.Fields) context.Context {
+	return context.WithValue(ctx, loggerKey{}, Logger(ctx).WithFields(fields))
+}
+
+// Logger returns the logger of the gRPC call ctx belongs to, or the standard logger outside of
+// calls. The ID of the current trace is added so logs can be matched with traces.
+func Logger(ctx context.Context) *log.Entry {
+	if ctx == nil {
+		return log.NewEntry(log.StandardLogger())
+	}
+	entry, ok := ctx.Value(loggerKey{}).(*log.Entry)
+	if !ok {
+		entry = log.NewEntry(log.StandardLogger())
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		if traceID := spanContext.TraceID().String(); entry.Data[LogFieldTraceID] != traceID {
+			entry = entry.WithField(LogFieldTraceID, traceID)
+		}
+	}
+	return entry
+}
+
+// ApplyLogConfig sets the format and level of the standard logger from cfg
+func ApplyLogConfig(cfg *PluginConfig) error {
+	level, err := log.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	switch cfg.LogFormat {
+	case LogFormatJSON:
+		log.SetFormatter(&log.JSONFormatter{
+			PrettyPrint:      true,
+			DisableTimestamp: false,
+			TimestampFormat:  "2006-01-02 15:04:05",
+		})
+	case LogFormatText:
+		log.SetFormatter(&log.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "2006-01-02 15:04:05",
+		})
+	default:
+		return fmt.Errorf("logFormat must be %s or %s, received '%s'", LogFormatJSON, LogFormatText, cfg.LogFormat)
+	}
+	log.SetOutput(os.Stdout)
+	log.SetLevel(level)
+	return nil
+}
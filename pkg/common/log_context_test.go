@@ -0,0 +1,49 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogger(t *testing.T) {
+	if entry := Logger(context.Background()); len(entry.Data) != 0 {
+		t.Errorf("expected no fields outside of a call, got %v", entry.Data)
+	}
+
+	ctx := WithLogFields(context.Background(), log.Fields{LogFieldMethod: "/csi.v1.Node/NodeStageVolume"})
+	ctx = WithLogFields(ctx, log.Fields{LogFieldVolumeID: "/vol1"})
+	entry := Logger(ctx)
+	if entry.Data[LogFieldMethod] != "/csi.v1.Node/NodeStageVolume" || entry.Data[LogFieldVolumeID] != "/vol1" {
+		t.Errorf("unexpected fields %v", entry.Data)
+	}
+
+	traceID := trace.TraceID{0x01, 0x02}
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: trace.SpanID{0x03}})
+	entry = Logger(trace.ContextWithSpanContext(ctx, spanContext))
+	if entry.Data[LogFieldTraceID] != traceID.String() || entry.Data[LogFieldVolumeID] != "/vol1" {
+		t.Errorf("unexpected fields %v", entry.Data)
+	}
+}
+
+func TestApplyLogConfig(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	defer log.SetFormatter(log.StandardLogger().Formatter)
+
+	cfg := DefaultPluginConfig()
+	cfg.LogFormat = LogFormatText
+	cfg.LogLevel = "warn"
+	if err := ApplyLogConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, isText := log.StandardLogger().Formatter.(*log.TextFormatter); !isText || log.GetLevel() != log.WarnLevel {
+		t.Errorf("unexpected formatter %T and level %s", log.StandardLogger().Formatter, log.GetLevel())
+	}
+
+	cfg.LogLevel = "loud"
+	if err := ApplyLogConfig(cfg); err == nil {
+		t.Errorf("expected an error for an invalid level")
+	}
+}
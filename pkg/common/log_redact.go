@@ -0,0 +1,134 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RedactedValue replaces secrets in logs
+const RedactedValue = "***redacted***"
+
+// Verbosity of the log line of a gRPC call
+const (
+	LogVerbosityNone    = "none"    // the call is not logged
+	LogVerbositySummary = "summary" // the method and error are logged without the request and response
+	LogVerbosityFull    = "full"    // the request and response are logged, redacted and capped
+)
+
+// redactedHeaders are the HTTP headers carrying credentials or session cookies
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// isSecretKey reports whether a JSON key holds a secret, ex. the secrets of CSI requests
+// (node_stage_secrets in CSI 0.x) or a password in a Hammerspace API body
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	return key == "secrets" || strings.HasSuffix(key, "_secrets") ||
+		key == "password" || key == "token"
+}
+
+// RedactPayload returns the JSON of payload with the values of secret keys replaced, capped to
+// the configured logPayloadLimit
+func RedactPayload(payload interface{}) string {
+	if payload == nil {
+		return ""
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Sprintf("<unable to marshal %T: %v>", payload, err)
+	}
+	return CapPayload(redactJSON(data))
+}
+
+// RedactBody returns a REST body with the values of secret keys replaced when it is JSON,
+// capped to the configured logPayloadLimit
+func RedactBody(body string) string {
+	return CapPayload(redactJSON([]byte(body)))
+}
+
+// redactJSON replaces the values of secret keys in data, data that is not JSON is returned as is
+func redactJSON(data []byte) string {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return string(data)
+	}
+	if !redactValue(value) {
+		return string(data)
+	}
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return RedactedValue
+	}
+	return string(redacted)
+}
+
+// redactValue replaces secrets in a decoded JSON value in place and reports whether it found any
+func redactValue(value interface{}) bool {
+	found := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if isSecretKey(key) && child != nil {
+				v[key] = RedactedValue
+				found = true
+				continue
+			}
+			found = redactValue(child) || found
+		}
+	case []interface{}:
+		for _, child := range v {
+			found = redactValue(child) || found
+		}
+	}
+	return found
+}
+
+// RedactHeaders returns a copy of headers without credentials and session cookies
+func RedactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+	for _, name := range redactedHeaders {
+		if _, exists := redacted[name]; exists {
+			redacted.Set(name, RedactedValue)
+		}
+	}
+	return redacted
+}
+
+// CapPayload truncates payload to the configured logPayloadLimit, 0 keeps the whole payload
+func CapPayload(payload string) string {
+	limit := GetConfig().LogPayloadLimit
+	if limit <= 0 || len(payload) <= limit {
+		return payload
+	}
+	return fmt.Sprintf("%s...(%d more bytes)", payload[:limit], len(payload)-limit)
+}
+
+// GRPCLogVerbosity returns the verbosity of the log line of a gRPC method, ex.
+// /csi.v1.Identity/Probe. Methods are configured by full or short name, ex. Probe.
+func GRPCLogVerbosity(method string) string {
+	cfg := GetConfig()
+	if verbosity, exists := cfg.GRPCMethodLogVerbosity[method]; exists {
+		return verbosity
+	}
+	if verbosity, exists := cfg.GRPCMethodLogVerbosity[method[strings.LastIndex(method, "/")+1:]]; exists {
+		return verbosity
+	}
+	return cfg.GRPCLogVerbosity
+}
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	csi_v0 "github.com/ameade/spec/lib/go/csi/v0"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestRedactPayload(t *testing.T) {
+	for _, payload := range []interface{}{
+		&csi.CreateVolumeRequest{
+			Name:       "vol1",
+			Parameters: map[string]string{"objectives": "keep-online"},
+			Secrets:    map[string]string{"password": "hunter2"},
+		},
+		&csi_v0.NodeStageVolumeRequest{
+			VolumeId:         "/vol1",
+			NodeStageSecrets: map[string]string{"username": "admin", "key": "hunter2"},
+		},
+	} {
+		redacted := RedactPayload(payload)
+		if strings.Contains(redacted, "hunter2") || !strings.Contains(redacted, RedactedValue) {
+			t.Errorf("secrets are not redacted from %s", redacted)
+		}
+		if !strings.Contains(redacted, "vol1") {
+			t.Errorf("payload is redacted too much: %s", redacted)
+		}
+	}
+
+	if redacted := RedactBody(`[{"name":"admin","password":"hunter2"}]`); redacted != `[{"name":"admin","password":"`+RedactedValue+`"}]` {
+		t.Errorf("unexpected redacted body %s", redacted)
+	}
+	if body := "not json, password=hunter2"; RedactBody(body) != body {
+		t.Errorf("a body that is not JSON must be kept")
+	}
+	if RedactPayload(nil) != "" {
+		t.Errorf("a nil payload must be empty")
+	}
+}
+
+func TestCapPayload(t *testing.T) {
+	defer SetConfig(GetConfig())
+	cfg := DefaultPluginConfig()
+	cfg.LogPayloadLimit = 4
+	SetConfig(cfg)
+
+	if capped := CapPayload("0123456789"); capped != "0123...(6 more bytes)" {
+		t.Errorf("unexpected capped payload %s", capped)
+	}
+	if capped := CapPayload("0123"); capped != "0123" {
+		t.Errorf("unexpected capped payload %s", capped)
+	}
+	cfg.LogPayloadLimit = 0
+	if capped := CapPayload("0123456789"); capped != "0123456789" {
+		t.Errorf("a limit of 0 must not cap, received %s", capped)
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Set-Cookie", "JSESSIONID=secret")
+	headers.Set("Content-Type", "application/json")
+
+	redacted := RedactHeaders(headers)
+	if redacted.Get("Set-Cookie") != RedactedValue || redacted.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected redacted headers %v", redacted)
+	}
+	if headers.Get("Set-Cookie") != "JSESSIONID=secret" {
+		t.Errorf("the original headers must not change")
+	}
+}
+
+func TestGRPCLogVerbosity(t *testing.T) {
+	defer SetConfig(GetConfig())
+	cfg := DefaultPluginConfig()
+	cfg.GRPCLogVerbosity = LogVerbositySummary
+	cfg.GRPCMethodLogVerbosity = map[string]string{
+		"Probe":                          LogVerbosityNone,
+		"/csi.v1.Controller/ListVolumes": LogVerbosityFull,
+	}
+	SetConfig(cfg)
+
+	for method, expected := range map[string]string{
+		"/csi.v1.Identity/Probe":         LogVerbosityNone,
+		"/csi.v0.Identity/Probe":         LogVerbosityNone,
+		"/csi.v1.Controller/ListVolumes": LogVerbosityFull,
+		"/csi.v0.Controller/ListVolumes": LogVerbositySummary,
+		"/csi.v1.Node/NodeGetInfo":       LogVerbositySummary,
+	} {
+		if verbosity := GRPCLogVerbosity(method); verbosity != expected {
+			t.Errorf("%s: expected %s, received %s", method, expected, verbosity)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// PluginConfig holds the tunables of the plugin. Values are taken from the defaults, then the
+// legacy environment variables, then the YAML config file. Durations are written as "50s".
+type PluginConfig struct {
+	// Timeout of checking whether a path is a mount point, MOUNT_CHECK_TIMEOUT
+	MountCheckTimeout time.Duration `yaml:"mountCheckTimeout"`
+	// Attempts to attach or detach a loop device, UNMOUNT_RETRY_COUNT
+	UnmountRetryCount int `yaml:"unmountRetryCount"`
+	// Wait between loop device attempts, UNMOUNT_RETRY_INTERVAL
+	UnmountRetryInterval time.Duration `yaml:"unmountRetryInterval"`
+	// Timeout of the commands run by the plugin, ex. mount and mkfs
+	CommandExecTimeout time.Duration `yaml:"commandExecTimeout"`
+	// Wait for the lock of a volume or snapshot before the call fails with Aborted
+	LockTimeout time.Duration `yaml:"lockTimeout"`
+	// Retries of Hammerspace API requests that failed with a transient error
+	RestRetryCount int `yaml:"restRetryCount"`
+	// Bounds of the jittered backoff between retries, a longer Retry-After is not retried
+	RestRetryMinInterval time.Duration `yaml:"restRetryMinInterval"`
+	RestRetryMaxInterval time.Duration `yaml:"restRetryMaxInterval"`
+	// Consecutive unreachable responses after which requests fail fast, 0 disables the circuit breaker
+	RestCircuitBreakerThreshold int `yaml:"restCircuitBreakerThreshold"`
+	// How long requests fail fast before one request tries the Hammerspace API again
+	RestCircuitBreakerCooldown time.Duration `yaml:"restCircuitBreakerCooldown"`
+	// Wait for a Hammerspace task before the call fails with Aborted, its retry waits for the same task
+	TaskWaitTimeout time.Duration `yaml:"taskWaitTimeout"`
+	// Format of the logs, json or text, LOG_FORMAT
+	LogFormat string `yaml:"logFormat"`
+	// Lowest level logged, ex. info or debug, LOG_LEVEL
+	LogLevel string `yaml:"logLevel"`
+	// Verbosity of the gRPC call logs: none, summary without the request and response, or full
+	GRPCLogVerbosity string `yaml:"grpcLogVerbosity"`
+	// Verbosity of single gRPC methods, by full or short name, ex. Probe: none
+	GRPCMethodLogVerbosity map[string]string `yaml:"grpcMethodLogVerbosity"`
+	// Bytes of a logged gRPC payload or Hammerspace API body before it is truncated, 0 disables the cap
+	LogPayloadLimit int `yaml:"logPayloadLimit"`
+	// Prefix of the export path when mounting through a data portal, HS_DATA_PORTAL_MOUNT_PREFIX
+	DataPortalMountPrefix string `yaml:"dataPortalMountPrefix"`
+	// Where the root export is mounted on nodes, only read at startup
+	RootMountPath string `yaml:"rootMountPath"`
+	// Where nodes keep a marker file per staged volume, only read at startup
+	VolumeMarkerPath string `yaml:"volumeMarkerPath"`
+}
+
+var currentConfig atomic.Pointer[PluginConfig]
+
+// DefaultPluginConfig returns the configuration used when neither the environment nor the config file set a value
+func DefaultPluginConfig() *PluginConfig {
+	return &PluginConfig{
+		MountCheckTimeout:           50 * time.Second,
+		UnmountRetryCount:           5,
+		UnmountRetryInterval:        1 * time.Second,
+		CommandExecTimeout:          300 * time.Second,
+		LockTimeout:                 30 * time.Second,
+		RestRetryCount:              3,
+		RestRetryMinInterval:        500 * time.Millisecond,
+		RestRetryMaxInterval:        10 * time.Second,
+		RestCircuitBreakerThreshold: 5,
+		RestCircuitBreakerCooldown:  30 * time.Second,
+		TaskWaitTimeout:             2 * time.Minute,
+		LogFormat:                   LogFormatJSON,
+		LogLevel:                    "debug",
+		GRPCLogVerbosity:            LogVerbosityFull,
+		LogPayloadLimit:             4096,
+		RootMountPath:               "/var/lib/hammerspace/rootmount",
+		VolumeMarkerPath:            "/var/lib/hammerspace/volumes",
+	}
+}
+
+// GetConfig returns the current configuration. It must not be modified, use SetConfig with a copy.
+func GetConfig() *PluginConfig {
+	if cfg := currentConfig.Load(); cfg != nil {
+		return cfg
+	}
+	cfg := DefaultPluginConfig()
+	applyConfigEnv(cfg)
+	currentConfig.CompareAndSwap(nil, cfg)
+	return currentConfig.Load()
+}
+
+// SetConfig replaces the current configuration
+func SetConfig(cfg *PluginConfig) {
+	currentConfig.Store(cfg)
+}
+
+// LoadConfig reads the configuration from the defaults, the environment and the config file at path.
+// An empty path skips the config file.
+func LoadConfig(path string) (*PluginConfig, error) {
+	cfg := DefaultPluginConfig()
+	applyConfigEnv(cfg)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// fields missing from the file keep the values set above
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyConfigEnv sets the fields of the legacy environment variables, ignoring invalid values
+func applyConfigEnv(cfg *PluginConfig) {
+	if value := os.Getenv("MOUNT_CHECK_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			cfg.MountCheckTimeout = timeout
+		} else {
+			log.Warnf("Invalid MOUNT_CHECK_TIMEOUT=%s; using default %s", value, cfg.MountCheckTimeout)
+		}
+	}
+	if value := os.Getenv("UNMOUNT_RETRY_COUNT"); value != "" {
+		if count, err := strconv.Atoi(value); err == nil && count >= 0 {
+			cfg.UnmountRetryCount = count
+		} else {
+			log.Warnf("Invalid UNMOUNT_RETRY_COUNT=%s; using default %d", value, cfg.UnmountRetryCount)
+		}
+	}
+	if value := os.Getenv("UNMOUNT_RETRY_INTERVAL"); value != "" {
+		if interval, err := time.ParseDuration(value); err == nil && interval >= 0 {
+			cfg.UnmountRetryInterval = interval
+		} else {
+			log.Warnf("Invalid UNMOUNT_RETRY_INTERVAL=%s; using default %s", value, cfg.UnmountRetryInterval)
+		}
+	}
+	if value := os.Getenv("HS_DATA_PORTAL_MOUNT_PREFIX"); value != "" {
+		cfg.DataPortalMountPrefix = value
+	}
+	if value := os.Getenv("LOG_FORMAT"); value != "" {
+		cfg.LogFormat = value
+	}
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		cfg.LogLevel = value
+	}
+}
+
+// Validate checks that every field holds a usable value
+func (cfg *PluginConfig) Validate() error {
+	if cfg.MountCheckTimeout <= 0 {
+		return fmt.Errorf("mountCheckTimeout must be positive, received %s", cfg.MountCheckTimeout)
+	}
+	if cfg.UnmountRetryCount < 0 {
+		return fmt.Errorf("unmountRetryCount must not be negative, received %d", cfg.UnmountRetryCount)
+	}
+	if cfg.UnmountRetryInterval < 0 {
+		return fmt.Errorf("unmountRetryInterval must not be negative, received %s", cfg.UnmountRetryInterval)
+	}
+	if cfg.CommandExecTimeout <= 0 {
+		return fmt.Errorf("commandExecTimeout must be positive, received %s", cfg.CommandExecTimeout)
+	}
+	if cfg.LockTimeout <= 0 {
+		return fmt.Errorf("lockTimeout must be positive, received %s", cfg.LockTimeout)
+	}
+	if cfg.RestRetryCount < 0 {
+		return fmt.Errorf("restRetryCount must not be negative, received %d", cfg.RestRetryCount)
+	}
+	if cfg.RestRetryMinInterval <= 0 || cfg.RestRetryMaxInterval < cfg.RestRetryMinInterval {
+		return fmt.Errorf("restRetryMinInterval must be positive and not above restRetryMaxInterval, received %s and %s",
+			cfg.RestRetryMinInterval, cfg.RestRetryMaxInterval)
+	}
+	if cfg.RestCircuitBreakerThreshold < 0 {
+		return fmt.Errorf("restCircuitBreakerThreshold must not be negative, received %d", cfg.RestCircuitBreakerThreshold)
+	}
+	if cfg.RestCircuitBreakerCooldown <= 0 {
+		return fmt.Errorf("restCircuitBreakerCooldown must be positive, received %s", cfg.RestCircuitBreakerCooldown)
+	}
+	if cfg.TaskWaitTimeout <= 0 {
+		return fmt.Errorf("taskWaitTimeout must be positive, received %s", cfg.TaskWaitTimeout)
+	}
+	if cfg.LogFormat != LogFormatJSON && cfg.LogFormat != LogFormatText {
+		return fmt.Errorf("logFormat must be %s or %s, received '%s'", LogFormatJSON, LogFormatText, cfg.LogFormat)
+	}
+	if _, err := log.ParseLevel(cfg.LogLevel); err != nil {
+		return fmt.Errorf("logLevel is invalid: %v", err)
+	}
+	if !isLogVerbosity(cfg.GRPCLogVerbosity) {
+		return fmt.Errorf("grpcLogVerbosity must be %s, %s or %s, received '%s'",
+			LogVerbosityNone, LogVerbositySummary, LogVerbosityFull, cfg.GRPCLogVerbosity)
+	}
+	for method, verbosity := range cfg.GRPCMethodLogVerbosity {
+		if !isLogVerbosity(verbosity) {
+			return fmt.Errorf("grpcMethodLogVerbosity of %s must be %s, %s or %s, received '%s'",
+				method, LogVerbosityNone, LogVerbositySummary, LogVerbosityFull, verbosity)
+		}
+	}
+	if cfg.LogPayloadLimit < 0 {
+		return fmt.Errorf("logPayloadLimit must not be negative, received %d", cfg.LogPayloadLimit)
+	}
+	if !filepath.IsAbs(cfg.RootMountPath) {
+		return fmt.Errorf("rootMountPath must be an absolute path, received '%s'", cfg.RootMountPath)
+	}
+	if !filepath.IsAbs(cfg.VolumeMarkerPath) {
+		return fmt.Errorf("volumeMarkerPath must be an absolute path, received '%s'", cfg.VolumeMarkerPath)
+	}
+	return nil
+}
+
+func isLogVerbosity(verbosity string) bool {
+	return verbosity == LogVerbosityNone || verbosity == LogVerbositySummary || verbosity == LogVerbosityFull
+}
+
+// ReloadConfig loads the config file at path and makes it the current configuration. Fields
+// only read at startup keep their current value. On error the current configuration is kept.
+func ReloadConfig(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	current := GetConfig()
+	if cfg.RootMountPath != current.RootMountPath || cfg.VolumeMarkerPath != current.VolumeMarkerPath {
+		log.Warnf("rootMountPath and volumeMarkerPath changes take effect after a restart")
+		cfg.RootMountPath = current.RootMountPath
+		cfg.VolumeMarkerPath = current.VolumeMarkerPath
+	}
+	SetConfig(cfg)
+	if err := ApplyLogConfig(cfg); err != nil {
+		log.Errorf("Failed to apply the log configuration: %v", err)
+	}
+	log.Infof("Reloaded configuration from %s: %+v", path, *cfg)
+	return nil
+}
+
+// WatchConfig reloads the config file at path whenever its content changes, checking every
+// interval until ctx is done. Polling the content also catches ConfigMap updates, which replace
+// the file through a symlink.
+func WatchConfig(ctx context.Context, path string, interval time.Duration) {
+	last, _ := os.ReadFile(path)
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			data, err := os.ReadFile(path)
+			if err != nil || bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			if err := ReloadConfig(path); err != nil {
+				log.Errorf("Failed to reload configuration, keeping the current one: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("UNMOUNT_RETRY_COUNT", "3")
+	t.Setenv("MOUNT_CHECK_TIMEOUT", "invalid")
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.UnmountRetryCount != 3 || cfg.MountCheckTimeout != 50*time.Second {
+		t.Errorf("unexpected config from the environment: %+v", *cfg)
+	}
+
+	path := writeConfigFile(t, "mountCheckTimeout: 10s\ndataPortalMountPrefix: /mnt/data-portal\n")
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := DefaultPluginConfig()
+	expected.MountCheckTimeout = 10 * time.Second
+	expected.UnmountRetryCount = 3
+	expected.DataPortalMountPrefix = "/mnt/data-portal"
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Expected: %+v", *expected)
+		t.Errorf("Actual: %+v", *cfg)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for _, content := range []string{
+		"mountCheckTimeout: 0s\n",
+		"unmountRetryCount: -1\n",
+		"commandExecTimeout: soon\n",
+		"rootMountPath: relative/path\n",
+		"taskWaitTimeout: 0s\n",
+		"logFormat: xml\n",
+		"logLevel: loud\n",
+		"grpcLogVerbosity: verbose\n",
+		"grpcMethodLogVerbosity:\n  Probe: quiet\n",
+		"unknownField: true\n",
+	} {
+		if _, err := LoadConfig(writeConfigFile(t, content)); err == nil {
+			t.Errorf("expected an error for %q", content)
+		}
+	}
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	defer SetConfig(DefaultPluginConfig())
+	SetConfig(DefaultPluginConfig())
+
+	path := writeConfigFile(t, "unmountRetryCount: 7\nrootMountPath: /mnt/root\n")
+	if err := ReloadConfig(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := GetConfig()
+	if cfg.UnmountRetryCount != 7 {
+		t.Errorf("expected the reloaded retry count, got %d", cfg.UnmountRetryCount)
+	}
+	if cfg.RootMountPath != DefaultPluginConfig().RootMountPath {
+		t.Errorf("expected rootMountPath to be kept until restart, got %s", cfg.RootMountPath)
+	}
+
+	// an invalid file keeps the current configuration
+	if err := os.WriteFile(path, []byte("unmountRetryCount: -1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReloadConfig(path); err == nil {
+		t.Errorf("expected an error for an invalid config")
+	}
+	if GetConfig().UnmountRetryCount != 7 {
+		t.Errorf("expected the previous configuration to be kept, got %+v", *GetConfig())
+	}
+}
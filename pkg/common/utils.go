@@ -3,12 +3,16 @@ package common
 import (
 	"sync/atomic"
 	"time"
+
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
 )
 
 var cache = CsiCache()
 
 func GetCacheData(key string) (interface{}, error) {
-	if cachedData, ok := cache.Get(key); ok {
+	cachedData, ok := cache.Get(key)
+	metrics.RecordCacheLookup(key, ok)
+	if ok {
 		return cachedData, nil
 	}
 	return nil, nil
@@ -21,6 +25,11 @@ func SetCacheData(key string, value interface{}, cacheExpireTime int) {
 	cache.Set(key, value, time.Duration(cacheExpireTime)*time.Second)
 }
 
+// DeleteCacheData removes stale data before it expires
+func DeleteCacheData(key string) {
+	cache.Delete(key)
+}
+
 // GetRoundRobinOrderedList returns a round-robin ordered list of items
 func GetRoundRobinOrderedList(index *uint32, list []string) []string {
 	count := len(list)
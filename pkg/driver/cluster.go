@@ -0,0 +1,309 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Volume and snapshot IDs of volumes on an additional cluster are prefixed with
+// "<cluster>:". IDs without a prefix belong to the default cluster.
+const clusterIDSeparator = ":"
+
+// SplitClusterID returns the cluster named in the prefix of a volume or snapshot ID and the
+// ID without the prefix. Volume IDs start with "/" and snapshot IDs contain "|", so a
+// separator after either of those is part of the ID itself.
+func SplitClusterID(id string) (string, string) {
+	i := strings.Index(id, clusterIDSeparator)
+	if i <= 0 || strings.ContainsAny(id[:i], "/|") {
+		return "", id
+	}
+	return id[:i], id[i+1:]
+}
+
+// JoinClusterID prefixes a volume or snapshot ID with its cluster
+func JoinClusterID(cluster, id string) string {
+	if cluster == "" || id == "" {
+		return id
+	}
+	return cluster + clusterIDSeparator + id
+}
+
+// clusterNames returns the default cluster followed by the configured clusters
+func (c *CSIDriver) clusterNames() []string {
+	names := make([]string, 0, len(c.clusters)+1)
+	for name := range c.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{""}, names...)
+}
+
+// stripClusterIDs removes the cluster prefix from the volume and snapshot IDs of a request and
+// returns the cluster the request must be sent to
+func (c *CSIDriver) stripClusterIDs(req interface{}) (string, error) {
+	var cluster string
+	// the cluster parameter of new volumes takes precedence over IDs
+	clusterFromParams := false
+	var ids []*string
+
+	switch r := req.(type) {
+	case *csi.CreateVolumeRequest:
+		cluster, clusterFromParams = r.GetParameters()["cluster"], true
+		if snap := r.GetVolumeContentSource().GetSnapshot(); snap != nil {
+			ids = append(ids, &snap.SnapshotId)
+		}
+		if vol := r.GetVolumeContentSource().GetVolume(); vol != nil {
+			ids = append(ids, &vol.VolumeId)
+		}
+	case *csi.GetCapacityRequest:
+		cluster, clusterFromParams = r.GetParameters()["cluster"], true
+	case *csi.DeleteVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.ControllerGetVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.ControllerModifyVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+		if snapshotId, exists := r.MutableParameters[revertToSnapshotParameter]; exists {
+			ids = append(ids, &snapshotId)
+			defer func() { r.MutableParameters[revertToSnapshotParameter] = snapshotId }()
+		}
+	case *csi.ControllerExpandVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.ControllerPublishVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.ControllerUnpublishVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.ValidateVolumeCapabilitiesRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.CreateSnapshotRequest:
+		ids = append(ids, &r.SourceVolumeId)
+	case *csi.DeleteSnapshotRequest:
+		ids = append(ids, &r.SnapshotId)
+	case *csi.ListSnapshotsRequest:
+		ids = append(ids, &r.SnapshotId, &r.SourceVolumeId)
+	case *csi.CreateVolumeGroupSnapshotRequest:
+		for i := range r.SourceVolumeIds {
+			ids = append(ids, &r.SourceVolumeIds[i])
+		}
+	case *csi.DeleteVolumeGroupSnapshotRequest:
+		ids = append(ids, &r.GroupSnapshotId)
+		for i := range r.SnapshotIds {
+			ids = append(ids, &r.SnapshotIds[i])
+		}
+	case *csi.GetVolumeGroupSnapshotRequest:
+		ids = append(ids, &r.GroupSnapshotId)
+		for i := range r.SnapshotIds {
+			ids = append(ids, &r.SnapshotIds[i])
+		}
+	case *csi.NodeStageVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.NodeUnstageVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.NodePublishVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.NodeUnpublishVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.NodeGetVolumeStatsRequest:
+		ids = append(ids, &r.VolumeId)
+	case *csi.NodeExpandVolumeRequest:
+		ids = append(ids, &r.VolumeId)
+	}
+
+	clusterKnown := clusterFromParams
+	for _, id := range ids {
+		if *id == "" {
+			continue
+		}
+		idCluster, stripped := SplitClusterID(*id)
+		if clusterKnown && idCluster != cluster {
+			return "", status.Errorf(codes.InvalidArgument, common.ClusterMismatch, *id, cluster)
+		}
+		cluster, clusterKnown = idCluster, true
+		*id = stripped
+	}
+
+	if cluster != "" {
+		if _, exists := c.clusters[cluster]; !exists {
+			if clusterFromParams {
+				return "", status.Errorf(codes.InvalidArgument, common.UnknownCluster, cluster)
+			}
+			return "", status.Errorf(codes.NotFound, common.UnknownCluster, cluster)
+		}
+	}
+	return cluster, nil
+}
+
+// addClusterIDs prefixes the volume and snapshot IDs of a response with their cluster
+func addClusterIDs(rsp interface{}, cluster string) {
+	if cluster == "" {
+		return
+	}
+	addToVolume := func(vol *csi.Volume) {
+		if vol == nil {
+			return
+		}
+		vol.VolumeId = JoinClusterID(cluster, vol.VolumeId)
+		if snap := vol.GetContentSource().GetSnapshot(); snap != nil {
+			snap.SnapshotId = JoinClusterID(cluster, snap.SnapshotId)
+		}
+		if src := vol.GetContentSource().GetVolume(); src != nil {
+			src.VolumeId = JoinClusterID(cluster, src.VolumeId)
+		}
+	}
+	addToSnapshot := func(snap *csi.Snapshot) {
+		if snap == nil {
+			return
+		}
+		snap.SnapshotId = JoinClusterID(cluster, snap.SnapshotId)
+		snap.SourceVolumeId = JoinClusterID(cluster, snap.SourceVolumeId)
+		snap.GroupSnapshotId = JoinClusterID(cluster, snap.GroupSnapshotId)
+	}
+	addToGroupSnapshot := func(group *csi.VolumeGroupSnapshot) {
+		if group == nil {
+			return
+		}
+		group.GroupSnapshotId = JoinClusterID(cluster, group.GroupSnapshotId)
+		for _, snap := range group.GetSnapshots() {
+			addToSnapshot(snap)
+		}
+	}
+
+	switch r := rsp.(type) {
+	case *csi.CreateVolumeResponse:
+		addToVolume(r.GetVolume())
+	case *csi.ControllerGetVolumeResponse:
+		addToVolume(r.GetVolume())
+	case *csi.ListVolumesResponse:
+		for _, entry := range r.GetEntries() {
+			addToVolume(entry.GetVolume())
+		}
+	case *csi.CreateSnapshotResponse:
+		addToSnapshot(r.GetSnapshot())
+	case *csi.ListSnapshotsResponse:
+		for _, entry := range r.GetEntries() {
+			addToSnapshot(entry.GetSnapshot())
+		}
+	case *csi.CreateVolumeGroupSnapshotResponse:
+		addToGroupSnapshot(r.GetGroupSnapshot())
+	case *csi.GetVolumeGroupSnapshotResponse:
+		addToGroupSnapshot(r.GetGroupSnapshot())
+	}
+}
+
+// listsAllClusters reports whether a request lists the volumes or snapshots of every cluster
+func listsAllClusters(req interface{}) bool {
+	switch r := req.(type) {
+	case *csi.ListVolumesRequest:
+		return true
+	case *csi.ListSnapshotsRequest:
+		return r.GetSnapshotId() == "" && r.GetSourceVolumeId() == ""
+	}
+	return false
+}
+
+// listAllClusters sends a list request to the clusters in name order and merges the entries of
+// the responses. A token holds the cluster of the next page and the token of that cluster, and
+// each cluster is only asked for the entries still missing from the page.
+func (c *CSIDriver) listAllClusters(ctx context.Context, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	var startingToken string
+	var maxEntries int32
+	switch r := req.(type) {
+	case *csi.ListVolumesRequest:
+		startingToken, maxEntries = r.GetStartingToken(), r.GetMaxEntries()
+	case *csi.ListSnapshotsRequest:
+		startingToken, maxEntries = r.GetStartingToken(), r.GetMaxEntries()
+	}
+	if maxEntries < 0 {
+		return handler(ctx, req)
+	}
+	cursor, err := decodePageToken(startingToken)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := &csi.ListVolumesResponse{}
+	snapshots := &csi.ListSnapshotsResponse{}
+	count := int32(0)
+	nextToken := ""
+	for _, cluster := range c.clusterNames() {
+		if cluster < cursor.share {
+			continue
+		}
+		if maxEntries > 0 && count == maxEntries {
+			// the next page starts with this cluster, it may have no entries left
+			nextToken = pageCursor{share: cluster}.token()
+			break
+		}
+		clusterToken := ""
+		if cluster == cursor.share {
+			clusterToken = cursor.id
+		}
+		clusterMaxEntries := int32(0)
+		if maxEntries > 0 {
+			clusterMaxEntries = maxEntries - count
+		}
+
+		var clusterReq interface{}
+		switch r := req.(type) {
+		case *csi.ListVolumesRequest:
+			clusterReq = &csi.ListVolumesRequest{MaxEntries: clusterMaxEntries, StartingToken: clusterToken}
+		case *csi.ListSnapshotsRequest:
+			clusterReq = &csi.ListSnapshotsRequest{MaxEntries: clusterMaxEntries, StartingToken: clusterToken, Secrets: r.GetSecrets()}
+		}
+		clusterCtx, err := c.withRequestClient(ctx, clusterReq, cluster)
+		if err != nil {
+			return nil, err
+		}
+		rsp, err := handler(clusterCtx, clusterReq)
+		if err != nil {
+			return nil, err
+		}
+		addClusterIDs(rsp, cluster)
+
+		clusterNextToken := ""
+		switch r := rsp.(type) {
+		case *csi.ListVolumesResponse:
+			volumes.Entries = append(volumes.Entries, r.GetEntries()...)
+			count += int32(len(r.GetEntries()))
+			clusterNextToken = r.GetNextToken()
+		case *csi.ListSnapshotsResponse:
+			snapshots.Entries = append(snapshots.Entries, r.GetEntries()...)
+			count += int32(len(r.GetEntries()))
+			clusterNextToken = r.GetNextToken()
+		}
+		if clusterNextToken != "" {
+			nextToken = pageCursor{share: cluster, id: clusterNextToken}.token()
+			break
+		}
+	}
+
+	if _, ok := req.(*csi.ListVolumesRequest); ok {
+		volumes.NextToken = nextToken
+		return volumes, nil
+	}
+	snapshots.NextToken = nextToken
+	return snapshots, nil
+}
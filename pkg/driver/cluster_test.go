@@ -0,0 +1,315 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/client"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSplitClusterID(t *testing.T) {
+	cases := []struct {
+		id, cluster, stripped string
+	}{
+		{"/test-volume", "", "/test-volume"},
+		{"/test-backing-share/test-volume", "", "/test-backing-share/test-volume"},
+		{"east:/test-volume", "east", "/test-volume"},
+		{"2019-05-24T15-26-57-0|/test-volume", "", "2019-05-24T15-26-57-0|/test-volume"},
+		{"east:2019-05-24T15-26-57-0|/test-volume", "east", "2019-05-24T15-26-57-0|/test-volume"},
+		{"/share:with-colon", "", "/share:with-colon"},
+		{"2019-05-24T15-26-57-0|/share:with-colon", "", "2019-05-24T15-26-57-0|/share:with-colon"},
+	}
+	for _, c := range cases {
+		cluster, stripped := SplitClusterID(c.id)
+		if cluster != c.cluster || stripped != c.stripped {
+			t.Errorf("SplitClusterID(%s) = %s, %s; expected %s, %s", c.id, cluster, stripped, c.cluster, c.stripped)
+		}
+		if joined := JoinClusterID(cluster, stripped); joined != c.id {
+			t.Errorf("JoinClusterID(%s, %s) = %s; expected %s", cluster, stripped, joined, c.id)
+		}
+	}
+}
+
+func TestStripClusterIDs(t *testing.T) {
+	d := &CSIDriver{
+		clusters: map[string]*client.Credentials{"east": {Endpoint: "https://east.example.com"}},
+	}
+
+	req := &csi.DeleteVolumeRequest{VolumeId: "east:/test-volume"}
+	cluster, err := d.stripClusterIDs(req)
+	if err != nil || cluster != "east" || req.VolumeId != "/test-volume" {
+		t.Errorf("Expected east and /test-volume, got %s, %s, %v", cluster, req.VolumeId, err)
+	}
+
+	// existing IDs without a prefix use the default cluster
+	req = &csi.DeleteVolumeRequest{VolumeId: "/test-volume"}
+	cluster, err = d.stripClusterIDs(req)
+	if err != nil || cluster != "" || req.VolumeId != "/test-volume" {
+		t.Errorf("Expected default cluster and /test-volume, got %s, %s, %v", cluster, req.VolumeId, err)
+	}
+
+	_, err = d.stripClusterIDs(&csi.DeleteVolumeRequest{VolumeId: "west:/test-volume"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for unknown cluster, got %v", err)
+	}
+
+	_, err = d.stripClusterIDs(&csi.CreateVolumeRequest{
+		Name:       "test-volume",
+		Parameters: map[string]string{"cluster": "west"},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for unknown cluster parameter, got %v", err)
+	}
+
+	// content sources must be on the cluster of the new volume
+	_, err = d.stripClusterIDs(&csi.CreateVolumeRequest{
+		Name: "test-volume",
+		VolumeContentSource: &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Snapshot{
+				Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "east:2019-05-24T15-26-57-0|/test-volume"},
+			},
+		},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for snapshot on another cluster, got %v", err)
+	}
+
+	// the snapshot a volume is reverted to is on the cluster of the volume
+	modifyReq := &csi.ControllerModifyVolumeRequest{
+		VolumeId:          "east:/test-volume",
+		MutableParameters: map[string]string{revertToSnapshotParameter: "east:2019-05-24T15-26-57-0|/test-volume"},
+	}
+	cluster, err = d.stripClusterIDs(modifyReq)
+	if err != nil || cluster != "east" || modifyReq.MutableParameters[revertToSnapshotParameter] != "2019-05-24T15-26-57-0|/test-volume" {
+		t.Errorf("Expected east and an unprefixed snapshot ID, got %s, %v, %v", cluster, modifyReq.MutableParameters, err)
+	}
+
+	// all members of a group snapshot must be on the same cluster
+	groupReq := &csi.CreateVolumeGroupSnapshotRequest{
+		Name:            "test-group",
+		SourceVolumeIds: []string{"east:/test-volume-1", "east:/test-volume-2"},
+	}
+	cluster, err = d.stripClusterIDs(groupReq)
+	if err != nil || cluster != "east" || groupReq.SourceVolumeIds[1] != "/test-volume-2" {
+		t.Errorf("Expected east and /test-volume-2, got %s, %v, %v", cluster, groupReq.SourceVolumeIds, err)
+	}
+	_, err = d.stripClusterIDs(&csi.CreateVolumeGroupSnapshotRequest{
+		Name:            "test-group",
+		SourceVolumeIds: []string{"east:/test-volume-1", "/test-volume-2"},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for group members on different clusters, got %v", err)
+	}
+}
+
+func TestListSnapshotsOfUnknownCluster(t *testing.T) {
+	d := &CSIDriver{
+		clusters: map[string]*client.Credentials{"east": {Endpoint: "https://east.example.com"}},
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Errorf("Expected %v not to reach a cluster", req)
+		return nil, nil
+	}
+
+	for _, req := range []*csi.ListSnapshotsRequest{
+		{SnapshotId: "west:2019-05-24T15-26-57-0|/test-volume"},
+		{SourceVolumeId: "west:/test-volume"},
+		{SnapshotId: "east:2019-05-24T15-26-57-0|/test-volume", SourceVolumeId: "/test-volume"},
+	} {
+		rsp, err := d.routeRequest(context.Background(), req, &grpc.UnaryServerInfo{}, handler)
+		if err != nil {
+			t.Errorf("Expected no error listing %v, got %v", req, err)
+		}
+		if listed, ok := rsp.(*csi.ListSnapshotsResponse); !ok || len(listed.Entries) != 0 {
+			t.Errorf("Expected no snapshots listed for %v, got %v", req, rsp)
+		}
+	}
+}
+
+func TestAddClusterIDs(t *testing.T) {
+	rsp := &csi.CreateSnapshotResponse{
+		Snapshot: &csi.Snapshot{
+			SnapshotId:     "2019-05-24T15-26-57-0|/test-volume",
+			SourceVolumeId: "/test-volume",
+		},
+	}
+	addClusterIDs(rsp, "east")
+	if rsp.Snapshot.SnapshotId != "east:2019-05-24T15-26-57-0|/test-volume" || rsp.Snapshot.SourceVolumeId != "east:/test-volume" {
+		t.Errorf("Unexpected snapshot IDs %s, %s", rsp.Snapshot.SnapshotId, rsp.Snapshot.SourceVolumeId)
+	}
+
+	groupRsp := &csi.CreateVolumeGroupSnapshotResponse{
+		GroupSnapshot: &csi.VolumeGroupSnapshot{
+			GroupSnapshotId: "group|test-group",
+			Snapshots: []*csi.Snapshot{{
+				SnapshotId:      "2019-05-24T15-26-57-0|/test-volume",
+				SourceVolumeId:  "/test-volume",
+				GroupSnapshotId: "group|test-group",
+			}},
+		},
+	}
+	addClusterIDs(groupRsp, "east")
+	group := groupRsp.GroupSnapshot
+	if group.GroupSnapshotId != "east:group|test-group" || group.Snapshots[0].GroupSnapshotId != "east:group|test-group" ||
+		group.Snapshots[0].SnapshotId != "east:2019-05-24T15-26-57-0|/test-volume" {
+		t.Errorf("Unexpected group snapshot IDs %v", group)
+	}
+
+	volRsp := &csi.CreateVolumeResponse{Volume: &csi.Volume{VolumeId: "/test-volume"}}
+	addClusterIDs(volRsp, "")
+	if volRsp.Volume.VolumeId != "/test-volume" {
+		t.Errorf("Expected default cluster IDs to be unchanged, got %s", volRsp.Volume.VolumeId)
+	}
+}
+
+func TestListAllClustersPaging(t *testing.T) {
+	d := &CSIDriver{
+		clusters: map[string]*client.Credentials{"east": {Endpoint: "https://east.example.com"}},
+	}
+	// each cluster pages its own volumes and is only asked for the volumes missing from the page
+	var requested []int32
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		r := req.(*csi.ListVolumesRequest)
+		requested = append(requested, r.MaxEntries)
+		cursor, err := decodePageToken(r.StartingToken)
+		if err != nil {
+			return nil, err
+		}
+		ids := []string{"/test-volume-1", "/test-volume-2"}
+		start, end, nextToken := sharePage("share", ids, cursor, 0, r.MaxEntries)
+		rsp := &csi.ListVolumesResponse{NextToken: nextToken}
+		for _, id := range ids[start:end] {
+			rsp.Entries = append(rsp.Entries, &csi.ListVolumesResponse_Entry{Volume: &csi.Volume{VolumeId: id}})
+		}
+		return rsp, nil
+	}
+
+	var ids []string
+	token := ""
+	for {
+		rsp, err := d.listAllClusters(context.Background(), &csi.ListVolumesRequest{MaxEntries: 3, StartingToken: token}, handler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range rsp.(*csi.ListVolumesResponse).Entries {
+			ids = append(ids, entry.Volume.VolumeId)
+		}
+		token = rsp.(*csi.ListVolumesResponse).NextToken
+		if token == "" {
+			break
+		}
+	}
+	expected := []string{"/test-volume-1", "/test-volume-2", "east:/test-volume-1", "east:/test-volume-2"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+	if !reflect.DeepEqual(requested, []int32{3, 1, 3}) {
+		t.Errorf("Expected clusters to be asked for the missing volumes, got %v", requested)
+	}
+
+	_, err := d.listAllClusters(context.Background(), &csi.ListVolumesRequest{StartingToken: "invalid"}, handler)
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("Expected Aborted for invalid token, got %v", err)
+	}
+}
+
+func TestRootExportPerCluster(t *testing.T) {
+	dir := t.TempDir()
+	defer func(mountPath, markerPath string) {
+		common.BaseBackingShareMountPath, common.BaseVolumeMarkerSourcePath = mountPath, markerPath
+	}(common.BaseBackingShareMountPath, common.BaseVolumeMarkerSourcePath)
+	common.BaseBackingShareMountPath = filepath.Join(dir, "rootmount")
+	common.BaseVolumeMarkerSourcePath = filepath.Join(dir, "markers")
+
+	d := NewCSIDriverWithClient(client.NewFakeClient("https://anvil.fake", 1<<30))
+	defaultCtx := context.Background()
+	eastCtx := context.WithValue(defaultCtx, hsClientContextKey{}, client.Client(client.NewFakeClient("https://east.fake:8443", 1<<30)))
+
+	defaultRoot := d.rootExportOf(defaultCtx)
+	if defaultRoot.mountPath != common.BaseBackingShareMountPath || defaultRoot.markerPath != common.BaseVolumeMarkerSourcePath {
+		t.Errorf("Expected the default cluster to keep the configured paths, got %+v", defaultRoot)
+	}
+	eastRoot := d.rootExportOf(eastCtx)
+	expected := rootExport{
+		mountPath:  common.BaseBackingShareMountPath + "-east.fake_8443",
+		markerPath: common.BaseVolumeMarkerSourcePath + "-east.fake_8443",
+	}
+	if eastRoot != expected {
+		t.Errorf("Expected root export %+v, got %+v", expected, eastRoot)
+	}
+
+	// The same volume name is published from the root export of its own cluster
+	if source := defaultRoot.volumeSourcePath("/vol"); source != common.BaseBackingShareMountPath+"/vol/" {
+		t.Errorf("Unexpected source path %s on the default cluster", source)
+	}
+	if source := eastRoot.volumeSourcePath("/vol"); source != expected.mountPath+"/vol/" {
+		t.Errorf("Unexpected source path %s on cluster east", source)
+	}
+
+	// Volumes staged from one cluster keep only its root export mounted
+	if err := os.MkdirAll(eastRoot.markerPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(GetHashedMarkerPath(eastRoot.markerPath, "/vol"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !IsAnyVolumeStillMounted(eastCtx, eastRoot.markerPath) {
+		t.Error("Expected the volume of cluster east to keep its root export")
+	}
+	if IsAnyVolumeStillMounted(defaultCtx, defaultRoot.markerPath) {
+		t.Error("Expected no volume to keep the root export of the default cluster")
+	}
+}
+
+func TestPublishedNodeMarkersPerCluster(t *testing.T) {
+	dir := t.TempDir()
+	defer func(mountPath string) { common.BaseBackingShareMountPath = mountPath }(common.BaseBackingShareMountPath)
+	common.BaseBackingShareMountPath = filepath.Join(dir, "rootmount")
+
+	d := NewCSIDriverWithClient(client.NewFakeClient("https://anvil.fake", 1<<30))
+	d.NodeID = "node-1"
+	eastCtx := context.WithValue(context.Background(), hsClientContextKey{}, client.Client(client.NewFakeClient("https://east.fake", 1<<30)))
+
+	// The marker is written to the root export of the cluster the controller reads it from
+	if err := d.markVolumePublished(eastCtx, "/vol"); err != nil {
+		t.Fatal(err)
+	}
+	markerName := GetPublishedNodeMarkerName("/vol", "node-1")
+	eastMarker := filepath.Join(d.rootExportOf(eastCtx).mountPath, common.PublishedNodesDir, markerName)
+	if _, err := os.Stat(eastMarker); err != nil {
+		t.Errorf("Expected published node marker %s, got %v", eastMarker, err)
+	}
+	defaultMarker := filepath.Join(common.BaseBackingShareMountPath, common.PublishedNodesDir, markerName)
+	if _, err := os.Stat(defaultMarker); !os.IsNotExist(err) {
+		t.Errorf("Expected no published node marker on the default cluster, got %v", err)
+	}
+
+	d.unmarkVolumePublished(eastCtx, "/vol")
+	if _, err := os.Stat(eastMarker); !os.IsNotExist(err) {
+		t.Errorf("Expected published node marker %s to be removed, got %v", eastMarker, err)
+	}
+}
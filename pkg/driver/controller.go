@@ -17,8 +17,13 @@ limitations under the License.
 package driver
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -45,8 +50,21 @@ const (
 )
 
 var (
-	recentlyCreatedSnapshots = map[string]*csi.Snapshot{}
-	tracer                   = otel.Tracer("hammerspace-csi/controller")
+	tracer = otel.Tracer("hammerspace-csi/controller")
+
+	// StorageClass parameters that may be changed on an existing volume through a VolumeAttributesClass
+	mutableVolumeParameters = []string{"objectives", "exportOptions", "comment", "additionalMetadataTags", revertToSnapshotParameter}
+
+	// Frequencies accepted by the snapshotSchedule StorageClass parameter
+	snapshotScheduleFrequencies = []string{"hourly", "daily", "weekly", "monthly"}
+
+	// Directory below which the controller mounts shares to copy a snapshot into a new share
+	contentCopyDir = common.ShareStagingDir + "/content-copy-mounts"
+	// mountShareExport and unmountShareExport mount the shares a snapshot is copied between
+	mountShareExport = func(ctx context.Context, d *CSIDriver, exportPath, targetPath string) error {
+		return d.publishShareBackedVolume(ctx, exportPath, targetPath)
+	}
+	unmountShareExport = common.UnmountFilesystem
 )
 
 func parseVolParams(params map[string]string) (common.HSVolumeParameters, error) {
@@ -171,6 +189,25 @@ func parseVolParams(params map[string]string) (common.HSVolumeParameters, error)
 		vParams.ClientMountOptions = strings.Split(clientMountOptions, ",")
 	}
 
+	if scheduleParam, exists := params["snapshotSchedule"]; exists {
+		schedule := strings.ToLower(strings.TrimSpace(scheduleParam))
+		if !slices.Contains(snapshotScheduleFrequencies, schedule) {
+			return vParams, status.Errorf(codes.InvalidArgument, common.InvalidSnapshotSchedule, scheduleParam)
+		}
+		vParams.SnapshotSchedule = schedule
+	}
+
+	if retentionParam, exists := params["snapshotRetention"]; exists {
+		if vParams.SnapshotSchedule == "" {
+			return vParams, status.Error(codes.InvalidArgument, common.SnapshotRetentionWithoutSchedule)
+		}
+		retention, err := strconv.Atoi(strings.TrimSpace(retentionParam))
+		if err != nil || retention <= 0 {
+			return vParams, status.Errorf(codes.InvalidArgument, common.InvalidSnapshotRetention, retentionParam)
+		}
+		vParams.SnapshotRetention = retention
+	}
+
 	return vParams, nil
 }
 
@@ -185,6 +222,10 @@ func (d *CSIDriver) ensureNFSDirectoryExists(ctx context.Context, backingShareNa
 
 	backingShare, err := d.ensureBackingShareExists(ctx, backingShareName, hsVolume)
 	if err != nil {
+		// a snapshot schedule other than the one of the backing share
+		if status.Code(err) == codes.InvalidArgument {
+			return err
+		}
 		return status.Errorf(codes.Internal, "%s", err.Error())
 	}
 
@@ -196,28 +237,235 @@ func (d *CSIDriver) ensureNFSDirectoryExists(ctx context.Context, backingShareNa
 	defer d.UnmountBackingShareIfUnused(ctx, backingShare.Name)
 	err = d.EnsureBackingShareMounted(ctx, backingShare.Name, hsVolume) // check if share is mounted
 	if err != nil {
-		log.Errorf("failed to ensure backing share is mounted, %v", err)
+		common.Logger(ctx).Errorf("failed to ensure backing share is mounted, %v", err)
 		return err
 	}
 
 	// create NFS directory inside base share
-	err = common.MakeEmptyRawFolder(deviceFile)
+	err = common.MakeEmptyRawFolder(ctx, deviceFile)
+	if err != nil {
+		common.Logger(ctx).Errorf("failed to create backing folder for volume, %v", err)
+		return err
+	}
+
+	if hsVolume.SourceVolumeId != "" {
+		err = d.cloneDirectoryContents(ctx, backingShare, hsVolume.SourceVolumeId, deviceFile)
+		if err != nil {
+			common.Logger(ctx).Errorf("failed to clone volume %s into %s, %v", hsVolume.SourceVolumeId, deviceFile, err)
+			return err
+		}
+	}
+
+	// limit the directory to the requested capacity so it cannot fill the backing share
+	if hsVolume.Size > 0 {
+		err = common.SetDirectoryQuota(ctx, deviceFile, hsVolume.Size)
+		if errors.Is(err, common.ErrHSCommandNotFound) {
+			if !d.unlimitedDirectories {
+				return status.Errorf(codes.FailedPrecondition, common.DirectoryQuotaUnavailable, deviceFile, hsVolume.Size, err)
+			}
+			// the capacity is still recorded and reported, but not enforced
+			common.Logger(ctx).Warnf("not limiting volume directory %s to %d bytes: %v", deviceFile, hsVolume.Size, err)
+			err = nil
+		}
+		if err != nil {
+			common.Logger(ctx).Errorf("failed to set quota on volume directory %s, %v", deviceFile, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expandDirectoryVolume updates the quota of a directory volume inside a backing share.
+// Returns false if the volume is not a directory.
+func (d *CSIDriver) expandDirectoryVolume(ctx context.Context, volumeId string, requestedSize int64) (bool, error) {
+	backingShareName := path.Base(path.Dir(volumeId))
+	unlock, err := d.acquireVolumeLock(ctx, backingShareName)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	defer d.UnmountBackingShareIfUnused(ctx, backingShareName)
+	err = d.EnsureBackingShareMounted(ctx, backingShareName, &common.HSVolume{})
+	if err != nil {
+		return false, err
+	}
+
+	localPath := common.ShareStagingDir + volumeId
+	info, err := os.Stat(localPath)
+	if err != nil || !info.IsDir() {
+		return false, nil
+	}
+
+	quota, err := common.GetDirectoryQuota(localPath)
+	if err != nil {
+		common.Logger(ctx).Warnf("could not read quota of %s, %v", localPath, err)
+	}
+	if quota >= requestedSize {
+		return true, nil
+	}
+	common.Logger(ctx).Debugf("updating quota of directory volume %s from %d to %d", volumeId, quota, requestedSize)
+	err = common.SetDirectoryQuota(ctx, localPath, requestedSize)
+	if errors.Is(err, common.ErrHSCommandNotFound) {
+		if !d.unlimitedDirectories {
+			return true, status.Errorf(codes.FailedPrecondition, common.DirectoryQuotaUnavailable, localPath, requestedSize, err)
+		}
+		common.Logger(ctx).Warnf("not limiting volume directory %s to %d bytes: %v", localPath, requestedSize, err)
+		return true, nil
+	}
+	return true, err
+}
+
+// cloneDirectoryContents copies a directory volume into destination. The copy is taken
+// from a temporary snapshot of the backing share so that it is point-in-time consistent.
+// The backing share must already be mounted.
+func (d *CSIDriver) cloneDirectoryContents(ctx context.Context, backingShare *common.ShareResponse, sourceVolumeId, destination string) error {
+	snapName, err := d.getHSClient(ctx).SnapshotShare(ctx, backingShare.Name)
+	if err != nil {
+		common.Logger(ctx).Errorf("Failed to snapshot backing share %s for clone, %v", backingShare.Name, err)
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	defer d.deleteTemporarySnapshot(ctx, backingShare.Name, snapName)
+
+	source := common.ShareStagingDir + backingShare.ExportPath + "/.snapshot/" + snapName + "/" + GetVolumeNameFromPath(sourceVolumeId)
+	waitCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	if err := d.WaitForPathReady(waitCtx, source, 500*time.Millisecond); err != nil {
+		common.Logger(ctx).Errorf("Clone source %s not ready: %v", source, err)
+		return status.Errorf(codes.Internal, "clone source %s not ready: %v", source, err)
+	}
+
+	return common.CopyDirectoryContents(ctx, source, destination)
+}
+
+// snapshotCloneSourceShare takes a temporary snapshot of the share behind
+// hsVolume.SourceVolumeId and points hsVolume at it, so a clone can reuse the
+// create-from-snapshot path. The returned func removes the temporary snapshot.
+func (d *CSIDriver) snapshotCloneSourceShare(ctx context.Context, hsVolume *common.HSVolume) (func(), error) {
+	sourceShareName := GetVolumeNameFromPath(hsVolume.SourceVolumeId)
+	snapName, err := d.getHSClient(ctx).SnapshotShare(ctx, sourceShareName)
+	if err != nil {
+		common.Logger(ctx).Errorf("Failed to snapshot clone source share %s, %v", sourceShareName, err)
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	hsVolume.SourceSnapPath = snapName
+	hsVolume.SourceSnapShareName = sourceShareName
+
+	return func() { d.deleteTemporarySnapshot(ctx, sourceShareName, snapName) }, nil
+}
+
+// deleteTemporarySnapshot removes a snapshot taken for a clone, even when the request that took
+// it is cancelled
+func (d *CSIDriver) deleteTemporarySnapshot(ctx context.Context, shareName, snapName string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 60*time.Second)
+	defer cancel()
+	if err := d.getHSClient(ctx).DeleteShareSnapshot(ctx, shareName, snapName); err != nil {
+		common.Logger(ctx).Warnf("failed to remove temporary clone snapshot %s of share %s, %v", snapName, shareName, err)
+	}
+}
+
+// copySnapshotToShare copies the snapshot a share-backed volume is created from into its share,
+// through mounts of the source share and the new share, and then removes the record
+// CreateShareFromSnapshot left on the new share
+func (d *CSIDriver) copySnapshotToShare(ctx context.Context, hsVolume *common.HSVolume) error {
+	sourceShare, err := d.getHSClient(ctx).GetShare(ctx, hsVolume.SourceSnapShareName)
 	if err != nil {
-		log.Errorf("failed to create backing folder for volume, %v", err)
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if sourceShare == nil {
+		return status.Error(codes.NotFound, common.SourceSnapshotShareNotFound)
+	}
+
+	mountDir := contentCopyDir + "/" + hsVolume.Name
+	sourcePath := mountDir + "/source"
+	destination := mountDir + "/destination"
+	if err := os.MkdirAll(mountDir, 0755); err != nil {
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	defer os.Remove(mountDir)
+
+	if err := mountShareExport(ctx, d, sourceShare.ExportPath, sourcePath); err != nil {
+		common.Logger(ctx).Errorf("Failed to mount source share %s, %v", sourceShare.Name, err)
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	defer unmountShareExport(ctx, sourcePath)
+	if err := mountShareExport(ctx, d, hsVolume.Path, destination); err != nil {
+		common.Logger(ctx).Errorf("Failed to mount share %s, %v", hsVolume.Name, err)
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	defer unmountShareExport(ctx, destination)
+
+	source := sourcePath + "/.snapshot/" + path.Base(hsVolume.SourceSnapPath)
+	waitCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	if err := d.WaitForPathReady(waitCtx, source, 500*time.Millisecond); err != nil {
+		common.Logger(ctx).Errorf("Snapshot %s not ready: %v", source, err)
+		return status.Errorf(codes.Internal, "snapshot %s not ready: %v", source, err)
+	}
+	if err := common.CopyDirectoryContents(ctx, source, destination); err != nil {
 		return err
 	}
 
+	err = d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, hsVolume.Name, map[string]string{common.ContentSourceRecord: ""})
+	if err != nil {
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	return nil
+}
+
+// validateCloneSource ensures the source volume of a clone exists with the same layout
+// as the requested volume and fits within the requested capacity
+func (d *CSIDriver) validateCloneSource(ctx context.Context, sourceVolumeId string, hsVolume *common.HSVolume, backingShareName string, fileBacked bool) error {
+	var sourceSize int64
+
+	switch {
+	case fileBacked:
+		file, err := d.getHSClient(ctx).GetFile(ctx, sourceVolumeId)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		if file == nil {
+			return status.Errorf(codes.NotFound, common.SourceVolumeNotFound, sourceVolumeId)
+		}
+		sourceSize = file.Size
+	case hsVolume.MountBackingShareName != "":
+		if path.Base(path.Dir(sourceVolumeId)) != backingShareName {
+			return status.Errorf(codes.InvalidArgument, common.CloneSourceWrongShare, sourceVolumeId, backingShareName)
+		}
+		exists, err := d.getHSClient(ctx).DoesFileExist(ctx, sourceVolumeId)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		if !exists {
+			return status.Errorf(codes.NotFound, common.SourceVolumeNotFound, sourceVolumeId)
+		}
+	default:
+		share, err := d.getHSClient(ctx).GetShare(ctx, GetVolumeNameFromPath(sourceVolumeId))
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		if share == nil || share.ShareState == "REMOVED" {
+			return status.Errorf(codes.NotFound, common.SourceVolumeNotFound, sourceVolumeId)
+		}
+		sourceSize = share.Size
+	}
+
+	if sourceSize > 0 && hsVolume.Size > 0 && sourceSize > hsVolume.Size {
+		return status.Errorf(codes.OutOfRange, common.CloneSourceTooLarge, hsVolume.Size, sourceSize)
+	}
 	return nil
 }
 
 func (d *CSIDriver) ensureShareBackedVolumeExists(ctx context.Context, hsVolume *common.HSVolume) error {
 
 	// Check if the Mount Volume Exists
-	share, err := d.hsclient.GetShare(ctx, hsVolume.Name)
+	share, err := d.getHSClient(ctx).GetShare(ctx, hsVolume.Name)
 	if err != nil {
 		return fmt.Errorf("failed to get share: %w", err)
 	}
-	if share != nil {
+	// A share whose create task is still running is created again, which waits for the task
+	if share != nil && !d.getHSClient(ctx).ShareCreateTracked(hsVolume.Name) {
 		if share.Size != hsVolume.Size {
 			return status.Errorf(codes.AlreadyExists, common.VolumeExistsSizeMismatch, share.Size, hsVolume.Size)
 		}
@@ -225,22 +473,45 @@ func (d *CSIDriver) ensureShareBackedVolumeExists(ctx context.Context, hsVolume
 		if share.ShareState == "REMOVED" {
 			return status.Errorf(codes.Aborted, common.VolumeBeingDeleted)
 		}
-		return err
+		// an earlier call created the share but failed to copy its source into it
+		if _, copying := share.ExtendedInfo[common.ContentSourceRecord]; copying && (hsVolume.SourceVolumeId != "" || hsVolume.SourceSnapPath != "") {
+			if hsVolume.SourceVolumeId != "" {
+				cleanup, err := d.snapshotCloneSourceShare(ctx, hsVolume)
+				if err != nil {
+					return err
+				}
+				defer cleanup()
+			}
+			if err := d.copySnapshotToShare(ctx, hsVolume); err != nil {
+				return err
+			}
+		}
+		// the schedule is missing if an earlier call failed to configure it
+		return d.applySnapshotSchedule(ctx, hsVolume.Name, hsVolume)
+	}
+
+	if hsVolume.SourceVolumeId != "" {
+		// Clone by seeding the new share from a temporary snapshot of the source
+		cleanup, err := d.snapshotCloneSourceShare(ctx, hsVolume)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
 	}
 
 	if hsVolume.SourceSnapPath != "" {
 		// Create from snapshot
-		sourceShare, err := d.hsclient.GetShare(ctx, hsVolume.SourceSnapShareName)
+		sourceShare, err := d.getHSClient(ctx).GetShare(ctx, hsVolume.SourceSnapShareName)
 		if err != nil {
-			log.Errorf("Failed to restore from snapshot, %v", err)
+			common.Logger(ctx).Errorf("Failed to restore from snapshot, %v", err)
 			return status.Error(codes.Internal, common.UnknownError)
 		}
 		if sourceShare == nil {
 			return status.Error(codes.NotFound, common.SourceSnapshotShareNotFound)
 		}
-		snapshots, err := d.hsclient.GetShareSnapshots(ctx, hsVolume.SourceSnapShareName)
+		snapshots, err := d.getHSClient(ctx).GetShareSnapshots(ctx, hsVolume.SourceSnapShareName)
 		if err != nil {
-			log.Errorf("Failed to restore from snapshot, %v", err)
+			common.Logger(ctx).Errorf("Failed to restore from snapshot, %v", err)
 			return status.Error(codes.Internal, common.UnknownError)
 		}
 
@@ -249,7 +520,7 @@ func (d *CSIDriver) ensureShareBackedVolumeExists(ctx context.Context, hsVolume
 			return status.Error(codes.NotFound, common.SourceSnapshotNotFound)
 		}
 
-		err = d.hsclient.CreateShareFromSnapshot(
+		err = d.getHSClient(ctx).CreateShareFromSnapshot(
 			ctx,
 			hsVolume.Name,
 			hsVolume.Path,
@@ -262,11 +533,14 @@ func (d *CSIDriver) ensureShareBackedVolumeExists(ctx context.Context, hsVolume
 		)
 
 		if err != nil {
-			return status.Errorf(codes.Internal, "%s", err.Error())
+			return HSClientError(err)
+		}
+		if err := d.copySnapshotToShare(ctx, hsVolume); err != nil {
+			return err
 		}
 	} else {
 		// Share is not there, try creating a new share
-		err = d.hsclient.CreateShare(
+		err = d.getHSClient(ctx).CreateShare(
 			ctx,
 			hsVolume.Name,
 			hsVolume.Path,
@@ -278,40 +552,44 @@ func (d *CSIDriver) ensureShareBackedVolumeExists(ctx context.Context, hsVolume
 		)
 
 		if err != nil {
-			return status.Errorf(codes.Internal, "%s", err.Error())
+			return HSClientError(err)
 		}
 	}
+	err = d.applySnapshotSchedule(ctx, hsVolume.Name, hsVolume)
+	if err != nil {
+		return err
+	}
 	// generate unique target path on host for setting file metadata
 	// mount -t nfs 10:200.../share1 /tmp/metadata-mounts/share1
 	targetPath := common.ShareStagingDir + "/metadata-mounts" + hsVolume.Path
-	log.Debugf("Creating empty folder with path %s", targetPath)
+	common.Logger(ctx).Debugf("Creating empty folder with path %s", targetPath)
 
-	defer common.UnmountFilesystem(targetPath)
+	defer common.UnmountFilesystem(ctx, targetPath)
 
-	log.Debugf("Created empty folder with path %s", targetPath)
+	common.Logger(ctx).Debugf("Created empty folder with path %s", targetPath)
 	err = d.publishShareBackedVolume(ctx, hsVolume.Path, targetPath)
 	if err != nil {
-		log.Warnf("failed to get share backed volume on hsVolumePath %s targetPath %s. Err %v", hsVolume.Path, targetPath, err)
+		common.Logger(ctx).Warnf("failed to get share backed volume on hsVolumePath %s targetPath %s. Err %v", hsVolume.Path, targetPath, err)
 	}
-	log.Debugf("Published share backed volume %s on targetpath %s", hsVolume.Path, targetPath)
+	common.Logger(ctx).Debugf("Published share backed volume %s on targetpath %s", hsVolume.Path, targetPath)
 
 	// The hs client expects a trailing slash for directories
-	err = common.SetMetadataTags(targetPath+"/", hsVolume.AdditionalMetadataTags)
+	err = common.SetMetadataTags(ctx, targetPath+"/", hsVolume.AdditionalMetadataTags)
 	if err != nil {
-		log.Warnf("failed to set additional metadata on share %v", err)
+		common.Logger(ctx).Warnf("failed to set additional metadata on share %v", err)
 	}
-	log.Debugf("Apply metadata finshed on published share backed volume %s", targetPath)
+	common.Logger(ctx).Debugf("Apply metadata finshed on published share backed volume %s", targetPath)
 
 	return nil
 }
 
 func (d *CSIDriver) ensureBackingShareExists(ctx context.Context, backingShareName string, hsVolume *common.HSVolume) (*common.ShareResponse, error) {
-	share, err := d.hsclient.GetShare(ctx, backingShareName)
+	share, err := d.getHSClient(ctx).GetShare(ctx, backingShareName)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "%s", err.Error())
 	}
-	if share == nil {
-		err = d.hsclient.CreateShare(
+	if share == nil || d.getHSClient(ctx).ShareCreateTracked(backingShareName) {
+		err = d.getHSClient(ctx).CreateShare(
 			ctx,
 			backingShareName,
 			hsVolume.Path,
@@ -322,44 +600,48 @@ func (d *CSIDriver) ensureBackingShareExists(ctx context.Context, backingShareNa
 			hsVolume.Comment,
 		)
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "%s", err.Error())
+			return nil, HSClientError(err)
 		}
-		share, err = d.hsclient.GetShare(ctx, backingShareName)
+		share, err = d.getHSClient(ctx).GetShare(ctx, backingShareName)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "%s", err.Error())
 		}
-		log.Infof("Checking if get share response back non nil share.")
+		common.Logger(ctx).Infof("Checking if get share response back non nil share.")
 		if share == nil {
-			log.Errorf("Error while creating share from ensure backing share exist method.")
+			common.Logger(ctx).Errorf("Error while creating share from ensure backing share exist method.")
 			return nil, fmt.Errorf("requested share [%s] not found", backingShareName)
 		}
 		// generate unique target path on host for setting file metadata
 		targetPath := common.ShareStagingDir + "/metadata-mounts" + hsVolume.Path
-		defer common.UnmountFilesystem(targetPath)
+		defer common.UnmountFilesystem(ctx, targetPath)
 		err = d.publishShareBackedVolume(ctx, hsVolume.Path, targetPath)
 		if err != nil {
-			log.Warnf("failed to get share backed volume on hsVolumePath %s targetPath %s. Err %v", hsVolume.Path, targetPath, err)
+			common.Logger(ctx).Warnf("failed to get share backed volume on hsVolumePath %s targetPath %s. Err %v", hsVolume.Path, targetPath, err)
 		}
-		err = common.SetMetadataTags(targetPath+"/", hsVolume.AdditionalMetadataTags)
+		err = common.SetMetadataTags(ctx, targetPath+"/", hsVolume.AdditionalMetadataTags)
 		if err != nil {
-			log.Warnf("failed to set additional metadata on share %v", err)
+			common.Logger(ctx).Warnf("failed to set additional metadata on share %v", err)
 		}
 	}
+	// an existing backing share gets the schedule again once its last volume removed it
+	if scheduleErr := d.applySnapshotSchedule(ctx, backingShareName, hsVolume); scheduleErr != nil {
+		return nil, scheduleErr
+	}
 
 	return share, err
 }
 
 func (d *CSIDriver) ensureDeviceFileExists(ctx context.Context, backingShare *common.ShareResponse, hsVolume *common.HSVolume) error {
-	log.WithFields(log.Fields{
-		"backingShare": backingShare,
-		"hsVolume":     hsVolume,
+	common.Logger(ctx).WithFields(log.Fields{
+		"backing_share": backingShare,
+		"hs_volume":     hsVolume,
 	}).Debug("ensureDeviceFileExists is called.")
 
 	hsVolume.Path = backingShare.ExportPath + "/" + hsVolume.Name
-	log.Debugf("checking if file exist %s", hsVolume.Path)
+	common.Logger(ctx).Debugf("checking if file exist %s", hsVolume.Path)
 
 	// Step 1: Check if file already exists in metadata
-	file, err := d.hsclient.GetFile(ctx, hsVolume.Path)
+	file, err := d.getHSClient(ctx).GetFile(ctx, hsVolume.Path)
 	if err != nil {
 		return status.Errorf(codes.Internal, "%s", err.Error())
 	}
@@ -386,12 +668,39 @@ func (d *CSIDriver) ensureDeviceFileExists(ctx context.Context, backingShare *co
 	backingDir := common.ShareStagingDir + backingShare.ExportPath
 	deviceFile := backingDir + "/" + hsVolume.Name
 
-	// Step 3: Create file from snapshot or empty
-	if hsVolume.SourceSnapPath != "" {
+	// Step 3: Create file from snapshot, clone or empty
+	if hsVolume.SourceVolumeId != "" {
+		// Clone by restoring a temporary snapshot of the source file
+		snapName, err := d.getHSClient(ctx).SnapshotFile(ctx, hsVolume.SourceVolumeId)
+		if err != nil {
+			common.Logger(ctx).Errorf("Failed to snapshot clone source file %s, %v", hsVolume.SourceVolumeId, err)
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		hsVolume.SourceSnapPath = snapName
+		defer func() {
+			if err := d.getHSClient(ctx).DeleteFileSnapshot(ctx, hsVolume.SourceVolumeId, snapName); err != nil {
+				common.Logger(ctx).Warnf("failed to remove temporary clone snapshot %s of file %s, %v", snapName, hsVolume.SourceVolumeId, err)
+			}
+		}()
+	}
+	restored := false
+	if hsVolume.SourceSnapPath != "" && hsVolume.SourceVolumeId == "" {
+		restored, err = d.restoreFromBackingShareSnapshot(ctx, backingShare, hsVolume, deviceFile)
+		if err != nil {
+			common.Logger(ctx).Errorf("Failed to restore from snapshot, %v", err)
+			return err
+		}
+	}
+	if restored {
+		common.Logger(ctx).Debugf("ensureDeviceFileExists restored %s from a snapshot of its backing share", deviceFile)
+	} else if hsVolume.SourceSnapPath != "" {
 		// Restore from snapshot
-		err := d.hsclient.RestoreFileSnapToDestination(ctx, hsVolume.SourceSnapPath, hsVolume.Path)
+		err := d.getHSClient(ctx).RestoreFileSnapToDestination(ctx, hsVolume.SourceSnapPath, hsVolume.Path)
 		if err != nil {
-			log.Errorf("Failed to restore from snapshot, %v", err)
+			common.Logger(ctx).Errorf("Failed to restore from snapshot, %v", err)
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
 			return status.Error(codes.NotFound, common.UnknownError)
 		}
 	} else {
@@ -400,28 +709,28 @@ func (d *CSIDriver) ensureDeviceFileExists(ctx context.Context, backingShare *co
 
 		err = d.EnsureBackingShareMounted(ctx, backingShare.Name, hsVolume)
 		if err != nil {
-			log.Errorf("failed to ensure backing share is mounted, %v", err)
+			common.Logger(ctx).Errorf("failed to ensure backing share is mounted, %v", err)
 			return err
 		}
 
-		log.Debugf("ensureDeviceFileExists mounted backing share %s", backingShare.Name)
+		common.Logger(ctx).Debugf("ensureDeviceFileExists mounted backing share %s", backingShare.Name)
 
-		err = common.MakeEmptyRawFile(deviceFile, hsVolume.Size)
+		err = common.MakeEmptyRawFile(ctx, deviceFile, hsVolume.Size)
 		if err != nil {
-			log.Errorf("failed to create backing file for volume, %v", err)
+			common.Logger(ctx).Errorf("failed to create backing file for volume, %v", err)
 			return err
 		}
 
 		// Add filesystem
-		log.Debugf("ensureDeviceFileExists created empty raw file over backing share %s and path %s", backingShare.Name, deviceFile)
+		common.Logger(ctx).Debugf("ensureDeviceFileExists created empty raw file over backing share %s and path %s", backingShare.Name, deviceFile)
 		if hsVolume.FSType != "" {
-			err = common.FormatDevice(deviceFile, hsVolume.FSType)
+			err = common.FormatDevice(ctx, deviceFile, hsVolume.FSType)
 			if err != nil {
-				log.Errorf("failed to format volume, %v", err)
+				common.Logger(ctx).Errorf("failed to format volume, %v", err)
 				return err
 			}
 		}
-		log.Debugf("ensureDeviceFileExists formatted file %s, with fstype %s", deviceFile, hsVolume.FSType)
+		common.Logger(ctx).Debugf("ensureDeviceFileExists formatted file %s, with fstype %s", deviceFile, hsVolume.FSType)
 	}
 
 	// Step 4: Use a fresh context to apply metadata
@@ -430,12 +739,39 @@ func (d *CSIDriver) ensureDeviceFileExists(ctx context.Context, backingShare *co
 
 	err = d.applyObjectiveAndMetadata(metadataCtx, backingShare, hsVolume, deviceFile)
 	if err != nil {
-		log.Warnf("Unable to apply objective and metadata over backing share %s, device path %s: %v", backingShare.Name, deviceFile, err)
+		common.Logger(ctx).Warnf("Unable to apply objective and metadata over backing share %s, device path %s: %v", backingShare.Name, deviceFile, err)
 	}
 
 	return nil
 }
 
+// restoreFromBackingShareSnapshot copies the device file of a volume created from a member of a
+// group snapshot out of the snapshot of the backing share of its source. It reports false when
+// the snapshot is a file snapshot instead.
+func (d *CSIDriver) restoreFromBackingShareSnapshot(ctx context.Context, backingShare *common.ShareResponse, hsVolume *common.HSVolume, deviceFile string) (bool, error) {
+	sourceShareName := GetSnapshotRecordShareName(hsVolume.SourceSnapVolumeId, false)
+	snapshots, err := d.getHSClient(ctx).GetShareSnapshots(ctx, sourceShareName)
+	if err != nil || !slice.ContainsString(snapshots, hsVolume.SourceSnapPath, strings.TrimSpace) {
+		return false, nil
+	}
+	sourceShare, err := d.getHSClient(ctx).GetShare(ctx, sourceShareName)
+	if err != nil {
+		return true, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if sourceShare == nil {
+		return true, status.Error(codes.NotFound, common.SourceSnapshotShareNotFound)
+	}
+
+	for _, shareName := range []string{sourceShareName, backingShare.Name} {
+		defer d.UnmountBackingShareIfUnused(ctx, shareName)
+		if err := d.EnsureBackingShareMounted(ctx, shareName, hsVolume); err != nil {
+			return true, err
+		}
+	}
+	source := common.ShareStagingDir + sourceShare.ExportPath + "/.snapshot/" + hsVolume.SourceSnapPath + "/" + path.Base(hsVolume.SourceSnapVolumeId)
+	return true, common.CopyFile(ctx, source, deviceFile)
+}
+
 // ensure from hs system /share/file exist to apply objective and metadata
 func (d *CSIDriver) applyObjectiveAndMetadata(ctx context.Context, backingShare *common.ShareResponse, hsVolume *common.HSVolume, deviceFile string) error {
 	b := &backoff.Backoff{
@@ -450,47 +786,47 @@ func (d *CSIDriver) applyObjectiveAndMetadata(ctx context.Context, backingShare
 		dur := b.Duration()
 		time.Sleep(dur)
 		// Wait for file to exist on metadata server
-		log.Debugf("Checking existance of file %s", hsVolume.Path)
-		backingFileExists, err = d.hsclient.DoesFileExist(ctx, hsVolume.Path)
+		common.Logger(ctx).Debugf("Checking existance of file %s", hsVolume.Path)
+		backingFileExists, err = d.getHSClient(ctx).DoesFileExist(ctx, hsVolume.Path)
 		if err != nil {
-			log.Warnf("Error checking file existence: %v", err)
+			common.Logger(ctx).Warnf("Error checking file existence: %v", err)
 			time.Sleep(time.Second)
 			continue
 		}
 		if backingFileExists {
-			log.Debugf("Successfully found backing file %s", hsVolume.Path)
+			common.Logger(ctx).Debugf("Successfully found backing file %s", hsVolume.Path)
 			break
 		}
-		log.Warnf("File does not exist yet: %s", hsVolume.Path)
+		common.Logger(ctx).Warnf("File does not exist yet: %s", hsVolume.Path)
 	}
 
 	if !backingFileExists {
-		log.Errorf("backing file failed to show up in API after 10 minutes")
+		common.Logger(ctx).Errorf("backing file failed to show up in API after 10 minutes")
 		return err
 	}
 
 	if len(hsVolume.Objectives) > 0 {
 		filePath := GetVolumeNameFromPath(hsVolume.Path)
-		err = d.hsclient.SetObjectives(ctx, backingShare.Name, filePath, hsVolume.Objectives, true)
+		err = d.getHSClient(ctx).SetObjectives(ctx, backingShare.Name, filePath, hsVolume.Objectives, true)
 		if err != nil {
-			log.Errorf("failed to set objectives on backing file for volume: %v\n", err)
+			common.Logger(ctx).Errorf("failed to set objectives on backing file for volume: %v\n", err)
 			return err
 		}
 	}
 
 	// Set additional metadata on file
-	err = common.SetMetadataTags(deviceFile, hsVolume.AdditionalMetadataTags)
+	err = common.SetMetadataTags(ctx, deviceFile, hsVolume.AdditionalMetadataTags)
 	if err != nil {
-		log.Errorf("Failed to set additional metadata on backing file for volume: %v\n", err)
+		common.Logger(ctx).Errorf("Failed to set additional metadata on backing file for volume: %v\n", err)
 	}
 	return err
 }
 
 func (d *CSIDriver) ensureFileBackedVolumeExists(ctx context.Context, hsVolume *common.HSVolume, backingShareName string) error {
 
-	log.WithFields(log.Fields{
-		"backingShareName": backingShareName,
-		"hsVolume":         hsVolume,
+	common.Logger(ctx).WithFields(log.Fields{
+		"backing_share": backingShareName,
+		"hs_volume":     hsVolume,
 	}).Debugf("ensureFileBackedVolumeExists is called.")
 	// Check if backing share exists
 	// Acquire BEFORE defer; with timeout so we never hang forever
@@ -503,14 +839,51 @@ func (d *CSIDriver) ensureFileBackedVolumeExists(ctx context.Context, hsVolume *
 
 	backingShare, err := d.ensureBackingShareExists(ctx, backingShareName, hsVolume)
 	if err != nil {
+		// a snapshot schedule other than the one of the backing share
+		if status.Code(err) == codes.InvalidArgument {
+			return err
+		}
 		return status.Errorf(codes.Internal, "%s", err.Error())
 	}
-	log.Debugf("Backing share existed %s", backingShareName)
+	common.Logger(ctx).Debugf("Backing share existed %s", backingShareName)
 	err = d.ensureDeviceFileExists(ctx, backingShare, hsVolume)
 
 	return err
 }
 
+// validateObjectives ensures every objective exists on the cluster
+func (d *CSIDriver) validateObjectives(ctx context.Context, objectives []string) error {
+	var clusterObjectiveNames []string
+	cachedObjectiveList, err := common.GetCacheData(d.getHSClient(ctx).CacheKey("OBJECTIVE_LIST_NAMES"))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if cachedObjectiveList != nil {
+		if cached, ok := cachedObjectiveList.([]string); ok && len(cached) > 0 {
+			// If cached objective list is not nil and not empty, assign it to clusterObjectiveNames
+			clusterObjectiveNames = cached
+		}
+	} else {
+		// If cached objective list is nil or empty, fetch it from the API
+		clusterObjectiveNames, err = d.getHSClient(ctx).ListObjectiveNames(ctx)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	for _, o := range objectives {
+		common.Logger(ctx).Debugf("Checking for objective inside the objective list.")
+		if !IsValueInList(o, clusterObjectiveNames) {
+			common.Logger(ctx).WithFields(log.Fields{
+				"objectives": clusterObjectiveNames,
+			}).Errorf("No objective found in objective list")
+			return status.Errorf(codes.InvalidArgument, common.InvalidObjectiveNameDoesNotExist, o)
+		}
+		common.Logger(ctx).Debugf("Found objective supplied in Storage class objective params.")
+	}
+	return nil
+}
+
 func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
 	// Start a span for tracing
 	ctx, span := tracer.Start(ctx, "Controller/CreateVolume", trace.WithAttributes(
@@ -530,14 +903,29 @@ func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeReque
 		return nil, status.Errorf(codes.InvalidArgument, common.NoCapabilitiesSupplied, req.Name)
 	}
 
-	vParams, err := parseVolParams(req.Parameters)
+	// Mutable parameters from a VolumeAttributesClass take precedence over the StorageClass
+	params := make(map[string]string, len(req.Parameters)+len(req.MutableParameters))
+	for k, v := range req.Parameters {
+		params[k] = v
+	}
+	for k, v := range req.MutableParameters {
+		params[k] = v
+	}
+
+	vParams, err := parseVolParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	accessibleTopology, err := d.volumeTopology(ctx, req.GetAccessibilityRequirements())
 	if err != nil {
 		return nil, err
 	}
 
-	// Check for snapshot source specified
+	// Check for snapshot or volume source specified
 	cs := req.VolumeContentSource
 	snap := cs.GetSnapshot()
+	srcVolume := cs.GetVolume()
 
 	// Get volumeMode
 	var fsType, volumeMode string
@@ -593,6 +981,7 @@ func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeReque
 	} else if filesystemRequested {
 		backingShareName = vParams.MountBackingShareName
 		if backingShareName == "" && fsType == "nfs" {
+			volumeName = GetShareVolumeName(volumeName)
 			backingShareName = volumeName
 		}
 	}
@@ -618,11 +1007,13 @@ func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeReque
 		Comment:                vParams.Comment,
 		FQDN:                   vParams.FQDN,
 		ClientMountOptions:     vParams.ClientMountOptions,
+		SnapshotSchedule:       vParams.SnapshotSchedule,
+		SnapshotRetention:      vParams.SnapshotRetention,
 	}
 
 	// if it's file backed, we should check capacity of backing share
 	if requestedSize > 0 {
-		freeCapacity, err := common.GetCacheData("FREE_CAPACITY")
+		freeCapacity, err := common.GetCacheData(d.getHSClient(ctx).CacheKey("FREE_CAPACITY"))
 		if err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
@@ -636,9 +1027,9 @@ func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeReque
 				return nil, status.Error(codes.Internal, "unexpected type for free capacity")
 			}
 		} else {
-			log.Infof("getting free capacity from (/cntl/state) api response")
+			common.Logger(ctx).Infof("getting free capacity from (/cntl/state) api response")
 			// Call your function to get the free capacity from the API response here
-			available, err = d.hsclient.GetClusterAvailableCapacity(ctx)
+			available, err = d.getHSClient(ctx).GetClusterAvailableCapacity(ctx)
 			if err != nil {
 				return nil, status.Error(codes.Internal, err.Error())
 			}
@@ -650,33 +1041,9 @@ func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeReque
 	}
 
 	// Check if objectives exist on the cluster
-	var clusterObjectiveNames []string
-	cachedObjectiveList, err := common.GetCacheData("OBJECTIVE_LIST_NAMES")
+	err = d.validateObjectives(ctx, vParams.Objectives)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	}
-	if cachedObjectiveList != nil {
-		if objectives, ok := cachedObjectiveList.([]string); ok && len(objectives) > 0 {
-			// If cached objective list is not nil and not empty, assign it to clusterObjectiveNames
-			clusterObjectiveNames = objectives
-		}
-	} else {
-		// If cached objective list is nil or empty, fetch it from the API
-		clusterObjectiveNames, err = d.hsclient.ListObjectiveNames(ctx)
-		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
-		}
-	}
-
-	for _, o := range vParams.Objectives {
-		log.Debugf("Checking for objective inside the objective list.")
-		if !IsValueInList(o, clusterObjectiveNames) {
-			log.WithFields(log.Fields{
-				"Supllied objective list": clusterObjectiveNames,
-			}).Errorf("No objective found in objective list")
-			return nil, status.Errorf(codes.InvalidArgument, common.InvalidObjectiveNameDoesNotExist, o)
-		}
-		log.Debugf("Found objective supplied in Storage class objective params.")
+		return nil, err
 	}
 
 	// Create Volume
@@ -700,30 +1067,61 @@ func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeReque
 			return nil, status.Error(codes.NotFound, err.Error())
 		}
 		hsVolume.SourceSnapShareName = sourceSnapShareName
+		_, hsVolume.SourceSnapVolumeId, _ = strings.Cut(snap.GetSnapshotId(), "|")
+
+		common.Logger(ctx).Info("using snapshot as volume source")
+	}
+
+	if srcVolume != nil {
+		sourceVolumeId := srcVolume.GetVolumeId()
+		if sourceVolumeId == "" {
+			return nil, status.Error(codes.InvalidArgument, common.EmptyVolumeId)
+		}
+		// Hold the source volume so it cannot be deleted while it is being cloned
+		unlockSource, err := d.acquireVolumeLock(ctx, sourceVolumeId)
+		if err != nil {
+			return nil, err
+		}
+		defer unlockSource()
+
+		err = d.validateCloneSource(ctx, sourceVolumeId, hsVolume, backingShareName, fileBacked)
+		if err != nil {
+			return nil, err
+		}
+		hsVolume.SourceVolumeId = sourceVolumeId
 
-		log.Info("using snapshot as volume source")
+		common.Logger(ctx).Infof("using volume %s as volume source", sourceVolumeId)
 	}
 
-	log.Infof("Volume Mode=%s, fsType=%s, Block=%t, FileBacked=%t", volumeMode, fsType, blockRequested, fileBacked)
+	common.Logger(ctx).Infof("Volume Mode=%s, fsType=%s, Block=%t, FileBacked=%t", volumeMode, fsType, blockRequested, fileBacked)
 
 	if !fileBacked && fsType == "nfs" && vParams.MountBackingShareName != "" {
 		// This function is called when user want new nfs share inside one base share
-		log.Debugf("Creating share for NFS volume inside base NFS share dir %s with path %s", vParams.MountBackingShareName, hsVolume.Path)
+		common.Logger(ctx).Debugf("Creating share for NFS volume inside base NFS share dir %s with path %s", vParams.MountBackingShareName, hsVolume.Path)
 		err := d.ensureNFSDirectoryExists(ctx, backingShareName, hsVolume)
 		if err != nil {
-			log.Errorf("failed to ensure base NFS share (%s): %v", backingShareName, err)
+			common.Logger(ctx).Errorf("failed to ensure base NFS share (%s): %v", backingShareName, err)
+			if code := status.Code(err); code == codes.FailedPrecondition || code == codes.InvalidArgument {
+				return nil, err
+			}
 			return nil, status.Errorf(codes.Internal, "failed to ensure base NFS share (%s): %v", backingShareName, err)
 		}
 		// mark the NFS created folder as a backing share, so that it can be used as ID for volumeDelete
 		hsVolume.Path = common.SharePathPrefix + backingShareName + "/" + hsVolume.Name
 		volID = fmt.Sprintf("%s/%s", volumePath, volumeName)
+		if err := d.recordVolume(ctx, backingShareName, volumeName, hsVolume.Size); err != nil {
+			return nil, status.Errorf(codes.Internal, common.VolumeRecordFailed, volumeName, backingShareName, err)
+		}
 	} else if fileBacked {
 		// This function will be called in case of Block and File backed share
-		log.Debugf("Creating share for File system volume (block or files) inside base backingshare name dir %s with path %s", backingShareName, hsVolume.Path)
+		common.Logger(ctx).Debugf("Creating share for File system volume (block or files) inside base backingshare name dir %s with path %s", backingShareName, hsVolume.Path)
 		err = d.ensureFileBackedVolumeExists(ctx, hsVolume, backingShareName)
 		if err != nil {
 			return nil, err
 		}
+		if err := d.recordVolume(ctx, backingShareName, volumeName, hsVolume.Size); err != nil {
+			return nil, status.Errorf(codes.Internal, common.VolumeRecordFailed, volumeName, backingShareName, err)
+		}
 
 	} else {
 		// NOTE
@@ -732,7 +1130,7 @@ func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeReque
 		// In that case all new created share will have path like /k8s-nfs-share/pvc-csi-uuid
 		// Then we create snapshot of that share /pvc-csi-uuid which will be inside /k8s-nfs-share/.snapshot
 		// Then restore the snapshot to the new created share from snapshot content source.
-		log.Debugf("Creating share for NFS volume with path %s", hsVolume.Path)
+		common.Logger(ctx).Debugf("Creating share for NFS volume with path %s", hsVolume.Path)
 		err = d.ensureShareBackedVolumeExists(ctx, hsVolume)
 		if err != nil {
 			return nil, err
@@ -752,13 +1150,14 @@ func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeReque
 		volContext["fsType"] = fsType
 	}
 
-	log.Infof("Total time taken for create volume %v", time.Since(startTime))
+	common.Logger(ctx).Infof("Total time taken for create volume %v", time.Since(startTime))
 
 	resp := &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
-			CapacityBytes: hsVolume.Size,
-			VolumeId:      volID,
-			VolumeContext: volContext,
+			CapacityBytes:      hsVolume.Size,
+			VolumeId:           volID,
+			VolumeContext:      volContext,
+			AccessibleTopology: accessibleTopology,
 		},
 	}
 
@@ -770,20 +1169,28 @@ func (d *CSIDriver) CreateVolume(ctx context.Context, req *csi.CreateVolumeReque
 				},
 			},
 		}
+	} else if srcVolume != nil {
+		resp.Volume.ContentSource = &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Volume{
+				Volume: &csi.VolumeContentSource_VolumeSource{
+					VolumeId: srcVolume.GetVolumeId(),
+				},
+			},
+		}
 	}
 
-	log.WithField("response", resp).Info("volume was created")
+	common.Logger(ctx).WithField("response", resp).Info("volume was created")
 	return resp, nil
 }
 
 func (d *CSIDriver) deleteFileBackedVolume(ctx context.Context, filepath string) error {
 	var exists bool
-	if exists, _ = d.hsclient.DoesFileExist(ctx, filepath); exists {
-		log.Debugf("found file-backed volume to delete, %s", filepath)
+	if exists, _ = d.getHSClient(ctx).DoesFileExist(ctx, filepath); exists {
+		common.Logger(ctx).Debugf("found file-backed volume to delete, %s", filepath)
 	}
 
 	// Check if file has snapshots and fail
-	snaps, _ := d.hsclient.GetFileSnapshots(ctx, filepath)
+	snaps, _ := d.getHSClient(ctx).GetFileSnapshots(ctx, filepath)
 	if len(snaps) > 0 {
 		return status.Errorf(codes.FailedPrecondition, common.VolumeDeleteHasSnapshots)
 	}
@@ -810,12 +1217,12 @@ func (d *CSIDriver) deleteFileBackedVolume(ctx context.Context, filepath string)
 		defer d.UnmountBackingShareIfUnused(ctx, residingShareName)
 		err = d.EnsureBackingShareMounted(ctx, residingShareName, hsVolume) // check if share is mounted
 		if err != nil {
-			log.Errorf("failed to ensure backing share is mounted, %v", err)
+			common.Logger(ctx).Errorf("failed to ensure backing share is mounted, %v", err)
 			return status.Errorf(codes.Internal, "%s", err.Error())
 		}
 		// Delete File
 		volumeName := GetVolumeNameFromPath(filepath)
-		err = common.DeleteFile(destination + "/" + volumeName)
+		err = common.DeleteFile(ctx, destination+"/"+volumeName)
 		if err != nil {
 			return status.Errorf(codes.Internal, "%s", err.Error())
 		}
@@ -825,13 +1232,20 @@ func (d *CSIDriver) deleteFileBackedVolume(ctx context.Context, filepath string)
 }
 
 func (d *CSIDriver) deleteShareBackedVolume(ctx context.Context, share *common.ShareResponse) error {
-	// Check for snapshots
-	snaps, err := d.hsclient.GetShareSnapshots(ctx, share.Name)
+	// Check for snapshots, other than those taken by the snapshot schedule of the volume
+	snaps, err := d.getHSClient(ctx).GetShareSnapshots(ctx, share.Name)
 	if err != nil {
 		return status.Errorf(codes.Internal, "%s", err.Error())
 	}
-	if len(snaps) > 0 {
-		return status.Errorf(codes.FailedPrecondition, common.VolumeDeleteHasSnapshots)
+	for _, snap := range snaps {
+		if !isScheduledSnapshot(snap) {
+			return status.Errorf(codes.FailedPrecondition, common.VolumeDeleteHasSnapshots)
+		}
+	}
+
+	// Snapshots taken by the schedule of the volume go with it
+	if err := d.removeSnapshotSchedule(ctx, share); err != nil {
+		return err
 	}
 
 	deleteDelay := int64(-1)
@@ -839,12 +1253,12 @@ func (d *CSIDriver) deleteShareBackedVolume(ctx context.Context, share *common.S
 		if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
 			deleteDelay = parsed
 		} else {
-			log.Warnf("csi_delete_delay extended info, %s, should be an integer, on share %s; falling back to cluster defaults", v, share.Name)
+			common.Logger(ctx).Warnf("csi_delete_delay extended info, %s, should be an integer, on share %s; falling back to cluster defaults", v, share.Name)
 		}
 	}
-	err = d.hsclient.DeleteShare(ctx, share.Name, deleteDelay)
+	err = d.getHSClient(ctx).DeleteShare(ctx, share.Name, deleteDelay)
 	if err != nil {
-		return status.Errorf(codes.Internal, "%s", err.Error())
+		return HSClientError(err)
 	}
 	return nil
 }
@@ -857,7 +1271,7 @@ func (d *CSIDriver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeReque
 	defer span.End()
 
 	volumeId := req.GetVolumeId()
-	log.Infof("Delete volume request for volume id, %s", volumeId)
+	common.Logger(ctx).Infof("Delete volume request for volume id, %s", volumeId)
 	//  If the volume is not specified, return error
 	if volumeId == "" {
 		return nil, status.Error(codes.InvalidArgument, common.EmptyVolumeId)
@@ -871,14 +1285,20 @@ func (d *CSIDriver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeReque
 	defer unlock()
 
 	volumeName := GetVolumeNameFromPath(volumeId)
-	share, err := d.hsclient.GetShare(ctx, volumeName)
+	share, err := d.getHSClient(ctx).GetShare(ctx, volumeName)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "%s", err.Error())
 	}
 	if share == nil { // Share does not exist, may be a file-backed volume
 		err = d.deleteFileBackedVolume(ctx, volumeId)
-
-		return &csi.DeleteVolumeResponse{}, err
+		if err != nil {
+			return &csi.DeleteVolumeResponse{}, err
+		}
+		err = d.removeVolumeRecord(ctx, path.Base(path.Dir(volumeId)), volumeName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		return &csi.DeleteVolumeResponse{}, nil
 	} else { // Share exists and is a Filesystem
 		err = d.deleteShareBackedVolume(ctx, share)
 		return &csi.DeleteVolumeResponse{}, err
@@ -886,57 +1306,305 @@ func (d *CSIDriver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeReque
 
 }
 
-// ControllerGetVolume implements the ControllerServer interface for CSI.
-// This is a stub implementation; you should update it to provide actual logic as needed.
-func (c *CSIDriver) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "ControllerGetVolume is not implemented")
-}
-
-// ControllerModifyVolume implements the ControllerServer interface for CSI.
-// This is a stub implementation; you should update it to provide actual logic as needed.
-func (c *CSIDriver) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "ControllerGetVolume is not implemented")
-}
-
-func (d *CSIDriver) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "ControllerPublishVolume not supported")
-}
-
-func (d *CSIDriver) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "ControllerUnpublishVolume not supported")
+// shareVolumeCondition reports a volume as abnormal unless the share it lives on is published
+func shareVolumeCondition(share *common.ShareResponse) *csi.VolumeCondition {
+	switch share.ShareState {
+	case "PUBLISHED":
+		return &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  common.VolumeHealthy,
+		}
+	case "REMOVED":
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf(common.VolumeShareRemoved, share.Name),
+		}
+	default:
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf(common.VolumeShareNotPublished, share.Name, share.ShareState),
+		}
+	}
 }
 
-func (d *CSIDriver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	var requestedSize int64
-	if req.GetCapacityRange().GetLimitBytes() != 0 {
-		requestedSize = req.GetCapacityRange().GetLimitBytes()
-	} else {
-		requestedSize = req.GetCapacityRange().GetRequiredBytes()
-	}
+// ControllerGetVolume reports the capacity and condition of share-backed volumes and of
+// directories or files residing inside a backing share
+func (d *CSIDriver) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
 	// Start a span for tracing
-	ctx, span := tracer.Start(ctx, "Controller/ExpandVolume", trace.WithAttributes(
+	ctx, span := tracer.Start(ctx, "Controller/GetVolume", trace.WithAttributes(
 		attribute.String("volume.id", req.GetVolumeId()),
-		attribute.Int64("volume.space.requested", req.GetCapacityRange().GetRequiredBytes()),
 	))
 	defer span.End()
 
-	fileBacked := false
+	volumeId := req.GetVolumeId()
+	if volumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, common.EmptyVolumeId)
+	}
 
-	if req.GetVolumeId() == "" {
-		return nil, status.Error(codes.InvalidArgument, common.VolumeNotFound)
+	volumeName := GetVolumeNameFromPath(volumeId)
+	share, err := d.getHSClient(ctx).GetShare(ctx, volumeName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+
+	var capacity int64
+	var condition *csi.VolumeCondition
+	if share != nil {
+		// Share-backed volume
+		capacity = share.Size
+		if capacity <= 0 {
+			capacity = share.Space.Total
+		}
+		condition = shareVolumeCondition(share)
+	} else {
+		// Directory or file inside a backing share
+		file, err := d.getHSClient(ctx).GetFile(ctx, volumeId)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		if file == nil {
+			return nil, status.Error(codes.NotFound, common.VolumeNotFound)
+		}
+		capacity = file.Size
+
+		backingShareName := path.Base(path.Dir(volumeId))
+		backingShare, err := d.getHSClient(ctx).GetShare(ctx, backingShareName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		// The recorded capacity is the quota of a directory volume, whose size is its usage
+		if backingShare != nil {
+			if recorded, err := strconv.ParseInt(backingShare.ExtendedInfo[GetVolumeRecordKey(volumeName)], 10, 64); err == nil {
+				capacity = recorded
+			}
+		}
+		if backingShare == nil {
+			condition = &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  fmt.Sprintf(common.VolumeBackingShareMissing, backingShareName),
+			}
+		} else {
+			condition = shareVolumeCondition(backingShare)
+		}
+	}
+
+	publishedNodes, err := d.getPublishedNodes(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volumeId,
+			CapacityBytes: capacity,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: publishedNodes.forVolume(volumeId),
+			VolumeCondition:  condition,
+		},
+	}, nil
+}
+
+// modifyShareBackedVolume applies mutable parameters to a share-backed volume
+func (d *CSIDriver) modifyShareBackedVolume(ctx context.Context, share *common.ShareResponse, params map[string]string, vParams common.HSVolumeParameters) error {
+	var comment *string
+	if _, exists := params["comment"]; exists {
+		comment = &vParams.Comment
+	}
+	if vParams.ExportOptions != nil {
+		// Keep the export rules of the nodes the volume is published to, under the lock
+		// ControllerPublishVolume updates them with
+		unlock, err := d.acquireVolumeLock(ctx, share.Name)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		share, err = d.getHSClient(ctx).GetShare(ctx, share.Name)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		if share == nil {
+			return status.Error(codes.NotFound, common.VolumeNotFound)
+		}
+		vParams.ExportOptions = withNodeExportRules(vParams.ExportOptions, share)
+	}
+	if comment != nil || vParams.ExportOptions != nil {
+		err := d.getHSClient(ctx).UpdateShare(ctx, share.Name, comment, vParams.ExportOptions)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+	}
+
+	if len(vParams.Objectives) > 0 {
+		err := d.getHSClient(ctx).SetObjectives(ctx, share.Name, "/", vParams.Objectives, true)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+	}
+
+	if len(vParams.AdditionalMetadataTags) > 0 {
+		// generate unique target path on host for setting file metadata
+		targetPath := common.ShareStagingDir + "/metadata-mounts" + share.ExportPath
+		defer common.UnmountFilesystem(ctx, targetPath)
+		err := d.publishShareBackedVolume(ctx, share.ExportPath, targetPath)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		// The hs client expects a trailing slash for directories
+		err = common.SetMetadataTags(ctx, targetPath+"/", vParams.AdditionalMetadataTags)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+	}
+	return nil
+}
+
+// modifyVolumeInBackingShare applies mutable parameters to a directory or file residing in a
+// backing share. Share level settings would affect every volume in the backing share, so
+// only objectives and metadata tags can be changed.
+func (d *CSIDriver) modifyVolumeInBackingShare(ctx context.Context, volumeId string, params map[string]string, vParams common.HSVolumeParameters) error {
+	if _, exists := params["comment"]; exists || vParams.ExportOptions != nil {
+		return status.Error(codes.InvalidArgument, common.ShareOnlyVolumeParameters)
+	}
+
+	exists, err := d.getHSClient(ctx).DoesFileExist(ctx, volumeId)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if !exists {
+		return status.Error(codes.NotFound, common.VolumeNotFound)
+	}
+
+	backingShareName := path.Base(path.Dir(volumeId))
+	if len(vParams.Objectives) > 0 {
+		err = d.getHSClient(ctx).SetObjectives(ctx, backingShareName, "/"+GetVolumeNameFromPath(volumeId), vParams.Objectives, true)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+	}
+
+	if len(vParams.AdditionalMetadataTags) > 0 {
+		unlock, err := d.acquireVolumeLock(ctx, backingShareName)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		defer d.UnmountBackingShareIfUnused(ctx, backingShareName)
+		err = d.EnsureBackingShareMounted(ctx, backingShareName, &common.HSVolume{})
+		if err != nil {
+			return err
+		}
+
+		localPath := common.ShareStagingDir + volumeId
+		if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+			// The hs client expects a trailing slash for directories
+			localPath += "/"
+		}
+		err = common.SetMetadataTags(ctx, localPath, vParams.AdditionalMetadataTags)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+	}
+	return nil
+}
+
+// ControllerModifyVolume applies the mutable parameters of a VolumeAttributesClass to an
+// existing volume
+func (d *CSIDriver) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	// Start a span for tracing
+	ctx, span := tracer.Start(ctx, "Controller/ModifyVolume", trace.WithAttributes(
+		attribute.String("volume.id", req.GetVolumeId()),
+	))
+	defer span.End()
+
+	volumeId := req.GetVolumeId()
+	if volumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, common.EmptyVolumeId)
+	}
+
+	params := req.GetMutableParameters()
+	for k := range params {
+		if !IsValueInList(k, mutableVolumeParameters) {
+			return nil, status.Errorf(codes.InvalidArgument, common.ImmutableVolumeParameter, k)
+		}
+	}
+	vParams, err := parseVolParams(params)
+	if err != nil {
+		return nil, err
+	}
+	err = d.validateObjectives(ctx, vParams.Objectives)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.acquireVolumeLock(ctx, volumeId)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	volumeName := GetVolumeNameFromPath(volumeId)
+	share, err := d.getHSClient(ctx).GetShare(ctx, volumeName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if snapshotId, exists := params[revertToSnapshotParameter]; exists {
+		err = d.revertVolume(ctx, volumeId, share, snapshotId)
+	} else {
+		err = d.forgetRevert(ctx, volumeId, share)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if share != nil {
+		err = d.modifyShareBackedVolume(ctx, share, params, vParams)
+	} else {
+		err = d.modifyVolumeInBackingShare(ctx, volumeId, params, vParams)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	common.Logger(ctx).WithFields(log.Fields{
+		"volume_id":          volumeId,
+		"mutable_parameters": params,
+	}).Info("volume was modified")
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
+
+func (d *CSIDriver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+	var requestedSize int64
+	if req.GetCapacityRange().GetLimitBytes() != 0 {
+		requestedSize = req.GetCapacityRange().GetLimitBytes()
+	} else {
+		requestedSize = req.GetCapacityRange().GetRequiredBytes()
+	}
+	// Start a span for tracing
+	ctx, span := tracer.Start(ctx, "Controller/ExpandVolume", trace.WithAttributes(
+		attribute.String("volume.id", req.GetVolumeId()),
+		attribute.Int64("volume.space.requested", req.GetCapacityRange().GetRequiredBytes()),
+	))
+	defer span.End()
+
+	fileBacked := false
+
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, common.VolumeNotFound)
 	}
 
 	volumeName := GetVolumeNameFromPath(req.GetVolumeId())
-	share, _ := d.hsclient.GetShare(ctx, volumeName)
+	share, _ := d.getHSClient(ctx).GetShare(ctx, volumeName)
 	if share == nil {
 		fileBacked = true
 	}
 
 	//  Check if the specified backing share or file exists
 	if share == nil {
-		backingFileExists, err := d.hsclient.DoesFileExist(ctx, req.GetVolumeId())
+		backingFileExists, err := d.getHSClient(ctx).DoesFileExist(ctx, req.GetVolumeId())
 		if err != nil {
-			log.Error(err)
+			common.Logger(ctx).Error(err)
 		}
 		if !backingFileExists {
 			return nil, status.Error(codes.NotFound, common.VolumeNotFound)
@@ -946,11 +1614,26 @@ func (d *CSIDriver) ControllerExpandVolume(ctx context.Context, req *csi.Control
 	}
 
 	if fileBacked {
-		file, err := d.hsclient.GetFile(ctx, req.GetVolumeId())
+		isDir, err := d.expandDirectoryVolume(ctx, req.GetVolumeId(), requestedSize)
+		if err != nil {
+			return nil, err
+		}
+		if isDir {
+			backingShareName := path.Base(path.Dir(req.GetVolumeId()))
+			if err := d.recordVolume(ctx, backingShareName, volumeName, requestedSize); err != nil {
+				return nil, status.Errorf(codes.Internal, common.VolumeRecordFailed, volumeName, backingShareName, err)
+			}
+			return &csi.ControllerExpandVolumeResponse{
+				CapacityBytes:         requestedSize,
+				NodeExpansionRequired: false,
+			}, nil
+		}
+
+		file, err := d.getHSClient(ctx).GetFile(ctx, req.GetVolumeId())
 		if file == nil || err != nil {
 			return nil, status.Error(codes.NotFound, common.VolumeNotFound)
 		} else {
-			log.Debugf("found file-backed volume to resize, %s", req.GetVolumeId())
+			common.Logger(ctx).Debugf("found file-backed volume to resize, %s", req.GetVolumeId())
 			// Check backing share size to determine if we can handle new size (look at create volume for how we do this)
 			// && check the size of the file only resize if requested is larger than what we have
 			// if we are good, then return saying we need a resize on next mount
@@ -963,7 +1646,7 @@ func (d *CSIDriver) ControllerExpandVolume(ctx context.Context, req *csi.Control
 				// if required - current > available on backend share
 				sizeDiff := requestedSize - file.Size
 				backingShareName := path.Base(path.Dir(req.GetVolumeId()))
-				backingShare, err := d.hsclient.GetShare(ctx, backingShareName)
+				backingShare, err := d.getHSClient(ctx).GetShare(ctx, backingShareName)
 				if err != nil {
 					return nil, fmt.Errorf("share not found %w", err)
 				}
@@ -975,6 +1658,9 @@ func (d *CSIDriver) ControllerExpandVolume(ctx context.Context, req *csi.Control
 				if available-sizeDiff < 0 {
 					return nil, status.Error(codes.OutOfRange, common.OutOfCapacity)
 				}
+				if err := d.recordVolume(ctx, backingShareName, volumeName, requestedSize); err != nil {
+					return nil, status.Errorf(codes.Internal, common.VolumeRecordFailed, volumeName, backingShareName, err)
+				}
 
 				return &csi.ControllerExpandVolumeResponse{
 					CapacityBytes:         requestedSize,
@@ -991,7 +1677,7 @@ func (d *CSIDriver) ControllerExpandVolume(ctx context.Context, req *csi.Control
 		if shareName == "" {
 			return nil, status.Error(codes.NotFound, common.VolumeNotFound)
 		}
-		share, err := d.hsclient.GetShare(ctx, shareName)
+		share, err := d.getHSClient(ctx).GetShare(ctx, shareName)
 		if share == nil {
 			return nil, status.Error(codes.NotFound, common.ShareNotFound)
 		}
@@ -1003,9 +1689,10 @@ func (d *CSIDriver) ControllerExpandVolume(ctx context.Context, req *csi.Control
 		}
 
 		if currentSize < requestedSize {
-			err = d.hsclient.UpdateShareSize(ctx, shareName, requestedSize)
+			err = d.getHSClient(ctx).UpdateShareSize(ctx, shareName, requestedSize)
 			if err != nil {
-				return nil, status.Error(codes.Internal, common.UnknownError)
+				common.Logger(ctx).Errorf("Failed to resize share %s, %v", shareName, err)
+				return nil, HSClientError(err)
 			}
 		}
 
@@ -1039,7 +1726,7 @@ func (d *CSIDriver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Val
 	fileBacked := false
 
 	volumeName := GetVolumeNameFromPath(req.GetVolumeId())
-	share, _ := d.hsclient.GetShare(ctx, volumeName)
+	share, _ := d.getHSClient(ctx).GetShare(ctx, volumeName)
 	if share != nil {
 		typeMount = true
 	}
@@ -1054,9 +1741,9 @@ func (d *CSIDriver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Val
 
 	//  Check if the specified backing share or file exists
 	if share == nil {
-		backingFileExists, err := d.hsclient.DoesFileExist(ctx, req.GetVolumeId())
+		backingFileExists, err := d.getHSClient(ctx).DoesFileExist(ctx, req.GetVolumeId())
 		if err != nil {
-			log.Error(err)
+			common.Logger(ctx).Error(err)
 		}
 		if !backingFileExists {
 			return nil, status.Error(codes.NotFound, common.VolumeNotFound)
@@ -1066,9 +1753,9 @@ func (d *CSIDriver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Val
 	}
 
 	if fileBacked {
-		log.Infof("Validating volume capabilities for file-backed volume %s", volumeName)
+		common.Logger(ctx).Infof("Validating volume capabilities for file-backed volume %s", volumeName)
 	} else if share != nil {
-		log.Infof("Validating volume capabilities for share-backed volume %s", volumeName)
+		common.Logger(ctx).Infof("Validating volume capabilities for share-backed volume %s", volumeName)
 	}
 
 	// Calculate Capabilties
@@ -1111,29 +1798,235 @@ func (d *CSIDriver) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest
 			"[ListVolumes] Invalid max entries request %v, must not be negative ", req.MaxEntries))
 	}
 
-	vlist, err := d.hsclient.ListVolumes(ctx)
+	cursor, err := decodePageToken(req.GetStartingToken())
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := d.getHSClient(ctx).ListShares(ctx)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("ListVolumes failed: %v", err))
 	}
+	publishedNodes, err := d.getPublishedNodes(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ListVolumes failed: %v", err))
+	}
+
+	// Only the shares from the one of the token on are read, until the page is full
+	rsp := &csi.ListVolumesResponse{}
+	for _, share := range sharesFrom(shares, cursor) {
+		if share.ExtendedInfo["csi_created_by_plugin_name"] != common.CsiPluginName || share.ShareState == "REMOVED" {
+			continue
+		}
+		entries := shareVolumeEntries(ctx, &share, publishedNodes)
+		ids := make([]string, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.GetVolume().GetVolumeId()
+		}
+		start, end, nextToken := sharePage(share.Name, ids, cursor, len(rsp.Entries), req.GetMaxEntries())
+		rsp.Entries = append(rsp.Entries, entries[start:end]...)
+		if nextToken != "" {
+			rsp.NextToken = nextToken
+			break
+		}
+	}
+	return rsp, nil
+}
 
-	ventries := make([]*csi.ListVolumesResponse_Entry, 0, len(vlist))
-	publishedNodeIds := make([]string, 0, len(ventries))
-	for _, v := range vlist {
-		ventry := csi.ListVolumesResponse_Entry{
+// shareVolumeEntries returns the volumes of a share created by this plugin sorted by ID. Volumes
+// are either the share itself or the volumes recorded in a backing share.
+func shareVolumeEntries(ctx context.Context, share *common.ShareResponse, publishedNodes publishedNodes) []*csi.ListVolumesResponse_Entry {
+	condition := shareVolumeCondition(share)
+	if !isBackingShare(share) {
+		if isLegacyBackingShare(share) {
+			common.Logger(ctx).Warnf("not listing share %s, it may be a backing share created by an earlier version; its volumes are recorded when the next volume is created in it", share.Name)
+			return nil
+		}
+		volumeId := common.SharePathPrefix + share.Name
+		return []*csi.ListVolumesResponse_Entry{{
 			Volume: &csi.Volume{
-				VolumeId:      v.Name,
-				CapacityBytes: v.Capacity,
+				VolumeId:      volumeId,
+				CapacityBytes: share.Size,
 			},
 			Status: &csi.ListVolumesResponse_VolumeStatus{
-				PublishedNodeIds: publishedNodeIds,
+				PublishedNodeIds: publishedNodes.forVolume(volumeId),
+				VolumeCondition:  condition,
 			},
+		}}
+	}
+
+	var ventries []*csi.ListVolumesResponse_Entry
+	for key, value := range share.ExtendedInfo {
+		volumeName, isRecord := strings.CutPrefix(key, common.VolumeRecordPrefix)
+		if !isRecord || value == "" {
+			continue
 		}
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			common.Logger(ctx).Warnf("ignoring volume record %s=%s on share %s, size must be an integer", key, value, share.Name)
+			continue
+		}
+		volumeId := common.SharePathPrefix + share.Name + "/" + volumeName
+		ventries = append(ventries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      volumeId,
+				CapacityBytes: size,
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: publishedNodes.forVolume(volumeId),
+				VolumeCondition:  condition,
+			},
+		})
+	}
+	sort.Slice(ventries, func(i, j int) bool {
+		return ventries[i].GetVolume().GetVolumeId() < ventries[j].GetVolume().GetVolumeId()
+	})
+	return ventries
+}
+
+// publishedNodes maps the hash of a volume ID to the IDs of the nodes the volume is staged on
+type publishedNodes map[string][]string
 
-		ventries = append(ventries, &ventry)
+// forVolume returns the sorted IDs of the nodes the volume is staged on, never nil
+func (p publishedNodes) forVolume(volumeId string) []string {
+	nodeIds := append([]string{}, p[hashVolumeID(volumeId)]...)
+	sort.Strings(nodeIds)
+	return nodeIds
+}
+
+// getPublishedNodes reads the markers nodes create in the published nodes directory when staging a volume
+func (d *CSIDriver) getPublishedNodes(ctx context.Context) (publishedNodes, error) {
+	dir, err := d.getHSClient(ctx).GetFile(ctx, common.PublishedNodesDir+"/")
+	if err != nil {
+		return nil, err
 	}
-	return &csi.ListVolumesResponse{
-		Entries: ventries,
-	}, nil
+	return parsePublishedNodes(dir), nil
+}
+
+// parsePublishedNodes reads the markers in the published nodes directory, which may be nil
+func parsePublishedNodes(dir *common.File) publishedNodes {
+	nodes := publishedNodes{}
+	if dir == nil {
+		return nodes
+	}
+	for _, child := range dir.Children {
+		volumeHash, nodeId, ok := ParsePublishedNodeMarkerName(child.Name)
+		if !ok {
+			continue
+		}
+		nodes[volumeHash] = append(nodes[volumeHash], nodeId)
+	}
+	return nodes
+}
+
+// isBackingShare reports whether a share holds file-backed or directory volumes
+func isBackingShare(share *common.ShareResponse) bool {
+	if share.ExtendedInfo[common.BackingShareMarker] == "true" {
+		return true
+	}
+	for key := range share.ExtendedInfo {
+		if strings.HasPrefix(key, common.VolumeRecordPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isShareBackedVolume reports whether a share is a share-backed volume created by this plugin,
+// whose share snapshots are snapshots of the volume. The share snapshots of backing shares,
+// scheduled ones included, hold several volumes and their share is not a volume.
+func isShareBackedVolume(share *common.ShareResponse) bool {
+	return share.ExtendedInfo["csi_created_by_plugin_name"] == common.CsiPluginName &&
+		!isBackingShare(share) && !isLegacyBackingShare(share)
+}
+
+// isLegacyBackingShare reports whether a share that is not marked as backing share may be a
+// backing share created by a version that did not mark them. Share-backed volumes of these
+// versions are told apart by their size limit, backing shares are created without one.
+func isLegacyBackingShare(share *common.ShareResponse) bool {
+	return share.ExtendedInfo[common.BackingSharesMarkedKey] != "true" && share.Size <= 0
+}
+
+// recordVolume stores the size of a volume in the extended info of the backing share it resides in,
+// and marks the share as a backing share. A backing share created by an earlier version is marked
+// with its first new volume, the volumes already in it are then recorded with their current size.
+// Volumes are only listed with a record, so creating or expanding a volume fails without one.
+func (d *CSIDriver) recordVolume(ctx context.Context, backingShareName, volumeName string, size int64) error {
+	unlock, err := d.acquireVolumeLock(ctx, backingShareName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	share, err := d.getHSClient(ctx).GetShare(ctx, backingShareName)
+	if err != nil {
+		return err
+	}
+	if share == nil {
+		return status.Error(codes.NotFound, common.ShareNotFound)
+	}
+	records := map[string]string{
+		common.BackingShareMarker:      "true",
+		GetVolumeRecordKey(volumeName): strconv.FormatInt(size, 10),
+	}
+	if share.ExtendedInfo[common.BackingShareMarker] != "true" {
+		dir, err := d.getHSClient(ctx).GetFile(ctx, share.ExportPath+"/")
+		if err != nil {
+			return err
+		}
+		for _, child := range legacyVolumes(dir) {
+			if _, exists := share.ExtendedInfo[GetVolumeRecordKey(child.Name)]; !exists && child.Name != volumeName {
+				records[GetVolumeRecordKey(child.Name)] = strconv.FormatInt(child.Size, 10)
+			}
+		}
+	}
+	return d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, backingShareName, records)
+}
+
+// legacyVolumes returns the files and directories in the root of a backing share, which are the
+// volumes created in it. Hidden entries, ex. the .snapshot directory, are skipped.
+func legacyVolumes(dir *common.File) []common.FileChildren {
+	if dir == nil {
+		return nil
+	}
+	var volumes []common.FileChildren
+	for _, child := range dir.Children {
+		if !strings.HasPrefix(child.Name, ".") {
+			volumes = append(volumes, child)
+		}
+	}
+	return volumes
+}
+
+// removeVolumeRecord removes the record of a volume from the extended info of its backing share
+func (d *CSIDriver) removeVolumeRecord(ctx context.Context, backingShareName, volumeName string) error {
+	unlock, err := d.acquireVolumeLock(ctx, backingShareName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	share, err := d.getHSClient(ctx).GetShare(ctx, backingShareName)
+	if err != nil || share == nil {
+		return err
+	}
+	if _, exists := share.ExtendedInfo[GetVolumeRecordKey(volumeName)]; exists {
+		err = d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, backingShareName, map[string]string{
+			GetVolumeRecordKey(volumeName): "",
+		})
+		if err != nil {
+			return err
+		}
+		delete(share.ExtendedInfo, GetVolumeRecordKey(volumeName))
+	}
+
+	// The snapshot schedule of a backing share ends with its last volume
+	for key := range share.ExtendedInfo {
+		if strings.HasPrefix(key, common.VolumeRecordPrefix) {
+			return nil
+		}
+	}
+	return d.removeSnapshotSchedule(ctx, share)
 }
 
 func (d *CSIDriver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
@@ -1170,6 +2063,13 @@ func (d *CSIDriver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest
 		return nil, err
 	}
 
+	// No capacity is available to topologies outside of the site of this cluster
+	if req.AccessibleTopology != nil && !topologyMatches(d.site(ctx), req.AccessibleTopology) {
+		return &csi.GetCapacityResponse{
+			AvailableCapacity: 0,
+		}, nil
+	}
+
 	var available int64 = 0
 	//  Check if the specified backing share or file exists
 	if fileBacked {
@@ -1179,7 +2079,7 @@ func (d *CSIDriver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest
 		} else {
 			backingShareName = vParams.MountBackingShareName
 		}
-		backingShare, err := d.hsclient.GetShare(ctx, backingShareName)
+		backingShare, err := d.getHSClient(ctx).GetShare(ctx, backingShareName)
 		if err != nil {
 			available = 0
 		}
@@ -1189,7 +2089,7 @@ func (d *CSIDriver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest
 
 	} else {
 		// Return all capacity of cluster for share backed volumes
-		available, err = d.hsclient.GetClusterAvailableCapacity(ctx)
+		available, err = d.getHSClient(ctx).GetClusterAvailableCapacity(ctx)
 		if err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
@@ -1218,6 +2118,13 @@ func (d *CSIDriver) ControllerGetCapabilities(ctx context.Context, req *csi.Cont
 				},
 			},
 		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+				},
+			},
+		},
 		{
 			Type: &csi.ControllerServiceCapability_Rpc{
 				Rpc: &csi.ControllerServiceCapability_RPC{
@@ -1246,6 +2153,43 @@ func (d *CSIDriver) ControllerGetCapabilities(ctx context.Context, req *csi.Cont
 				},
 			},
 		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+				},
+			},
+		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_GET_VOLUME,
+				},
+			},
+		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+				},
+			},
+		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+				},
+			},
+		},
+	}
+	if d.nodeExportRules {
+		caps = append(caps, &csi.ControllerServiceCapability{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+				},
+			},
+		})
 	}
 
 	return &csi.ControllerGetCapabilitiesResponse{
@@ -1262,9 +2206,9 @@ func (d *CSIDriver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotR
 	defer span.End()
 
 	// Check arguments
-	log.WithFields(log.Fields{
-		"Name":  req.Name,
-		"Param": req.SourceVolumeId,
+	common.Logger(ctx).WithFields(log.Fields{
+		"name":             req.Name,
+		"source_volume_id": req.SourceVolumeId,
 	}).Infof("Create snapshot request recived.")
 
 	if len(req.GetName()) == 0 {
@@ -1285,51 +2229,145 @@ func (d *CSIDriver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotR
 	}
 	defer unlock()
 
-	// FIXME: Check to see if snapshot already exists?
-	//  (using their id somehow?, update the share extended info maybe?) what about for file-backed volumes?
-	// do we update extended info on backing share?
-	if _, exists := recentlyCreatedSnapshots[req.GetName()]; !exists {
-		// find source volume (is it file or share?
-		volumeName := GetVolumeNameFromPath(req.GetSourceVolumeId())
-		share, err := d.hsclient.GetShare(ctx, volumeName)
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "%s", err.Error())
-		}
-		// Create the snapshot
-		var hsSnapName string
-		if share != nil {
-			hsSnapName, err = d.hsclient.SnapshotShare(ctx, volumeName)
-		} else {
-			hsSnapName, err = d.hsclient.SnapshotFile(ctx, req.GetSourceVolumeId())
-		}
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "%s", err.Error())
-		}
+	// find source volume (is it file or share?
+	volumeName := GetVolumeNameFromPath(req.GetSourceVolumeId())
+	share, err := d.getHSClient(ctx).GetShare(ctx, volumeName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
 
-		snapID := GetSnapshotIDFromSnapshotName(hsSnapName, req.GetSourceVolumeId())
-		now := time.Now()
-		timeTaken := &timestamp.Timestamp{
-			Seconds: now.Unix(),
-			Nanos:   int32(now.UnixNano() % time.Second.Nanoseconds()),
-		}
-		snapshotResponse := &csi.Snapshot{
-			SnapshotId:     snapID,
-			SourceVolumeId: req.GetSourceVolumeId(),
-			CreationTime:   timeTaken,
-			ReadyToUse:     true,
-		}
-		// FIXME: this is a hack to reduce the chance we create a snapshot twice
-		recentlyCreatedSnapshots[req.GetName()] = snapshotResponse
+	// A previous call may already have created the snapshot, possibly before a controller restart
+	recordShareName := GetSnapshotRecordShareName(req.GetSourceVolumeId(), share != nil)
+	snapID, err := d.findRecordedSnapshot(ctx, recordShareName, req.GetName())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if snapID != "" {
+		common.Logger(ctx).Infof("Snapshot %s already exists as %s", req.GetName(), snapID)
+		return &csi.CreateSnapshotResponse{
+			Snapshot: newSnapshot(snapID, req.GetSourceVolumeId()),
+		}, nil
+	}
+	// The name may be recorded for a snapshot of another volume, on the record share of that volume
+	otherSnapID, err := d.findSnapshotRecord(ctx, req.GetName())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if _, sourceVolumeID, _ := strings.Cut(otherSnapID, "|"); sourceVolumeID != "" {
+		return nil, status.Errorf(codes.AlreadyExists, common.SnapshotExistsForOtherVolume, req.GetName(), sourceVolumeID)
+	}
+
+	// Create the snapshot
+	var hsSnapName string
+	if share != nil {
+		hsSnapName, err = d.getHSClient(ctx).SnapshotShare(ctx, volumeName)
 	} else {
-		if recentlyCreatedSnapshots[req.GetName()].SourceVolumeId != req.GetSourceVolumeId() {
-			return nil, status.Errorf(codes.AlreadyExists, "snapshot already exists for a different volume")
+		hsSnapName, err = d.getHSClient(ctx).SnapshotFile(ctx, req.GetSourceVolumeId())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+
+	snapID = GetSnapshotIDFromSnapshotName(hsSnapName, req.GetSourceVolumeId())
+	err = d.recordSnapshot(ctx, recordShareName, req.GetName(), snapID)
+	if err != nil {
+		// A retry would not find the snapshot, remove it so the retry does not leave it behind
+		if deleteErr := d.deleteSnapshot(ctx, snapID); deleteErr != nil {
+			common.Logger(ctx).Warnf("failed to delete unrecorded snapshot %s: %v", snapID, deleteErr)
 		}
+		return nil, status.Errorf(codes.Internal, common.SnapshotRecordFailed, snapID, recordShareName, err)
 	}
+
 	return &csi.CreateSnapshotResponse{
-		Snapshot: recentlyCreatedSnapshots[req.GetName()],
+		Snapshot: newSnapshot(snapID, req.GetSourceVolumeId()),
 	}, nil
 }
 
+// newSnapshot builds the CSI snapshot for a Hammerspace snapshot, the creation time is taken
+// from the snapshot name assigned by Hammerspace
+func newSnapshot(snapID, sourceVolumeID string) *csi.Snapshot {
+	snapshot := &csi.Snapshot{
+		SnapshotId:     snapID,
+		SourceVolumeId: sourceVolumeID,
+		ReadyToUse:     true,
+	}
+	hsSnapName, _, _ := strings.Cut(snapID, "|")
+	created, err := GetSnapshotCreationTime(hsSnapName)
+	if err != nil {
+		log.Warnf("could not determine creation time of snapshot %s: %v", snapID, err)
+		created = time.Now()
+	}
+	snapshot.CreationTime = &timestamp.Timestamp{
+		Seconds: created.Unix(),
+		Nanos:   int32(created.Nanosecond()),
+	}
+	return snapshot
+}
+
+// findRecordedSnapshot returns the ID of the snapshot recorded for a CSI snapshot name on the
+// record share of the source volume, or an empty string if no snapshot was created under that name
+func (d *CSIDriver) findRecordedSnapshot(ctx context.Context, shareName, csiSnapshotName string) (string, error) {
+	share, err := d.getHSClient(ctx).GetShare(ctx, shareName)
+	if err != nil || share == nil {
+		return "", err
+	}
+	return share.ExtendedInfo[GetSnapshotRecordKey(csiSnapshotName)], nil
+}
+
+// findSnapshotRecord returns the ID of the snapshot recorded for a CSI snapshot name on any
+// share, or an empty string if no snapshot was created under that name
+func (d *CSIDriver) findSnapshotRecord(ctx context.Context, csiSnapshotName string) (string, error) {
+	shares, err := d.getHSClient(ctx).ListShares(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, share := range shares {
+		if snapID := share.ExtendedInfo[GetSnapshotRecordKey(csiSnapshotName)]; snapID != "" {
+			return snapID, nil
+		}
+	}
+	return "", nil
+}
+
+// recordSnapshot stores the snapshot ID created for a CSI snapshot name in the extended info of a share
+func (d *CSIDriver) recordSnapshot(ctx context.Context, shareName, csiSnapshotName, snapID string) error {
+	unlock, err := d.acquireVolumeLock(ctx, shareName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, shareName, map[string]string{
+		GetSnapshotRecordKey(csiSnapshotName): snapID,
+	})
+}
+
+// removeSnapshotRecord removes any snapshot and group snapshot records of a snapshot ID from the
+// extended info of a share
+func (d *CSIDriver) removeSnapshotRecord(ctx context.Context, shareName, snapID string) error {
+	unlock, err := d.acquireVolumeLock(ctx, shareName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	share, err := d.getHSClient(ctx).GetShare(ctx, shareName)
+	if err != nil || share == nil {
+		return err
+	}
+	records := map[string]string{}
+	for key, value := range share.ExtendedInfo {
+		isRecord := strings.HasPrefix(key, common.SnapshotRecordPrefix) || strings.HasPrefix(key, common.GroupSnapshotRecordPrefix)
+		if isRecord && value == snapID {
+			records[key] = ""
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, shareName, records)
+}
+
 func (d *CSIDriver) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
 	// Start a span for tracing
 	ctx, span := tracer.Start(ctx, "Controller/DeleteSnapshot", trace.WithAttributes(
@@ -1342,35 +2380,57 @@ func (d *CSIDriver) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotR
 		return nil, status.Error(codes.InvalidArgument, common.EmptySnapshotId)
 	}
 
+	if err := d.deleteSnapshot(ctx, snapshotId); err != nil {
+		return nil, err
+	}
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+// deleteSnapshot deletes a share or file snapshot and the records of it, snapshots that do not
+// exist are treated as deleted
+func (d *CSIDriver) deleteSnapshot(ctx context.Context, snapshotId string) error {
 	splitSnapId := strings.SplitN(snapshotId, "|", 2)
 	if len(splitSnapId) != 2 {
-		log.Warnf("DeleteSnapshot: malformed snapshot ID %s; treating as success (idempotent)", snapshotId)
-		return &csi.DeleteSnapshotResponse{}, nil
+		common.Logger(ctx).Warnf("DeleteSnapshot: malformed snapshot ID %s; treating as success (idempotent)", snapshotId)
+		return nil
 	}
 	snapshotName, path := splitSnapId[0], splitSnapId[1]
 
 	// If the snapshot does not exist then return an idempotent response.
 
 	shareName := GetVolumeNameFromPath(path)
+	share, err := d.getHSClient(ctx).GetShare(ctx, shareName)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
 
-	var err error
-	if shareName != "" {
-		err = d.hsclient.DeleteShareSnapshot(ctx, shareName, snapshotName)
+	if share == nil && filepath.Dir(path) == "/" {
+		// the share-backed volume and its snapshots are already gone
+		common.Logger(ctx).Infof("DeleteSnapshot: share %s for snapshot %s not found, treating as success", shareName, snapshotId)
+		return nil
+	}
+
+	if share != nil {
+		err = d.getHSClient(ctx).DeleteShareSnapshot(ctx, shareName, snapshotName)
 	} else {
-		err = d.hsclient.DeleteFileSnapshot(ctx, path, snapshotName)
+		err = d.getHSClient(ctx).DeleteFileSnapshot(ctx, path, snapshotName)
 	}
 
 	if err != nil {
 		// https://github.com/container-storage-interface/spec/blob/master/spec.md#controller-deletesnapshot
-		if strings.Contains(err.Error(), "not found") {
-			log.Infof("DeleteSnapshot: snapshot %s not found, treating as success", snapshotId)
-			return &csi.DeleteSnapshotResponse{}, nil
+		if !strings.Contains(err.Error(), "not found") {
+			return status.Error(codes.Internal, err.Error())
 		}
-		return nil, status.Error(codes.Internal, err.Error())
+		common.Logger(ctx).Infof("DeleteSnapshot: snapshot %s not found, treating as success", snapshotId)
 	}
 
-	// Delete snapshot
-	return &csi.DeleteSnapshotResponse{}, nil
+	// Forget the CSI snapshot name so it may be reused
+	recordShareName := GetSnapshotRecordShareName(path, share != nil)
+	if err := d.removeSnapshotRecord(ctx, recordShareName, snapshotId); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return nil
 }
 
 func (d *CSIDriver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
@@ -1386,53 +2446,73 @@ func (d *CSIDriver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsReq
 			"[ListSnapshots] Invalid max entries request %v, must not be negative ", req.MaxEntries))
 	}
 
-	// Initialize a slice to hold the snapshot entries
-	var snapshots []*csi.ListSnapshotsResponse_Entry
-
-	// Fetch all snapshots from the backend storage
-	backendSnapshots, err := d.hsclient.ListSnapshots(ctx, req.SnapshotId, req.SourceVolumeId)
+	cursor, err := decodePageToken(req.GetStartingToken())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
 	}
 
-	if backendSnapshots == nil {
-		log.Infof("No snapshot found backendSnapshots %v", backendSnapshots)
-		return &csi.ListSnapshotsResponse{
-			Entries: snapshots,
-		}, nil
+	// addShareSnapshots adds the sorted snapshots of a share to the page and reports whether
+	// the page is full
+	rsp := &csi.ListSnapshotsResponse{}
+	addShareSnapshots := func(shareName string, snapshots []common.SnapshotResponse) bool {
+		ids := make([]string, len(snapshots))
+		for i, snapshot := range snapshots {
+			ids[i] = snapshot.Id
+		}
+		start, end, nextToken := sharePage(shareName, ids, cursor, len(rsp.Entries), req.GetMaxEntries())
+		for _, snapshot := range snapshots[start:end] {
+			rsp.Entries = append(rsp.Entries, &csi.ListSnapshotsResponse_Entry{
+				Snapshot: &csi.Snapshot{
+					SizeBytes:      snapshot.Size,
+					SnapshotId:     snapshot.Id,
+					ReadyToUse:     snapshot.ReadyToUse,
+					SourceVolumeId: snapshot.SourceVolumeId,
+					CreationTime: &timestamp.Timestamp{
+						Seconds: snapshot.Created,
+					},
+				},
+			})
+		}
+		rsp.NextToken = nextToken
+		return nextToken != ""
 	}
 
-	// Apply filtering based on snapshot_id and source_volume_id
-	for _, snapshot := range backendSnapshots {
-		// Filter by snapshot_id if provided
-		if req.GetSnapshotId() != "" && snapshot.Id != req.GetSnapshotId() {
-			continue
+	hsclient := d.getHSClient(ctx)
+	if req.GetSnapshotId() != "" || req.GetSourceVolumeId() != "" {
+		// A snapshot ID or source volume ID only matches snapshots of one share
+		snapshots, err := hsclient.ListSnapshots(ctx, req.GetSnapshotId(), req.GetSourceVolumeId())
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if len(snapshots) == 0 {
+			return rsp, nil
 		}
+		share, err := hsclient.GetShare(ctx, path.Base(snapshots[0].SourceVolumeId))
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if share != nil && isShareBackedVolume(share) {
+			addShareSnapshots(share.Name, snapshots)
+		}
+		return rsp, nil
+	}
 
-		// Filter by source_volume_id if provided
-		if req.GetSourceVolumeId() != "" && snapshot.SourceVolumeId != req.GetSourceVolumeId() {
+	// Only the snapshots of the shares from the one of the token on are read, until the page is full
+	shares, err := hsclient.ListShares(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	for _, share := range sharesFrom(shares, cursor) {
+		if !isShareBackedVolume(&share) {
 			continue
 		}
-
-		// Build the SnapshotEntry for each matching snapshot
-		snapshotEntry := &csi.ListSnapshotsResponse_Entry{
-			Snapshot: &csi.Snapshot{
-				SizeBytes:      snapshot.Size,
-				SnapshotId:     snapshot.Id,
-				ReadyToUse:     snapshot.ReadyToUse,
-				SourceVolumeId: snapshot.SourceVolumeId,
-				CreationTime: &timestamp.Timestamp{
-					Seconds: snapshot.Created,
-				},
-			},
+		snapshots, err := hsclient.ListShareSnapshots(ctx, &share)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if addShareSnapshots(share.Name, snapshots) {
+			break
 		}
-
-		// Add the snapshot entry to the response
-		snapshots = append(snapshots, snapshotEntry)
 	}
-
-	// Return the ListSnapshotsResponse with filtered snapshots
-	return &csi.ListSnapshotsResponse{
-		Entries: snapshots,
-	}, nil
+	return rsp, nil
 }
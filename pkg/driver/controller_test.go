@@ -1,10 +1,22 @@
 package driver
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/client"
 	common "github.com/hammer-space/csi-plugin/pkg/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestParseParams(t *testing.T) {
@@ -184,4 +196,440 @@ func TestParseParams(t *testing.T) {
 		t.FailNow()
 	}
 
+	// Test snapshot schedule
+	stringParams = map[string]string{
+		"snapshotSchedule":  " Daily",
+		"snapshotRetention": "7",
+	}
+	actualParams, err = parseVolParams(stringParams)
+	if err != nil || actualParams.SnapshotSchedule != "daily" || actualParams.SnapshotRetention != 7 {
+		t.Logf("Expected a daily schedule keeping 7 snapshots, got %v, %v", actualParams, err)
+		t.FailNow()
+	}
+
+	// Test invalid snapshot schedules
+	for _, stringParams = range []map[string]string{
+		{"snapshotSchedule": "every minute"},
+		{"snapshotSchedule": "daily", "snapshotRetention": "0"},
+		{"snapshotSchedule": "daily", "snapshotRetention": "a week"},
+		{"snapshotRetention": "7"},
+	} {
+		_, err = parseVolParams(stringParams)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Logf("expected InvalidArgument for %v, got %v", stringParams, err)
+			t.FailNow()
+		}
+	}
+
+}
+
+func TestShareVolumeCondition(t *testing.T) {
+	condition := shareVolumeCondition(&common.ShareResponse{Name: "share1", ShareState: "PUBLISHED"})
+	if condition.Abnormal {
+		t.Logf("Expected published share to be healthy, got: %v", condition)
+		t.FailNow()
+	}
+
+	condition = shareVolumeCondition(&common.ShareResponse{Name: "share1", ShareState: "REMOVED"})
+	if !condition.Abnormal {
+		t.Logf("Expected removed share to be abnormal")
+		t.FailNow()
+	}
+
+	condition = shareVolumeCondition(&common.ShareResponse{Name: "share1", ShareState: "UNPUBLISHED"})
+	if !condition.Abnormal {
+		t.Logf("Expected unpublished share to be abnormal")
+		t.FailNow()
+	}
+	expected := "share share1 is not published, current state is UNPUBLISHED"
+	if condition.Message != expected {
+		t.Logf("Expected: %v", expected)
+		t.Logf("Actual: %v", condition.Message)
+		t.FailNow()
+	}
+}
+
+func TestControllerModifyVolumeRejectsImmutableParameters(t *testing.T) {
+	d := &CSIDriver{}
+
+	_, err := d.ControllerModifyVolume(context.Background(), &csi.ControllerModifyVolumeRequest{
+		VolumeId: "/test-volume",
+		MutableParameters: map[string]string{
+			"volumeNameFormat": "csi-%s",
+		},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Logf("Expected InvalidArgument, got: %v", err)
+		t.FailNow()
+	}
+
+	_, err = d.ControllerModifyVolume(context.Background(), &csi.ControllerModifyVolumeRequest{
+		MutableParameters: map[string]string{
+			"comment": "new comment",
+		},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Logf("Expected InvalidArgument, got: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestListVolumes(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc(client.BasePath+"/login", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc(client.BasePath+"/shares", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `[
+			{"name": "root", "path": "/", "extendedInfo": {}},
+			{"name": "pvc-share", "path": "/pvc-share", "shareSizeLimit": 1073741824, "shareState": "PUBLISHED",
+			 "extendedInfo": {"csi_created_by_plugin_name": "com.hammerspace.csi"}},
+			{"name": "pvc-removed", "path": "/pvc-removed", "shareSizeLimit": 1073741824, "shareState": "REMOVED",
+			 "extendedInfo": {"csi_created_by_plugin_name": "com.hammerspace.csi"}},
+			{"name": "backing", "path": "/backing", "shareState": "PUBLISHED",
+			 "extendedInfo": {"csi_created_by_plugin_name": "com.hammerspace.csi", "csi_backing_share": "true",
+			  "csi_volume_pvc-file": "2147483648", "csi_volume_pvc-dir": "1073741824", "csi_snapshot_snap": "x|/backing/pvc-file"}},
+			{"name": "empty-backing", "path": "/empty-backing", "shareState": "PUBLISHED",
+			 "extendedInfo": {"csi_created_by_plugin_name": "com.hammerspace.csi", "csi_backing_share": "true"}},
+			{"name": "pvc-unlimited", "path": "/pvc-unlimited", "shareState": "PUBLISHED",
+			 "extendedInfo": {"csi_created_by_plugin_name": "com.hammerspace.csi", "csi_backing_shares_marked": "true"}},
+			{"name": "legacy-backing", "path": "/legacy-backing", "shareState": "PUBLISHED",
+			 "extendedInfo": {"csi_created_by_plugin_name": "com.hammerspace.csi"}}
+		]`)
+	})
+	mux.HandleFunc(client.BasePath+"/files", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") != common.PublishedNodesDir+"/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, `{"name": ".csi-published", "children": [
+			{"name": "`+GetPublishedNodeMarkerName("/pvc-share", "node-b")+`"},
+			{"name": "`+GetPublishedNodeMarkerName("/pvc-share", "node-a")+`"},
+			{"name": "`+GetPublishedNodeMarkerName("/backing/pvc-file", "node-a")+`"},
+			{"name": "not-a-marker"}
+		]}`)
+	})
+	hsclient, err := client.NewHammerspaceClient(server.URL, "test_user", "test_password", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &CSIDriver{hsclient: hsclient}
+
+	rsp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes := map[string]int64{}
+	nodes := map[string][]string{}
+	for _, entry := range rsp.Entries {
+		volumes[entry.Volume.VolumeId] = entry.Volume.CapacityBytes
+		nodes[entry.Volume.VolumeId] = entry.Status.PublishedNodeIds
+		if entry.Status.VolumeCondition.Abnormal {
+			t.Errorf("volume %s reported abnormal: %s", entry.Volume.VolumeId, entry.Status.VolumeCondition.Message)
+		}
+	}
+	expected := map[string]int64{
+		"/pvc-share":        1073741824,
+		"/pvc-unlimited":    0,
+		"/backing/pvc-dir":  1073741824,
+		"/backing/pvc-file": 2147483648,
+	}
+	if !reflect.DeepEqual(volumes, expected) {
+		t.Logf("Expected: %v", expected)
+		t.Logf("Actual: %v", volumes)
+		t.FailNow()
+	}
+	expectedNodes := map[string][]string{
+		"/pvc-share":        {"node-a", "node-b"},
+		"/pvc-unlimited":    {},
+		"/backing/pvc-dir":  {},
+		"/backing/pvc-file": {"node-a"},
+	}
+	if !reflect.DeepEqual(nodes, expectedNodes) {
+		t.Logf("Expected: %v", expectedNodes)
+		t.Logf("Actual: %v", nodes)
+		t.FailNow()
+	}
+}
+
+func TestControllerGetVolumeReportsRecordedCapacity(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	d := NewCSIDriverWithClient(fake)
+	if err := fake.CreateShare(ctx, "backing", "/backing", -1, nil, nil, -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	// The size of a directory volume is its usage, its capacity is the recorded quota
+	fake.AddFile("/backing/pvc-dir", 4096)
+	if err := d.recordVolume(ctx, "backing", "pvc-dir", 1<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	rsp, err := d.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: "/backing/pvc-dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Volume.CapacityBytes != 1<<20 {
+		t.Errorf("Expected the recorded capacity %d, got %d", 1<<20, rsp.Volume.CapacityBytes)
+	}
+}
+
+func TestRecordVolumeInLegacyBackingShare(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	d := NewCSIDriverWithClient(fake)
+	if err := fake.CreateShare(ctx, "legacy", "/legacy", -1, nil, nil, -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Shares created by earlier versions carry no marker
+	if err := fake.UpdateShareExtendedInfo(ctx, "legacy", map[string]string{common.BackingSharesMarkedKey: ""}); err != nil {
+		t.Fatal(err)
+	}
+	fake.AddFile("/legacy/pvc-old", 1<<20)
+
+	listVolumes := func() map[string]int64 {
+		rsp, err := d.ListVolumes(ctx, &csi.ListVolumesRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		volumes := map[string]int64{}
+		for _, entry := range rsp.Entries {
+			volumes[entry.Volume.VolumeId] = entry.Volume.CapacityBytes
+		}
+		return volumes
+	}
+	if volumes := listVolumes(); len(volumes) != 0 {
+		t.Errorf("Expected the legacy backing share not to be listed as a volume, got %v", volumes)
+	}
+
+	// The volumes already in the backing share are recorded with its first new volume
+	if err := d.recordVolume(ctx, "legacy", "pvc-new", 2<<20); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int64{"/legacy/pvc-old": 1 << 20, "/legacy/pvc-new": 2 << 20}
+	if volumes := listVolumes(); !reflect.DeepEqual(volumes, expected) {
+		t.Errorf("Expected volumes %v, got %v", expected, volumes)
+	}
+
+	if err := d.recordVolume(ctx, "missing", "pvc-new", 2<<20); err == nil {
+		t.Error("Expected recording a volume on a missing backing share to fail")
+	}
+}
+
+// unrecordedClient fails to update share extended info
+type unrecordedClient struct {
+	*client.FakeClient
+}
+
+func (c unrecordedClient) UpdateShareExtendedInfo(ctx context.Context, name string, info map[string]string) error {
+	return status.Error(codes.Unavailable, "extended info unavailable")
+}
+
+func TestCreateSnapshotRecordedOnSourceShare(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	for _, shareName := range []string{"vol-a", "vol-b"} {
+		if err := fake.CreateShare(ctx, shareName, "/"+shareName, 1<<20, nil, nil, -1, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: "/vol-a"}
+	created, err := NewCSIDriverWithClient(fake).CreateSnapshot(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The record on the source share survives a controller restart
+	d := NewCSIDriverWithClient(fake)
+	retried, err := d.CreateSnapshot(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.Snapshot.SnapshotId != created.Snapshot.SnapshotId {
+		t.Errorf("Expected snapshot %s to be returned, got %s", created.Snapshot.SnapshotId, retried.Snapshot.SnapshotId)
+	}
+	share, _ := fake.GetShare(ctx, "vol-a")
+	if recorded := share.ExtendedInfo[GetSnapshotRecordKey("snap")]; recorded != created.Snapshot.SnapshotId {
+		t.Errorf("Expected snapshot %s to be recorded on the source share, got %q", created.Snapshot.SnapshotId, recorded)
+	}
+
+	// Snapshot names are not reused for other volumes, also after a controller restart
+	other, err := d.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "other", SourceVolumeId: "/vol-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewCSIDriverWithClient(fake).CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "other", SourceVolumeId: "/vol-b"})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("Expected AlreadyExists for a name used for another volume, got %v", err)
+	}
+	// until the snapshot is deleted
+	if _, err := d.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: other.Snapshot.SnapshotId}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewCSIDriverWithClient(fake).CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "other", SourceVolumeId: "/vol-b"})
+	if err != nil {
+		t.Errorf("Expected the name of a deleted snapshot to be reused, got %v", err)
+	}
+
+	// A snapshot that cannot be recorded is removed again
+	before, _ := fake.GetShareSnapshots(ctx, "vol-b")
+	_, err = NewCSIDriverWithClient(unrecordedClient{fake}).CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "unrecorded", SourceVolumeId: "/vol-b"})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("Expected Internal for a snapshot that cannot be recorded, got %v", err)
+	}
+	if snapshots, _ := fake.GetShareSnapshots(ctx, "vol-b"); !reflect.DeepEqual(snapshots, before) {
+		t.Errorf("Expected the unrecorded snapshot to be deleted, got %v", snapshots)
+	}
+}
+
+// stubShareMounts mounts the shares of fake as directories below a temporary root, where the
+// snapshots of a share are copies of its files taken when it is first mounted after them
+func stubShareMounts(t *testing.T, fake *client.FakeClient) string {
+	root := t.TempDir()
+	copyDir, mount, unmount := contentCopyDir, mountShareExport, unmountShareExport
+	t.Cleanup(func() { contentCopyDir, mountShareExport, unmountShareExport = copyDir, mount, unmount })
+
+	contentCopyDir = t.TempDir()
+	mountShareExport = func(ctx context.Context, d *CSIDriver, exportPath, targetPath string) error {
+		exportDir := filepath.Join(root, exportPath)
+		if err := os.MkdirAll(exportDir, 0755); err != nil {
+			return err
+		}
+		shares, _ := fake.ListShares(ctx)
+		for _, share := range shares {
+			if share.ExportPath != exportPath {
+				continue
+			}
+			snapshots, _ := fake.GetShareSnapshots(ctx, share.Name)
+			for _, snapshot := range snapshots {
+				if err := snapshotDirectory(exportDir, snapshot); err != nil {
+					return err
+				}
+			}
+		}
+		return os.Symlink(exportDir, targetPath)
+	}
+	unmountShareExport = func(ctx context.Context, targetPath string) error {
+		return os.Remove(targetPath)
+	}
+	return root
+}
+
+// snapshotDirectory copies the files of dir into dir/.snapshot/name unless the snapshot exists
+func snapshotDirectory(dir, name string) error {
+	snapshotDir := filepath.Join(dir, ".snapshot", name)
+	if _, err := os.Stat(snapshotDir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(snapshotDir, entry.Name()), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestCreateShareBackedVolumeCopiesSource(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	root := stubShareMounts(t, fake)
+	d := NewCSIDriverWithClient(fake)
+
+	if err := fake.CreateShare(ctx, "source", "/source", 1<<20, nil, nil, -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	sourceFile := filepath.Join(root, "source", "data")
+	if err := os.MkdirAll(filepath.Dir(sourceFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sourceFile, []byte("snapshotted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := d.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: "/source"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	share, _ := fake.GetShare(ctx, "source")
+	if err := snapshotDirectory(filepath.Join(root, "source"), strings.Split(snapshot.Snapshot.SnapshotId, "|")[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sourceFile, []byte("current"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	createVolume := func(name string, source *csi.VolumeContentSource) (string, error) {
+		rsp, err := d.CreateVolume(ctx, &csi.CreateVolumeRequest{
+			Name:          name,
+			CapacityRange: &csi.CapacityRange{RequiredBytes: share.Size},
+			VolumeCapabilities: []*csi.VolumeCapability{{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+			}},
+			VolumeContentSource: source,
+		})
+		if err != nil {
+			return "", err
+		}
+		return rsp.Volume.VolumeId, nil
+	}
+	expectContent := func(volumeId, expected string) {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(root, volumeId, "data"))
+		if err != nil || string(data) != expected {
+			t.Errorf("Expected volume %s to contain %q, got %q, %v", volumeId, expected, data, err)
+		}
+		share, _ := fake.GetShare(ctx, GetVolumeNameFromPath(volumeId))
+		if _, copying := share.ExtendedInfo[common.ContentSourceRecord]; copying {
+			t.Errorf("Expected the content source record to be removed from volume %s", volumeId)
+		}
+	}
+
+	restored, err := createVolume("restored", &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{
+		Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: snapshot.Snapshot.SnapshotId},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContent(restored, "snapshotted")
+
+	cloneSource := &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Volume{
+		Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "/source"},
+	}}
+	cloned, err := createVolume("cloned", cloneSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContent(cloned, "current")
+	if snapshots, _ := fake.GetShareSnapshots(ctx, "source"); len(snapshots) != 1 {
+		t.Errorf("Expected the temporary clone snapshot to be deleted, got %v", snapshots)
+	}
+
+	// A clone whose copy failed is copied again when it is retried
+	mount := mountShareExport
+	mountShareExport = func(ctx context.Context, d *CSIDriver, exportPath, targetPath string) error {
+		return errors.New("mount failed")
+	}
+	if _, err := createVolume("retried", cloneSource); status.Code(err) != codes.Internal {
+		t.Fatalf("Expected Internal when the shares cannot be mounted, got %v", err)
+	}
+	mountShareExport = mount
+	retried, err := createVolume("retried", cloneSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContent(retried, "current")
 }
@@ -18,31 +18,34 @@ package driver
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"net"
 	"os"
-	"runtime/debug"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/hammer-space/csi-plugin/pkg/common"
-	"golang.org/x/sync/semaphore"
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
+	"github.com/hammer-space/csi-plugin/pkg/tracing"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	client "github.com/hammer-space/csi-plugin/pkg/client"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type CSIDriver struct {
 	csi.UnimplementedControllerServer
 	csi.UnimplementedNodeServer
 	csi.UnimplementedIdentityServer
+	csi.UnimplementedGroupControllerServer
 	listener      net.Listener
 	server        *grpc.Server
 	wg            sync.WaitGroup
@@ -50,91 +53,95 @@ type CSIDriver struct {
 	locksMu       sync.Mutex
 	volumeLocks   map[string]*keyLock
 	snapshotLocks map[string]*keyLock
-	hsclient      *client.HammerspaceClient
-	NodeID        string
+	hsclient      client.Client
+	clients       *client.ClientPool
+	clusters      map[string]*client.Credentials
+	sites         map[string]string // topology site of each Hammerspace endpoint
+	// Mode selects the services served, controller, node or all. Empty serves all.
+	Mode     string
+	NodeID   string
+	NodeIP   string
+	NodeZone string
+	// ControllerPublishVolume adds an export rule for the node IP to the share of the volume
+	nodeExportRules bool
+	// Directory volumes are not limited to their capacity when the hs command is missing
+	unlimitedDirectories bool
 }
 
 func NewCSIDriver(endpoint, username, password, tlsVerifyStr string) *CSIDriver {
-	tlsVerify := false
-	if os.Getenv("HS_TLS_VERIFY") != "" {
-		tlsVerify, _ = strconv.ParseBool(tlsVerifyStr)
-	} else {
-		tlsVerify = false
-	}
-	client, err := client.NewHammerspaceClient(endpoint, username, password, tlsVerify)
+	hsclient, err := newHammerspaceClient(endpoint, username, password, tlsVerifyStr)
 	if err != nil {
 		log.Error(err)
 		os.Exit(1)
 	}
-	// We now require mounting through a DSX server
-	common.UseAnvil = false
-
-	return &CSIDriver{
-		hsclient:      client,
-		volumeLocks:   make(map[string]*keyLock),
-		snapshotLocks: make(map[string]*keyLock),
-		NodeID:        os.Getenv("CSI_NODE_NAME"),
-	}
-
+	return NewCSIDriverWithClient(hsclient)
 }
 
-type keyLock struct {
-	sem *semaphore.Weighted // weight=1 → acts like a mutex
-}
-
-func newKeyLock() *keyLock {
-	return &keyLock{sem: semaphore.NewWeighted(1)}
-}
-
-func (kl *keyLock) lock(ctx context.Context) error {
-	return kl.sem.Acquire(ctx, 1)
+// NewNodeCSIDriver creates a driver serving the node service. The node service only reads from
+// the Hammerspace API and the client logs in again on its next request, so a failed login is
+// logged and does not keep the node plugin from unpublishing and unstaging volumes.
+func NewNodeCSIDriver(endpoint, username, password, tlsVerifyStr string) *CSIDriver {
+	hsclient, err := newHammerspaceClient(endpoint, username, password, tlsVerifyStr)
+	if hsclient == nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Warnf("node plugin started without logging in to %s: %v", endpoint, err)
+	}
+	d := NewCSIDriverWithClient(hsclient)
+	d.Mode = common.ModeNode
+	return d
 }
 
-func (kl *keyLock) unlock() {
-	kl.sem.Release(1)
+func newHammerspaceClient(endpoint, username, password, tlsVerifyStr string) (*client.HammerspaceClient, error) {
+	tlsVerify := false
+	if os.Getenv("HS_TLS_VERIFY") != "" {
+		tlsVerify, _ = strconv.ParseBool(tlsVerifyStr)
+	}
+	return client.NewHammerspaceClient(endpoint, username, password, tlsVerify)
 }
 
-// acquire helpers with timeout + unlock func return
-func (c *CSIDriver) acquireVolumeLock(ctx context.Context, volID string) (func(), error) {
-	log.Debug("acquireVolumeLock: ", volID)
-	c.locksMu.Lock()
-	lk, ok := c.volumeLocks[volID]
-	if !ok {
-		lk = newKeyLock()
-		c.volumeLocks[volID] = lk
+// NewCSIDriverWithClient creates a driver using hsclient for requests without a cluster or
+// credentials, ex. with a FakeClient in tests. The rest is configured from the environment.
+func NewCSIDriverWithClient(hsclient client.Client) *CSIDriver {
+	endpoint := hsclient.Endpoint()
+	// Additional clusters selected with the cluster StorageClass parameter
+	clusters := map[string]*client.Credentials{}
+	if clustersConfig := os.Getenv("HS_CLUSTERS_CONFIG"); clustersConfig != "" {
+		var err error
+		clusters, err = client.LoadClusters(clustersConfig)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
 	}
-	c.locksMu.Unlock()
-
-	lctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	if err := lk.lock(lctx); err != nil {
-		log.WithError(err).Errorf("Error acquiring volume lock for %s", volID)
-		debug.PrintStack()
-		os.Exit(1)
+	// Topology sites are configured per cluster, HS_SITE is the site of HS_ENDPOINT and of the node
+	sites := map[string]string{endpoint: os.Getenv("HS_SITE")}
+	for _, creds := range clusters {
+		if creds.Site != "" {
+			sites[creds.Endpoint] = creds.Site
+		}
 	}
-	return func() { lk.unlock() }, nil
-}
+	nodeExportRules, _ := strconv.ParseBool(os.Getenv("HS_NODE_EXPORT_RULES"))
+	unlimitedDirectories, _ := strconv.ParseBool(os.Getenv("HS_UNLIMITED_DIRECTORY_VOLUMES"))
+	// We now require mounting through a DSX server
+	common.UseAnvil = false
 
-func (c *CSIDriver) acquireSnapshotLock(ctx context.Context, snapID string) (func(), error) {
-	log.Debug("acquireSnapshotLock: ", snapID)
-	c.locksMu.Lock()
-	lk, ok := c.snapshotLocks[snapID]
-	if !ok {
-		lk = newKeyLock()
-		c.snapshotLocks[snapID] = lk
+	return &CSIDriver{
+		hsclient:             hsclient,
+		clients:              client.NewClientPool(hsclient),
+		clusters:             clusters,
+		sites:                sites,
+		volumeLocks:          make(map[string]*keyLock),
+		snapshotLocks:        make(map[string]*keyLock),
+		NodeID:               os.Getenv("CSI_NODE_NAME"),
+		NodeIP:               os.Getenv("CSI_NODE_IP"),
+		NodeZone:             os.Getenv("CSI_NODE_ZONE"),
+		nodeExportRules:      nodeExportRules,
+		unlimitedDirectories: unlimitedDirectories,
 	}
-	c.locksMu.Unlock()
-
-	lctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
 
-	if err := lk.lock(lctx); err != nil {
-		log.WithError(err).Errorf("Error acquiring snapshot lock for %s", snapID)
-		debug.PrintStack()
-		os.Exit(1)
-	}
-	return func() { lk.unlock() }, nil
 }
 
 func (c *CSIDriver) goServe(started chan<- bool) {
@@ -171,6 +178,7 @@ func (c *CSIDriver) Start(l net.Listener) error {
 	csi.RegisterControllerServer(c.server, c)
 	csi.RegisterIdentityServer(c.server, c)
 	csi.RegisterNodeServer(c.server, c)
+	csi.RegisterGroupControllerServer(c.server, c)
 	reflection.Register(c.server)
 
 	// Start listening for requests
@@ -197,7 +205,7 @@ func (c *CSIDriver) Close() {
 	c.server.Stop()
 }
 
-func (c *CSIDriver) GetHammerspaceClient() *client.HammerspaceClient {
+func (c *CSIDriver) GetHammerspaceClient() client.Client {
 	return c.hsclient
 }
 
@@ -206,26 +214,164 @@ func (c *CSIDriver) callInterceptor(
 	req interface{},
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, span := startCallSpan(ctx, info.FullMethod)
+	defer span.End()
+	ctx = common.WithLogFields(ctx, requestLogFields(info.FullMethod, req, c.NodeID))
+	startTime := time.Now()
+	var rsp interface{}
+	err := c.checkMode(info.FullMethod)
+	if err == nil {
+		rsp, err = c.routeRequest(ctx, req, info, handler)
+	} else {
+		logGRPC(ctx, req, nil, err)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	metrics.ObserveRPC(info.FullMethod, status.Code(err), time.Since(startTime))
+	return rsp, err
+}
+
+// startCallSpan starts the span of a gRPC call, joining the trace of the caller, ex. the
+// external-provisioner. The spans and logs of the call share its trace ID.
+func startCallSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(tracing.ExtractIncoming(ctx), method, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// requestLogFields returns the fields identifying a gRPC call in the logs of the call. Node
+// service calls are logged with the node of the plugin.
+func requestLogFields(method string, req interface{}, nodeID string) log.Fields {
+	fields := log.Fields{common.LogFieldMethod: method}
+	if r, ok := req.(interface{ GetVolumeId() string }); ok && r.GetVolumeId() != "" {
+		fields[common.LogFieldVolumeID] = r.GetVolumeId()
+	} else if r, ok := req.(interface{ GetSourceVolumeId() string }); ok && r.GetSourceVolumeId() != "" {
+		fields[common.LogFieldVolumeID] = r.GetSourceVolumeId()
+	}
+	if r, ok := req.(interface{ GetSnapshotId() string }); ok && r.GetSnapshotId() != "" {
+		fields[common.LogFieldSnapshotID] = r.GetSnapshotId()
+	}
+	if r, ok := req.(interface{ GetNodeId() string }); ok && r.GetNodeId() != "" {
+		fields[common.LogFieldNodeID] = r.GetNodeId()
+	} else if strings.Contains(method, ".Node/") && nodeID != "" {
+		fields[common.LogFieldNodeID] = nodeID
+	}
+	return fields
+}
+
+// routeRequest sends a request to the Hammerspace cluster and client it is for
+func (c *CSIDriver) routeRequest(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	cluster, err := c.stripClusterIDs(req)
+	if _, isListSnapshots := req.(*csi.ListSnapshotsRequest); isListSnapshots && err != nil {
+		// there are no snapshots on an unknown cluster, or of a volume on another cluster
+		rsp := &csi.ListSnapshotsResponse{}
+		logGRPC(ctx, req, rsp, nil)
+		return rsp, nil
+	}
+	if err != nil {
+		logGRPC(ctx, req, nil, err)
+		return nil, err
+	}
+	if len(c.clusters) > 0 && listsAllClusters(req) {
+		rsp, err := c.listAllClusters(ctx, req, handler)
+		logGRPC(ctx, req, rsp, err)
+		return rsp, err
+	}
+	ctx, err = c.withRequestClient(ctx, req, cluster)
+	if err != nil {
+		logGRPC(ctx, req, nil, err)
+		return nil, err
+	}
 	rsp, err := handler(ctx, req)
-	logGRPC(info.FullMethod, req, rsp, err)
+	addClusterIDs(rsp, cluster)
+	logGRPC(ctx, req, rsp, err)
 	return rsp, err
 }
 
-func logGRPC(method string, request, reply interface{}, err error) {
-	// Log JSON with the request and response for easier parsing
-	logMessage := struct {
-		Method   string
-		Request  interface{}
-		Response interface{}
-		Error    string
-	}{
-		Method:   method,
-		Request:  request,
-		Response: reply,
+// servesController reports whether the controller and group controller services are served
+func (c *CSIDriver) servesController() bool {
+	return c.Mode != common.ModeNode
+}
+
+// servesNode reports whether the node service is served
+func (c *CSIDriver) servesNode() bool {
+	return c.Mode != common.ModeController
+}
+
+// checkMode rejects calls to a service that is not served in the mode of the plugin, ex. a node
+// call sent to the controller plugin
+func (c *CSIDriver) checkMode(method string) error {
+	served := true
+	service, _, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	switch service {
+	case "csi.v1.Controller", "csi.v1.GroupController", "csi.v0.Controller":
+		served = c.servesController()
+	case "csi.v1.Node", "csi.v0.Node":
+		served = c.servesNode()
+	}
+	if !served {
+		return status.Errorf(codes.Unimplemented, common.MethodNotServedInMode, method, c.Mode)
+	}
+	return nil
+}
+
+type hsClientContextKey struct{}
+
+// withRequestClient selects the Hammerspace client for the cluster of a request and the
+// credentials in its secrets
+func (c *CSIDriver) withRequestClient(ctx context.Context, req interface{}, cluster string) (context.Context, error) {
+	if c.clients == nil {
+		return ctx, nil
+	}
+	hsclient, err := c.clients.Get(c.clusters[cluster])
+	if err != nil {
+		return ctx, status.Errorf(codes.Unavailable, common.LoginFailed, c.clusters[cluster].Endpoint, c.clusters[cluster].Username, err.Error())
+	}
+
+	if withSecrets, ok := req.(interface{ GetSecrets() map[string]string }); ok {
+		creds, err := client.CredentialsFromSecrets(withSecrets.GetSecrets(), hsclient)
+		if err != nil {
+			return ctx, status.Errorf(codes.InvalidArgument, common.InvalidSecrets, err.Error())
+		}
+		if creds != nil {
+			hsclient, err = c.clients.Get(creds)
+			if err != nil {
+				return ctx, status.Errorf(codes.Unauthenticated, common.LoginFailed, creds.Endpoint, creds.Username, err.Error())
+			}
+		}
+	}
+	return context.WithValue(ctx, hsClientContextKey{}, hsclient), nil
+}
+
+// getHSClient returns the Hammerspace client selected for the request, or the default client
+func (c *CSIDriver) getHSClient(ctx context.Context) client.Client {
+	if hsclient, ok := ctx.Value(hsClientContextKey{}).(client.Client); ok {
+		return hsclient
+	}
+	return c.hsclient
+}
+
+// logGRPC logs a gRPC call with the verbosity configured for its method, taken from the logger
+// of ctx. Secrets are redacted from the request and response, which are capped to the payload limit.
+func logGRPC(ctx context.Context, request, reply interface{}, err error) {
+	logger := common.Logger(ctx)
+	method, _ := logger.Data[common.LogFieldMethod].(string)
+	verbosity := common.GRPCLogVerbosity(method)
+	if verbosity == common.LogVerbosityNone {
+		return
+	}
+	fields := log.Fields{}
+	if verbosity == common.LogVerbosityFull {
+		fields["request"] = common.RedactPayload(request)
+		fields["response"] = common.RedactPayload(reply)
 	}
 	if err != nil {
-		logMessage.Error = err.Error()
+		fields["code"] = status.Code(err).String()
+		logger.WithFields(fields).WithError(err).Error("gRPCCall")
+		return
 	}
-	msg, _ := json.Marshal(logMessage)
-	fmt.Printf("gRPCCall: %s\n", msg)
+	logger.WithFields(fields).Info("gRPCCall")
 }
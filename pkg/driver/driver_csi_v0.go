@@ -25,6 +25,7 @@ import (
 	csi_v0 "github.com/ameade/spec/lib/go/csi/v0"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/hammer-space/csi-plugin/pkg/common"
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -122,8 +123,20 @@ func (c *CSIDriver_v0Support) callInterceptor(
 	req interface{},
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (interface{}, error) {
-	rsp, err := handler(ctx, req)
-	logGRPC(info.FullMethod, req, rsp, err)
+	ctx, span := startCallSpan(ctx, info.FullMethod)
+	defer span.End()
+	ctx = common.WithLogFields(ctx, requestLogFields(info.FullMethod, req, c.driver.NodeID))
+	startTime := time.Now()
+	var rsp interface{}
+	err := c.driver.checkMode(info.FullMethod)
+	if err == nil {
+		rsp, err = handler(ctx, req)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	metrics.ObserveRPC(info.FullMethod, status.Code(err), time.Since(startTime))
+	logGRPC(ctx, req, rsp, err)
 	return rsp, err
 }
 
@@ -1,10 +1,14 @@
 package driver
 
 import (
+    "context"
     "fmt"
     csi_v0 "github.com/ameade/spec/lib/go/csi/v0"
     "github.com/container-storage-interface/spec/lib/go/csi"
     "github.com/hammer-space/csi-plugin/pkg/common"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
     "reflect"
     "strings"
     "testing"
@@ -71,3 +75,23 @@ func TestConvertVolumeCapablityfromv0tov1(t *testing.T) {
         }
     }
 }
+
+func TestV0CallInterceptorChecksMode(t *testing.T) {
+    d := NewCSIDriver_v0Support(&CSIDriver{Mode: common.ModeNode})
+    called := false
+    handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+        called = true
+        return nil, nil
+    }
+
+    info := &grpc.UnaryServerInfo{FullMethod: "/csi.v0.Controller/CreateVolume"}
+    _, err := d.callInterceptor(context.Background(), &csi_v0.CreateVolumeRequest{}, info, handler)
+    if status.Code(err) != codes.Unimplemented || called {
+        t.Errorf("Expected Unimplemented without calling the handler, got %v", err)
+    }
+
+    info = &grpc.UnaryServerInfo{FullMethod: "/csi.v0.Node/NodeGetCapabilities"}
+    if _, err := d.callInterceptor(context.Background(), &csi_v0.NodeGetCapabilitiesRequest{}, info, handler); err != nil || !called {
+        t.Errorf("Expected the handler to be called, got %v", err)
+    }
+}
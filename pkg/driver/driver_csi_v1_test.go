@@ -2,8 +2,21 @@ package driver
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/client"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // TestAcquireAndReleaseVolumeLock ensures a lock can be acquired and released.
@@ -39,6 +52,10 @@ func TestAcquireVolumeLockTimeout(t *testing.T) {
 	}
 
 	volID := "vol-timeout"
+	cfg := *common.GetConfig()
+	cfg.LockTimeout = 300 * time.Millisecond
+	common.SetConfig(&cfg)
+	defer common.SetConfig(common.DefaultPluginConfig())
 
 	// Acquire the lock and don't release
 	unlock, err := d.acquireVolumeLock(context.Background(), volID)
@@ -60,6 +77,70 @@ func TestAcquireVolumeLockTimeout(t *testing.T) {
 	if elapsed < 250*time.Millisecond {
 		t.Fatalf("expected blocking for ~300ms, got only %v", elapsed)
 	}
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("expected Aborted, got %v", err)
+	}
+
+	// The timed out waiter leaves the lock to its holder
+	if len(d.volumeLocks) != 1 || d.volumeLocks[volID].refs != 1 {
+		t.Fatalf("expected only the holder to reference the lock, got %+v", d.volumeLocks)
+	}
+	unlock()
+	if len(d.volumeLocks) != 0 {
+		t.Fatalf("expected the released lock to be removed, got %+v", d.volumeLocks)
+	}
+}
+
+// TestLocks ensures held and waited locks are reported and removed once released
+func TestLocks(t *testing.T) {
+	d := &CSIDriver{
+		volumeLocks:   make(map[string]*keyLock),
+		snapshotLocks: make(map[string]*keyLock),
+	}
+
+	unlockVolume, err := d.acquireVolumeLock(context.Background(), "vol-1")
+	if err != nil {
+		t.Fatalf("expected lock to succeed, got error: %v", err)
+	}
+	unlockSnapshot, err := d.acquireSnapshotLock(context.Background(), "snap-1")
+	if err != nil {
+		t.Fatalf("expected lock to succeed, got error: %v", err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		unlock, err := d.acquireVolumeLock(context.Background(), "vol-1")
+		if err != nil {
+			t.Errorf("expected waiting lock to succeed, got error: %v", err)
+		}
+		acquired <- unlock
+	}()
+	for {
+		locks := d.Locks()
+		if len(locks) == 2 && len(locks[1].Waiters) == 1 {
+			if locks[0].Kind != "snapshot" || locks[0].ID != "snap-1" || locks[0].Holder == nil {
+				t.Fatalf("unexpected snapshot lock %+v", locks[0])
+			}
+			if locks[1].Kind != "volume" || locks[1].ID != "vol-1" || locks[1].Holder == nil {
+				t.Fatalf("unexpected volume lock %+v", locks[1])
+			}
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	unlockVolume()
+	unlockSnapshot()
+	unlock := <-acquired
+	// unlocking twice has no effect
+	unlockVolume()
+	if locks := d.Locks(); len(locks) != 1 || len(locks[0].Waiters) != 0 {
+		t.Fatalf("expected only the acquired volume lock, got %+v", locks)
+	}
+	unlock()
+	if len(d.volumeLocks) != 0 || len(d.snapshotLocks) != 0 {
+		t.Fatalf("expected all locks to be removed, got %+v %+v", d.volumeLocks, d.snapshotLocks)
+	}
 }
 
 // TestSnapshotLock is just to ensure snapshotLocks uses same logic
@@ -85,3 +166,164 @@ func TestAcquireSnapshotLock(t *testing.T) {
 		t.Fatalf("expected lock after unlock to succeed, got error: %v", err)
 	}
 }
+
+// TestWithRequestClient ensures requests without credentials use the default client
+// and invalid credentials are rejected
+func TestWithRequestClient(t *testing.T) {
+	defaultClient := &client.HammerspaceClient{}
+	d := &CSIDriver{
+		hsclient: defaultClient,
+		clients:  client.NewClientPool(defaultClient),
+	}
+
+	ctx, err := d.withRequestClient(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "/test-volume"}, "")
+	if err != nil {
+		t.Fatalf("expected no error without secrets, got %v", err)
+	}
+	if d.getHSClient(ctx) != defaultClient {
+		t.Fatalf("expected default client without secrets")
+	}
+
+	_, err = d.withRequestClient(context.Background(), &csi.DeleteVolumeRequest{
+		VolumeId: "/test-volume",
+		Secrets:  map[string]string{"username": "tenant"},
+	}, "")
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for incomplete secrets, got %v", err)
+	}
+}
+
+func TestCheckMode(t *testing.T) {
+	cases := []struct {
+		mode     string
+		method   string
+		expected codes.Code
+	}{
+		{"", "/csi.v1.Node/NodeStageVolume", codes.OK},
+		{"", "/csi.v1.Controller/CreateVolume", codes.OK},
+		{common.ModeAll, "/csi.v1.GroupController/CreateVolumeGroupSnapshot", codes.OK},
+		{common.ModeController, "/csi.v1.Controller/ControllerGetCapabilities", codes.OK},
+		{common.ModeController, "/csi.v1.Node/NodeGetCapabilities", codes.Unimplemented},
+		{common.ModeController, "/csi.v1.Identity/Probe", codes.OK},
+		{common.ModeNode, "/csi.v1.Node/NodeGetCapabilities", codes.OK},
+		{common.ModeNode, "/csi.v1.Controller/ControllerGetCapabilities", codes.Unimplemented},
+		{common.ModeNode, "/csi.v1.GroupController/GroupControllerGetCapabilities", codes.Unimplemented},
+		{common.ModeNode, "/csi.v1.Identity/GetPluginInfo", codes.OK},
+		{common.ModeNode, "/csi.v0.Controller/CreateVolume", codes.Unimplemented},
+		{common.ModeNode, "/csi.v0.Node/NodePublishVolume", codes.OK},
+		{common.ModeController, "/csi.v0.Node/NodePublishVolume", codes.Unimplemented},
+		{common.ModeController, "/csi.v0.Identity/Probe", codes.OK},
+	}
+	for _, c := range cases {
+		d := &CSIDriver{Mode: c.mode}
+		if code := status.Code(d.checkMode(c.method)); code != c.expected {
+			t.Errorf("mode %q, method %s: expected %v, got %v", c.mode, c.method, c.expected, code)
+		}
+	}
+}
+
+func TestGetPluginCapabilitiesMode(t *testing.T) {
+	for mode, expected := range map[string]bool{
+		common.ModeAll:        true,
+		common.ModeController: true,
+		common.ModeNode:       false,
+	} {
+		d := &CSIDriver{Mode: mode}
+		rsp, err := d.GetPluginCapabilities(context.Background(), &csi.GetPluginCapabilitiesRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		controller := false
+		for _, c := range rsp.Capabilities {
+			if c.GetService().GetType() == csi.PluginCapability_Service_CONTROLLER_SERVICE {
+				controller = true
+			}
+		}
+		if controller != expected {
+			t.Errorf("mode %s: expected CONTROLLER_SERVICE %v, got %v", mode, expected, controller)
+		}
+	}
+}
+
+func TestNewNodeCSIDriverWithoutLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	// The node plugin starts and logs in again on its next request
+	d := NewNodeCSIDriver(server.URL, "reader", "wrong", "false")
+	if d.hsclient == nil || d.Mode != common.ModeNode {
+		t.Errorf("expected a node driver, got client %v mode %q", d.hsclient, d.Mode)
+	}
+}
+
+func TestLogGRPC(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	defer common.SetConfig(common.GetConfig())
+	cfg := common.DefaultPluginConfig()
+	cfg.GRPCMethodLogVerbosity = map[string]string{"Probe": common.LogVerbosityNone}
+	common.SetConfig(cfg)
+
+	req := &csi.CreateVolumeRequest{Name: "vol1", Secrets: map[string]string{"password": "hunter2"}}
+	ctx := common.WithLogFields(context.Background(), requestLogFields("/csi.v1.Controller/CreateVolume", req, ""))
+	logGRPC(ctx, req, nil, status.Error(codes.NotFound, "not found"))
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != log.ErrorLevel || entry.Data["code"] != codes.NotFound.String() ||
+		entry.Data[common.LogFieldMethod] != "/csi.v1.Controller/CreateVolume" {
+		t.Fatalf("unexpected log entry %+v", entry)
+	}
+	if request := entry.Data["request"].(string); strings.Contains(request, "hunter2") || !strings.Contains(request, "vol1") {
+		t.Errorf("unexpected logged request %s", request)
+	}
+
+	hook.Reset()
+	ctx = common.WithLogFields(context.Background(), requestLogFields("/csi.v1.Identity/Probe", &csi.ProbeRequest{}, ""))
+	logGRPC(ctx, &csi.ProbeRequest{}, &csi.ProbeResponse{}, nil)
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("Probe must not be logged")
+	}
+}
+
+func TestRequestLogFields(t *testing.T) {
+	cases := []struct {
+		method   string
+		req      interface{}
+		expected log.Fields
+	}{
+		{"/csi.v1.Controller/DeleteVolume", &csi.DeleteVolumeRequest{VolumeId: "/vol1"},
+			log.Fields{"method": "/csi.v1.Controller/DeleteVolume", "volume_id": "/vol1"}},
+		{"/csi.v1.Controller/CreateSnapshot", &csi.CreateSnapshotRequest{SourceVolumeId: "/vol1", Name: "snap1"},
+			log.Fields{"method": "/csi.v1.Controller/CreateSnapshot", "volume_id": "/vol1"}},
+		{"/csi.v1.Controller/ListSnapshots", &csi.ListSnapshotsRequest{SnapshotId: "snap1|/vol1"},
+			log.Fields{"method": "/csi.v1.Controller/ListSnapshots", "snapshot_id": "snap1|/vol1"}},
+		{"/csi.v1.Controller/ControllerPublishVolume", &csi.ControllerPublishVolumeRequest{VolumeId: "/vol1", NodeId: "node2"},
+			log.Fields{"method": "/csi.v1.Controller/ControllerPublishVolume", "volume_id": "/vol1", "node_id": "node2"}},
+		{"/csi.v1.Node/NodeUnstageVolume", &csi.NodeUnstageVolumeRequest{VolumeId: "/vol1"},
+			log.Fields{"method": "/csi.v1.Node/NodeUnstageVolume", "volume_id": "/vol1", "node_id": "node1"}},
+		{"/csi.v1.Identity/Probe", &csi.ProbeRequest{},
+			log.Fields{"method": "/csi.v1.Identity/Probe"}},
+	}
+	for _, c := range cases {
+		if fields := requestLogFields(c.method, c.req, "node1"); !reflect.DeepEqual(fields, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.method, c.expected, fields)
+		}
+	}
+}
+
+func TestCallInterceptorLogger(t *testing.T) {
+	d := &CSIDriver{NodeID: "node1"}
+	var logger *log.Entry
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		logger = common.Logger(ctx)
+		return &csi.NodeGetInfoResponse{}, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Node/NodeGetInfo"}
+	if _, err := d.callInterceptor(context.Background(), &csi.NodeGetInfoRequest{}, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	if logger.Data[common.LogFieldMethod] != info.FullMethod || logger.Data[common.LogFieldNodeID] != "node1" {
+		t.Errorf("unexpected logger fields %v", logger.Data)
+	}
+}
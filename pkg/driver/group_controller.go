@@ -0,0 +1,386 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	timestamp "google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+// groupSnapshotMember is a source volume of a group snapshot and its snapshot ID
+type groupSnapshotMember struct {
+	sourceVolumeID string
+	snapID         string
+}
+
+func (d *CSIDriver) GroupControllerGetCapabilities(ctx context.Context, req *csi.GroupControllerGetCapabilitiesRequest) (*csi.GroupControllerGetCapabilitiesResponse, error) {
+	return &csi.GroupControllerGetCapabilitiesResponse{
+		Capabilities: []*csi.GroupControllerServiceCapability{
+			{
+				Type: &csi.GroupControllerServiceCapability_Rpc{
+					Rpc: &csi.GroupControllerServiceCapability_RPC{
+						Type: csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (d *CSIDriver) CreateVolumeGroupSnapshot(ctx context.Context, req *csi.CreateVolumeGroupSnapshotRequest) (*csi.CreateVolumeGroupSnapshotResponse, error) {
+	// Start a span for tracing
+	ctx, span := tracer.Start(ctx, "GroupController/CreateVolumeGroupSnapshot", trace.WithAttributes(
+		attribute.String("group.snapshot.name", req.GetName()),
+		attribute.StringSlice("source.volume.ids", req.GetSourceVolumeIds()),
+	))
+	defer span.End()
+
+	common.Logger(ctx).WithFields(log.Fields{
+		"name":              req.Name,
+		"source_volume_ids": req.SourceVolumeIds,
+	}).Infof("Create group snapshot request recived.")
+
+	if len(req.GetName()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, common.EmptyGroupSnapshotName)
+	}
+	if len(req.GetName()) > MaxNameLength {
+		return nil, status.Errorf(codes.InvalidArgument, common.SnapshotIdTooLong, MaxNameLength)
+	}
+	if len(req.GetSourceVolumeIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, common.MissingGroupSnapshotSourceVolumeIds)
+	}
+	seen := map[string]bool{}
+	for _, sourceVolumeID := range req.GetSourceVolumeIds() {
+		if sourceVolumeID == "" {
+			return nil, status.Error(codes.InvalidArgument, common.MissingSnapshotSourceVolumeId)
+		}
+		if seen[sourceVolumeID] {
+			return nil, status.Errorf(codes.InvalidArgument, common.DuplicateGroupSnapshotMember, sourceVolumeID)
+		}
+		seen[sourceVolumeID] = true
+	}
+
+	unlock, err := d.acquireSnapshotLock(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	groupSnapshotID := GetGroupSnapshotID(req.GetName())
+
+	// Find every source volume and the share it is snapshotted with before taking the snapshot
+	members := make([]*groupSnapshotMember, 0, len(req.GetSourceVolumeIds()))
+	var shareName string
+	for _, sourceVolumeID := range req.GetSourceVolumeIds() {
+		share, err := d.getHSClient(ctx).GetShare(ctx, GetVolumeNameFromPath(sourceVolumeID))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		if share == nil {
+			exists := false
+			if filepath.Dir(sourceVolumeID) != "/" {
+				exists, err = d.getHSClient(ctx).DoesFileExist(ctx, sourceVolumeID)
+				if err != nil {
+					return nil, status.Errorf(codes.Internal, "%s", err.Error())
+				}
+			}
+			if !exists {
+				return nil, status.Errorf(codes.NotFound, common.SourceVolumeNotFound, sourceVolumeID)
+			}
+		}
+		memberShareName := GetSnapshotRecordShareName(sourceVolumeID, share != nil)
+		if shareName == "" {
+			shareName = memberShareName
+		} else if memberShareName != shareName {
+			return nil, status.Errorf(codes.InvalidArgument, common.GroupSnapshotMembersOnSeveralShares,
+				members[0].sourceVolumeID, shareName, sourceVolumeID, memberShareName)
+		}
+		members = append(members, &groupSnapshotMember{sourceVolumeID: sourceVolumeID})
+	}
+
+	// A previous call may already have created the group snapshot
+	snapIDs, err := d.findGroupSnapshotMembers(ctx, req.GetName(), []string{shareName})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if len(snapIDs) > 0 {
+		var sourceVolumeIDs []string
+		for _, snapID := range snapIDs {
+			_, sourceVolumeID, _ := strings.Cut(snapID, "|")
+			sourceVolumeIDs = append(sourceVolumeIDs, sourceVolumeID)
+		}
+		if !sameMembers(sourceVolumeIDs, req.GetSourceVolumeIds()) {
+			return nil, status.Errorf(codes.AlreadyExists, common.GroupSnapshotExistsForOtherVolumes, req.GetName())
+		}
+		common.Logger(ctx).Infof("Group snapshot %s already exists with snapshots %v", req.GetName(), snapIDs)
+		return &csi.CreateVolumeGroupSnapshotResponse{
+			GroupSnapshot: newGroupSnapshot(groupSnapshotID, snapIDs),
+		}, nil
+	}
+
+	// A single snapshot of the share captures all members at the same instant
+	hsSnapName, err := d.getHSClient(ctx).SnapshotShare(ctx, shareName)
+	if err != nil {
+		common.Logger(ctx).Errorf("failed to snapshot share %s for group snapshot %s: %v", shareName, req.GetName(), err)
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	snapIDs = make([]string, 0, len(members))
+	for _, member := range members {
+		member.snapID = GetSnapshotIDFromSnapshotName(hsSnapName, member.sourceVolumeID)
+		snapIDs = append(snapIDs, member.snapID)
+	}
+
+	// Get and delete rely on the records, so a group that cannot be recorded is removed
+	if err := d.recordGroupSnapshot(ctx, shareName, req.GetName(), members); err != nil {
+		common.Logger(ctx).Errorf("failed to record group snapshot %s: %v", req.GetName(), err)
+		if err := d.getHSClient(ctx).DeleteShareSnapshot(ctx, shareName, hsSnapName); err != nil {
+			common.Logger(ctx).Warnf("failed to delete snapshot %s of share %s of incomplete group snapshot: %v", hsSnapName, shareName, err)
+		}
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+
+	return &csi.CreateVolumeGroupSnapshotResponse{
+		GroupSnapshot: newGroupSnapshot(groupSnapshotID, snapIDs),
+	}, nil
+}
+
+func (d *CSIDriver) DeleteVolumeGroupSnapshot(ctx context.Context, req *csi.DeleteVolumeGroupSnapshotRequest) (*csi.DeleteVolumeGroupSnapshotResponse, error) {
+	// Start a span for tracing
+	ctx, span := tracer.Start(ctx, "GroupController/DeleteVolumeGroupSnapshot", trace.WithAttributes(
+		attribute.String("group.snapshot.id", req.GetGroupSnapshotId()),
+		attribute.StringSlice("snapshot.ids", req.GetSnapshotIds()),
+	))
+	defer span.End()
+
+	groupSnapshotName, err := d.validateGroupSnapshotRequest(req.GetGroupSnapshotId(), req.GetSnapshotIds())
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.acquireSnapshotLock(ctx, groupSnapshotName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Members deleted by an earlier attempt are no longer recorded, so only check that no
+	// recorded member would be left behind
+	recorded, err := d.findGroupSnapshotMembers(ctx, groupSnapshotName, groupSnapshotShareNames(req.GetSnapshotIds()))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	requested := map[string]bool{}
+	for _, snapID := range req.GetSnapshotIds() {
+		requested[snapID] = true
+	}
+	for _, snapID := range recorded {
+		if !requested[snapID] {
+			return nil, status.Errorf(codes.InvalidArgument, common.GroupSnapshotMemberMismatch, req.GetSnapshotIds(), recorded, req.GetGroupSnapshotId())
+		}
+	}
+
+	// The members share one snapshot, which is deleted with the first of them
+	deleted := map[string]bool{}
+	for _, snapID := range req.GetSnapshotIds() {
+		hsSnapName, sourceVolumeID, _ := strings.Cut(snapID, "|")
+		shareName := groupSnapshotShareName(sourceVolumeID)
+		if !deleted[shareName+"|"+hsSnapName] {
+			if err := d.deleteShareSnapshot(ctx, shareName, hsSnapName); err != nil {
+				return nil, err
+			}
+			deleted[shareName+"|"+hsSnapName] = true
+		}
+		if err := d.removeSnapshotRecord(ctx, shareName, snapID); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+}
+
+func (d *CSIDriver) GetVolumeGroupSnapshot(ctx context.Context, req *csi.GetVolumeGroupSnapshotRequest) (*csi.GetVolumeGroupSnapshotResponse, error) {
+	// Start a span for tracing
+	ctx, span := tracer.Start(ctx, "GroupController/GetVolumeGroupSnapshot", trace.WithAttributes(
+		attribute.String("group.snapshot.id", req.GetGroupSnapshotId()),
+	))
+	defer span.End()
+
+	groupSnapshotName, err := d.validateGroupSnapshotRequest(req.GetGroupSnapshotId(), req.GetSnapshotIds())
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, err := d.findGroupSnapshotMembers(ctx, groupSnapshotName, groupSnapshotShareNames(req.GetSnapshotIds()))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if len(recorded) == 0 {
+		return nil, status.Errorf(codes.NotFound, common.GroupSnapshotNotFound, req.GetGroupSnapshotId())
+	}
+	if !sameMembers(recorded, req.GetSnapshotIds()) {
+		return nil, status.Errorf(codes.InvalidArgument, common.GroupSnapshotMemberMismatch, req.GetSnapshotIds(), recorded, req.GetGroupSnapshotId())
+	}
+
+	return &csi.GetVolumeGroupSnapshotResponse{
+		GroupSnapshot: newGroupSnapshot(req.GetGroupSnapshotId(), recorded),
+	}, nil
+}
+
+// validateGroupSnapshotRequest checks the IDs of a group snapshot request and returns the group snapshot name
+func (d *CSIDriver) validateGroupSnapshotRequest(groupSnapshotId string, snapIDs []string) (string, error) {
+	if len(groupSnapshotId) == 0 {
+		return "", status.Error(codes.InvalidArgument, common.EmptyGroupSnapshotId)
+	}
+	groupSnapshotName, err := GetGroupSnapshotNameFromId(groupSnapshotId)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "%s", err.Error())
+	}
+	if len(snapIDs) == 0 {
+		return "", status.Error(codes.InvalidArgument, common.MissingGroupSnapshotIds)
+	}
+	for _, snapID := range snapIDs {
+		if _, err := GetSnapshotNameFromSnapshotId(snapID); err != nil {
+			return "", status.Errorf(codes.InvalidArgument, "%s", err.Error())
+		}
+	}
+	return groupSnapshotName, nil
+}
+
+// newGroupSnapshot builds the CSI group snapshot for the snapshots of its members, the group is
+// as old as its oldest member
+func newGroupSnapshot(groupSnapshotID string, snapIDs []string) *csi.VolumeGroupSnapshot {
+	groupSnapshot := &csi.VolumeGroupSnapshot{
+		GroupSnapshotId: groupSnapshotID,
+		ReadyToUse:      true,
+	}
+	for _, snapID := range snapIDs {
+		_, sourceVolumeID, _ := strings.Cut(snapID, "|")
+		snapshot := newSnapshot(snapID, sourceVolumeID)
+		snapshot.GroupSnapshotId = groupSnapshotID
+		groupSnapshot.Snapshots = append(groupSnapshot.Snapshots, snapshot)
+
+		created := snapshot.GetCreationTime().AsTime()
+		if groupSnapshot.CreationTime == nil || created.Before(groupSnapshot.CreationTime.AsTime()) {
+			groupSnapshot.CreationTime = timestamp.New(created)
+		}
+	}
+	return groupSnapshot
+}
+
+// findGroupSnapshotMembers returns the snapshot IDs recorded for the members of a group snapshot
+// on the given shares, or nothing if no group snapshot was created under that name
+func (d *CSIDriver) findGroupSnapshotMembers(ctx context.Context, groupSnapshotName string, shareNames []string) ([]string, error) {
+	prefix := GetGroupSnapshotRecordPrefix(groupSnapshotName)
+	var snapIDs []string
+	for _, shareName := range shareNames {
+		share, err := d.getHSClient(ctx).GetShare(ctx, shareName)
+		if err != nil {
+			return nil, err
+		}
+		if share == nil {
+			continue
+		}
+		for key, snapID := range share.ExtendedInfo {
+			if strings.HasPrefix(key, prefix) && snapID != "" {
+				snapIDs = append(snapIDs, snapID)
+			}
+		}
+	}
+	sort.Strings(snapIDs)
+	return snapIDs, nil
+}
+
+// groupSnapshotShareName returns the share that is snapshotted for a member of a group snapshot,
+// the share of a share-backed volume or the backing share of other volumes
+func groupSnapshotShareName(sourceVolumeID string) string {
+	return GetSnapshotRecordShareName(sourceVolumeID, filepath.Dir(sourceVolumeID) == "/")
+}
+
+// groupSnapshotShareNames returns the shares snapshotted for the member snapshots of a group
+func groupSnapshotShareNames(snapIDs []string) []string {
+	var shareNames []string
+	for _, snapID := range snapIDs {
+		_, sourceVolumeID, _ := strings.Cut(snapID, "|")
+		if shareName := groupSnapshotShareName(sourceVolumeID); !slices.Contains(shareNames, shareName) {
+			shareNames = append(shareNames, shareName)
+		}
+	}
+	return shareNames
+}
+
+// recordGroupSnapshot stores the snapshot of each member of a group snapshot in the extended
+// info of the share that was snapshotted
+func (d *CSIDriver) recordGroupSnapshot(ctx context.Context, shareName, groupSnapshotName string, members []*groupSnapshotMember) error {
+	records := map[string]string{}
+	for _, member := range members {
+		records[GetGroupSnapshotRecordKey(groupSnapshotName, member.sourceVolumeID)] = member.snapID
+	}
+
+	unlock, err := d.acquireVolumeLock(ctx, shareName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, shareName, records)
+}
+
+// deleteShareSnapshot deletes the snapshot of a group, a snapshot or share that does not exist is
+// treated as deleted
+func (d *CSIDriver) deleteShareSnapshot(ctx context.Context, shareName, hsSnapName string) error {
+	share, err := d.getHSClient(ctx).GetShare(ctx, shareName)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if share == nil {
+		return nil
+	}
+	err = d.getHSClient(ctx).DeleteShareSnapshot(ctx, shareName, hsSnapName)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// sameMembers reports whether two lists contain the same IDs
+func sameMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, id := range a {
+		counts[id]++
+	}
+	for _, id := range b {
+		if counts[id] == 0 {
+			return false
+		}
+		counts[id]--
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package driver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/client"
+	common "github.com/hammer-space/csi-plugin/pkg/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateVolumeGroupSnapshotValidation(t *testing.T) {
+	d := &CSIDriver{}
+
+	cases := []*csi.CreateVolumeGroupSnapshotRequest{
+		{SourceVolumeIds: []string{"/test-volume"}},
+		{Name: "test-group"},
+		{Name: "test-group", SourceVolumeIds: []string{"/test-volume", ""}},
+		{Name: "test-group", SourceVolumeIds: []string{"/test-volume", "/test-volume"}},
+	}
+	for _, req := range cases {
+		_, err := d.CreateVolumeGroupSnapshot(context.Background(), req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %v, got: %v", req, err)
+		}
+	}
+}
+
+func TestValidateGroupSnapshotRequest(t *testing.T) {
+	d := &CSIDriver{}
+
+	name, err := d.validateGroupSnapshotRequest("group|test-group", []string{"2019-05-24T15-26-57-0|/test-volume"})
+	if err != nil || name != "test-group" {
+		t.Errorf("Expected test-group, got %s, %v", name, err)
+	}
+
+	cases := []struct {
+		groupSnapshotId string
+		snapIDs         []string
+	}{
+		{"", []string{"2019-05-24T15-26-57-0|/test-volume"}},
+		{"test-group", []string{"2019-05-24T15-26-57-0|/test-volume"}},
+		{"group|test-group", nil},
+		{"group|test-group", []string{"/test-volume"}},
+	}
+	for _, c := range cases {
+		_, err := d.validateGroupSnapshotRequest(c.groupSnapshotId, c.snapIDs)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %s, %v, got: %v", c.groupSnapshotId, c.snapIDs, err)
+		}
+	}
+}
+
+func TestNewGroupSnapshot(t *testing.T) {
+	group := newGroupSnapshot("group|test-group", []string{
+		"2019-05-24T15-26-58-0|/test-volume-1",
+		"2019-05-24T15-26-57-0|/test-backing-share/test-volume-2",
+	})
+
+	if !group.ReadyToUse || len(group.Snapshots) != 2 {
+		t.Fatalf("Unexpected group snapshot %v", group)
+	}
+	expected := time.Date(2019, 5, 24, 15, 26, 57, 0, time.UTC)
+	if !group.CreationTime.AsTime().Equal(expected) {
+		t.Errorf("Expected creation time %v, got %v", expected, group.CreationTime.AsTime())
+	}
+	for _, snapshot := range group.Snapshots {
+		if snapshot.GroupSnapshotId != "group|test-group" {
+			t.Errorf("Expected snapshot %s in group group|test-group, got %s", snapshot.SnapshotId, snapshot.GroupSnapshotId)
+		}
+	}
+	if group.Snapshots[1].SourceVolumeId != "/test-backing-share/test-volume-2" {
+		t.Errorf("Unexpected source volume %s", group.Snapshots[1].SourceVolumeId)
+	}
+}
+
+func TestSameMembers(t *testing.T) {
+	if !sameMembers([]string{"a", "b"}, []string{"b", "a"}) {
+		t.Errorf("Expected members to match")
+	}
+	if sameMembers([]string{"a", "b"}, []string{"a"}) || sameMembers([]string{"a", "a"}, []string{"a", "b"}) {
+		t.Errorf("Expected members not to match")
+	}
+}
+
+// unlistedClient fails to list shares, the group snapshot records are looked up on the member shares
+type unlistedClient struct {
+	*client.FakeClient
+}
+
+func (c unlistedClient) ListShares(ctx context.Context) ([]common.ShareResponse, error) {
+	return nil, status.Error(codes.Unavailable, "share list unavailable")
+}
+
+func TestVolumeGroupSnapshotTakesOneShareSnapshot(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	for _, shareName := range []string{"backing", "other"} {
+		if err := fake.CreateShare(ctx, shareName, "/"+shareName, -1, nil, nil, -1, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.AddFile("/backing/data", 1<<20)
+	fake.AddFile("/backing/log", 1<<20)
+	fake.AddFile("/other/log", 1<<20)
+	d := NewCSIDriverWithClient(unlistedClient{fake})
+
+	_, err := d.CreateVolumeGroupSnapshot(ctx, &csi.CreateVolumeGroupSnapshotRequest{
+		Name:            "spread",
+		SourceVolumeIds: []string{"/backing/data", "/other/log"},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for members on several shares, got %v", err)
+	}
+
+	req := &csi.CreateVolumeGroupSnapshotRequest{Name: "group", SourceVolumeIds: []string{"/backing/data", "/backing/log"}}
+	created, err := d.CreateVolumeGroupSnapshot(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, _ := fake.GetShareSnapshots(ctx, "backing")
+	if len(snapshots) != 1 {
+		t.Fatalf("Expected one snapshot of the backing share, got %v", snapshots)
+	}
+	var snapIDs []string
+	for _, snapshot := range created.GroupSnapshot.Snapshots {
+		if hsSnapName, _, _ := strings.Cut(snapshot.SnapshotId, "|"); hsSnapName != snapshots[0] {
+			t.Errorf("Expected member %s to be in snapshot %s", snapshot.SnapshotId, snapshots[0])
+		}
+		snapIDs = append(snapIDs, snapshot.SnapshotId)
+	}
+
+	retried, err := d.CreateVolumeGroupSnapshot(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retried.GroupSnapshot.Snapshots) != 2 {
+		t.Errorf("Expected the recorded group snapshot to be returned, got %v", retried.GroupSnapshot)
+	}
+	got, err := d.GetVolumeGroupSnapshot(ctx, &csi.GetVolumeGroupSnapshotRequest{
+		GroupSnapshotId: created.GroupSnapshot.GroupSnapshotId,
+		SnapshotIds:     snapIDs,
+	})
+	if err != nil || len(got.GroupSnapshot.Snapshots) != 2 {
+		t.Errorf("Expected the group snapshot to be found, got %v, %v", got, err)
+	}
+
+	_, err = d.DeleteVolumeGroupSnapshot(ctx, &csi.DeleteVolumeGroupSnapshotRequest{
+		GroupSnapshotId: created.GroupSnapshot.GroupSnapshotId,
+		SnapshotIds:     snapIDs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, _ := fake.GetShareSnapshots(ctx, "backing"); len(snapshots) != 0 {
+		t.Errorf("Expected the snapshot of the backing share to be deleted, got %v", snapshots)
+	}
+	share, _ := fake.GetShare(ctx, "backing")
+	for key := range share.ExtendedInfo {
+		if strings.HasPrefix(key, common.GroupSnapshotRecordPrefix) {
+			t.Errorf("Expected the group snapshot records to be removed, got %s", key)
+		}
+	}
+}
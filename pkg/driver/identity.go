@@ -46,12 +46,15 @@ func (d *CSIDriver) Probe(
 	req *csi.ProbeRequest) (
 	*csi.ProbeResponse, error) {
 
-	// Make sure the client and backend can communicate
-	err := d.hsclient.EnsureLogin()
+	// Make sure the client and backend can communicate, fails fast while the circuit breaker of the client is open
+	err := d.getHSClient(ctx).EnsureLogin()
 	if err != nil {
+		if status.Code(err) != codes.Unavailable {
+			err = status.Errorf(codes.Unavailable, "%s", err.Error())
+		}
 		return &csi.ProbeResponse{
 			Ready: &wrappers.BoolValue{Value: false},
-		}, status.Errorf(codes.Unavailable, "%s", err.Error())
+		}, err
 	}
 
 	return &csi.ProbeResponse{
@@ -64,36 +67,50 @@ func (d *CSIDriver) GetPluginCapabilities(
 	req *csi.GetPluginCapabilitiesRequest) (
 	*csi.GetPluginCapabilitiesResponse, error) {
 
-	return &csi.GetPluginCapabilitiesResponse{
-		Capabilities: []*csi.PluginCapability{
-			{
+	caps := []*csi.PluginCapability{
+		{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS,
+				},
+			},
+		},
+		{
+			Type: &csi.PluginCapability_VolumeExpansion_{
+				VolumeExpansion: &csi.PluginCapability_VolumeExpansion{
+					Type: csi.PluginCapability_VolumeExpansion_ONLINE,
+				},
+			},
+		},
+		{
+			Type: &csi.PluginCapability_VolumeExpansion_{
+				VolumeExpansion: &csi.PluginCapability_VolumeExpansion{
+					Type: csi.PluginCapability_VolumeExpansion_OFFLINE,
+				},
+			},
+		},
+	}
+	// The node plugin does not serve the controller services
+	if d.servesController() {
+		caps = append(caps,
+			&csi.PluginCapability{
 				Type: &csi.PluginCapability_Service_{
 					Service: &csi.PluginCapability_Service{
 						Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
 					},
 				},
 			},
-			{
+			&csi.PluginCapability{
 				Type: &csi.PluginCapability_Service_{
 					Service: &csi.PluginCapability_Service{
-						Type: csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS,
+						Type: csi.PluginCapability_Service_GROUP_CONTROLLER_SERVICE,
 					},
 				},
 			},
-			{
-				Type: &csi.PluginCapability_VolumeExpansion_{
-					VolumeExpansion: &csi.PluginCapability_VolumeExpansion{
-						Type: csi.PluginCapability_VolumeExpansion_ONLINE,
-					},
-				},
-			},
-			{
-				Type: &csi.PluginCapability_VolumeExpansion_{
-					VolumeExpansion: &csi.PluginCapability_VolumeExpansion{
-						Type: csi.PluginCapability_VolumeExpansion_OFFLINE,
-					},
-				},
-			},
-		},
+		)
+	}
+
+	return &csi.GetPluginCapabilitiesResponse{
+		Capabilities: caps,
 	}, nil
 }
@@ -0,0 +1,192 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// keyLock serializes the calls on one volume or snapshot. All fields but sem are guarded by
+// CSIDriver.locksMu.
+type keyLock struct {
+	sem *semaphore.Weighted // weight=1 → acts like a mutex
+	// holders and waiters, the lock is removed from its map when it drops to zero
+	refs    int
+	holder  *lockOwner
+	waiters map[*lockOwner]struct{}
+}
+
+// lockOwner is a call holding or waiting for a lock
+type lockOwner struct {
+	method string
+	since  time.Time
+}
+
+func newKeyLock() *keyLock {
+	return &keyLock{
+		sem:     semaphore.NewWeighted(1),
+		waiters: map[*lockOwner]struct{}{},
+	}
+}
+
+func (kl *keyLock) lock(ctx context.Context) error {
+	return kl.sem.Acquire(ctx, 1)
+}
+
+func (kl *keyLock) unlock() {
+	kl.sem.Release(1)
+}
+
+// acquire helpers with timeout + unlock func return
+func (c *CSIDriver) acquireVolumeLock(ctx context.Context, volID string) (func(), error) {
+	common.Logger(ctx).Debug("acquireVolumeLock: ", volID)
+	return c.acquireLock(ctx, "volume", c.volumeLocks, volID)
+}
+
+func (c *CSIDriver) acquireSnapshotLock(ctx context.Context, snapID string) (func(), error) {
+	common.Logger(ctx).Debug("acquireSnapshotLock: ", snapID)
+	return c.acquireLock(ctx, "snapshot", c.snapshotLocks, snapID)
+}
+
+// acquireLock waits for the lock of id in locks. When the lock is not acquired within the lock
+// timeout, or ctx ends first, it returns Aborted so the caller retries the call later.
+func (c *CSIDriver) acquireLock(ctx context.Context, kind string, locks map[string]*keyLock, id string) (func(), error) {
+	method, _ := grpc.Method(ctx)
+	waiter := &lockOwner{method: method, since: time.Now()}
+
+	c.locksMu.Lock()
+	lk, ok := locks[id]
+	if !ok {
+		lk = newKeyLock()
+		locks[id] = lk
+	}
+	lk.refs++
+	lk.waiters[waiter] = struct{}{}
+	c.locksMu.Unlock()
+
+	lctx, cancel := context.WithTimeout(ctx, common.GetConfig().LockTimeout)
+	defer cancel()
+
+	err := lk.lock(lctx)
+	waited := time.Since(waiter.since)
+	metrics.ObserveLockWait(kind, waited)
+
+	c.locksMu.Lock()
+	delete(lk.waiters, waiter)
+	if err != nil {
+		holder := "another call"
+		if lk.holder != nil && lk.holder.method != "" {
+			holder = lk.holder.method
+		}
+		c.releaseLockRef(locks, id, lk)
+		c.locksMu.Unlock()
+		common.Logger(ctx).WithError(err).Errorf("Error acquiring %s lock for %s, held by %s", kind, id, holder)
+		return nil, status.Errorf(codes.Aborted, common.LockTimeout, waited.Round(time.Millisecond), kind, id, holder)
+	}
+	lk.holder = &lockOwner{method: method, since: time.Now()}
+	c.locksMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.locksMu.Lock()
+			lk.holder = nil
+			c.releaseLockRef(locks, id, lk)
+			c.locksMu.Unlock()
+			lk.unlock()
+		})
+	}, nil
+}
+
+// releaseLockRef drops a reference to lk and removes it from locks once unused. Callers hold locksMu.
+func (c *CSIDriver) releaseLockRef(locks map[string]*keyLock, id string, lk *keyLock) {
+	lk.refs--
+	if lk.refs == 0 && locks[id] == lk {
+		delete(locks, id)
+	}
+}
+
+// LockInfo describes a volume or snapshot lock for the lock debug endpoint
+type LockInfo struct {
+	Kind    string          `json:"kind"`
+	ID      string          `json:"id"`
+	Holder  *LockOwnerInfo  `json:"holder,omitempty"`
+	Waiters []LockOwnerInfo `json:"waiters"`
+}
+
+// LockOwnerInfo is a call holding or waiting for a lock, with the seconds it has held or waited
+type LockOwnerInfo struct {
+	Method  string  `json:"method"`
+	Seconds float64 `json:"seconds"`
+}
+
+// Locks returns the locks currently held or waited for, ordered by kind and ID
+func (c *CSIDriver) Locks() []LockInfo {
+	now := time.Now()
+	ownerInfo := func(owner *lockOwner) LockOwnerInfo {
+		return LockOwnerInfo{Method: owner.method, Seconds: now.Sub(owner.since).Seconds()}
+	}
+
+	c.locksMu.Lock()
+	defer c.locksMu.Unlock()
+	infos := []LockInfo{}
+	for kind, locks := range map[string]map[string]*keyLock{"volume": c.volumeLocks, "snapshot": c.snapshotLocks} {
+		for id, lk := range locks {
+			info := LockInfo{Kind: kind, ID: id, Waiters: []LockOwnerInfo{}}
+			if lk.holder != nil {
+				holder := ownerInfo(lk.holder)
+				info.Holder = &holder
+			}
+			for waiter := range lk.waiters {
+				info.Waiters = append(info.Waiters, ownerInfo(waiter))
+			}
+			// longest waiting first
+			sort.Slice(info.Waiters, func(i, j int) bool { return info.Waiters[i].Seconds > info.Waiters[j].Seconds })
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Kind != infos[j].Kind {
+			return infos[i].Kind < infos[j].Kind
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// LocksHandler serves the current locks as JSON
+func (c *CSIDriver) LocksHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.Locks()); err != nil {
+			log.Errorf("failed to write locks: %v", err)
+		}
+	})
+}
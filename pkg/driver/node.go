@@ -35,16 +35,16 @@ import (
 func (d *CSIDriver) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 
 	// Determine if this node is a data portal
-	dataPortals, err := d.hsclient.GetDataPortals(ctx, d.NodeID)
+	dataPortals, err := d.getHSClient(ctx).GetDataPortals(ctx, d.NodeID)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"Node ID": d.NodeID,
+		common.Logger(ctx).WithFields(log.Fields{
+			"node_id": d.NodeID,
 		}).Errorf("Could not list data-portals, %s", err.Error())
 		return nil, err
 	}
 
-	log.WithFields(log.Fields{
-		"dataPortals": dataPortals,
+	common.Logger(ctx).WithFields(log.Fields{
+		"data_portals": dataPortals,
 	}).Debugf("Recived data portal list")
 	var isDataPortal bool
 	for _, p := range dataPortals {
@@ -53,21 +53,34 @@ func (d *CSIDriver) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest
 		}
 	}
 
+	segments := d.nodeTopology(ctx)
+	segments[common.TopologyKeyDataPortal] = strconv.FormatBool(isDataPortal)
+
 	csiNodeResponse := &csi.NodeGetInfoResponse{
-		NodeId: d.NodeID,
+		NodeId: d.csiNodeID(),
 		AccessibleTopology: &csi.Topology{
-			Segments: map[string]string{
-				common.TopologyKeyDataPortal: strconv.FormatBool(isDataPortal),
-			},
+			Segments: segments,
 		},
 	}
-	log.WithFields(log.Fields{
-		"csiNodeResponse": csiNodeResponse,
+	common.Logger(ctx).WithFields(log.Fields{
+		"response": csiNodeResponse,
 	}).Debugf("NodeGetInfo was successful.")
 
 	return csiNodeResponse, nil
 }
 
+// csiNodeID returns the node ID reported to the CO, which carries the node IP when
+// per-node export rules are enabled
+func (d *CSIDriver) csiNodeID() string {
+	if !d.nodeExportRules {
+		return d.NodeID
+	}
+	return JoinNodeID(d.NodeID, d.NodeIP)
+}
+
+// Filesystem type reported by statfs for NFS mounts
+const nfsSuperMagic = 0x6969
+
 func (d *CSIDriver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
 
 	if req.GetVolumeId() == "" {
@@ -81,13 +94,13 @@ func (d *CSIDriver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolu
 	// Check if path exists
 	info, err := os.Stat(req.GetVolumePath())
 	if err != nil {
-		log.Errorf("volume path not found: %s, err: %v", req.GetVolumePath(), err)
+		common.Logger(ctx).Errorf("volume path not found: %s, err: %v", req.GetVolumePath(), err)
 		return nil, status.Error(codes.NotFound, common.VolumeNotFound)
 	}
 
 	// If it's a block device, use Stat_t
 	if IsBlockDevice(info) {
-		log.Infof("Detected block volume: %s", req.GetVolumePath())
+		common.Logger(ctx).Infof("Detected block volume: %s", req.GetVolumePath())
 
 		file, err := os.Open(req.GetVolumePath())
 		if err != nil {
@@ -125,7 +138,7 @@ func (d *CSIDriver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolu
 	var st syscall.Statfs_t
 	err = syscall.Statfs(req.GetVolumePath(), &st)
 	if err != nil {
-		log.Errorf("statfs failed on %s: %v", req.GetVolumePath(), err)
+		common.Logger(ctx).Errorf("statfs failed on %s: %v", req.GetVolumePath(), err)
 		return nil, status.Error(codes.Internal, common.FileNotFound)
 	}
 
@@ -137,6 +150,24 @@ func (d *CSIDriver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolu
 	inodesavail := int64(st.Ffree)
 	inodesused := inodestotal - inodesavail
 
+	// Directory volumes inside a backing share are limited by a quota, not by the size of the share
+	if st.Type == nfsSuperMagic && filepath.Dir(req.GetVolumeId()) != "/" {
+		quota, err := common.GetDirectoryQuota(req.GetVolumePath())
+		if err != nil {
+			common.Logger(ctx).Warnf("could not read quota of %s, reporting share usage: %v", req.GetVolumePath(), err)
+		} else if quota > 0 {
+			dirUsed, dirInodesUsed, err := common.GetDirectoryUsage(req.GetVolumePath())
+			if err != nil {
+				common.Logger(ctx).Warnf("could not determine usage of %s, reporting share usage: %v", req.GetVolumePath(), err)
+			} else {
+				used, inodesused = dirUsed, dirInodesUsed
+				total = quota
+				available = max(quota-used, 0)
+				inodesavail = max(inodestotal-inodesused, 0)
+			}
+		}
+	}
+
 	return &csi.NodeGetVolumeStatsResponse{
 		Usage: []*csi.VolumeUsage{
 			{
@@ -170,31 +201,36 @@ func (d *CSIDriver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolum
 		return nil, status.Error(codes.InvalidArgument, "VolumeCapability must be provided")
 	}
 
-	log.WithFields(log.Fields{
+	common.Logger(ctx).WithFields(log.Fields{
 		"volume_id":      volumeID,
 		"staging_target": stagingTarget,
 	}).Debug("NodeStageVolume will only stage hammerspace root share to use bind on future publish call.")
 
 	// Step 1: Create a marker file for each new volume comming in.
-	// Create marker for this volume
-	if err := os.MkdirAll(common.BaseVolumeMarkerSourcePath, 0755); err != nil {
-		log.Warnf("Failed to create marker root directory %s: %v", common.BaseVolumeMarkerSourcePath, err)
+	// Create marker for this volume, next to the markers of the other volumes of its cluster
+	root := d.rootExportOf(ctx)
+	if err := os.MkdirAll(root.markerPath, 0755); err != nil {
+		common.Logger(ctx).Warnf("Failed to create marker root directory %s: %v", root.markerPath, err)
 	}
 
-	marker := GetHashedMarkerPath(common.BaseVolumeMarkerSourcePath, volumeID)
+	marker := GetHashedMarkerPath(root.markerPath, volumeID)
 
 	err := os.WriteFile(marker, []byte(""), 0644)
 	if err != nil {
-		log.Warnf("Not able to create marker file path %s err %v", marker, err)
+		common.Logger(ctx).Warnf("Not able to create marker file path %s err %v", marker, err)
 	}
 
-	// Step 2: Ensure the root NFS export is mounted once per node
+	// Step 2: Ensure the root NFS export of the cluster is mounted once per node
 	// EnsureRootExportMounted function will do a mount check before mounting or creating dir.
-	if err := d.EnsureRootExportMounted(ctx, common.BaseBackingShareMountPath); err != nil {
+	if err := d.EnsureRootExportMounted(ctx, root.mountPath); err != nil {
 		return nil, status.Errorf(codes.Internal, "root export mount failed: %v", err)
 	}
 
-	log.Infof("[NodeStageVolume] completed mounting base HS share.")
+	if err := d.markVolumePublished(ctx, volumeID); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	common.Logger(ctx).Infof("[NodeStageVolume] completed mounting base HS share.")
 
 	return &csi.NodeStageVolumeResponse{}, nil
 }
@@ -210,24 +246,28 @@ func (d *CSIDriver) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageV
 		return nil, status.Error(codes.InvalidArgument, "Staging target path missing")
 	}
 
-	log.WithFields(log.Fields{
+	common.Logger(ctx).WithFields(log.Fields{
 		"volume_id":      volumeID,
 		"staging_target": stagingTarget,
 	}).Debug("NodeUnstageVolume will remove the any volume mounted counter, and at last delete base hs mount.")
 
+	// Step 0: Remove the published node record while the root export is still mounted.
+	d.unmarkVolumePublished(ctx, volumeID)
+
 	// Step 1: Remove volume marker unstage request comes in.
-	marker := GetHashedMarkerPath(common.BaseVolumeMarkerSourcePath, volumeID)
+	root := d.rootExportOf(ctx)
+	marker := GetHashedMarkerPath(root.markerPath, volumeID)
 
 	// 1. Delete marker.txt for this volume
-	log.Debugf("Removing volume marker %s", marker)
+	common.Logger(ctx).Debugf("Removing volume marker %s", marker)
 	_ = os.Remove(marker)
-	log.Debugf("Removed volume marker %s", marker)
-	// 2. If marker tree is now empty, clean up root
-	if !IsAnyVolumeStillMounted(common.BaseVolumeMarkerSourcePath) {
+	common.Logger(ctx).Debugf("Removed volume marker %s", marker)
+	// 2. If marker tree of the cluster is now empty, clean up its root
+	if !IsAnyVolumeStillMounted(ctx, root.markerPath) {
 		// if no volume are mounted
-		log.Debugf("No volume marker is present on this node. Remove root mount as well..")
-		_ = os.RemoveAll(common.BaseVolumeMarkerSourcePath)
-		_ = common.UnmountFilesystem(common.BaseBackingShareMountPath)
+		common.Logger(ctx).Debugf("No volume marker of the cluster is present on this node. Remove root mount as well..")
+		_ = os.RemoveAll(root.markerPath)
+		_ = common.UnmountFilesystem(ctx, root.mountPath)
 	}
 
 	return &csi.NodeUnstageVolumeResponse{}, nil
@@ -240,10 +280,10 @@ func (d *CSIDriver) NodePublishVolume(ctx context.Context, req *csi.NodePublishV
 	volumeCapability := req.GetVolumeCapability()
 
 	if volume_id == "" || targetPath == "" || volumeCapability == nil {
-		log.WithFields(log.Fields{
-			"volume_id":        volume_id,
-			"targetPath":       targetPath,
-			"volumeCapability": volumeCapability,
+		common.Logger(ctx).WithFields(log.Fields{
+			"volume_id":         volume_id,
+			"target_path":       targetPath,
+			"volume_capability": volumeCapability,
 		}).Errorf("Invalid arguments")
 		if volume_id == "" {
 			return nil, status.Error(codes.InvalidArgument, common.EmptyVolumeId)
@@ -258,13 +298,13 @@ func (d *CSIDriver) NodePublishVolume(ctx context.Context, req *csi.NodePublishV
 
 	unlock, err := d.acquireVolumeLock(ctx, volume_id)
 	if err != nil {
-		log.Errorf("Failed to acquire volume lock for volume %s: %v", volume_id, err)
+		common.Logger(ctx).Errorf("Failed to acquire volume lock for volume %s: %v", volume_id, err)
 		// surfaces to kubelet instead of hanging forever
 		return nil, err
 	}
 	defer unlock()
 
-	log.Infof("Attempting to publish volume %s at target path %s", volume_id, targetPath)
+	common.Logger(ctx).Infof("Attempting to publish volume %s at target path %s", volume_id, targetPath)
 
 	var volumeContext = req.GetVolumeContext()
 	var readOnly bool = req.GetReadonly()
@@ -290,34 +330,34 @@ func (d *CSIDriver) NodePublishVolume(ctx context.Context, req *csi.NodePublishV
 
 	// For NFS
 	if fsType == "nfs" && backingShareName == "" {
-		log.WithFields(log.Fields{
-			"NFS Backing share": backingShareName,
-			"Volume_id":         volume_id,
-			"Traget Path":       targetPath,
+		common.Logger(ctx).WithFields(log.Fields{
+			"backing_share": backingShareName,
+			"volume_id":     volume_id,
+			"target_path":   targetPath,
 		}).Info("Starting node publish volume for Share backed NFS volume without backing share.")
 		err := d.publishShareBackedVolume(ctx, volume_id, targetPath)
 		if err != nil {
 			return nil, err
 		}
 	} else if fsType == "nfs" && backingShareName != "" {
-		log.WithFields(log.Fields{
-			"NFS Backing share": backingShareName,
-			"Volume_id":         volume_id,
-			"Traget Path":       targetPath,
+		common.Logger(ctx).WithFields(log.Fields{
+			"backing_share": backingShareName,
+			"volume_id":     volume_id,
+			"target_path":   targetPath,
 		}).Info("Starting node publish volume for Share backed NFS volume with backing share.")
 		err := d.publishShareBackedDirBasedVolume(ctx, backingShareName, volume_id, targetPath, fsType, mountFlags, volumeContext["fqdn"])
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		log.WithFields(log.Fields{
-			"Backing share": backingShareName,
-			"Volume_id":     volume_id,
-			"Traget Path":   targetPath,
+		common.Logger(ctx).WithFields(log.Fields{
+			"backing_share": backingShareName,
+			"volume_id":     volume_id,
+			"target_path":   targetPath,
 		}).Info("Starting node publish volume file backed.")
 		err := d.publishFileBackedVolume(ctx, backingShareName, volume_id, targetPath, fsType, mountFlags, readOnly, volumeContext["fqdn"])
 		if err != nil {
-			log.Errorf("Error while running publishFileBackedVolume.")
+			common.Logger(ctx).Errorf("Error while running publishFileBackedVolume.")
 			return nil, err
 		}
 	}
@@ -334,11 +374,11 @@ func (d *CSIDriver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpubl
 		return nil, status.Error(codes.InvalidArgument, common.EmptyTargetPath)
 	}
 
-	log.Infof("Attempting to unpublish volume %s", req.GetVolumeId())
+	common.Logger(ctx).Infof("Attempting to unpublish volume %s", req.GetVolumeId())
 
 	unlock, err := d.acquireVolumeLock(ctx, req.VolumeId)
 	if err != nil {
-		log.Errorf("Failed to acquire volume lock for volume %s: %v", req.VolumeId, err)
+		common.Logger(ctx).Errorf("Failed to acquire volume lock for volume %s: %v", req.VolumeId, err)
 		// surfaces to kubelet instead of hanging forever
 		return nil, err
 	}
@@ -348,7 +388,7 @@ func (d *CSIDriver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpubl
 	fi, err := os.Lstat(targetPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Infof("target path does not exist on this host: %s", targetPath)
+			common.Logger(ctx).Infof("target path does not exist on this host: %s", targetPath)
 			return &csi.NodeUnpublishVolumeResponse{}, nil
 		}
 		return nil, status.Errorf(codes.Internal, "error stating target path: %v", err)
@@ -358,7 +398,7 @@ func (d *CSIDriver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpubl
 	if fi.Mode()&os.ModeSymlink != 0 {
 		resolvedPath, err := filepath.EvalSymlinks(targetPath)
 		if err != nil {
-			log.Warnf("Broken symlink at %s: %v", targetPath, err)
+			common.Logger(ctx).Warnf("Broken symlink at %s: %v", targetPath, err)
 			// remove the symlink path
 			if rmErr := os.Remove(targetPath); rmErr != nil {
 				return nil, status.Errorf(codes.Internal, "failed to remove broken symlink: %v", rmErr)
@@ -366,7 +406,7 @@ func (d *CSIDriver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpubl
 			return &csi.NodeUnpublishVolumeResponse{}, nil
 		}
 
-		log.Infof("Resolved symlink targetPath=%s → %s", req.GetTargetPath(), resolvedPath)
+		common.Logger(ctx).Infof("Resolved symlink targetPath=%s → %s", req.GetTargetPath(), resolvedPath)
 		targetPath = resolvedPath
 		fi, err = os.Stat(targetPath)
 		if err != nil {
@@ -376,18 +416,18 @@ func (d *CSIDriver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpubl
 
 	switch mode := fi.Mode(); {
 	case IsBlockDevice(fi): // block device
-		log.Infof("Detected block device at target path %s", targetPath)
+		common.Logger(ctx).Infof("Detected block device at target path %s", targetPath)
 		if err := d.unpublishFileBackedVolume(ctx, req.GetVolumeId(), targetPath); err != nil {
 			return nil, err
 		}
 	case mode.IsDir(): // directory for mount volumes
-		log.Infof("Detected directory mount at target path %s", targetPath)
-		if err := common.UnmountFilesystem(targetPath); err != nil {
+		common.Logger(ctx).Infof("Detected directory mount at target path %s", targetPath)
+		if err := common.UnmountFilesystem(ctx, targetPath); err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
 	default:
 		// Unknown file type, attempt cleanup
-		log.Warnf("Target path %s exists but is not a block device nor directory. Removing...", targetPath)
+		common.Logger(ctx).Warnf("Target path %s exists but is not a block device nor directory. Removing...", targetPath)
 		if err := os.Remove(targetPath); err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to remove unexpected target path: %v", err)
 		}
@@ -446,10 +486,10 @@ func (d *CSIDriver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVol
 	fileBacked := false
 
 	volumeName := GetVolumeNameFromPath(req.GetVolumeId())
-	share, _ := d.hsclient.GetShare(ctx, volumeName)
+	share, _ := d.getHSClient(ctx).GetShare(ctx, volumeName)
 	if share != nil {
 		typeMount = true
-		if isMounted := common.IsShareMounted(share.ExportPath); !isMounted {
+		if isMounted := common.IsShareMounted(ctx, share.ExportPath); !isMounted {
 			return nil, status.Error(codes.FailedPrecondition, common.ShareNotMounted)
 		}
 	} else {
@@ -458,9 +498,9 @@ func (d *CSIDriver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVol
 
 	//  Check if the specified backing share or file exists
 	if share == nil {
-		backingFileExists, err := d.hsclient.DoesFileExist(ctx, req.GetVolumeId())
+		backingFileExists, err := d.getHSClient(ctx).DoesFileExist(ctx, req.GetVolumeId())
 		if err != nil {
-			log.Error(err)
+			common.Logger(ctx).Error(err)
 		}
 		if !backingFileExists {
 			return nil, status.Error(codes.InvalidArgument, common.VolumeNotFound)
@@ -478,12 +518,12 @@ func (d *CSIDriver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVol
 	if fileBacked {
 		// Ensure it's file-backed, otherwise no-op
 		// Resize device
-		err := common.ExpandDeviceFileSize(common.ShareStagingDir+req.GetVolumeId(), requestedSize)
+		err := common.ExpandDeviceFileSize(ctx, common.ShareStagingDir+req.GetVolumeId(), requestedSize)
 		if err != nil {
 			return nil, err
 		}
 		if typeMount {
-			err = common.ExpandFilesystem(common.ShareStagingDir+req.GetVolumeId(), req.VolumeCapability.GetMount().FsType)
+			err = common.ExpandFilesystem(ctx, common.ShareStagingDir+req.GetVolumeId(), req.VolumeCapability.GetMount().FsType)
 			if err != nil {
 				return nil, err
 			}
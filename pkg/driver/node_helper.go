@@ -2,54 +2,113 @@ package driver
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
 
 	"context"
 
 	"github.com/hammer-space/csi-plugin/pkg/common"
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// rootExport is where the root export of a Hammerspace cluster is mounted on the node, the
+// volumes of the cluster are bind-mounted from it. A marker in markerPath counts each volume
+// staged from the cluster, the root export is unmounted once the last of them is unstaged.
+type rootExport struct {
+	mountPath  string
+	markerPath string
+}
+
+// rootExportOf returns the root export of the cluster a request is sent to. The cluster at
+// HS_ENDPOINT is mounted at rootMountPath. Additional clusters and endpoints selected by secrets
+// are mounted at rootMountPath-<endpoint>, next to it, since a directory inside rootMountPath
+// would be part of the namespace of HS_ENDPOINT.
+func (d *CSIDriver) rootExportOf(ctx context.Context) rootExport {
+	hsclient := d.getHSClient(ctx)
+	if hsclient == nil || d.hsclient == nil || hsclient.Endpoint() == d.hsclient.Endpoint() {
+		return rootExport{
+			mountPath:  common.BaseBackingShareMountPath,
+			markerPath: common.BaseVolumeMarkerSourcePath,
+		}
+	}
+	suffix := "-" + endpointDirName(hsclient.Endpoint())
+	return rootExport{
+		mountPath:  common.BaseBackingShareMountPath + suffix,
+		markerPath: common.BaseVolumeMarkerSourcePath + suffix,
+	}
+}
+
+// endpointDirName turns the host of an endpoint into a directory name, ex. anvil.example.com_8443
+// for https://anvil.example.com:8443
+func endpointDirName(endpoint string) string {
+	host := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-') {
+			return r
+		}
+		return '_'
+	}, host)
+}
+
+// volumeSourcePath returns the directory of a share-backed volume in the root export of its
+// cluster. The trailing slash triggers the automounter, see publishShareBackedVolume.
+func (root rootExport) volumeSourcePath(volumeId string) string {
+	sourcePath := filepath.Join(root.mountPath, volumeId)
+	if !strings.HasSuffix(sourcePath, "/") {
+		sourcePath += "/"
+	}
+	return sourcePath
+}
+
 // Mount share and attach it
 func (d *CSIDriver) publishShareBackedVolume(ctx context.Context, volumeId, targetPath string) error {
+	root := d.rootExportOf(ctx)
 	// Step 0 — Ensure root share mount exists for this volume (lazy stage for old volumes)
 	// Lazy stage for old volumes (skip if root share already mounted)
-	rootShareMounted, _ := common.SafeIsMountPoint(common.BaseBackingShareMountPath)
+	rootShareMounted, _ := common.SafeIsMountPoint(root.mountPath)
 	if !rootShareMounted {
-		log.Infof("[LazyStage] Root share not mounted — performing stage for old volume %s", volumeId)
+		common.Logger(ctx).Infof("[LazyStage] Root share not mounted — performing stage for old volume %s", volumeId)
 
 		// Create marker file (same as NodeStageVolume)
-		if err := os.MkdirAll(common.BaseVolumeMarkerSourcePath, 0755); err != nil {
-			log.Warnf("Failed to create marker root directory %s: %v", common.BaseVolumeMarkerSourcePath, err)
+		if err := os.MkdirAll(root.markerPath, 0755); err != nil {
+			common.Logger(ctx).Warnf("Failed to create marker root directory %s: %v", root.markerPath, err)
 		}
-		marker := GetHashedMarkerPath(common.BaseVolumeMarkerSourcePath, volumeId)
+		marker := GetHashedMarkerPath(root.markerPath, volumeId)
 		if err := os.WriteFile(marker, []byte(""), 0644); err != nil {
-			log.Warnf("Not able to create marker file path %s err %v", marker, err)
+			common.Logger(ctx).Warnf("Not able to create marker file path %s err %v", marker, err)
 		}
 
 		// Mount root export (same as NodeStageVolume)
-		if err := d.EnsureRootExportMounted(ctx, common.BaseBackingShareMountPath); err != nil {
+		if err := d.EnsureRootExportMounted(ctx, root.mountPath); err != nil {
 			return status.Errorf(codes.Internal, "[LazyStage] root export mount failed: %v", err)
 		}
+		if err := d.markVolumePublished(ctx, volumeId); err != nil {
+			return status.Errorf(codes.Internal, "[LazyStage] %v", err)
+		}
 
 		// Clear old mount because now this will come up with bind mount.
 		// This meant the the publish was not from bind mount, so remove old share mount to clear old direct nfs mount and do bind mount from here.
-		log.Debugf("Strating unmouting for target path %s, due to old style mount from v1.2.7 and earlier", targetPath)
-		if err := common.UnmountFilesystem(targetPath); err != nil {
-			log.Warnf("Not able to clear the old mount point targetpath (%s) volumeid (%s)", targetPath, volumeId)
+		common.Logger(ctx).Debugf("Strating unmouting for target path %s, due to old style mount from v1.2.7 and earlier", targetPath)
+		if err := common.UnmountFilesystem(ctx, targetPath); err != nil {
+			common.Logger(ctx).Warnf("Not able to clear the old mount point targetpath (%s) volumeid (%s)", targetPath, volumeId)
 		}
-		log.Infof("[LazyStage] Completed mounting base HS share for volume %s", volumeId)
+		common.Logger(ctx).Infof("[LazyStage] Completed mounting base HS share for volume %s", volumeId)
 	}
 
 	// Step 1 create a targetpath
-	log.Debugf("Check if target path exist. %s", targetPath)
+	common.Logger(ctx).Debugf("Check if target path exist. %s", targetPath)
 	if _, err := os.Stat(targetPath); err != nil {
-		log.Debugf("Target path does not exist creating it. %s", targetPath)
+		common.Logger(ctx).Debugf("Target path does not exist creating it. %s", targetPath)
 		if os.IsNotExist(err) {
 			if err := os.MkdirAll(targetPath, 0755); err != nil {
 				return fmt.Errorf("failed to create target path: %w", err)
@@ -60,17 +119,17 @@ func (d *CSIDriver) publishShareBackedVolume(ctx context.Context, volumeId, targ
 	}
 
 	// Step 2 check if this is already a mount point
-	log.Debugf("Target path exist check if it already a mount point")
+	common.Logger(ctx).Debugf("Target path exist check if it already a mount point")
 	mounted, err := common.SafeIsMountPoint(targetPath)
-	log.Debugf("Checking if target is a already a mount point %s", targetPath)
+	common.Logger(ctx).Debugf("Checking if target is a already a mount point %s", targetPath)
 	if err != nil {
-		log.Warnf("Error while checking target path is a mount point %s %v", targetPath, err)
+		common.Logger(ctx).Warnf("Error while checking target path is a mount point %s %v", targetPath, err)
 		return status.Error(codes.Internal, err.Error())
 	}
 
 	// Step 3 check is mounted return
 	if mounted {
-		log.Debugf("Volume (%s) already published at %s", volumeId, targetPath)
+		common.Logger(ctx).Debugf("Volume (%s) already published at %s", volumeId, targetPath)
 		return nil
 	}
 	// Step 4 if not mounted created a mount point
@@ -84,33 +143,30 @@ func (d *CSIDriver) publishShareBackedVolume(ctx context.Context, volumeId, targ
 	* This is the same thing as with "autofs": if you do "/net/foo" as opposed to "/net/foo/" you won't trigger the automounter.
 	This is by design, so that readdir() and "ls -l" won't trigger an automtic automount of everything in the directory.
 	**/
-	sourcePath := filepath.Join(common.BaseBackingShareMountPath, volumeId)
-	if !strings.HasSuffix(sourcePath, "/") {
-		sourcePath += "/"
-	}
+	sourcePath := root.volumeSourcePath(volumeId)
 
 	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
 	if err := d.WaitForPathReady(ctx, sourcePath, 500*time.Millisecond); err != nil {
-		log.Errorf("Volume path %s not ready: %v", sourcePath, err)
+		common.Logger(ctx).Errorf("Volume path %s not ready: %v", sourcePath, err)
 		return status.Errorf(codes.Internal, "volume path %s not ready: %v", sourcePath, err)
 	}
 
-	if err := common.BindMountDevice(sourcePath, targetPath); err != nil {
-		log.Errorf("bind mount failed for %s: %v", targetPath, err)
+	if err := common.BindMountDevice(ctx, sourcePath, targetPath); err != nil {
+		common.Logger(ctx).Errorf("bind mount failed for %s: %v", targetPath, err)
 		return err
 	}
-	log.Debugf("Bind mount is success, from source (%s) to target (%s)", sourcePath, targetPath)
+	common.Logger(ctx).Debugf("Bind mount is success, from source (%s) to target (%s)", sourcePath, targetPath)
 
 	mounted, err = common.SafeIsMountPoint(targetPath)
-	log.Debugf("Checking mount is point target (%s).", targetPath)
+	common.Logger(ctx).Debugf("Checking mount is point target (%s).", targetPath)
 	if err != nil {
-		log.Warnf("Could not determine mount status of %s: %v", targetPath, err)
+		common.Logger(ctx).Warnf("Could not determine mount status of %s: %v", targetPath, err)
 	} else if !mounted {
-		log.Warnf("Bind mount from %s to %s appears to have failed (target is not a mount point)", sourcePath, targetPath)
+		common.Logger(ctx).Warnf("Bind mount from %s to %s appears to have failed (target is not a mount point)", sourcePath, targetPath)
 	} else {
-		log.Infof("Bind mount completed from %s to %s.", sourcePath, targetPath)
+		common.Logger(ctx).Infof("Bind mount completed from %s to %s.", sourcePath, targetPath)
 	}
 
 	return err
@@ -119,7 +175,7 @@ func (d *CSIDriver) publishShareBackedVolume(ctx context.Context, volumeId, targ
 
 // Check base pv exist as backingShareName and create path with backingShareName/exportPath attach to target path
 func (d *CSIDriver) publishShareBackedDirBasedVolume(ctx context.Context, backingShareName, exportPath, targetPath, fsType string, mountFlags []string, fqdn string) error {
-	log.Debugf("Recived publish dir based volume request.")
+	common.Logger(ctx).Debugf("Recived publish dir based volume request.")
 	unlock, err := d.acquireVolumeLock(ctx, backingShareName)
 	if err != nil {
 		// surfaces to kubelet instead of hanging forever
@@ -141,7 +197,7 @@ func (d *CSIDriver) publishShareBackedDirBasedVolume(ctx context.Context, backin
 	}
 
 	if mounted {
-		log.Debugf("Volume already published at %s", targetPath)
+		common.Logger(ctx).Debugf("Volume already published at %s", targetPath)
 		return nil
 	}
 
@@ -150,7 +206,7 @@ func (d *CSIDriver) publishShareBackedDirBasedVolume(ctx context.Context, backin
 		FSType:             fsType,
 		ClientMountOptions: mountFlags,
 	}
-	log.Infof("check nfs backed volume %v", hsVolume)
+	common.Logger(ctx).Infof("check nfs backed volume %v", hsVolume)
 
 	// Ensure the backing share is mounted
 	if err := d.EnsureBackingShareMounted(ctx, backingShareName, hsVolume); err != nil {
@@ -158,7 +214,7 @@ func (d *CSIDriver) publishShareBackedDirBasedVolume(ctx context.Context, backin
 	}
 
 	// Mount the file
-	log.Infof("Mounting NFS-backed volume at %s", targetPath)
+	common.Logger(ctx).Infof("Mounting NFS-backed volume at %s", targetPath)
 
 	// Compute full source path inside mounted backing share
 	sourceMountPoint := filepath.Join(common.ShareStagingDir, exportPath)
@@ -171,14 +227,14 @@ func (d *CSIDriver) publishShareBackedDirBasedVolume(ctx context.Context, backin
 		return status.Errorf(codes.Internal, "error accessing source path %s: %v", sourceMountPoint, err)
 	}
 
-	if err := common.BindMountDevice(sourceMountPoint, targetPath); err != nil {
-		log.Errorf("bind mount failed for %s: %v", targetPath, err)
-		CleanupLoopDevice(targetPath)
+	if err := common.BindMountDevice(ctx, sourceMountPoint, targetPath); err != nil {
+		common.Logger(ctx).Errorf("bind mount failed for %s: %v", targetPath, err)
+		CleanupLoopDevice(ctx, targetPath)
 		d.UnmountBackingShareIfUnused(ctx, backingShareName)
 		return err
 	}
 
-	log.Infof("Successfully mounted %s -> %s", sourceMountPoint, targetPath)
+	common.Logger(ctx).Infof("Successfully mounted %s -> %s", sourceMountPoint, targetPath)
 	return nil
 }
 
@@ -190,10 +246,10 @@ func (d *CSIDriver) publishFileBackedVolume(ctx context.Context, backingShareNam
 	}
 	defer unlock()
 
-	log.Debugf("Recived publish file backed volume request.")
+	common.Logger(ctx).Debugf("Recived publish file backed volume request.")
 	mounted, err := common.SafeIsMountPoint(targetPath)
 	if err != nil {
-		log.Errorf("Some error while checking valid mount point")
+		common.Logger(ctx).Errorf("Some error while checking valid mount point")
 		if os.IsNotExist(err) {
 			// Path does not exist
 			if fsType != "" {
@@ -221,7 +277,7 @@ func (d *CSIDriver) publishFileBackedVolume(ctx context.Context, backingShareNam
 	}
 
 	if mounted {
-		log.Debugf("Volume already published at %s", targetPath)
+		common.Logger(ctx).Debugf("Volume already published at %s", targetPath)
 		return nil
 	}
 
@@ -231,10 +287,10 @@ func (d *CSIDriver) publishFileBackedVolume(ctx context.Context, backingShareNam
 		ClientMountOptions: mountFlags,
 	}
 
-	log.WithFields(log.Fields{
-		"fqdn":             hsVolume.FQDN,
-		"FSType":           hsVolume.FSType,
-		"backingShareName": backingShareName,
+	common.Logger(ctx).WithFields(log.Fields{
+		"fqdn":          hsVolume.FQDN,
+		"fs_type":       hsVolume.FSType,
+		"backing_share": backingShareName,
 	}).Info("Publish file backed volume.")
 
 	// Ensure the backing share is mounted
@@ -243,22 +299,22 @@ func (d *CSIDriver) publishFileBackedVolume(ctx context.Context, backingShareNam
 	}
 
 	// Mount the file
-	log.Infof("Mounting file-backed volume at %s", targetPath)
+	common.Logger(ctx).Infof("Mounting file-backed volume at %s", targetPath)
 	filePath := common.ShareStagingDir + volumePath
 
 	if fsType == "" {
-		deviceStr, err := AttachLoopDeviceWithRetry(filePath, readOnly)
+		deviceStr, err := AttachLoopDeviceWithRetry(ctx, filePath, readOnly)
 		if err != nil {
-			log.Errorf("failed to attach loop device: %v", err)
-			CleanupLoopDevice(deviceStr)
+			common.Logger(ctx).Errorf("failed to attach loop device: %v", err)
+			CleanupLoopDevice(ctx, deviceStr)
 			d.UnmountBackingShareIfUnused(ctx, backingShareName)
 			return status.Errorf(codes.Internal, common.LoopDeviceAttachFailed, deviceStr, filePath)
 		}
-		log.Infof("File %s attached to %s", filePath, deviceStr)
+		common.Logger(ctx).Infof("File %s attached to %s", filePath, deviceStr)
 
-		if err := common.BindMountDevice(deviceStr, targetPath); err != nil {
-			log.Errorf("bind mount failed for %s: %v", deviceStr, err)
-			CleanupLoopDevice(deviceStr)
+		if err := common.BindMountDevice(ctx, deviceStr, targetPath); err != nil {
+			common.Logger(ctx).Errorf("bind mount failed for %s: %v", deviceStr, err)
+			CleanupLoopDevice(ctx, deviceStr)
 			d.UnmountBackingShareIfUnused(ctx, backingShareName)
 			return err
 		}
@@ -266,7 +322,7 @@ func (d *CSIDriver) publishFileBackedVolume(ctx context.Context, backingShareNam
 		if readOnly {
 			mountFlags = append(mountFlags, "ro")
 		}
-		if err := common.MountFilesystem(filePath, targetPath, fsType, mountFlags); err != nil {
+		if err := common.MountFilesystem(ctx, filePath, targetPath, fsType, mountFlags); err != nil {
 			d.UnmountBackingShareIfUnused(ctx, backingShareName)
 			return err
 		}
@@ -289,42 +345,75 @@ func (d *CSIDriver) unpublishFileBackedVolume(ctx context.Context, volumePath, t
 
 	deviceMinor, err := common.GetDeviceMinorNumber(targetPath)
 	if err != nil {
-		log.Errorf("could not determine corresponding device path for target path, %s, %v", targetPath, err)
+		common.Logger(ctx).Errorf("could not determine corresponding device path for target path, %s, %v", targetPath, err)
 		return status.Error(codes.Internal, err.Error())
 	}
 	lodevice := fmt.Sprintf("/dev/loop%d", deviceMinor)
-	log.Infof("found device %s for mount %s", lodevice, targetPath)
+	common.Logger(ctx).Infof("found device %s for mount %s", lodevice, targetPath)
 
 	// Remove bind mount
 	output, err := common.ExecCommand("umount", targetPath)
 	if err != nil {
-		log.Errorf("could not remove bind mount, %s", err)
+		common.Logger(ctx).Errorf("could not remove bind mount, %s", err)
 		return status.Error(codes.Internal, err.Error())
 	}
-	log.Infof("unmounted the targetPath %s. Command output %v ", targetPath, output)
+	common.Logger(ctx).Infof("unmounted the targetPath %s. Command output %v ", targetPath, output)
 	// delete target path
 	err = os.Remove(targetPath)
 	if err != nil {
-		log.Errorf("could not remove target path, %v", err)
+		common.Logger(ctx).Errorf("could not remove target path, %v", err)
 		return status.Error(codes.Internal, err.Error())
 	}
 
 	// detach from loopback device
-	log.Infof("detaching loop device, %s", lodevice)
+	common.Logger(ctx).Infof("detaching loop device, %s", lodevice)
 	output, err = common.ExecCommand("losetup", "-d", lodevice)
+	metrics.RecordMountOperation("loop_detach", err)
 	if err != nil {
-		log.Errorf("%s, %v", output, err.Error())
+		common.Logger(ctx).Errorf("%s, %v", output, err.Error())
 		return status.Error(codes.Internal, err.Error())
 	}
 
 	// Unmount backing share if appropriate
 	unmounted, err := d.UnmountBackingShareIfUnused(ctx, backingShareName)
 	if unmounted {
-		log.Infof("unmounted backing share, %s", backingShareName)
+		common.Logger(ctx).Infof("unmounted backing share, %s", backingShareName)
 	}
 	if err != nil {
-		log.Errorf("unmounted backing share, %s, failed: %v", backingShareName, err)
+		common.Logger(ctx).Errorf("unmounted backing share, %s, failed: %v", backingShareName, err)
 		return status.Error(codes.Internal, err.Error())
 	}
 	return nil
 }
+
+// Record on Hammerspace, through the root export mount of the cluster of the volume, that the
+// volume is staged on this node. The controller lists these files through the client of the same
+// cluster to report published nodes, and refuses to revert staged volumes, so staging fails
+// without the record.
+func (d *CSIDriver) markVolumePublished(ctx context.Context, volumeId string) error {
+	if d.NodeID == "" {
+		return nil
+	}
+	dir := filepath.Join(d.rootExportOf(ctx).mountPath, common.PublishedNodesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create published nodes directory %s: %v", dir, err)
+	}
+	marker := filepath.Join(dir, GetPublishedNodeMarkerName(volumeId, d.csiNodeID()))
+	if err := os.WriteFile(marker, []byte(""), 0644); err != nil {
+		return fmt.Errorf("not able to create published node marker %s: %v", marker, err)
+	}
+	return nil
+}
+
+// Remove the record that the volume is staged on this node. Must be called
+// while the root export is still mounted.
+func (d *CSIDriver) unmarkVolumePublished(ctx context.Context, volumeId string) {
+	if d.NodeID == "" {
+		return
+	}
+	marker := filepath.Join(d.rootExportOf(ctx).mountPath, common.PublishedNodesDir,
+		GetPublishedNodeMarkerName(volumeId, d.csiNodeID()))
+	if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+		common.Logger(ctx).Warnf("Not able to remove published node marker %s err %v", marker, err)
+	}
+}
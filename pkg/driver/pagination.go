@@ -0,0 +1,92 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+// Pages of ListVolumes and ListSnapshots list shares in name order and the entries of each
+// share in ID order. A token holds the name of a share and the ID of the first entry of the next
+// page rather than an offset, so pages stay stable when entries are added or removed between
+// calls, and a page only lists the shares it returns entries from.
+const pageTokenPrefix = "v2:"
+
+// pageCursorSeparator separates the share of a token from the ID of the entry
+const pageCursorSeparator = "\n"
+
+// pageCursor is the position of the first entry of a page. With multiple clusters, share is
+// the name of a cluster and id the token of the page of that cluster.
+type pageCursor struct {
+	share string
+	id    string
+}
+
+func (c pageCursor) token() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(pageTokenPrefix + c.share + pageCursorSeparator + c.id))
+}
+
+// decodePageToken returns the cursor of a token, the zero cursor for an empty token
+func decodePageToken(token string) (pageCursor, error) {
+	if token == "" {
+		return pageCursor{}, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	payload, hasPrefix := strings.CutPrefix(string(decoded), pageTokenPrefix)
+	share, id, found := strings.Cut(payload, pageCursorSeparator)
+	if err != nil || !hasPrefix || !found || (share == "" && id == "") {
+		return pageCursor{}, status.Errorf(codes.Aborted, common.InvalidStartingToken, token)
+	}
+	return pageCursor{share: share, id: id}, nil
+}
+
+// sharesFrom sorts shares by name and returns those from the share of a cursor on
+func sharesFrom(shares []common.ShareResponse, cursor pageCursor) []common.ShareResponse {
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Name < shares[j].Name })
+	start := sort.Search(len(shares), func(i int) bool { return shares[i].Name >= cursor.share })
+	return shares[start:]
+}
+
+// sharePage returns the range of the sorted entry IDs of a share that go on a page already
+// holding count entries, and the token of the next page when the page fills up before the last
+// entry of the share. A maxEntries of 0 means no limit.
+func sharePage(share string, ids []string, cursor pageCursor, count int, maxEntries int32) (int, int, string) {
+	start := 0
+	if share < cursor.share {
+		start = len(ids)
+	} else if share == cursor.share {
+		start = sort.SearchStrings(ids, cursor.id)
+	}
+
+	end := len(ids)
+	if maxEntries > 0 && start+int(maxEntries)-count < end {
+		end = start + int(maxEntries) - count
+	}
+
+	nextToken := ""
+	if end < len(ids) {
+		nextToken = pageCursor{share: share, id: ids[end]}.token()
+	}
+	return start, end, nextToken
+}
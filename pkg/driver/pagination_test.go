@@ -0,0 +1,121 @@
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hammer-space/csi-plugin/pkg/client"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+func snapshotIDs(rsp *csi.ListSnapshotsResponse) []string {
+	ids := []string{}
+	for _, entry := range rsp.GetEntries() {
+		ids = append(ids, entry.GetSnapshot().GetSnapshotId())
+	}
+	return ids
+}
+
+func TestSharePage(t *testing.T) {
+	ids := []string{"a|/vol", "b|/vol", "c|/vol"}
+	start, end, nextToken := sharePage("vol", ids, pageCursor{}, 0, 2)
+	if start != 0 || end != 2 || nextToken != (pageCursor{share: "vol", id: "c|/vol"}).token() {
+		t.Fatalf("Unexpected first page %d-%d, token '%s'", start, end, nextToken)
+	}
+
+	// entries removed before the next page do not shift it
+	cursor, err := decodePageToken(nextToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, end, nextToken = sharePage("vol", []string{"c|/vol", "d|/vol"}, cursor, 0, 2)
+	if start != 0 || end != 2 || nextToken != "" {
+		t.Errorf("Unexpected last page %d-%d, token '%s'", start, end, nextToken)
+	}
+
+	// a full page ends with a token for the first entry of the next share
+	start, end, nextToken = sharePage("vol2", ids, cursor, 2, 2)
+	if start != end || nextToken != (pageCursor{share: "vol2", id: "a|/vol"}).token() {
+		t.Errorf("Expected an empty range and a token for the next share, got %d-%d, '%s'", start, end, nextToken)
+	}
+
+	// shares before the one of the cursor were listed by earlier pages
+	if start, end, _ = sharePage("earlier", ids, cursor, 0, 0); start != len(ids) || end != len(ids) {
+		t.Errorf("Expected no entries of an earlier share, got %d-%d", start, end)
+	}
+}
+
+func TestDecodePageTokenInvalid(t *testing.T) {
+	for _, token := range []string{"not a token", pageCursor{share: "vol"}.token()[:2], "djI6", "djE6L3ZvbA"} {
+		_, err := decodePageToken(token)
+		if status.Code(err) != codes.Aborted {
+			t.Errorf("Expected Aborted for token '%s', got %v", token, err)
+		}
+	}
+}
+
+// countingClient counts the shares whose snapshot directory is read
+type countingClient struct {
+	*client.FakeClient
+	read *[]string
+}
+
+func (c countingClient) ListShareSnapshots(ctx context.Context, share *common.ShareResponse) ([]common.SnapshotResponse, error) {
+	*c.read = append(*c.read, share.Name)
+	return c.FakeClient.ListShareSnapshots(ctx, share)
+}
+
+func TestListSnapshotsReadsSharesOfPage(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	for _, shareName := range []string{"vol-c", "vol-a", "vol-b"} {
+		if err := fake.CreateShare(ctx, shareName, "/"+shareName, 1<<20, nil, nil, -1, ""); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := fake.SnapshotShare(ctx, shareName); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var read []string
+	d := NewCSIDriverWithClient(countingClient{fake, &read})
+
+	rsp, err := d.ListSnapshots(ctx, &csi.ListSnapshotsRequest{MaxEntries: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Entries) != 3 || rsp.NextToken == "" || !reflect.DeepEqual(read, []string{"vol-a", "vol-b"}) {
+		t.Fatalf("Unexpected first page %v, token '%s', read shares %v", snapshotIDs(rsp), rsp.NextToken, read)
+	}
+
+	read = nil
+	next, err := d.ListSnapshots(ctx, &csi.ListSnapshotsRequest{StartingToken: rsp.NextToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.Entries) != 3 || next.NextToken != "" || !reflect.DeepEqual(read, []string{"vol-b", "vol-c"}) {
+		t.Errorf("Unexpected last page %v, token '%s', read shares %v", snapshotIDs(next), next.NextToken, read)
+	}
+	// shares are listed in name order
+	var allIDs []string
+	for _, volumeID := range []string{"/vol-a", "/vol-b", "/vol-c"} {
+		snapshots, _ := fake.ListSnapshots(ctx, "", volumeID)
+		for _, snapshot := range snapshots {
+			allIDs = append(allIDs, snapshot.Id)
+		}
+	}
+	if listed := append(snapshotIDs(rsp), snapshotIDs(next)...); !reflect.DeepEqual(listed, allIDs) {
+		t.Errorf("Expected pages to list %v, got %v", allIDs, listed)
+	}
+
+	_, err = d.ListSnapshots(ctx, &csi.ListSnapshotsRequest{StartingToken: "invalid"})
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("Expected Aborted for invalid token, got %v", err)
+	}
+}
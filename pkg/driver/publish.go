@@ -0,0 +1,294 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// With HS_NODE_EXPORT_RULES enabled, ControllerPublishVolume adds an export rule for the IP of
+// the node to the share a volume is exported through, and ControllerUnpublishVolume removes it.
+// Volumes inside a backing share share its export, so the volumes published to each node IP are
+// recorded in the extended info of the share and the rule is only removed with the last of them.
+// The rule is read-only while all of them are published read-only.
+
+// readOnlyRecordPrefix marks the volumes published read-only in the export record of a node IP.
+// Volume IDs start with a slash, so it cannot be part of one.
+const readOnlyRecordPrefix = "ro:"
+
+func (d *CSIDriver) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	// Start a span for tracing
+	ctx, span := tracer.Start(ctx, "Controller/PublishVolume", trace.WithAttributes(
+		attribute.String("volume.id", req.GetVolumeId()),
+		attribute.String("node.id", req.GetNodeId()),
+	))
+	defer span.End()
+
+	if !d.nodeExportRules {
+		return nil, status.Error(codes.Unimplemented, "ControllerPublishVolume not supported")
+	}
+	volumeId := req.GetVolumeId()
+	if volumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, common.EmptyVolumeId)
+	}
+	if req.GetNodeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, common.EmptyNodeId)
+	}
+	if req.GetVolumeCapability() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, common.NoCapabilitiesSupplied, volumeId)
+	}
+	_, nodeIP := SplitNodeID(req.GetNodeId())
+	if nodeIP == "" {
+		return nil, status.Errorf(codes.FailedPrecondition, common.NodeIPMissing, req.GetNodeId())
+	}
+
+	shareName, err := d.exportShareName(ctx, volumeId)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.updateNodeExports(ctx, shareName, volumeId, nodeIP, true, req.GetReadonly()); err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+
+	common.Logger(ctx).WithFields(log.Fields{
+		"volume_id": volumeId,
+		"node_id":   req.GetNodeId(),
+		"share":     shareName,
+	}).Info("volume published to node")
+	return &csi.ControllerPublishVolumeResponse{}, nil
+}
+
+func (d *CSIDriver) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	// Start a span for tracing
+	ctx, span := tracer.Start(ctx, "Controller/UnpublishVolume", trace.WithAttributes(
+		attribute.String("volume.id", req.GetVolumeId()),
+		attribute.String("node.id", req.GetNodeId()),
+	))
+	defer span.End()
+
+	if !d.nodeExportRules {
+		return nil, status.Error(codes.Unimplemented, "ControllerUnpublishVolume not supported")
+	}
+	volumeId := req.GetVolumeId()
+	if volumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, common.EmptyVolumeId)
+	}
+	// An empty node ID unpublishes the volume from every node
+	var nodeIP string
+	if req.GetNodeId() != "" {
+		_, nodeIP = SplitNodeID(req.GetNodeId())
+		if nodeIP == "" {
+			// nodes without an IP are never published to
+			return &csi.ControllerUnpublishVolumeResponse{}, nil
+		}
+	}
+
+	shareName, err := d.exportShareName(ctx, volumeId)
+	if status.Code(err) == codes.NotFound {
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := d.updateNodeExports(ctx, shareName, volumeId, nodeIP, false, false); err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err.Error())
+	}
+
+	common.Logger(ctx).WithFields(log.Fields{
+		"volume_id": volumeId,
+		"node_id":   req.GetNodeId(),
+		"share":     shareName,
+	}).Info("volume unpublished from node")
+	return &csi.ControllerUnpublishVolumeResponse{}, nil
+}
+
+// exportShareName returns the share a volume is exported through, the share itself for
+// share-backed volumes and the backing share for directories and files inside it
+func (d *CSIDriver) exportShareName(ctx context.Context, volumeId string) (string, error) {
+	shareName := GetVolumeNameFromPath(volumeId)
+	share, err := d.getHSClient(ctx).GetShare(ctx, shareName)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if share != nil {
+		return shareName, nil
+	}
+
+	exists, err := d.getHSClient(ctx).DoesFileExist(ctx, volumeId)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if !exists {
+		return "", status.Error(codes.NotFound, common.VolumeNotFound)
+	}
+	return path.Base(path.Dir(volumeId)), nil
+}
+
+// updateNodeExports records the volume as published to, or unpublished from, the node IP and
+// adds, updates or removes the export rule of the node IP accordingly. An empty node IP when
+// unpublishing stands for every node the volume is published to. Both steps are reconciled on
+// every call, so retries repair a rule that failed to update.
+func (d *CSIDriver) updateNodeExports(ctx context.Context, shareName, volumeId, nodeIP string, publish, readonly bool) error {
+	unlock, err := d.acquireVolumeLock(ctx, shareName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	share, err := d.getHSClient(ctx).GetShare(ctx, shareName)
+	if err != nil {
+		return err
+	}
+	if share == nil {
+		return status.Error(codes.NotFound, common.ShareNotFound)
+	}
+
+	nodeIPs := []string{nodeIP}
+	if nodeIP == "" {
+		nodeIPs = nil
+		for key := range share.ExtendedInfo {
+			if recordedIP, isRecord := strings.CutPrefix(key, common.NodeExportRecordPrefix); isRecord {
+				nodeIPs = append(nodeIPs, recordedIP)
+			}
+		}
+	}
+
+	records := map[string]string{}
+	exportOptions := share.ExportOptions
+	exportsChanged := false
+	for _, ip := range nodeIPs {
+		key := GetNodeExportRecordKey(ip)
+		volumes := updateVolumeList(share.ExtendedInfo[key], volumeId, publish, readonly)
+		if volumes != share.ExtendedInfo[key] {
+			records[key] = volumes
+		}
+		var changed bool
+		exportOptions, changed = nodeExportOptions(exportOptions, ip, nodeAccess(volumes))
+		exportsChanged = exportsChanged || changed
+	}
+
+	if len(records) > 0 {
+		if err := d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, shareName, records); err != nil {
+			return err
+		}
+	}
+	if exportsChanged {
+		if err := d.getHSClient(ctx).UpdateShare(ctx, shareName, nil, exportOptions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateVolumeList adds or removes a volume ID from a sorted, comma separated list of volume IDs,
+// where volumes published read-only carry the readOnlyRecordPrefix
+func updateVolumeList(list, volumeId string, add, readonly bool) string {
+	var volumes []string
+	for _, v := range strings.Split(list, ",") {
+		if v != "" && recordedVolumeId(v) != volumeId {
+			volumes = append(volumes, v)
+		}
+	}
+	if add {
+		if readonly {
+			volumeId = readOnlyRecordPrefix + volumeId
+		}
+		volumes = append(volumes, volumeId)
+	}
+	sort.Strings(volumes)
+	return strings.Join(volumes, ",")
+}
+
+// recordedVolumeId returns the volume ID of an entry of the export record of a node IP
+func recordedVolumeId(entry string) string {
+	return strings.TrimPrefix(entry, readOnlyRecordPrefix)
+}
+
+// nodeAccess returns the access the export rule of a node IP grants to the volumes recorded for
+// it, "RW" when any of them is published read-write, "RO" otherwise and "" without volumes
+func nodeAccess(list string) string {
+	access := ""
+	for _, v := range strings.Split(list, ",") {
+		if v == "" {
+			continue
+		}
+		if !strings.HasPrefix(v, readOnlyRecordPrefix) {
+			return "RW"
+		}
+		access = "RO"
+	}
+	return access
+}
+
+// nodeExportOptions adds, updates or removes the export rule of a node IP, granting the access
+// given, or no rule for an empty access. Returns whether the export options changed.
+func nodeExportOptions(options []common.ShareExportOptions, nodeIP string, access string) ([]common.ShareExportOptions, bool) {
+	updated := make([]common.ShareExportOptions, 0, len(options)+1)
+	found := false
+	changed := false
+	for _, option := range options {
+		if option.Subnet == nodeIP {
+			found = true
+			if access == "" {
+				changed = true
+				continue
+			}
+			if option.AccessPermissions != access {
+				option.AccessPermissions = access
+				changed = true
+			}
+		}
+		updated = append(updated, option)
+	}
+	if access != "" && !found {
+		updated = append(updated, common.ShareExportOptions{
+			Subnet:            nodeIP,
+			AccessPermissions: access,
+			RootSquash:        false,
+		})
+		changed = true
+	}
+	return updated, changed
+}
+
+// withNodeExportRules returns export options with the rules of the node IPs recorded on a share
+// added, so replacing the static export options of a share keeps the nodes volumes are
+// published to
+func withNodeExportRules(options []common.ShareExportOptions, share *common.ShareResponse) []common.ShareExportOptions {
+	var nodeIPs []string
+	for key := range share.ExtendedInfo {
+		if nodeIP, isRecord := strings.CutPrefix(key, common.NodeExportRecordPrefix); isRecord {
+			nodeIPs = append(nodeIPs, nodeIP)
+		}
+	}
+	sort.Strings(nodeIPs)
+	for _, nodeIP := range nodeIPs {
+		options, _ = nodeExportOptions(options, nodeIP, nodeAccess(share.ExtendedInfo[GetNodeExportRecordKey(nodeIP)]))
+	}
+	return options
+}
@@ -0,0 +1,243 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/client"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newPublishTestDriver serves a single backing share, holding volumes vol-a and vol-b, whose
+// fields are updated by PUT requests, and no objectives
+func newPublishTestDriver(t *testing.T) (*CSIDriver, func() common.ShareResponse) {
+	var lock sync.Mutex
+	share := map[string]interface{}{
+		"name":          "backing",
+		"path":          "/backing",
+		"exportOptions": []interface{}{map[string]interface{}{"subnet": "192.168.0.0/24", "accessPermissions": "RO", "rootSquash": true}},
+		"extendedInfo":  map[string]interface{}{},
+	}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc(client.BasePath+"/login", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc(client.BasePath+"/shares/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if strings.TrimPrefix(r.URL.Path, client.BasePath+"/shares/") != "backing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == "PUT" {
+			share = map[string]interface{}{}
+			if err := json.NewDecoder(r.Body).Decode(&share); err != nil {
+				t.Error(err)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(share)
+	})
+	mux.HandleFunc(client.BasePath+"/objectives", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc(client.BasePath+"/files", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("path") {
+		case "/backing/vol-a", "/backing/vol-b":
+			_, _ = w.Write([]byte(`{"name": "vol"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	hsclient, err := client.NewHammerspaceClient(server.URL, "test_user", "test_password", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &CSIDriver{
+		hsclient:        hsclient,
+		volumeLocks:     make(map[string]*keyLock),
+		snapshotLocks:   make(map[string]*keyLock),
+		nodeExportRules: true,
+	}
+	getShare := func() common.ShareResponse {
+		share, err := hsclient.GetShare(context.Background(), "backing")
+		if err != nil || share == nil {
+			t.Fatalf("failed to get share: %v", err)
+		}
+		return *share
+	}
+	return d, getShare
+}
+
+func TestControllerPublishVolumeNodeExportRules(t *testing.T) {
+	d, getShare := newPublishTestDriver(t)
+	ctx := context.Background()
+	capability := &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}}
+	staticRule := common.ShareExportOptions{Subnet: "192.168.0.0/24", AccessPermissions: "RO", RootSquash: true}
+	nodeRule := common.ShareExportOptions{Subnet: "10.0.0.1", AccessPermissions: "RW", RootSquash: false}
+
+	for _, volumeId := range []string{"/backing/vol-a", "/backing/vol-b", "/backing/vol-a"} {
+		_, err := d.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+			VolumeId:         volumeId,
+			NodeId:           "node-1@10.0.0.1",
+			VolumeCapability: capability,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	share := getShare()
+	if !reflect.DeepEqual(share.ExportOptions, []common.ShareExportOptions{staticRule, nodeRule}) {
+		t.Errorf("unexpected export options after publish: %v", share.ExportOptions)
+	}
+	if share.ExtendedInfo["csi_export_10.0.0.1"] != "/backing/vol-a,/backing/vol-b" {
+		t.Errorf("unexpected export record after publish: %v", share.ExtendedInfo)
+	}
+
+	// The rule stays while another volume of the backing share is published to the node
+	_, err := d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: "/backing/vol-a",
+		NodeId:   "node-1@10.0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	share = getShare()
+	if !reflect.DeepEqual(share.ExportOptions, []common.ShareExportOptions{staticRule, nodeRule}) {
+		t.Errorf("unexpected export options after first unpublish: %v", share.ExportOptions)
+	}
+	if share.ExtendedInfo["csi_export_10.0.0.1"] != "/backing/vol-b" {
+		t.Errorf("unexpected export record after first unpublish: %v", share.ExtendedInfo)
+	}
+
+	// An empty node ID unpublishes from every node
+	_, err = d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: "/backing/vol-b",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	share = getShare()
+	if !reflect.DeepEqual(share.ExportOptions, []common.ShareExportOptions{staticRule}) {
+		t.Errorf("unexpected export options after last unpublish: %v", share.ExportOptions)
+	}
+	if _, exists := share.ExtendedInfo["csi_export_10.0.0.1"]; exists {
+		t.Errorf("export record not removed: %v", share.ExtendedInfo)
+	}
+
+	// Volumes published read-only get a read-only rule, until a volume is published read-write
+	_, err = d.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         "/backing/vol-a",
+		NodeId:           "node-1@10.0.0.1",
+		VolumeCapability: capability,
+		Readonly:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnlyRule := common.ShareExportOptions{Subnet: "10.0.0.1", AccessPermissions: "RO", RootSquash: false}
+	if share = getShare(); !reflect.DeepEqual(share.ExportOptions, []common.ShareExportOptions{staticRule, readOnlyRule}) {
+		t.Errorf("unexpected export options after read-only publish: %v", share.ExportOptions)
+	}
+	_, err = d.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         "/backing/vol-b",
+		NodeId:           "node-1@10.0.0.1",
+		VolumeCapability: capability,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share = getShare(); !reflect.DeepEqual(share.ExportOptions, []common.ShareExportOptions{staticRule, nodeRule}) {
+		t.Errorf("unexpected export options after read-write publish: %v", share.ExportOptions)
+	}
+
+	// Modifying the static export options keeps the rules of the nodes
+	_, err = d.ControllerModifyVolume(ctx, &csi.ControllerModifyVolumeRequest{
+		VolumeId:          "/backing",
+		MutableParameters: map[string]string{"exportOptions": "172.16.0.0/16,RO,true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	modifiedRule := common.ShareExportOptions{Subnet: "172.16.0.0/16", AccessPermissions: "RO", RootSquash: true}
+	if share = getShare(); !reflect.DeepEqual(share.ExportOptions, []common.ShareExportOptions{modifiedRule, nodeRule}) {
+		t.Errorf("unexpected export options after modify: %v", share.ExportOptions)
+	}
+
+	// Unpublishing a volume that no longer exists succeeds
+	_, err = d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: "/backing/vol-c",
+		NodeId:   "node-1@10.0.0.1",
+	})
+	if err != nil {
+		t.Errorf("expected unpublish of a missing volume to succeed, got %v", err)
+	}
+}
+
+func TestControllerPublishVolumeErrors(t *testing.T) {
+	d, _ := newPublishTestDriver(t)
+	ctx := context.Background()
+	capability := &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}}
+
+	cases := []struct {
+		req      *csi.ControllerPublishVolumeRequest
+		expected codes.Code
+	}{
+		{&csi.ControllerPublishVolumeRequest{NodeId: "node-1@10.0.0.1", VolumeCapability: capability}, codes.InvalidArgument},
+		{&csi.ControllerPublishVolumeRequest{VolumeId: "/backing/vol-a", VolumeCapability: capability}, codes.InvalidArgument},
+		{&csi.ControllerPublishVolumeRequest{VolumeId: "/backing/vol-a", NodeId: "node-1@10.0.0.1"}, codes.InvalidArgument},
+		{&csi.ControllerPublishVolumeRequest{VolumeId: "/backing/vol-a", NodeId: "node-1", VolumeCapability: capability}, codes.FailedPrecondition},
+		{&csi.ControllerPublishVolumeRequest{VolumeId: "/backing/vol-c", NodeId: "node-1@10.0.0.1", VolumeCapability: capability}, codes.NotFound},
+	}
+	for _, c := range cases {
+		_, err := d.ControllerPublishVolume(ctx, c.req)
+		if status.Code(err) != c.expected {
+			t.Errorf("%v: expected %v, got %v", c.req, c.expected, err)
+		}
+	}
+
+	d.nodeExportRules = false
+	_, err := d.ControllerPublishVolume(ctx, cases[0].req)
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented without node export rules, got %v", err)
+	}
+}
+
+func TestUpdateVolumeList(t *testing.T) {
+	cases := []struct {
+		list     string
+		volumeId string
+		add      bool
+		readonly bool
+		expected string
+	}{
+		{"", "/a", true, false, "/a"},
+		{"/b", "/a", true, false, "/a,/b"},
+		{"/a,/b", "/a", true, false, "/a,/b"},
+		{"/a,/b", "/a", false, false, "/b"},
+		{"/a", "/a", false, false, ""},
+		{"", "/a", false, false, ""},
+		{"/b", "/a", true, true, "/b,ro:/a"},
+		{"/a,/b", "/a", true, true, "/b,ro:/a"},
+		{"/b,ro:/a", "/a", true, false, "/a,/b"},
+		{"/b,ro:/a", "/a", false, false, "/b"},
+	}
+	for _, c := range cases {
+		actual := updateVolumeList(c.list, c.volumeId, c.add, c.readonly)
+		if actual != c.expected {
+			t.Errorf("updateVolumeList(%q, %q, %v, %v): expected %q, got %q", c.list, c.volumeId, c.add, c.readonly, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/kubernetes/pkg/util/slice"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+// revertToSnapshotParameter is the VolumeAttributesClass parameter reverting a volume in place
+// to one of its snapshots, given by snapshot ID
+const revertToSnapshotParameter = "revertToSnapshot"
+
+// revertVolume restores a share-backed volume from one of its share snapshots, or a volume in a
+// backing share from one of its file snapshots. The volume must not be staged on any node. The
+// snapshot is recorded in the extended info of the share, so retrying the same modification
+// does not revert the volume again.
+func (d *CSIDriver) revertVolume(ctx context.Context, volumeId string, share *common.ShareResponse, snapshotId string) error {
+	snapshotName, err := GetSnapshotNameFromSnapshotId(snapshotId)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, sourceVolumeId, _ := strings.Cut(snapshotId, "|"); sourceVolumeId != volumeId {
+		return status.Errorf(codes.InvalidArgument, common.RevertSnapshotOtherVolume, snapshotId, volumeId)
+	}
+
+	recordShareName := GetSnapshotRecordShareName(volumeId, share != nil)
+	recordKey := GetRevertRecordKey(GetVolumeNameFromPath(volumeId))
+	recordShare := share
+	if share == nil {
+		recordShare, err = d.getHSClient(ctx).GetShare(ctx, recordShareName)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		if recordShare == nil {
+			return status.Error(codes.NotFound, common.VolumeNotFound)
+		}
+	}
+	if recordShare.ExtendedInfo[recordKey] == snapshotId {
+		common.Logger(ctx).Infof("volume %s was already reverted to snapshot %s", volumeId, snapshotId)
+		return nil
+	}
+
+	if err := d.checkVolumeNotStaged(ctx, volumeId, recordShare); err != nil {
+		return err
+	}
+
+	if share != nil {
+		snapshots, err := d.getHSClient(ctx).GetShareSnapshots(ctx, share.Name)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		if !slice.ContainsString(snapshots, snapshotName, strings.TrimSpace) {
+			return status.Error(codes.NotFound, common.SourceSnapshotNotFound)
+		}
+		err = d.getHSClient(ctx).RestoreShareSnapshot(ctx, share.Name, snapshotName)
+		if err != nil {
+			return HSClientError(err)
+		}
+	} else {
+		exists, err := d.getHSClient(ctx).DoesFileExist(ctx, volumeId)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+		if !exists {
+			return status.Error(codes.NotFound, common.VolumeNotFound)
+		}
+		err = d.getHSClient(ctx).RestoreFileSnapToDestination(ctx, snapshotName, volumeId)
+		if err != nil {
+			return HSClientError(err)
+		}
+	}
+
+	common.Logger(ctx).WithFields(log.Fields{
+		"volume_id":   volumeId,
+		"snapshot_id": snapshotId,
+	}).Info("volume was reverted to snapshot")
+	return d.updateRevertRecord(ctx, recordShareName, share != nil, recordKey, snapshotId)
+}
+
+// checkVolumeNotStaged fails with FailedPrecondition while a volume is staged on a node, or when
+// that cannot be told. Nodes record the volumes they stage in the published nodes directory of
+// the cluster, which is only missing while no node has staged a volume on the cluster, ex. when
+// all volumes were staged by versions without the records. With node export rules the nodes a
+// volume is published to are recorded in the extended info of its export share as well.
+func (d *CSIDriver) checkVolumeNotStaged(ctx context.Context, volumeId string, exportShare *common.ShareResponse) error {
+	if d.nodeExportRules {
+		var nodeIPs []string
+		for key, volumes := range exportShare.ExtendedInfo {
+			nodeIP, isRecord := strings.CutPrefix(key, common.NodeExportRecordPrefix)
+			if isRecord && slice.ContainsString(strings.Split(volumes, ","), volumeId, recordedVolumeId) {
+				nodeIPs = append(nodeIPs, nodeIP)
+			}
+		}
+		if len(nodeIPs) > 0 {
+			sort.Strings(nodeIPs)
+			return status.Errorf(codes.FailedPrecondition, common.RevertVolumePublished, volumeId, nodeIPs)
+		}
+	}
+
+	dir, err := d.getHSClient(ctx).GetFile(ctx, common.PublishedNodesDir+"/")
+	if err != nil {
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if dir == nil {
+		return status.Errorf(codes.FailedPrecondition, common.RevertStagingUnknown, volumeId)
+	}
+	if nodeIds := parsePublishedNodes(dir).forVolume(volumeId); len(nodeIds) > 0 {
+		return status.Errorf(codes.FailedPrecondition, common.RevertVolumePublished, volumeId, nodeIds)
+	}
+	return nil
+}
+
+// forgetRevert removes the record of the snapshot a volume was last reverted to, so the volume
+// can be reverted to the same snapshot again
+func (d *CSIDriver) forgetRevert(ctx context.Context, volumeId string, share *common.ShareResponse) error {
+	recordShareName := GetSnapshotRecordShareName(volumeId, share != nil)
+	recordKey := GetRevertRecordKey(GetVolumeNameFromPath(volumeId))
+	recordShare := share
+	if share == nil {
+		var err error
+		recordShare, err = d.getHSClient(ctx).GetShare(ctx, recordShareName)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+	}
+	if recordShare == nil {
+		return nil
+	}
+	if _, exists := recordShare.ExtendedInfo[recordKey]; !exists {
+		return nil
+	}
+	return d.updateRevertRecord(ctx, recordShareName, share != nil, recordKey, "")
+}
+
+// updateRevertRecord sets or, with an empty snapshotId, removes the revert record of a volume.
+// The backing share of a volume is locked while its extended info changes, a share-backed
+// volume is already locked by the caller.
+func (d *CSIDriver) updateRevertRecord(ctx context.Context, recordShareName string, shareBacked bool, recordKey, snapshotId string) error {
+	if !shareBacked {
+		unlock, err := d.acquireVolumeLock(ctx, recordShareName)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	err := d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, recordShareName, map[string]string{
+		recordKey: snapshotId,
+	})
+	if err != nil {
+		return HSClientError(err)
+	}
+	return nil
+}
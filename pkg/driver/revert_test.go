@@ -0,0 +1,122 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/client"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func revertVolumeTo(d *CSIDriver, volumeId, snapshotId string) error {
+	_, err := d.ControllerModifyVolume(context.Background(), &csi.ControllerModifyVolumeRequest{
+		VolumeId:          volumeId,
+		MutableParameters: map[string]string{revertToSnapshotParameter: snapshotId},
+	})
+	return err
+}
+
+func TestRevertShareBackedVolume(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	d := NewCSIDriverWithClient(fake)
+	for _, name := range []string{"vol", "other"} {
+		if err := fake.CreateShare(ctx, name, "/"+name, 1<<20, nil, nil, -1, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapName, _ := fake.SnapshotShare(ctx, "vol")
+	snapshotId := GetSnapshotIDFromSnapshotName(snapName, "/vol")
+
+	// Without any published node markers on the cluster, the volume may be staged by a node
+	// running an earlier version
+	if err := revertVolumeTo(d, "/vol", snapshotId); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition without published node markers, got %v", err)
+	}
+	fake.AddFile(common.PublishedNodesDir+"/"+GetPublishedNodeMarkerName("/other", "node-2"), 0)
+
+	if err := revertVolumeTo(d, "/other", snapshotId); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a snapshot of another volume, got %v", err)
+	}
+	if err := revertVolumeTo(d, "/vol", GetSnapshotIDFromSnapshotName("2019-05-24T15-26-57-0", "/vol")); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for a missing snapshot, got %v", err)
+	}
+
+	// The volume must not be staged on a node
+	marker := common.PublishedNodesDir + "/" + GetPublishedNodeMarkerName("/vol", "node-1")
+	fake.AddFile(marker, 0)
+	if err := revertVolumeTo(d, "/vol", snapshotId); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for a staged volume, got %v", err)
+	}
+	fake.RemoveFile(marker)
+
+	if err := revertVolumeTo(d, "/vol", snapshotId); err != nil {
+		t.Fatalf("Expected the volume to be reverted, got %v", err)
+	}
+	share, _ := fake.GetShare(ctx, "vol")
+	if share.ExtendedInfo[GetRevertRecordKey("vol")] != snapshotId {
+		t.Errorf("Expected the revert to be recorded, got %v", share.ExtendedInfo)
+	}
+
+	// Retrying the modification does not revert the volume again, even if it is staged meanwhile
+	fake.AddFile(marker, 0)
+	if err := revertVolumeTo(d, "/vol", snapshotId); err != nil {
+		t.Errorf("Expected the retry to succeed, got %v", err)
+	}
+	fake.RemoveFile(marker)
+
+	// Modifying the volume without revertToSnapshot forgets the revert
+	_, err := d.ControllerModifyVolume(ctx, &csi.ControllerModifyVolumeRequest{
+		VolumeId:          "/vol",
+		MutableParameters: map[string]string{"comment": "reverted"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	share, _ = fake.GetShare(ctx, "vol")
+	if _, exists := share.ExtendedInfo[GetRevertRecordKey("vol")]; exists {
+		t.Errorf("Expected the revert record to be removed, got %v", share.ExtendedInfo)
+	}
+}
+
+func TestRevertVolumeInBackingShare(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	d := NewCSIDriverWithClient(fake)
+	if err := fake.CreateShare(ctx, "backing", "/backing", -1, nil, nil, -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	fake.AddFile("/backing/vol-a", 1<<20)
+	fake.AddFile(common.PublishedNodesDir+"/"+GetPublishedNodeMarkerName("/backing/vol-c", "node-2"), 0)
+	snapName, _ := fake.SnapshotFile(ctx, "/backing/vol-a")
+	snapshotId := GetSnapshotIDFromSnapshotName(snapName, "/backing/vol-a")
+
+	// Volumes published to a node with node export rules are recorded on the backing share
+	d.nodeExportRules = true
+	err := fake.UpdateShareExtendedInfo(ctx, "backing", map[string]string{GetNodeExportRecordKey("10.0.0.1"): "/backing/vol-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := revertVolumeTo(d, "/backing/vol-a", snapshotId); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for a volume published to a node, got %v", err)
+	}
+	err = fake.UpdateShareExtendedInfo(ctx, "backing", map[string]string{GetNodeExportRecordKey("10.0.0.1"): ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := revertVolumeTo(d, "/backing/vol-a", snapshotId); err != nil {
+		t.Fatalf("Expected the volume to be reverted, got %v", err)
+	}
+	share, _ := fake.GetShare(ctx, "backing")
+	if share.ExtendedInfo[GetRevertRecordKey("vol-a")] != snapshotId {
+		t.Errorf("Expected the revert to be recorded on the backing share, got %v", share.ExtendedInfo)
+	}
+
+	if err := revertVolumeTo(d, "/backing/vol-b", GetSnapshotIDFromSnapshotName(snapName, "/backing/vol-b")); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for a missing volume, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+// applySnapshotSchedule configures the snapshot schedule of the snapshotSchedule and
+// snapshotRetention parameters on a share and records it in the extended info of the share.
+// A share that already has a recorded schedule keeps it. The volumes of a backing share share its
+// schedule, so a volume requesting another schedule or retention is rejected. The caller holds
+// the lock of the share.
+func (d *CSIDriver) applySnapshotSchedule(ctx context.Context, shareName string, hsVolume *common.HSVolume) error {
+	if hsVolume.SnapshotSchedule == "" {
+		return nil
+	}
+	share, err := d.getHSClient(ctx).GetShare(ctx, shareName)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	if share == nil {
+		return status.Error(codes.NotFound, common.ShareNotFound)
+	}
+	retention := ""
+	if hsVolume.SnapshotRetention > 0 {
+		retention = strconv.Itoa(hsVolume.SnapshotRetention)
+	}
+	if schedule, exists := share.ExtendedInfo[common.SnapshotScheduleRecord]; exists {
+		recordedRetention := share.ExtendedInfo[common.SnapshotRetentionRecord]
+		if isBackingShare(share) && (schedule != hsVolume.SnapshotSchedule || recordedRetention != retention) {
+			return status.Errorf(codes.InvalidArgument, common.SnapshotScheduleMismatch,
+				shareName, schedule, recordedRetention, hsVolume.SnapshotSchedule, retention)
+		}
+		return nil
+	}
+
+	err = d.getHSClient(ctx).SetShareSnapshotSchedule(ctx, shareName, common.ShareSnapshotSchedule{
+		Name:               common.SnapshotScheduleName,
+		Frequency:          hsVolume.SnapshotSchedule,
+		Retention:          hsVolume.SnapshotRetention,
+		SnapshotNamePrefix: common.ScheduledSnapshotPrefix,
+	})
+	if err != nil {
+		return HSClientError(err)
+	}
+	err = d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, shareName, map[string]string{
+		common.SnapshotScheduleRecord:  hsVolume.SnapshotSchedule,
+		common.SnapshotRetentionRecord: retention,
+	})
+	if err != nil {
+		return HSClientError(err)
+	}
+	common.Logger(ctx).WithFields(log.Fields{
+		"share":     shareName,
+		"frequency": hsVolume.SnapshotSchedule,
+		"retention": hsVolume.SnapshotRetention,
+	}).Info("configured snapshot schedule")
+	return nil
+}
+
+// removeSnapshotSchedule removes the recorded snapshot schedule of a share together with the
+// snapshots it took, which are told apart by their name prefix. Other snapshots are never
+// deleted. The record is removed last so a failed removal is retried. The caller holds the lock
+// of the share.
+func (d *CSIDriver) removeSnapshotSchedule(ctx context.Context, share *common.ShareResponse) error {
+	_, recorded := share.ExtendedInfo[common.SnapshotScheduleRecord]
+	if recorded {
+		err := d.getHSClient(ctx).RemoveShareSnapshotSchedule(ctx, share.Name, common.SnapshotScheduleName)
+		if err != nil {
+			return HSClientError(err)
+		}
+	}
+
+	snapshots, err := d.getHSClient(ctx).GetShareSnapshots(ctx, share.Name)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%s", err.Error())
+	}
+	for _, snapshotName := range snapshots {
+		if !isScheduledSnapshot(snapshotName) {
+			continue
+		}
+		err = d.getHSClient(ctx).DeleteShareSnapshot(ctx, share.Name, snapshotName)
+		if err != nil && !strings.Contains(err.Error(), "not found") {
+			return status.Errorf(codes.Internal, "%s", err.Error())
+		}
+	}
+
+	if !recorded {
+		return nil
+	}
+	err = d.getHSClient(ctx).UpdateShareExtendedInfo(ctx, share.Name, map[string]string{
+		common.SnapshotScheduleRecord:  "",
+		common.SnapshotRetentionRecord: "",
+	})
+	if err != nil {
+		return HSClientError(err)
+	}
+	common.Logger(ctx).Infof("removed snapshot schedule of share %s", share.Name)
+	return nil
+}
+
+// isScheduledSnapshot reports whether a share snapshot was taken by the snapshot schedule the
+// plugin configures
+func isScheduledSnapshot(snapshotName string) bool {
+	return strings.HasPrefix(snapshotName, common.ScheduledSnapshotPrefix)
+}
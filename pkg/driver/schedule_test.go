@@ -0,0 +1,159 @@
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/client"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSnapshotScheduleOfShareBackedVolume(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	d := NewCSIDriverWithClient(fake)
+	if err := fake.CreateShare(ctx, "vol", "/vol", 1<<20, nil, nil, -1, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	hsVolume := &common.HSVolume{SnapshotSchedule: "daily", SnapshotRetention: 2}
+	if err := d.applySnapshotSchedule(ctx, "vol", hsVolume); err != nil {
+		t.Fatal(err)
+	}
+	expected := []common.ShareSnapshotSchedule{{
+		Name:               common.SnapshotScheduleName,
+		Frequency:          "daily",
+		Retention:          2,
+		SnapshotNamePrefix: common.ScheduledSnapshotPrefix,
+	}}
+	if schedules := fake.SnapshotSchedules("vol"); !reflect.DeepEqual(schedules, expected) {
+		t.Errorf("Expected schedules %v, got %v", expected, schedules)
+	}
+
+	// The recorded schedule is kept
+	if err := d.applySnapshotSchedule(ctx, "vol", &common.HSVolume{SnapshotSchedule: "hourly"}); err != nil {
+		t.Fatal(err)
+	}
+	if schedules := fake.SnapshotSchedules("vol"); !reflect.DeepEqual(schedules, expected) {
+		t.Errorf("Expected schedules %v to be kept, got %v", expected, schedules)
+	}
+
+	for range 3 {
+		if _, err := fake.TakeScheduledSnapshot("vol", common.SnapshotScheduleName); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listed, err := d.ListSnapshots(ctx, &csi.ListSnapshotsRequest{SourceVolumeId: "/vol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Entries) != 2 {
+		t.Errorf("Expected the 2 retained scheduled snapshots to be listed, got %v", listed.Entries)
+	}
+
+	snapshot, err := d.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "on-demand", SourceVolumeId: "/vol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	onDemandSnapshot, _ := GetSnapshotNameFromSnapshotId(snapshot.Snapshot.SnapshotId)
+	adminSnapshot, _ := fake.SnapshotShare(ctx, "vol")
+
+	// Snapshots not taken by the schedule block the deletion, which leaves the schedule in place
+	for i, snapshotName := range []string{onDemandSnapshot, adminSnapshot} {
+		_, err = d.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "/vol"})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Expected FailedPrecondition for a volume with snapshots, got %v", err)
+		}
+		if schedules := fake.SnapshotSchedules("vol"); !reflect.DeepEqual(schedules, expected) {
+			t.Errorf("Expected the schedule to be kept, got %v", schedules)
+		}
+		if snapshots, _ := fake.GetShareSnapshots(ctx, "vol"); len(snapshots) != 4-i {
+			t.Errorf("Expected no snapshot to be deleted, got %v", snapshots)
+		}
+		if err := fake.DeleteShareSnapshot(ctx, "vol", snapshotName); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Scheduled snapshots are deleted with the schedule and the volume
+	if _, err := d.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "/vol"}); err != nil {
+		t.Errorf("Expected the volume to be deleted, got %v", err)
+	}
+	if share, _ := fake.GetShare(ctx, "vol"); share != nil {
+		t.Errorf("Expected the share to be deleted, got %v", share)
+	}
+}
+
+func TestSnapshotScheduleOfBackingShare(t *testing.T) {
+	ctx := context.Background()
+	fake := client.NewFakeClient("https://anvil.fake", 1<<30)
+	d := NewCSIDriverWithClient(fake)
+	if err := fake.CreateShare(ctx, "backing", "/backing", -1, nil, nil, -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, volumeName := range []string{"vol-a", "vol-b"} {
+		if err := d.recordVolume(ctx, "backing", volumeName, 1<<20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.applySnapshotSchedule(ctx, "backing", &common.HSVolume{SnapshotSchedule: "hourly", SnapshotRetention: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The volumes of a backing share share its schedule
+	if err := d.applySnapshotSchedule(ctx, "backing", &common.HSVolume{SnapshotSchedule: "hourly", SnapshotRetention: 3}); err != nil {
+		t.Errorf("Expected the recorded schedule to be accepted, got %v", err)
+	}
+	for _, hsVolume := range []*common.HSVolume{
+		{SnapshotSchedule: "daily", SnapshotRetention: 3},
+		{SnapshotSchedule: "hourly"},
+		{SnapshotSchedule: "hourly", SnapshotRetention: 5},
+	} {
+		err := d.applySnapshotSchedule(ctx, "backing", hsVolume)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for schedule %s with retention %d, got %v", hsVolume.SnapshotSchedule, hsVolume.SnapshotRetention, err)
+		}
+	}
+
+	if _, err := fake.TakeScheduledSnapshot("backing", common.SnapshotScheduleName); err != nil {
+		t.Fatal(err)
+	}
+	adminSnapshot, _ := fake.SnapshotShare(ctx, "backing")
+
+	// The share of a backing share is not a volume, its snapshots are not listed
+	for _, req := range []*csi.ListSnapshotsRequest{{}, {SourceVolumeId: "/backing"}} {
+		listed, err := d.ListSnapshots(ctx, req)
+		if err != nil || len(listed.Entries) != 0 {
+			t.Errorf("Expected no snapshots of the backing share to be listed, got %v, %v", listed, err)
+		}
+	}
+
+	// The schedule is kept while the backing share holds volumes
+	if err := d.removeVolumeRecord(ctx, "backing", "vol-a"); err != nil {
+		t.Fatal(err)
+	}
+	if schedules := fake.SnapshotSchedules("backing"); len(schedules) != 1 {
+		t.Errorf("Expected the schedule to be kept, got %v", schedules)
+	}
+
+	if err := d.removeVolumeRecord(ctx, "backing", "vol-b"); err != nil {
+		t.Fatal(err)
+	}
+	if schedules := fake.SnapshotSchedules("backing"); len(schedules) != 0 {
+		t.Errorf("Expected the schedule to be removed with the last volume, got %v", schedules)
+	}
+	if snapshots, _ := fake.GetShareSnapshots(ctx, "backing"); !reflect.DeepEqual(snapshots, []string{adminSnapshot}) {
+		t.Errorf("Expected only the scheduled snapshots to be deleted, got %v", snapshots)
+	}
+	share, _ := fake.GetShare(ctx, "backing")
+	if _, exists := share.ExtendedInfo[common.SnapshotScheduleRecord]; exists {
+		t.Errorf("Expected the schedule record to be removed, got %v", share.ExtendedInfo)
+	}
+	if _, exists := share.ExtendedInfo[common.SnapshotRetentionRecord]; exists {
+		t.Errorf("Expected the retention record to be removed, got %v", share.ExtendedInfo)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// site returns the configured topology site of the Hammerspace cluster the request is sent to,
+// or "" when no site is configured
+func (d *CSIDriver) site(ctx context.Context) string {
+	return d.sites[d.getHSClient(ctx).Endpoint()]
+}
+
+// nodeTopology returns the site, zone and cluster segments of a node. The cluster segment is the
+// name of the Hammerspace cluster at HS_ENDPOINT. It is informational, nodes may mount volumes of
+// every cluster, so it is omitted when the cluster cannot be reached. Hammerspace does not report
+// availability zones, data portals only carry their node name and address, so the zone is the
+// CSI_NODE_ZONE of the node.
+func (d *CSIDriver) nodeTopology(ctx context.Context) map[string]string {
+	segments := map[string]string{}
+	clusterName, err := d.getHSClient(ctx).GetClusterName(ctx)
+	if err != nil {
+		common.Logger(ctx).Warnf("omitting the cluster topology segment, could not get the cluster name: %v", err)
+	} else {
+		segments[common.TopologyKeyCluster] = clusterName
+	}
+	if site := d.site(ctx); site != "" {
+		segments[common.TopologyKeySite] = site
+	}
+	if d.NodeZone != "" {
+		segments[common.TopologyKeyZone] = d.NodeZone
+	}
+	return segments
+}
+
+// topologyMatches reports whether a topology can be served by a cluster at site. Volumes are only
+// pinned to their site, so every topology matches when no site is configured.
+func topologyMatches(site string, topology *csi.Topology) bool {
+	value, defined := topology.GetSegments()[common.TopologyKeySite]
+	return site == "" || !defined || value == site
+}
+
+// volumeTopology returns the accessible topology of a new volume. Volumes are reachable from every
+// zone of the site of the cluster they are created on. Returns nil when the CO sends no
+// accessibility requirements or the cluster has no site, so the volume is accessible everywhere.
+func (d *CSIDriver) volumeTopology(ctx context.Context, requirements *csi.TopologyRequirement) ([]*csi.Topology, error) {
+	site := d.site(ctx)
+	if requirements == nil || site == "" {
+		return nil, nil
+	}
+
+	// The volume must be accessible from at least one requisite topology. Preferred topologies are a
+	// subset of the requisite ones, and only express a preference when there are none.
+	if requisite := requirements.GetRequisite(); len(requisite) > 0 {
+		accessible := false
+		for _, topology := range requisite {
+			if topologyMatches(site, topology) {
+				accessible = true
+				break
+			}
+		}
+		if !accessible {
+			return nil, status.Errorf(codes.ResourceExhausted, common.TopologyNotAccessible, requisite, site)
+		}
+	}
+	return []*csi.Topology{{Segments: map[string]string{common.TopologyKeySite: site}}}, nil
+}
@@ -0,0 +1,163 @@
+package driver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hammer-space/csi-plugin/pkg/client"
+	"github.com/hammer-space/csi-plugin/pkg/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTopologyTestDriver(t *testing.T, site string) *CSIDriver {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc(client.BasePath+"/login", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc(client.BasePath+"/cntl/state", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"name": "hs-east", "capacity": {"free": 1000}}`)
+	})
+	hsclient, err := client.NewHammerspaceClient(server.URL, "test_user", "test_password", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CSIDriver{hsclient: hsclient, sites: map[string]string{server.URL: site}}
+}
+
+func TestTopologyMatches(t *testing.T) {
+	cases := []struct {
+		site     string
+		segments map[string]string
+		expected bool
+	}{
+		{"east", nil, true},
+		{"east", map[string]string{common.TopologyKeySite: "east"}, true},
+		{"east", map[string]string{common.TopologyKeySite: "east", common.TopologyKeyZone: "a"}, true},
+		{"east", map[string]string{common.TopologyKeySite: "east", common.TopologyKeyCluster: "hs-west"}, true},
+		{"east", map[string]string{common.TopologyKeyZone: "a"}, true},
+		{"east", map[string]string{common.TopologyKeySite: "west"}, false},
+		{"", map[string]string{common.TopologyKeySite: "west"}, true},
+	}
+	for _, c := range cases {
+		actual := topologyMatches(c.site, &csi.Topology{Segments: c.segments})
+		if actual != c.expected {
+			t.Errorf("topologyMatches(%s, %v): expected %v, got %v", c.site, c.segments, c.expected, actual)
+		}
+	}
+}
+
+func TestNodeTopology(t *testing.T) {
+	expected := map[string]string{
+		common.TopologyKeyCluster: "hs-east",
+	}
+	actual := newTopologyTestDriver(t, "").nodeTopology(context.Background())
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	expected[common.TopologyKeySite] = "east"
+	expected[common.TopologyKeyZone] = "a"
+	d := newTopologyTestDriver(t, "east")
+	d.NodeZone = "a"
+	actual = d.nodeTopology(context.Background())
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestNodeTopologyWithoutCluster(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc(client.BasePath+"/login", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc(client.BasePath+"/cntl/state", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	hsclient, err := client.NewHammerspaceClient(server.URL, "test_user", "test_password", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &CSIDriver{hsclient: hsclient, sites: map[string]string{server.URL: "east"}}
+
+	// The cluster segment is omitted when the cluster cannot be reached
+	expected := map[string]string{common.TopologyKeySite: "east"}
+	if actual := d.nodeTopology(context.Background()); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestVolumeTopology(t *testing.T) {
+	d := newTopologyTestDriver(t, "east")
+	east := &csi.Topology{Segments: map[string]string{common.TopologyKeySite: "east", common.TopologyKeyZone: "a"}}
+	west := &csi.Topology{Segments: map[string]string{common.TopologyKeySite: "west", common.TopologyKeyZone: "b"}}
+	expected := []*csi.Topology{{Segments: map[string]string{common.TopologyKeySite: "east"}}}
+
+	topology, err := d.volumeTopology(context.Background(), nil)
+	if err != nil || topology != nil {
+		t.Errorf("expected no topology without requirements, got %v, %v", topology, err)
+	}
+
+	topology, err = d.volumeTopology(context.Background(), &csi.TopologyRequirement{
+		Requisite: []*csi.Topology{west, east},
+		Preferred: []*csi.Topology{west},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(topology, expected) {
+		t.Errorf("expected %v, got %v", expected, topology)
+	}
+
+	// Preferred topologies alone do not restrict where the volume is created
+	topology, err = d.volumeTopology(context.Background(), &csi.TopologyRequirement{
+		Preferred: []*csi.Topology{west},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(topology, expected) {
+		t.Errorf("expected %v, got %v", expected, topology)
+	}
+
+	_, err = d.volumeTopology(context.Background(), &csi.TopologyRequirement{
+		Requisite: []*csi.Topology{west},
+	})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+
+	// Volumes of clusters without a site are accessible everywhere
+	topology, err = newTopologyTestDriver(t, "").volumeTopology(context.Background(), &csi.TopologyRequirement{
+		Requisite: []*csi.Topology{west},
+	})
+	if err != nil || topology != nil {
+		t.Errorf("expected no topology without a site, got %v, %v", topology, err)
+	}
+}
+
+func TestGetCapacityTopology(t *testing.T) {
+	d := newTopologyTestDriver(t, "east")
+	cases := []struct {
+		topology *csi.Topology
+		expected int64
+	}{
+		{nil, 1000},
+		{&csi.Topology{Segments: map[string]string{common.TopologyKeySite: "east", common.TopologyKeyZone: "a"}}, 1000},
+		{&csi.Topology{Segments: map[string]string{common.TopologyKeySite: "west"}}, 0},
+	}
+	for _, c := range cases {
+		rsp, err := d.GetCapacity(context.Background(), &csi.GetCapacityRequest{AccessibleTopology: c.topology})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rsp.AvailableCapacity != c.expected {
+			t.Errorf("topology %v: expected capacity %d, got %d", c.topology, c.expected, rsp.AvailableCapacity)
+		}
+	}
+}
@@ -34,35 +34,9 @@ import (
 	"google.golang.org/grpc/status"
 
 	common "github.com/hammer-space/csi-plugin/pkg/common"
+	"github.com/hammer-space/csi-plugin/pkg/metrics"
 )
 
-var (
-	maxRetries    int           = 5
-	retryInterval time.Duration = 1 * time.Second
-)
-
-func init() {
-	retryCountStr := os.Getenv("UNMOUNT_RETRY_COUNT")
-	if retryCountStr != "" {
-		if count, err := strconv.Atoi(retryCountStr); err == nil && count >= 0 {
-			maxRetries = count
-		} else {
-			log.Warnf("Invalid UNMOUNT_RETRY_COUNT=%s; using default %d", retryCountStr, maxRetries)
-		}
-	}
-
-	retryIntervalStr := os.Getenv("UNMOUNT_RETRY_INTERVAL")
-	if retryIntervalStr != "" {
-		if interval, err := time.ParseDuration(retryIntervalStr); err == nil && interval >= 0 {
-			retryInterval = interval
-		} else {
-			log.Warnf("Invalid UNMOUNT_RETRY_INTERVAL=%s; using default %s", retryIntervalStr, retryInterval)
-		}
-	}
-
-	log.Infof("Unmount retry config: maxRetries=%d, retryInterval=%s", maxRetries, retryInterval)
-}
-
 func IsBlockDevice(fileInfo os.FileInfo) bool {
 	mode := fileInfo.Mode()
 	return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0
@@ -89,6 +63,7 @@ func AttachLoopDevice(filePath string, readOnly bool) (string, error) {
 	flags = append(flags, deviceStr, filePath)
 
 	output, err := common.ExecCommand("losetup", flags...)
+	metrics.RecordMountOperation("loop_attach", err)
 
 	if err != nil {
 		return "", fmt.Errorf("losetup failed: %s, %w", string(output), err)
@@ -98,8 +73,8 @@ func AttachLoopDevice(filePath string, readOnly bool) (string, error) {
 }
 
 // AttachLoopDeviceWithRetry binds a loop device to a filePath with retry support for EBUSY
-func AttachLoopDeviceWithRetry(filePath string, readOnly bool) (string, error) {
-	log.Debugf("Recived request to AttachLoopDeviceWithRetry for filepath %s", filePath)
+func AttachLoopDeviceWithRetry(ctx context.Context, filePath string, readOnly bool) (string, error) {
+	common.Logger(ctx).Debugf("Recived request to AttachLoopDeviceWithRetry for filepath %s", filePath)
 	// Step 1: Check if already attached
 	output, err := common.ExecCommand("losetup", "-j", filePath)
 	if err == nil && strings.TrimSpace(string(output)) != "" {
@@ -107,7 +82,7 @@ func AttachLoopDeviceWithRetry(filePath string, readOnly bool) (string, error) {
 		fields := strings.Split(string(output), ":")
 		if len(fields) > 0 {
 			device := strings.TrimSpace(fields[0])
-			log.Infof("Backing file %s already attached to loop device %s", filePath, device)
+			common.Logger(ctx).Infof("Backing file %s already attached to loop device %s", filePath, device)
 			return device, nil
 		}
 	}
@@ -115,14 +90,14 @@ func AttachLoopDeviceWithRetry(filePath string, readOnly bool) (string, error) {
 	// 3. Create loop device if missing
 	deviceStr, err := GetFreeLoopDevice()
 	if err != nil {
-		log.Errorf("Will not retry [GetFreeLoopDevice] recived an error. %v", err)
+		common.Logger(ctx).Errorf("Will not retry [GetFreeLoopDevice] recived an error. %v", err)
 		return "", err
 	}
 	if _, err := os.Stat(deviceStr); os.IsNotExist(err) {
 		major := 7
 		minor, err := common.GetDeviceMinorNumber(deviceStr)
 		if err != nil {
-			log.Debugf("Unable to parse lopp device minor number from %s", deviceStr)
+			common.Logger(ctx).Debugf("Unable to parse lopp device minor number from %s", deviceStr)
 		}
 		_, err = common.ExecCommand("mknod", "-m660", deviceStr, "b", strconv.Itoa(major), strconv.Itoa(int(minor)))
 		if err != nil {
@@ -131,16 +106,17 @@ func AttachLoopDeviceWithRetry(filePath string, readOnly bool) (string, error) {
 	}
 
 	// Step 2: Attach using losetup
+	cfg := common.GetConfig()
 	var lastErr error
-	for i := 0; i < maxRetries; i++ {
+	for i := 0; i < cfg.UnmountRetryCount; i++ {
 		deviceStr, err := AttachLoopDevice(filePath, readOnly)
 		if err != nil {
-			log.Errorf("Not able to attach the loop device, Err %v", err)
+			common.Logger(ctx).Errorf("Not able to attach the loop device, Err %v", err)
 			// retry if device is busy
 			if strings.Contains(err.Error(), "busy") {
-				log.Warnf("losetup attempt %d failed: %v", i+1, err)
+				common.Logger(ctx).Warnf("losetup attempt %d failed: %v", i+1, err)
 				lastErr = fmt.Errorf("device busy on attempt %d: %w", i+1, err)
-				time.Sleep(retryInterval)
+				time.Sleep(cfg.UnmountRetryInterval)
 				continue
 			}
 			// Other error → return immediately
@@ -149,27 +125,29 @@ func AttachLoopDeviceWithRetry(filePath string, readOnly bool) (string, error) {
 		return deviceStr, nil
 	}
 
-	return "", fmt.Errorf("failed to attach loop device for %s after %d retries: %w", filePath, maxRetries, lastErr)
+	return "", fmt.Errorf("failed to attach loop device for %s after %d retries: %w", filePath, cfg.UnmountRetryCount, lastErr)
 }
 
 // CleanupLoopDevice detaches a loop device if it exists
-func CleanupLoopDevice(dev string) {
+func CleanupLoopDevice(ctx context.Context, dev string) {
 	if _, err := os.Stat(dev); os.IsNotExist(err) {
-		log.Warnf("Loop device %s does not exist, skipping cleanup", dev)
+		common.Logger(ctx).Warnf("Loop device %s does not exist, skipping cleanup", dev)
 		return
 	}
 
-	for i := 0; i < maxRetries; i++ {
+	cfg := common.GetConfig()
+	for i := 0; i < cfg.UnmountRetryCount; i++ {
 		out, err := common.ExecCommand("losetup", "-d", dev)
+		metrics.RecordMountOperation("loop_detach", err)
 		if err == nil {
-			log.Infof("Loop device %s detached successfully", dev)
+			common.Logger(ctx).Infof("Loop device %s detached successfully", dev)
 			return
 		}
-		log.Warnf("Attempt %d: Failed to detach loop device %s: %v. Output: %s", i+1, dev, err, string(out))
-		time.Sleep(retryInterval)
+		common.Logger(ctx).Warnf("Attempt %d: Failed to detach loop device %s: %v. Output: %s", i+1, dev, err, string(out))
+		time.Sleep(cfg.UnmountRetryInterval)
 	}
 
-	log.Errorf("Failed to detach loop device %s after %d retries", dev, maxRetries)
+	common.Logger(ctx).Errorf("Failed to detach loop device %s after %d retries", dev, cfg.UnmountRetryCount)
 }
 
 func IsValueInList(value string, list []string) bool {
@@ -185,6 +163,17 @@ func GetVolumeNameFromPath(path string) string {
 	return filepath.Base(path)
 }
 
+// GetShareVolumeName returns the name of the share of a share-backed volume. Names longer than
+// Hammerspace allows for shares are cut short and end with a hash of the full name, so a CSI
+// name always maps to the same share.
+func GetShareVolumeName(volumeName string) string {
+	if len(volumeName) <= common.MaxShareNameLength {
+		return volumeName
+	}
+	hash := hashVolumeID(volumeName)[:16]
+	return volumeName[:common.MaxShareNameLength-len(hash)-1] + "-" + hash
+}
+
 func GetSnapshotNameFromSnapshotId(snapshotId string) (string, error) {
 	tokens := strings.SplitN(snapshotId, "|", 2)
 	if len(tokens) != 2 {
@@ -207,26 +196,93 @@ func GetSnapshotIDFromSnapshotName(hsSnapName, sourceVolumeID string) string {
 	return fmt.Sprintf("%s|%s", hsSnapName, sourceVolumeID)
 }
 
+// GetSnapshotRecordKey returns the share extended info key used to record which Hammerspace
+// snapshot was created for a CSI snapshot name
+func GetSnapshotRecordKey(csiSnapshotName string) string {
+	return common.SnapshotRecordPrefix + csiSnapshotName
+}
+
+// GetVolumeRecordKey returns the backing share extended info key recording a volume inside it
+func GetVolumeRecordKey(volumeName string) string {
+	return common.VolumeRecordPrefix + volumeName
+}
+
+// GetRevertRecordKey returns the share extended info key recording the snapshot a volume was
+// last reverted to
+func GetRevertRecordKey(volumeName string) string {
+	return common.RevertRecordPrefix + volumeName
+}
+
+// GetSnapshotRecordShareName returns the share whose extended info holds the snapshot records
+// for a volume, this is the share itself for share-backed volumes or the backing share otherwise
+func GetSnapshotRecordShareName(sourceVolumeID string, shareBacked bool) string {
+	if shareBacked {
+		return GetVolumeNameFromPath(sourceVolumeID)
+	}
+	return path.Base(path.Dir(sourceVolumeID))
+}
+
+// GetSnapshotCreationTime parses the creation time encoded in a Hammerspace snapshot name,
+// ex. 2019-05-24T15-26-57-0
+func GetSnapshotCreationTime(hsSnapName string) (time.Time, error) {
+	name := path.Base(hsSnapName)
+	if len(name) < len(common.SnapshotTimeFormat) {
+		return time.Time{}, fmt.Errorf("snapshot name %s does not contain a creation time", hsSnapName)
+	}
+	return time.ParseInLocation(common.SnapshotTimeFormat, name[:len(common.SnapshotTimeFormat)], time.UTC)
+}
+
+// GetGroupSnapshotID generates the group snapshot ID stored by the CO, group|<group snapshot name>
+func GetGroupSnapshotID(groupSnapshotName string) string {
+	return common.GroupSnapshotIDPrefix + groupSnapshotName
+}
+
+func GetGroupSnapshotNameFromId(groupSnapshotId string) (string, error) {
+	if !strings.HasPrefix(groupSnapshotId, common.GroupSnapshotIDPrefix) || len(groupSnapshotId) == len(common.GroupSnapshotIDPrefix) {
+		return "", fmt.Errorf(common.ImproperlyFormattedGroupSnapshotId, groupSnapshotId)
+	}
+	return strings.TrimPrefix(groupSnapshotId, common.GroupSnapshotIDPrefix), nil
+}
+
+// GetGroupSnapshotRecordKey returns the share extended info key used to record the snapshot of a
+// member volume of a group snapshot. Keys of all members of a group share the same prefix.
+func GetGroupSnapshotRecordKey(groupSnapshotName, sourceVolumeID string) string {
+	return GetGroupSnapshotRecordPrefix(groupSnapshotName) + GetVolumeNameFromPath(sourceVolumeID)
+}
+
+func GetGroupSnapshotRecordPrefix(groupSnapshotName string) string {
+	return common.GroupSnapshotRecordPrefix + groupSnapshotName + "/"
+}
+
+// HSClientError keeps the gRPC code of an error returned by the Hammerspace client, ex.
+// Aborted while a task is still running, other errors are Internal
+func HSClientError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Errorf(codes.Internal, "%s", err.Error())
+}
+
 func (d *CSIDriver) EnsureBackingShareMounted(ctx context.Context, backingShareName string, hsVol *common.HSVolume) error {
-	backingShare, err := d.hsclient.GetShare(ctx, backingShareName)
+	backingShare, err := d.getHSClient(ctx).GetShare(ctx, backingShareName)
 	if err != nil {
 		return status.Errorf(codes.NotFound, "%s", err.Error())
 	}
 	if backingShare != nil {
 		backingDir := common.ShareStagingDir + backingShare.ExportPath
 		// Mount backing share
-		isMounted := common.IsShareMounted(backingDir)
-		log.Infof("Checked mount for %s: isMounted=%t", backingDir, isMounted)
+		isMounted := common.IsShareMounted(ctx, backingDir)
+		common.Logger(ctx).Infof("Checked mount for %s: isMounted=%t", backingDir, isMounted)
 		if !isMounted {
 			err := d.MountShareAtBestDataportal(ctx, backingShare.ExportPath, backingDir, hsVol.ClientMountOptions, hsVol.FQDN)
 			if err != nil {
-				log.Errorf("failed to mount backing share, %v", err)
+				common.Logger(ctx).Errorf("failed to mount backing share, %v", err)
 				return err
 			}
 
-			log.Infof("mounted backing share, %s", backingDir)
+			common.Logger(ctx).Infof("mounted backing share, %s", backingDir)
 		} else {
-			log.Infof("backing share already mounted, %s", backingDir)
+			common.Logger(ctx).Infof("backing share already mounted, %s", backingDir)
 		}
 		return nil
 	}
@@ -234,14 +290,14 @@ func (d *CSIDriver) EnsureBackingShareMounted(ctx context.Context, backingShareN
 }
 
 func (d *CSIDriver) UnmountBackingShareIfUnused(ctx context.Context, backingShareName string) (bool, error) {
-	log.Infof("UnmountBackingShareIfUnused is called with backing share name %s", backingShareName)
-	backingShare, err := d.hsclient.GetShare(ctx, backingShareName)
+	common.Logger(ctx).Infof("UnmountBackingShareIfUnused is called with backing share name %s", backingShareName)
+	backingShare, err := d.getHSClient(ctx).GetShare(ctx, backingShareName)
 	if err != nil || backingShare == nil {
-		log.Errorf("unable to get share while checking UnmountBackingShareIfUnused. Err %v", err)
+		common.Logger(ctx).Errorf("unable to get share while checking UnmountBackingShareIfUnused. Err %v", err)
 		return false, err
 	}
 	mountPath := common.ShareStagingDir + backingShare.ExportPath
-	if isMounted := common.IsShareMounted(mountPath); !isMounted {
+	if isMounted := common.IsShareMounted(ctx, mountPath); !isMounted {
 		return true, nil
 	}
 	// If any loopback devices are using the mount
@@ -256,16 +312,16 @@ func (d *CSIDriver) UnmountBackingShareIfUnused(ctx context.Context, backingShar
 			device := strings.Split(d, " ")
 			backingFile := strings.Trim(device[len(device)-1], ":()")
 			if strings.Index(backingFile, mountPath) == 0 {
-				log.Infof("backing share, %s, still in use by, %s", mountPath, devices[0])
+				common.Logger(ctx).Infof("backing share, %s, still in use by, %s", mountPath, devices[0])
 				return false, nil
 			}
 		}
 	}
 
-	log.Infof("unmounting backing share %s", mountPath)
-	err = common.UnmountFilesystem(mountPath)
+	common.Logger(ctx).Infof("unmounting backing share %s", mountPath)
+	err = common.UnmountFilesystem(ctx, mountPath)
 	if err != nil {
-		log.Errorf("failed to unmount backing share %s", mountPath)
+		common.Logger(ctx).Errorf("failed to unmount backing share %s", mountPath)
 		return false, err
 	}
 
@@ -282,36 +338,36 @@ func (d *CSIDriver) MountShareAtBestDataportal(ctx context.Context, shareExportP
 	var err error
 	var fipaddr string = ""
 
-	log.Infof("Finding best host exporting %s", shareExportPath)
+	common.Logger(ctx).Infof("Finding best host exporting %s", shareExportPath)
 
-	portals, err := d.hsclient.GetDataPortals(ctx, d.NodeID)
+	portals, err := d.getHSClient(ctx).GetDataPortals(ctx, d.NodeID)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"share":   shareExportPath,
-			"target":  targetPath,
-			"Node_id": d.NodeID,
+		common.Logger(ctx).WithFields(log.Fields{
+			"share":       shareExportPath,
+			"target_path": targetPath,
+			"node_id":     d.NodeID,
 		}).Errorf("Could not create list of data-portals")
 		return status.Errorf(codes.Internal, "could not create list of data-portals, %v", err)
 	}
 
 	extracted_endpoint, err := common.ResolveFQDN(fqdn)
 	if err != nil {
-		log.Errorf("Not able to resolve FQDN=%s checking floating IP's. Error %v", fqdn, err)
+		common.Logger(ctx).Errorf("Not able to resolve FQDN=%s checking floating IP's. Error %v", fqdn, err)
 	}
 	if extracted_endpoint != "" && err == nil { // if fqdn is provided use that ip
 		// check if rpcinfo gives a response
-		ok, err := common.CheckNFSExports(extracted_endpoint)
+		ok, err := common.CheckNFSExports(ctx, extracted_endpoint)
 		if err != nil {
-			log.Warnf("Could not get exports for fqdn %s ip %s. Error: %v", fqdn, extracted_endpoint, err)
+			common.Logger(ctx).Warnf("Could not get exports for fqdn %s ip %s. Error: %v", fqdn, extracted_endpoint, err)
 		}
 		if ok {
 			fipaddr = extracted_endpoint
 		}
 	} else {
 		// Always look for floating data portal IPs
-		fipaddr, err = d.hsclient.GetPortalFloatingIp(ctx)
+		fipaddr, err = d.getHSClient(ctx).GetPortalFloatingIp(ctx)
 		if err != nil {
-			log.Errorf("Could not contact Anvil for floating IPs, %v", err)
+			common.Logger(ctx).Errorf("Could not contact Anvil for floating IPs, %v", err)
 		}
 	}
 
@@ -325,27 +381,28 @@ func (d *CSIDriver) MountShareAtBestDataportal(ctx context.Context, shareExportP
 		return false
 	}
 
+	prefix := common.GetConfig().DataPortalMountPrefix
 	MountToDataPortal := func(portal common.DataPortal, mount_options []string) bool {
 		addr := ""
 		if len(fipaddr) > 0 {
 			addr = fipaddr
-			log.Infof("Floating IP address detected: %s", fipaddr)
+			common.Logger(ctx).Infof("Floating IP address detected: %s", fipaddr)
 		} else {
 			addr = portal.Node.MgmtIpAddress.Address
 		}
 		export := ""
 		// Use configured prefix if specified
-		if common.DataPortalMountPrefix != "" {
-			export = fmt.Sprintf("%s:%s%s", addr, common.DataPortalMountPrefix, shareExportPath)
+		if prefix != "" {
+			export = fmt.Sprintf("%s:%s%s", addr, prefix, shareExportPath)
 		} else {
 			// grab exports with showmount
 			exports, err := common.GetNFSExports(addr)
 			common.SetCacheData("NFS_EXPORTS", exports, 60*60) // keep the exports for an our before auto expire
 			if err != nil {
-				log.Infof("Could not get exports for data-portal at %s, %s. Error: %v", addr, portal.Uoid["uuid"], err)
+				common.Logger(ctx).Infof("Could not get exports for data-portal at %s, %s. Error: %v", addr, portal.Uoid["uuid"], err)
 				return false
 			}
-			log.Infof("Found exports for data-portal %s, %v", addr, exports)
+			common.Logger(ctx).Infof("Found exports for data-portal %s, %v", addr, exports)
 
 			// Check configured prefix
 			// Check the default prefixes
@@ -353,7 +410,7 @@ func (d *CSIDriver) MountShareAtBestDataportal(ctx context.Context, shareExportP
 				for _, e := range exports {
 					if e == fmt.Sprintf("%s%s", mountPrefix, shareExportPath) {
 						export = fmt.Sprintf("%s:%s%s", addr, mountPrefix, shareExportPath)
-						log.Infof("Found export %s", export)
+						common.Logger(ctx).Infof("Found export %s", export)
 						break
 					}
 				}
@@ -362,24 +419,24 @@ func (d *CSIDriver) MountShareAtBestDataportal(ctx context.Context, shareExportP
 				}
 			}
 			if export == "" {
-				log.Infof("Could not find any matching export on data-portal address - %s uuid - %s.", portal.Node.MgmtIpAddress.Address, portal.Uoid["uuid"])
+				common.Logger(ctx).Infof("Could not find any matching export on data-portal address - %s uuid - %s.", portal.Node.MgmtIpAddress.Address, portal.Uoid["uuid"])
 				return false
 			}
 		}
-		err = common.MountShare(export, targetPath, mount_options)
+		err = common.MountShare(ctx, export, targetPath, mount_options)
 		if err != nil {
-			log.WithFields(log.Fields{
+			common.Logger(ctx).WithFields(log.Fields{
 				"share":         shareExportPath,
-				"target":        targetPath,
+				"target_path":   targetPath,
 				"portal_name":   portal.Node.Name,
 				"portal_ip":     portal.Node.MgmtIpAddress.Address,
 				"portal":        portal.Uoid["uuid"],
 				"mount_options": mount_options,
 			}).Errorf("Could NOT mount share %s to %s ERR %v", shareExportPath, targetPath, err)
 		} else {
-			log.WithFields(log.Fields{
+			common.Logger(ctx).WithFields(log.Fields{
 				"share":         shareExportPath,
-				"target":        targetPath,
+				"target_path":   targetPath,
 				"portal_name":   portal.Node.Name,
 				"portal_ip":     portal.Node.MgmtIpAddress.Address,
 				"portal":        portal.Uoid["uuid"],
@@ -391,7 +448,7 @@ func (d *CSIDriver) MountShareAtBestDataportal(ctx context.Context, shareExportP
 		return false
 	}
 
-	log.Infof("Attempting to mount with provided mount flags.")
+	common.Logger(ctx).Infof("Attempting to mount with provided mount flags.")
 	// Attempt to mount with provided mount flags if they contain nfsvers
 	if containsNfsvers(mountFlags) {
 		for _, p := range portals {
@@ -407,11 +464,11 @@ func (d *CSIDriver) MountShareAtBestDataportal(ctx context.Context, shareExportP
 			}
 		}
 		mountFlags = filteredMountFlags
-		log.Infof("Mount with provided mount flags failed, removed nfsvers option.")
+		common.Logger(ctx).Infof("Mount with provided mount flags failed, removed nfsvers option.")
 	}
 
 	// Fallback to NFS 4.2
-	log.Infof("Provided mount flags do not contain nfsvers option or failed to mount, using default to NFS 4.2.")
+	common.Logger(ctx).Infof("Provided mount flags do not contain nfsvers option or failed to mount, using default to NFS 4.2.")
 	for _, p := range portals {
 		if MountToDataPortal(p, append(mountFlags, "nfsvers=4.2")) {
 			return nil
@@ -419,7 +476,7 @@ func (d *CSIDriver) MountShareAtBestDataportal(ctx context.Context, shareExportP
 	}
 
 	// Fallback to NFS 3
-	log.Infof("Could not mount via NFS 4.2, falling back to NFS 3.")
+	common.Logger(ctx).Infof("Could not mount via NFS 4.2, falling back to NFS 3.")
 	for _, p := range portals {
 		if MountToDataPortal(p, append(mountFlags, "nfsvers=3,nolock")) {
 			return nil
@@ -430,38 +487,38 @@ func (d *CSIDriver) MountShareAtBestDataportal(ctx context.Context, shareExportP
 }
 
 func (d *CSIDriver) EnsureRootExportMounted(ctx context.Context, baseRootDirPath string) error {
-	log.Debugf("Check if %s is already mounted", baseRootDirPath)
-	if common.IsShareMounted(baseRootDirPath) {
-		log.Debugf("Root dir mount is already mounted at this node on path %s", baseRootDirPath)
+	common.Logger(ctx).Debugf("Check if %s is already mounted", baseRootDirPath)
+	if common.IsShareMounted(ctx, baseRootDirPath) {
+		common.Logger(ctx).Debugf("Root dir mount is already mounted at this node on path %s", baseRootDirPath)
 		return nil
 	}
-	log.Debugf("Create dir if %s is not already there.", baseRootDirPath)
+	common.Logger(ctx).Debugf("Create dir if %s is not already there.", baseRootDirPath)
 	if err := os.MkdirAll(baseRootDirPath, 0755); err != nil {
 		return err
 	}
 	// Step 1 - Get Anvil IP
-	anvilEndpointIP, err := d.hsclient.GetAnvilPortal()
+	anvilEndpointIP, err := d.getHSClient(ctx).GetAnvilPortal()
 	if err != nil {
-		log.Errorf("Not able to extract anvil endpoint. Err %v", err)
+		common.Logger(ctx).Errorf("Not able to extract anvil endpoint. Err %v", err)
 	}
 	// Step 2 - Use export ip and path to mount root with 4.2 only.
-	log.Debugf("Calling mount via nfs v4.2 using anvil IP %s to mount (/) on %s", "", baseRootDirPath)
+	common.Logger(ctx).Debugf("Calling mount via nfs v4.2 using anvil IP %s to mount (/) on %s", "", baseRootDirPath)
 	var mountOption []string
 	mountOption = append(mountOption, "nfsvers=4.2")
-	err = common.MountShare(anvilEndpointIP+":/", baseRootDirPath, mountOption)
+	err = common.MountShare(ctx, anvilEndpointIP+":/", baseRootDirPath, mountOption)
 	if err != nil {
-		log.Errorf("Unable to mount root share via 4.2 using anvil IP. %v", err)
+		common.Logger(ctx).Errorf("Unable to mount root share via 4.2 using anvil IP. %v", err)
 
 		// Step 3 - Use fallback
-		log.Debugf("Call for mount root share with anvil IP and 4.2 FAILED, now will do a fallback try with other data portals, with fallback to 4.2 and v3")
+		common.Logger(ctx).Debugf("Call for mount root share with anvil IP and 4.2 FAILED, now will do a fallback try with other data portals, with fallback to 4.2 and v3")
 		err = d.MountShareAtBestDataportal(ctx, "/", baseRootDirPath, nil, "")
 		if err != nil {
-			log.Errorf("Not able to mount root share to mount point %s. Error %v", baseRootDirPath, err)
+			common.Logger(ctx).Errorf("Not able to mount root share to mount point %s. Error %v", baseRootDirPath, err)
 			return err
 		}
 	}
 
-	log.Debugf("Successfully mounted base (/) share at best data portal to mount point %s", baseRootDirPath)
+	common.Logger(ctx).Debugf("Successfully mounted base (/) share at best data portal to mount point %s", baseRootDirPath)
 	return err
 }
 
@@ -494,14 +551,14 @@ func (d *CSIDriver) WaitForPathReady(ctx context.Context, path string, pollInter
 	}
 }
 
-func IsAnyVolumeStillMounted(baseMarkerDir string) bool {
+func IsAnyVolumeStillMounted(ctx context.Context, baseMarkerDir string) bool {
 	files, err := os.ReadDir(baseMarkerDir)
 	if err != nil {
 		return false // Fail safe
 	}
 
 	for _, f := range files {
-		log.Debugf("volume marker still present at %s", f.Name())
+		common.Logger(ctx).Debugf("volume marker still present at %s", f.Name())
 		if strings.HasSuffix(f.Name(), ".marker") {
 			return true
 		}
@@ -511,12 +568,58 @@ func IsAnyVolumeStillMounted(baseMarkerDir string) bool {
 }
 
 func GetHashedMarkerPath(baseDir, volmeID string) string {
-	h := sha256.New()
-	h.Write([]byte(volmeID))
-	hashStr := hex.EncodeToString(h.Sum(nil))
+	hashStr := hashVolumeID(volmeID)
 
 	// Instead of putting marker as a file named ".marker" inside hash directory,
 	// create a file named "<hash>.marker" directly inside baseDir
 	markerFile := filepath.Join(baseDir, hashStr+".marker")
 	return markerFile
 }
+
+// hashVolumeID returns the hex encoded sha256 of a volume ID, used to name
+// per-volume marker files.
+func hashVolumeID(volumeID string) string {
+	h := sha256.New()
+	h.Write([]byte(volumeID))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GetPublishedNodeMarkerName returns the name of the file recording that
+// volumeID is staged on nodeID, "<hash of volume ID>@<node ID>".
+func GetPublishedNodeMarkerName(volumeID, nodeID string) string {
+	return hashVolumeID(volumeID) + "@" + nodeID
+}
+
+// ParsePublishedNodeMarkerName splits a published node marker name into the
+// volume ID hash and the node ID.
+func ParsePublishedNodeMarkerName(name string) (volumeHash, nodeID string, ok bool) {
+	volumeHash, nodeID, ok = strings.Cut(name, "@")
+	if !ok || volumeHash == "" || nodeID == "" {
+		return "", "", false
+	}
+	return volumeHash, nodeID, true
+}
+
+// JoinNodeID returns the node ID reported to the CO, "<node name>@<node IP>" when the node IP is
+// known so ControllerPublishVolume can add an export rule for it, else the node name
+func JoinNodeID(nodeName, nodeIP string) string {
+	if nodeIP == "" {
+		return nodeName
+	}
+	return nodeName + "@" + nodeIP
+}
+
+// SplitNodeID returns the node name and node IP of a node ID. The IP is empty for node IDs
+// without one.
+func SplitNodeID(nodeID string) (nodeName, nodeIP string) {
+	i := strings.LastIndex(nodeID, "@")
+	if i < 0 {
+		return nodeID, ""
+	}
+	return nodeID[:i], nodeID[i+1:]
+}
+
+// GetNodeExportRecordKey returns the share extended info key recording the volumes published to a node IP
+func GetNodeExportRecordKey(nodeIP string) string {
+	return common.NodeExportRecordPrefix + nodeIP
+}
@@ -2,7 +2,11 @@ package driver
 
 import (
     "reflect"
+    "strings"
     "testing"
+    "time"
+
+    "github.com/hammer-space/csi-plugin/pkg/common"
 )
 
 func TestGetSnapshotNameFromSnapshotId(t *testing.T) {
@@ -72,4 +76,141 @@ func TestGetVolumeNameFromPath(t *testing.T) {
         t.Logf("Actual: %v", actual)
         t.FailNow()
     }
-}
\ No newline at end of file
+}
+func TestGetSnapshotRecordShareName(t *testing.T) {
+    actual := GetSnapshotRecordShareName("/sanity-controller-source-vol", true)
+    if actual != "sanity-controller-source-vol" {
+        t.Logf("Expected: %v", "sanity-controller-source-vol")
+        t.Logf("Actual: %v", actual)
+        t.FailNow()
+    }
+
+    actual = GetSnapshotRecordShareName("/test-backing-share/test-volume", false)
+    if actual != "test-backing-share" {
+        t.Logf("Expected: %v", "test-backing-share")
+        t.Logf("Actual: %v", actual)
+        t.FailNow()
+    }
+}
+
+func TestGetSnapshotCreationTime(t *testing.T) {
+    expected := time.Date(2019, 5, 24, 15, 26, 57, 0, time.UTC)
+    actual, err := GetSnapshotCreationTime("2019-05-24T15-26-57-0")
+    if err != nil {
+        t.Logf("Unexpected error, %v", err)
+        t.FailNow()
+    }
+    if !actual.Equal(expected) {
+        t.Logf("Expected: %v", expected)
+        t.Logf("Actual: %v", actual)
+        t.FailNow()
+    }
+
+    // File snapshot names may be returned as paths
+    actual, err = GetSnapshotCreationTime("/test-backing-share/test-volume/2019-05-24T15-26-57-0")
+    if err != nil {
+        t.Logf("Unexpected error, %v", err)
+        t.FailNow()
+    }
+    if !actual.Equal(expected) {
+        t.Logf("Expected: %v", expected)
+        t.Logf("Actual: %v", actual)
+        t.FailNow()
+    }
+
+    _, err = GetSnapshotCreationTime("not-a-snapshot")
+    if err == nil {
+        t.Logf("Expected error")
+        t.FailNow()
+    }
+}
+
+func TestGetGroupSnapshotNameFromId(t *testing.T) {
+    expected := "test-group"
+    actual, err := GetGroupSnapshotNameFromId(GetGroupSnapshotID(expected))
+    if err != nil || actual != expected {
+        t.Logf("Expected: %v", expected)
+        t.Logf("Actual: %v, %v", actual, err)
+        t.FailNow()
+    }
+
+    for _, id := range []string{"test-group", "group|", "2019-05-24T15-26-57-0|/test-volume"} {
+        if _, err := GetGroupSnapshotNameFromId(id); err == nil {
+            t.Logf("Expected error for %v", id)
+            t.FailNow()
+        }
+    }
+}
+
+func TestGetGroupSnapshotRecordKey(t *testing.T) {
+    expected := "csi_group_snapshot_test-group/test-volume"
+    actual := GetGroupSnapshotRecordKey("test-group", "/test-backing-share/test-volume")
+    if actual != expected {
+        t.Logf("Expected: %v", expected)
+        t.Logf("Actual: %v", actual)
+        t.FailNow()
+    }
+}
+
+func TestGetVolumeRecordKey(t *testing.T) {
+    expected := "csi_volume_test-volume"
+    actual := GetVolumeRecordKey("test-volume")
+    if actual != expected {
+        t.Logf("Expected: %v", expected)
+        t.Logf("Actual: %v", actual)
+        t.FailNow()
+    }
+}
+
+func TestPublishedNodeMarkerName(t *testing.T) {
+    name := GetPublishedNodeMarkerName("/backing/pvc-file", "node@1")
+    volumeHash, nodeID, ok := ParsePublishedNodeMarkerName(name)
+    if !ok || volumeHash != hashVolumeID("/backing/pvc-file") || nodeID != "node@1" {
+        t.Logf("Actual: %v %v %v", volumeHash, nodeID, ok)
+        t.FailNow()
+    }
+    if GetHashedMarkerPath("/markers", "/backing/pvc-file") != "/markers/"+volumeHash+".marker" {
+        t.FailNow()
+    }
+    for _, invalid := range []string{"", "no-node", "@node", "hash@"} {
+        if _, _, ok := ParsePublishedNodeMarkerName(invalid); ok {
+            t.Errorf("expected %q to be rejected", invalid)
+        }
+    }
+}
+
+func TestSplitNodeID(t *testing.T) {
+    cases := []struct {
+        nodeID, name, ip string
+    }{
+        {"node-1", "node-1", ""},
+        {"node-1@10.0.0.1", "node-1", "10.0.0.1"},
+        {"node-1@fd00::1", "node-1", "fd00::1"},
+    }
+    for _, c := range cases {
+        name, ip := SplitNodeID(c.nodeID)
+        if name != c.name || ip != c.ip {
+            t.Errorf("SplitNodeID(%s): expected %s %s, got %s %s", c.nodeID, c.name, c.ip, name, ip)
+        }
+        if c.ip != "" && JoinNodeID(name, ip) != c.nodeID {
+            t.Errorf("JoinNodeID(%s, %s) != %s", name, ip, c.nodeID)
+        }
+    }
+    if JoinNodeID("node-1", "") != "node-1" {
+        t.FailNow()
+    }
+}
+
+func TestGetShareVolumeName(t *testing.T) {
+    if GetShareVolumeName("pvc-1") != "pvc-1" {
+        t.FailNow()
+    }
+    long := strings.Repeat("a", MaxNameLength)
+    name := GetShareVolumeName(long)
+    if len(name) != common.MaxShareNameLength || !strings.HasPrefix(name, long[:60]) {
+        t.Errorf("expected a name of %d characters, got %s", common.MaxShareNameLength, name)
+    }
+    if GetShareVolumeName(long) != name || GetShareVolumeName(long[:MaxNameLength-1]) == name {
+        t.Errorf("expected names to map to the same share and only to it")
+    }
+}
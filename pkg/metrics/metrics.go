@@ -0,0 +1,231 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics defines the Prometheus metrics exported by the plugin
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+const namespace = "hammerspace_csi"
+
+var (
+	// Provisioning may wait on long running Hammerspace tasks, so buckets extend to 10 minutes
+	durationBuckets = []float64{.005, .025, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Duration of CSI gRPC calls by method and status code.",
+		Buckets:   durationBuckets,
+	}, []string{"method", "code"})
+
+	rpcErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_errors_total",
+		Help:      "Number of CSI gRPC calls that returned an error by method and status code.",
+	}, []string{"method", "code"})
+
+	restDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rest_request_duration_seconds",
+		Help:      "Duration of Hammerspace REST API calls by HTTP method, resource and status code.",
+		Buckets:   durationBuckets,
+	}, []string{"method", "resource", "code"})
+
+	taskWaitDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_wait_duration_seconds",
+		Help:      "Time spent waiting for Hammerspace tasks to complete by result.",
+		Buckets:   durationBuckets,
+	}, []string{"result"})
+
+	taskProgress = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "task_progress_ratio",
+		Help:      "Progress from 0 to 1 of the least advanced running Hammerspace task the plugin waits for by action.",
+	}, []string{"action"})
+
+	// progress of the running tasks by action and task ID, aggregated into taskProgress
+	runningTasksMu sync.Mutex
+	runningTasks   = map[string]map[string]float64{}
+
+	mountOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mount_operations_total",
+		Help:      "Number of mount, unmount and loop device operations by operation and result.",
+	}, []string{"operation", "result"})
+
+	lockWaitDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "lock_wait_duration_seconds",
+		Help:      "Time spent waiting to acquire volume and snapshot locks.",
+		Buckets:   durationBuckets,
+	}, []string{"lock"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Number of cache lookups by key and result (hit or miss).",
+	}, []string{"key", "result"})
+)
+
+// ObserveRPC records the duration and result of a CSI gRPC call
+func ObserveRPC(method string, code codes.Code, duration time.Duration) {
+	rpcDuration.WithLabelValues(method, code.String()).Observe(duration.Seconds())
+	if code != codes.OK {
+		rpcErrors.WithLabelValues(method, code.String()).Inc()
+	}
+}
+
+// ObserveRESTCall records the duration and status code of a Hammerspace REST API call.
+// A status code of 0 means no response was received.
+func ObserveRESTCall(method, urlPath string, statusCode int, duration time.Duration) {
+	restDuration.WithLabelValues(method, restResource(urlPath), statusCodeLabel(statusCode)).Observe(duration.Seconds())
+}
+
+// ObserveTaskWait records the time spent waiting for a Hammerspace task
+func ObserveTaskWait(result string, duration time.Duration) {
+	taskWaitDuration.WithLabelValues(result).Observe(duration.Seconds())
+}
+
+// SetTaskProgress records the progress, from 0 to 1, of a running Hammerspace task
+func SetTaskProgress(action, taskID string, progress float64) {
+	runningTasksMu.Lock()
+	defer runningTasksMu.Unlock()
+	if runningTasks[action] == nil {
+		runningTasks[action] = map[string]float64{}
+	}
+	runningTasks[action][taskID] = progress
+	updateTaskProgress(action)
+}
+
+// ClearTaskProgress removes the progress of a Hammerspace task the plugin stopped waiting for
+func ClearTaskProgress(action, taskID string) {
+	runningTasksMu.Lock()
+	defer runningTasksMu.Unlock()
+	if _, exists := runningTasks[action][taskID]; !exists {
+		return
+	}
+	delete(runningTasks[action], taskID)
+	updateTaskProgress(action)
+}
+
+// updateTaskProgress sets the progress of action to the least advanced of its running tasks,
+// the gauge is removed once none is running. The caller holds runningTasksMu.
+func updateTaskProgress(action string) {
+	progress, running := leastTaskProgress(action)
+	if !running {
+		delete(runningTasks, action)
+		taskProgress.DeleteLabelValues(action)
+		return
+	}
+	taskProgress.WithLabelValues(action).Set(progress)
+}
+
+// leastTaskProgress returns the progress of the least advanced running task of action. The
+// caller holds runningTasksMu.
+func leastTaskProgress(action string) (float64, bool) {
+	if len(runningTasks[action]) == 0 {
+		return 0, false
+	}
+	least := 1.0
+	for _, progress := range runningTasks[action] {
+		least = min(least, progress)
+	}
+	return least, true
+}
+
+// RecordMountOperation counts a mount, unmount or loop device operation
+func RecordMountOperation(operation string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	mountOperations.WithLabelValues(operation, result).Inc()
+}
+
+// ObserveLockWait records the time spent waiting for a volume or snapshot lock
+func ObserveLockWait(lock string, duration time.Duration) {
+	lockWaitDuration.WithLabelValues(lock).Observe(duration.Seconds())
+}
+
+// RecordCacheLookup counts a cache hit or miss. Keys scoped to a cluster are counted under
+// the unscoped key.
+func RecordCacheLookup(key string, hit bool) {
+	key, _, _ = strings.Cut(key, "|")
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.WithLabelValues(key, result).Inc()
+}
+
+// debugHandlers are served next to the metrics, by path
+var debugHandlers = map[string]http.Handler{}
+
+// Handle serves handler at path next to the metrics. It must be called before Serve.
+func Handle(path string, handler http.Handler) {
+	debugHandlers[path] = handler
+}
+
+// Serve exposes the metrics at /metrics on address in the background
+func Serve(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	for path, handler := range debugHandlers {
+		mux.Handle(path, handler)
+	}
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Infof("serving metrics on %s/metrics", address)
+		if err := server.ListenAndServe(); err != nil {
+			log.Errorf("metrics listener stopped: %v", err)
+		}
+	}()
+}
+
+// restResource returns the resource of a REST API path without names and IDs,
+// ex. /mgmt/v1.2/rest/shares/my-share becomes shares
+func restResource(urlPath string) string {
+	if i := strings.Index(urlPath, "/rest/"); i >= 0 {
+		urlPath = urlPath[i+len("/rest/"):]
+	}
+	resource, _, _ := strings.Cut(strings.TrimPrefix(urlPath, "/"), "/")
+	return resource
+}
+
+func statusCodeLabel(statusCode int) string {
+	if statusCode == 0 {
+		return "none"
+	}
+	return strconv.Itoa(statusCode)
+}
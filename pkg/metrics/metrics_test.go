@@ -0,0 +1,64 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+)
+
+func TestRestResource(t *testing.T) {
+	cases := map[string]string{
+		"/mgmt/v1.2/rest/shares":                                     "shares",
+		"/mgmt/v1.2/rest/shares/my-share":                            "shares",
+		"/mgmt/v1.2/rest/tasks/99184048-9390-4e68-92b8-d3ce6413372d": "tasks",
+		"/mgmt/v1.2/rest/file-snapshots/create":                      "file-snapshots",
+		"/mgmt/v1.2/rest/login":                                      "login",
+	}
+	for urlPath, expected := range cases {
+		if actual := restResource(urlPath); actual != expected {
+			t.Errorf("restResource(%s) = %s, expected %s", urlPath, actual, expected)
+		}
+	}
+}
+
+func TestStatusCodeLabel(t *testing.T) {
+	if actual := statusCodeLabel(0); actual != "none" {
+		t.Errorf("Expected none, got %s", actual)
+	}
+	if actual := statusCodeLabel(202); actual != "202" {
+		t.Errorf("Expected 202, got %s", actual)
+	}
+}
+
+func TestTaskProgress(t *testing.T) {
+	SetTaskProgress("share-create", "task-a", 0.5)
+	SetTaskProgress("share-create", "task-b", 0.2)
+	if actual, _ := leastTaskProgress("share-create"); actual != 0.2 {
+		t.Errorf("Expected the progress of the least advanced task 0.2, got %v", actual)
+	}
+
+	ClearTaskProgress("share-create", "task-b")
+	if actual, _ := leastTaskProgress("share-create"); actual != 0.5 {
+		t.Errorf("Expected the progress of the remaining task 0.5, got %v", actual)
+	}
+
+	ClearTaskProgress("share-create", "task-a")
+	ClearTaskProgress("share-create", "unknown")
+	if _, running := leastTaskProgress("share-create"); running || taskProgress.DeleteLabelValues("share-create") {
+		t.Error("Expected the progress to be removed once no task is running")
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing configures the OpenTelemetry tracer provider and trace context propagation
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/hammer-space/csi-plugin/pkg/common"
+)
+
+const (
+	ServiceName = "hammerspace-csi"
+
+	// Path of the file spans are written to by the file exporter
+	TracesFileEnvVar = "CSI_TRACES_FILE"
+)
+
+// Init sets the global tracer provider and propagator. Exporters are selected with
+// OTEL_TRACES_EXPORTER, a comma separated list of otlp, console, file and none (default).
+// The OTLP exporters, sampler and resource are configured by the standard OTEL_* variables.
+func Init(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	res, err := newResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	for _, name := range exporterNames() {
+		exporter, err := newExporter(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if exporter != nil {
+			log.Infof("exporting traces with the %s exporter", name)
+			options = append(options, sdktrace.WithBatcher(exporter))
+		}
+	}
+
+	// The sampler is read from OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG
+	tp := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return tp, nil
+}
+
+// exporterNames returns the exporters listed in OTEL_TRACES_EXPORTER
+func exporterNames() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("OTEL_TRACES_EXPORTER"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name != "" && name != "none" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func newExporter(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "otlp":
+		protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+		if protocol == "" {
+			protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+		}
+		switch protocol {
+		case "grpc":
+			return otlptracegrpc.New(ctx)
+		case "", "http/protobuf":
+			return otlptracehttp.New(ctx)
+		default:
+			return nil, fmt.Errorf("unsupported OTLP protocol %s, must be grpc or http/protobuf", protocol)
+		}
+	case "console":
+		return stdouttrace.New()
+	case "file":
+		path := os.Getenv(TracesFileEnvVar)
+		if path == "" {
+			return nil, fmt.Errorf("%s must be set to use the file traces exporter", TracesFileEnvVar)
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unsupported traces exporter %s, must be otlp, console, file or none", name)
+	}
+}
+
+// newResource describes this plugin instance. OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+// take precedence over the defaults.
+func newResource(ctx context.Context) (*resource.Resource, error) {
+	attributes := []attribute.KeyValue{
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(common.Version),
+		attribute.String("hammerspace.csi.githash", common.Githash),
+	}
+	if nodeName := os.Getenv("CSI_NODE_NAME"); nodeName != "" {
+		attributes = append(attributes, semconv.K8SNodeName(nodeName))
+	}
+	return resource.New(ctx,
+		resource.WithAttributes(attributes...),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+}
+
+// metadataCarrier adapts gRPC metadata to a propagation.TextMapCarrier
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	values := metadata.MD(m).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// ExtractIncoming returns a context carrying the trace context sent by the caller of a gRPC
+// call, so spans of the call join the caller's trace
+func ExtractIncoming(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+}
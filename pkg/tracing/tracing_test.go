@@ -0,0 +1,100 @@
+/*
+Copyright 2019 Hammerspace
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestInit(t *testing.T) {
+	t.Setenv("CSI_NODE_NAME", "test-node")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=test")
+
+	tp, err := Init(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	defer tp.Shutdown(context.Background())
+
+	res, err := newResource(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	attributes := map[string]string{}
+	for _, kv := range res.Attributes() {
+		attributes[string(kv.Key)] = kv.Value.Emit()
+	}
+	for key, expected := range map[string]string{
+		"service.name":           ServiceName,
+		"k8s.node.name":          "test-node",
+		"deployment.environment": "test",
+	} {
+		if attributes[key] != expected {
+			t.Errorf("Expected resource attribute %s=%s, got %s", key, expected, attributes[key])
+		}
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	t.Setenv(TracesFileEnvVar, "")
+	if _, err := newExporter(context.Background(), "file"); err == nil {
+		t.Errorf("Expected error for file exporter without %s", TracesFileEnvVar)
+	}
+
+	t.Setenv(TracesFileEnvVar, filepath.Join(t.TempDir(), "traces.json"))
+	if exporter, err := newExporter(context.Background(), "file"); err != nil || exporter == nil {
+		t.Errorf("Expected file exporter, got %v", err)
+	}
+
+	if _, err := newExporter(context.Background(), "zipkin"); err == nil {
+		t.Errorf("Expected error for unsupported exporter")
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	if _, err := newExporter(context.Background(), "otlp"); err == nil {
+		t.Errorf("Expected error for unsupported OTLP protocol")
+	}
+}
+
+func TestExporterNames(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp, Console,none")
+	names := exporterNames()
+	if len(names) != 2 || names[0] != "otlp" || names[1] != "console" {
+		t.Errorf("Unexpected exporters %v", names)
+	}
+}
+
+func TestExtractIncoming(t *testing.T) {
+	tp, err := Init(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	defer tp.Shutdown(context.Background())
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	))
+	spanCtx := trace.SpanContextFromContext(ExtractIncoming(ctx))
+	if spanCtx.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !spanCtx.IsRemote() {
+		t.Errorf("Expected remote trace context, got %v", spanCtx)
+	}
+}
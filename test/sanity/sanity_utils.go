@@ -12,6 +12,11 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+var (
+	// HSClient is the in-memory cluster used when HS_ENDPOINT is not set
+	HSClient *client.FakeClient
+)
+
 func copyStringMap(originalMap map[string]string) map[string]string {
 	newMap := make(map[string]string)
 	for key, value := range originalMap {
@@ -70,7 +75,10 @@ func uniqueString(prefix string) string {
 	return prefix + "-" + pseudoUUID()
 }
 
-func GetHammerspaceClient() *client.HammerspaceClient {
+func GetHammerspaceClient() client.Client {
+	if HSClient != nil {
+		return HSClient
+	}
 	tlsVerify, _ := strconv.ParseBool(os.Getenv("HS_TLS_VERIFY"))
 
 	client, err := client.NewHammerspaceClient(